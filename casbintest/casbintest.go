@@ -0,0 +1,93 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package casbintest provides helpers for testing the decisions and the policy of an enforcer.
+package casbintest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/casbin/casbin/v2"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// TestingT is the subset of testing.TB used by the helpers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertEnforce reports an error on t if enforcing req does not return want.
+// The message shows the rule that decided the request, if any.
+func AssertEnforce(t TestingT, e casbin.IEnforcer, req []interface{}, want bool) bool {
+	t.Helper()
+	res, explain, err := e.EnforceEx(req...)
+	if err != nil {
+		t.Errorf("%s: unexpected error: %v", requestToString(req), err)
+		return false
+	}
+	if res == want {
+		return true
+	}
+
+	matched := "no rule matched"
+	if len(explain) != 0 {
+		matched = "matched rule: " + util.ArrayToString(explain)
+	}
+	t.Errorf("%s: %t, supposed to be %t (%s)", requestToString(req), res, want, matched)
+	return false
+}
+
+// AssertPolicy reports an error on t if the policy rules of "p" are not wantPolicy, regardless of the order.
+// The message lists the missing and the unexpected rules.
+func AssertPolicy(t TestingT, e casbin.IEnforcer, wantPolicy [][]string) bool {
+	t.Helper()
+	policy := e.GetPolicy()
+	missing := subtractRules(wantPolicy, policy)
+	unexpected := subtractRules(policy, wantPolicy)
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return true
+	}
+
+	t.Errorf("policy: %v, supposed to be %v (missing: %v, unexpected: %v)", policy, wantPolicy, missing, unexpected)
+	return false
+}
+
+func requestToString(req []interface{}) string {
+	s := make([]string, len(req))
+	for i, rval := range req {
+		s[i] = fmt.Sprint(rval)
+	}
+	return strings.Join(s, ", ")
+}
+
+// subtractRules returns the rules of a that are not in b, a rule appearing twice in a needs to appear twice in b.
+func subtractRules(a [][]string, b [][]string) [][]string {
+	count := make(map[string]int, len(b))
+	for _, rule := range b {
+		count[strings.Join(rule, ", ")]++
+	}
+
+	var res [][]string
+	for _, rule := range a {
+		key := strings.Join(rule, ", ")
+		if count[key] > 0 {
+			count[key]--
+		} else {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
@@ -0,0 +1,88 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbintest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/casbin/casbin/v2"
+)
+
+// recordingT records the errors reported by the helpers instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func testErrors(t *testing.T, rt *recordingT, res ...string) {
+	t.Helper()
+	if len(rt.errors) != len(res) {
+		t.Fatalf("errors: %q, supposed to be %q", rt.errors, res)
+	}
+	for i := range res {
+		if rt.errors[i] != res[i] {
+			t.Errorf("error: %q, supposed to be %q", rt.errors[i], res[i])
+		}
+	}
+	rt.errors = nil
+}
+
+func TestAssertEnforce(t *testing.T) {
+	e, _ := casbin.NewEnforcer("../examples/rbac_with_deny_model.conf", "../examples/rbac_with_deny_policy.csv")
+
+	AssertEnforce(t, e, []interface{}{"alice", "data1", "read"}, true)
+	AssertEnforce(t, e, []interface{}{"alice", "data2", "write"}, false)
+
+	rt := &recordingT{}
+	if AssertEnforce(rt, e, []interface{}{"alice", "data1", "read"}, true) != true {
+		t.Error("AssertEnforce should return true for an expected decision")
+	}
+	testErrors(t, rt)
+
+	if AssertEnforce(rt, e, []interface{}{"alice", "data1", "read"}, false) != false {
+		t.Error("AssertEnforce should return false for an unexpected decision")
+	}
+	AssertEnforce(rt, e, []interface{}{"alice", "data2", "write"}, true)
+	AssertEnforce(rt, e, []interface{}{"bob", "data1", "read"}, true)
+	AssertEnforce(rt, e, []interface{}{"bob", "data1"}, true)
+	testErrors(t, rt,
+		"alice, data1, read: true, supposed to be false (matched rule: alice, data1, read, allow)",
+		"alice, data2, write: false, supposed to be true (matched rule: alice, data2, write, deny)",
+		"bob, data1, read: false, supposed to be true (no rule matched)",
+		"bob, data1: unexpected error: invalid request size: expected 3, got 2, rvals: [bob data1]",
+	)
+}
+
+func TestAssertPolicy(t *testing.T) {
+	e, _ := casbin.NewEnforcer("../examples/basic_model.conf", "../examples/basic_policy.csv")
+
+	AssertPolicy(t, e, [][]string{{"bob", "data2", "write"}, {"alice", "data1", "read"}})
+
+	rt := &recordingT{}
+	if AssertPolicy(rt, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "read"}}) != false {
+		t.Error("AssertPolicy should return false for an unexpected policy")
+	}
+	AssertPolicy(rt, e, [][]string{{"alice", "data1", "read"}, {"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	testErrors(t, rt,
+		"policy: [[alice data1 read] [bob data2 write]], supposed to be [[alice data1 read] [bob data2 read]] (missing: [[bob data2 read]], unexpected: [[bob data2 write]])",
+		"policy: [[alice data1 read] [bob data2 write]], supposed to be [[alice data1 read] [alice data1 read] [bob data2 write]] (missing: [[alice data1 read]], unexpected: [])",
+	)
+}
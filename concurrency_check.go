@@ -0,0 +1,97 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+
+	Err "github.com/casbin/casbin/v2/errors"
+)
+
+// stackSnippetLines is the number of lines of the stack snippets of an ErrConcurrentModification.
+const stackSnippetLines = 16
+
+// concurrencyCheck detects the changes of the policy made while enforcing on another goroutine.
+type concurrencyCheck struct {
+	enabled   int32
+	modifying int32
+	changes   uint64
+	// stack is the stack snippet of the goroutine that made the last change.
+	stack atomic.Value
+}
+
+// EnableConcurrencyCheck controls whether the enforcements fail with an *errors.ErrConcurrentModification when
+// the policy is changed by another goroutine meanwhile, like the runtime detects the concurrent writes to a map.
+// The plain Enforcer must not be changed and used concurrently, this is a debug aid to find the calls doing so:
+// the changes record their stack while it is enabled. It costs an atomic load per call while disabled.
+func (e *Enforcer) EnableConcurrencyCheck(enable bool) {
+	var enabled int32
+	if enable {
+		enabled = 1
+	}
+	atomic.StoreInt32(&e.concurrency.enabled, enabled)
+}
+
+func endNothing() {}
+
+// beginChange marks the start of a change of the policy, the returned function marks its end.
+func (e *Enforcer) beginChange() func() {
+	c := &e.concurrency
+	if atomic.LoadInt32(&c.enabled) == 0 {
+		return endNothing
+	}
+
+	c.stack.Store(stackSnippet())
+	atomic.AddInt32(&c.modifying, 1)
+	atomic.AddUint64(&c.changes, 1)
+	return func() {
+		atomic.AddUint64(&c.changes, 1)
+		atomic.AddInt32(&c.modifying, -1)
+	}
+}
+
+// beginEnforce marks the start of an enforcement, the returned function reports whether the policy was changed
+// since. It returns nil while the check is disabled.
+func (e *Enforcer) beginEnforce() func() error {
+	c := &e.concurrency
+	if atomic.LoadInt32(&c.enabled) == 0 {
+		return nil
+	}
+
+	modifying := atomic.LoadInt32(&c.modifying) != 0
+	changes := atomic.LoadUint64(&c.changes)
+	return func() error {
+		if !modifying && atomic.LoadInt32(&c.modifying) == 0 && atomic.LoadUint64(&c.changes) == changes {
+			return nil
+		}
+		modifyStack, _ := c.stack.Load().(string)
+		return &Err.ErrConcurrentModification{EnforceStack: stackSnippet(), ModifyStack: modifyStack}
+	}
+}
+
+// stackSnippet returns the first lines of the stack of the calling goroutine, without the frames of the check.
+func stackSnippet() string {
+	lines := strings.Split(strings.TrimSpace(string(debug.Stack())), "\n")
+	// the goroutine header, then 2 lines per frame: debug.Stack, stackSnippet and its caller in this file.
+	if len(lines) > 7 {
+		lines = append(lines[:1], lines[7:]...)
+	}
+	if len(lines) > stackSnippetLines {
+		lines = lines[:stackSnippetLines]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+// overrideExplain is the explanation the overridden decisions are logged with.
+var overrideExplain = [][]string{{"override"}}
+
+// decisionOverride wraps the function set by SetDecisionOverride, an atomic.Value cannot hold nil.
+type decisionOverride struct {
+	fn func(rvals []interface{}) (decision bool, overridden bool)
+}
+
+// SetDecisionOverride sets a function deciding the requests before the policy does, e.g. to allow an admin
+// or to deny a compromised subject during an incident without changing the policy. When it returns true for
+// overridden, the enforcement returns decision right away, the decision is logged with the explanation "override"
+// and CachedEnforcer does not cache it. It is given the request values without the EnforceContext.
+// It can be set or removed with nil at any time, the enforcements in progress use the function they started with.
+func (e *Enforcer) SetDecisionOverride(fn func(rvals []interface{}) (decision bool, overridden bool)) {
+	e.decisionOverride.Store(decisionOverride{fn: fn})
+}
+
+// overrideDecision returns the decision of the override for the request and whether it overrides the policy,
+// the overridden decisions are logged.
+func (e *Enforcer) overrideDecision(matcher string, rvals []interface{}) (bool, bool) {
+	override, _ := e.decisionOverride.Load().(decisionOverride)
+	if override.fn == nil {
+		return false, false
+	}
+
+	_, rvals = getEnforceContext(rvals)
+	res, overridden := override.fn(rvals)
+	if overridden {
+		e.logger.LogEnforce(matcher, rvals, res, overrideExplain)
+	}
+	return res, overridden
+}
@@ -0,0 +1,136 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+	"testing"
+)
+
+// incidentOverride allows root and denies mallory whatever the policy says.
+func incidentOverride(rvals []interface{}) (bool, bool) {
+	switch rvals[0] {
+	case "root":
+		return true, true
+	case "mallory":
+		return false, true
+	}
+	return false, false
+}
+
+func TestDecisionOverride(t *testing.T) {
+	logger := &enforceLogger{}
+	logger.EnableLog(true)
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", logger)
+	_, _ = e.AddGroupingPolicy("mallory", "data2_admin")
+	testEnforce(t, e, "root", "data1", "read", false)
+	testEnforce(t, e, "mallory", "data2", "read", true)
+
+	e.SetDecisionOverride(incidentOverride)
+	testEnforce(t, e, "root", "data1", "read", true)
+	testEnforce(t, e, "mallory", "data2", "read", false)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	if logger.overrides != 2 {
+		t.Errorf("logged overrides: %d, supposed to be 2", logger.overrides)
+	}
+
+	// the override also comes before a disabled enforcer, and is given the request without the enforce context.
+	e.EnableEnforce(false)
+	testEnforce(t, e, "mallory", "data2", "read", false)
+	e.EnableEnforce(true)
+	if res, _ := e.Enforce(NewEnforceContext(""), "root", "data1", "read"); !res {
+		t.Error("Enforce with an enforce context: false, supposed to be true")
+	}
+	if res, rule, _ := e.EnforceExStructured("root", "data1", "read"); !res || rule != nil {
+		t.Errorf("EnforceExStructured: %t, %v, supposed to be true without rule", res, rule)
+	}
+
+	e.SetDecisionOverride(nil)
+	testEnforce(t, e, "root", "data1", "read", false)
+	testEnforce(t, e, "mallory", "data2", "read", true)
+}
+
+func TestDecisionOverrideCache(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	_, _ = e.AddGroupingPolicy("mallory", "data2_admin")
+
+	// the decision cached before the override is not served while it overrides the request.
+	testEnforceCache(t, e, "mallory", "data2", "read", true)
+	e.SetDecisionOverride(incidentOverride)
+	testEnforceCache(t, e, "mallory", "data2", "read", false)
+	testEnforceCache(t, e, "root", "data1", "read", true)
+	if res, err := e.BatchEnforce([][]interface{}{{"root", "data1", "read"}, {"mallory", "data2", "read"}, {"alice", "data1", "read"}}); err != nil || len(res) != 3 || !res[0] || res[1] || !res[2] {
+		t.Errorf("BatchEnforce: %v, %v, supposed to be [true false true]", res, err)
+	}
+	if _, _, err := e.GetCachedDecision(cacheKey(e, "root", "data1", "read")); err == nil {
+		t.Error("the overridden decision of root should not be cached")
+	}
+
+	e.SetDecisionOverride(nil)
+	testEnforceCache(t, e, "root", "data1", "read", false)
+	testEnforceCache(t, e, "mallory", "data2", "read", true)
+}
+
+func TestDecisionOverrideCacheMiss(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	calls := 0
+	e.SetDecisionOverride(func(rvals []interface{}) (bool, bool) {
+		calls++
+		return incidentOverride(rvals)
+	})
+
+	// the override runs once for a request missing the cache, and once for a request found in it.
+	testEnforceCache(t, e, "root", "data1", "read", true)
+	if calls != 1 {
+		t.Errorf("the override ran %d times for a cache miss, supposed to be 1", calls)
+	}
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	if calls != 3 {
+		t.Errorf("the override ran %d times, supposed to be 3", calls)
+	}
+	if _, _, err := e.GetCachedDecision(cacheKey(e, "root", "data1", "read")); err == nil {
+		t.Error("the overridden decision of root should not be cached")
+	}
+}
+
+func TestDecisionOverrideConcurrent(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				// root is only allowed by the override, which is swapped meanwhile.
+				_, _ = e.Enforce("root", "data1", "read")
+				if res, _ := e.Enforce("alice", "data1", "read"); !res {
+					t.Error("Enforce(alice, data1, read): false, supposed to be true")
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 200; j++ {
+		if j%2 == 0 {
+			e.SetDecisionOverride(incidentOverride)
+		} else {
+			e.SetDecisionOverride(nil)
+		}
+	}
+	wg.Wait()
+}
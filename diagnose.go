@@ -0,0 +1,146 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// ClauseResult is the result of a top-level && clause of the matcher for a policy rule.
+type ClauseResult struct {
+	// Clause is the text of the clause, e.g. "keyMatch(r.obj, p.obj)".
+	Clause string
+	// Result is whether the clause evaluated to true.
+	Result bool
+	// Values are the values of the request and policy tokens used by the clause, keyed by token, e.g. "r.obj".
+	Values map[string]interface{}
+	// Err is the error the evaluation of the clause failed with, if any.
+	Err error
+}
+
+// Diagnosis explains an enforcement clause by clause, see EnforceDiagnose.
+type Diagnosis struct {
+	// Rule is the policy rule satisfying the most clauses, the first one if several do. It is nil if the matcher
+	// does not use the policy or if there is no policy rule.
+	Rule []string
+	// Clauses are the results of the top-level && clauses of the matcher for Rule, in the order of the matcher.
+	Clauses []ClauseResult
+}
+
+// EnforceDiagnose decides whether a "subject" can access a "object" with the operation "action" like Enforce(),
+// and explains the decision with the policy rule that came closest to matching the request:
+// the one satisfying the most top-level && clauses of the matcher, e.g. whether the object or the action did
+// not match. Every clause is evaluated on its own for every rule, so it is much slower than Enforce()
+// and is meant for troubleshooting, not for serving requests.
+func (e *Enforcer) EnforceDiagnose(rvals ...interface{}) (bool, *Diagnosis, error) {
+	result, err := e.enforce(context.Background(), "", nil, nil, rvals...)
+	if err != nil {
+		return false, nil, err
+	}
+
+	enforceContext, rvals := getEnforceContext(rvals)
+	rType, pType, mType := enforceContext.RType, enforceContext.PType, enforceContext.MType
+	expString := e.model["m"][mType].Value
+
+	buffer := e.getEnforceBuffer(e.model["r"][rType].Tokens, e.model["p"][pType].Tokens, rvals)
+	defer putEnforceBuffer(buffer)
+	parameters := &buffer.parameters
+
+	functions := e.getFunctions(context.Background())
+	if util.HasEval(expString) {
+		functions["eval"] = generateEvalFunction(functions, parameters)
+	}
+
+	clauses := util.SplitConjunction(expString)
+	expressions := make([]*govaluate.EvaluableExpression, len(clauses))
+	for i, clause := range clauses {
+		if expressions[i], err = govaluate.NewEvaluableExpressionWithFunctions(clause, functions); err != nil {
+			return false, nil, fmt.Errorf("invalid clause %s of matcher %s: %s", clause, mType, err)
+		}
+	}
+
+	// the tokens each clause uses and the clauses as written in the model do not depend on the rule.
+	tokens := append(append([]string{}, e.model["r"][rType].Tokens...), e.model["p"][pType].Tokens...)
+	clauseTokens := make([][]string, len(clauses))
+	names := make([]string, len(clauses))
+	for i, clause := range clauses {
+		names[i] = clause
+		for _, token := range tokens {
+			if re := tokenRegexp(token); re.MatchString(clause) {
+				clauseTokens[i] = append(clauseTokens[i], token)
+				names[i] = re.ReplaceAllLiteralString(names[i], unescapeToken(token))
+			}
+		}
+	}
+
+	diagnose := func(rule []string) []ClauseResult {
+		parameters.pVals = rule
+		results := make([]ClauseResult, len(clauses))
+		for i := range clauses {
+			results[i] = ClauseResult{Clause: names[i], Values: map[string]interface{}{}}
+			for _, token := range clauseTokens[i] {
+				results[i].Values[unescapeToken(token)], _ = parameters.Get(token)
+			}
+
+			value, err := expressions[i].Eval(parameters)
+			switch value := value.(type) {
+			case bool:
+				results[i].Result = value
+			case float64:
+				results[i].Result = value != 0
+			}
+			results[i].Err = err
+		}
+		return results
+	}
+
+	diagnosis := &Diagnosis{}
+	if !strings.Contains(expString, pType+"_") || len(e.model["p"][pType].Policy) == 0 {
+		diagnosis.Clauses = diagnose(make([]string, len(e.model["p"][pType].Tokens)))
+		return result, diagnosis, nil
+	}
+
+	best := -1
+	for _, rule := range e.model["p"][pType].Policy {
+		results := diagnose(rule)
+		satisfied := 0
+		for _, clause := range results {
+			if clause.Result {
+				satisfied++
+			}
+		}
+		if satisfied > best {
+			best = satisfied
+			diagnosis.Rule, diagnosis.Clauses = deepCopyPolicy(rule), results
+		}
+	}
+	return result, diagnosis, nil
+}
+
+// tokenRegexp matches the token, e.g. "r_obj", as a whole word.
+func tokenRegexp(token string) *regexp.Regexp {
+	return regexp.MustCompile(`\b` + regexp.QuoteMeta(token) + `\b`)
+}
+
+// unescapeToken turns an escaped token like "r_obj" back into "r.obj".
+func unescapeToken(token string) string {
+	return strings.Replace(token, "_", ".", 1)
+}
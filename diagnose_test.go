@@ -0,0 +1,109 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/util"
+)
+
+func testEnforceDiagnose(t *testing.T, e *Enforcer, sub string, obj string, act string, res bool, rule []string, clauses []ClauseResult) {
+	t.Helper()
+	myRes, diagnosis, err := e.EnforceDiagnose(sub, obj, act)
+	if err != nil {
+		t.Fatalf("EnforceDiagnose: %v", err)
+	}
+	if myRes != res {
+		t.Errorf("%s, %s, %s: %t, supposed to be %t", sub, obj, act, myRes, res)
+	}
+	if !util.ArrayEquals(diagnosis.Rule, rule) {
+		t.Errorf("%s, %s, %s: rule %v, supposed to be %v", sub, obj, act, diagnosis.Rule, rule)
+	}
+	if !reflect.DeepEqual(diagnosis.Clauses, clauses) {
+		t.Errorf("%s, %s, %s: clauses %v, supposed to be %v", sub, obj, act, diagnosis.Clauses, clauses)
+	}
+}
+
+func TestEnforceDiagnose(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_model.conf", "examples/keymatch_policy.csv")
+
+	testEnforceDiagnose(t, e, "alice", "/alice_data/resource1", "GET", true,
+		[]string{"alice", "/alice_data/*", "GET"},
+		[]ClauseResult{
+			{Clause: "r.sub == p.sub", Result: true, Values: map[string]interface{}{"r.sub": "alice", "p.sub": "alice"}},
+			{Clause: "keyMatch(r.obj, p.obj)", Result: true, Values: map[string]interface{}{"r.obj": "/alice_data/resource1", "p.obj": "/alice_data/*"}},
+			{Clause: "regexMatch(r.act, p.act)", Result: true, Values: map[string]interface{}{"r.act": "GET", "p.act": "GET"}},
+		})
+
+	// The object matches but the action does not.
+	testEnforceDiagnose(t, e, "alice", "/alice_data/resource1", "DELETE", false,
+		[]string{"alice", "/alice_data/*", "GET"},
+		[]ClauseResult{
+			{Clause: "r.sub == p.sub", Result: true, Values: map[string]interface{}{"r.sub": "alice", "p.sub": "alice"}},
+			{Clause: "keyMatch(r.obj, p.obj)", Result: true, Values: map[string]interface{}{"r.obj": "/alice_data/resource1", "p.obj": "/alice_data/*"}},
+			{Clause: "regexMatch(r.act, p.act)", Result: false, Values: map[string]interface{}{"r.act": "DELETE", "p.act": "GET"}},
+		})
+
+	// The action matches but the object does not.
+	testEnforceDiagnose(t, e, "cathy", "/cathy_data/resource1", "GET", false,
+		[]string{"cathy", "/cathy_data", "(GET)|(POST)"},
+		[]ClauseResult{
+			{Clause: "r.sub == p.sub", Result: true, Values: map[string]interface{}{"r.sub": "cathy", "p.sub": "cathy"}},
+			{Clause: "keyMatch(r.obj, p.obj)", Result: false, Values: map[string]interface{}{"r.obj": "/cathy_data/resource1", "p.obj": "/cathy_data"}},
+			{Clause: "regexMatch(r.act, p.act)", Result: true, Values: map[string]interface{}{"r.act": "GET", "p.act": "(GET)|(POST)"}},
+		})
+
+	// The first of the rules satisfying as many clauses is reported.
+	testEnforceDiagnose(t, e, "bob", "/alice_data/resource1", "GET", false,
+		[]string{"alice", "/alice_data/*", "GET"},
+		[]ClauseResult{
+			{Clause: "r.sub == p.sub", Result: false, Values: map[string]interface{}{"r.sub": "bob", "p.sub": "alice"}},
+			{Clause: "keyMatch(r.obj, p.obj)", Result: true, Values: map[string]interface{}{"r.obj": "/alice_data/resource1", "p.obj": "/alice_data/*"}},
+			{Clause: "regexMatch(r.act, p.act)", Result: true, Values: map[string]interface{}{"r.act": "GET", "p.act": "GET"}},
+		})
+
+	if _, _, err := e.EnforceDiagnose("alice", "/alice_data/resource1"); err == nil {
+		t.Error("EnforceDiagnose should fail for a request of the wrong size")
+	}
+}
+
+func TestEnforceDiagnoseDisjunction(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj || r.sub == "root"
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+
+	// A matcher with a top-level || is a single clause, "a && b || c" is "(a && b) || c".
+	testEnforceDiagnose(t, e, "root", "data3", "read", true,
+		[]string{"alice", "data1", "read"},
+		[]ClauseResult{
+			{Clause: `r.sub == p.sub && r.obj == p.obj || r.sub == "root"`, Result: true,
+				Values: map[string]interface{}{"r.sub": "root", "p.sub": "alice", "r.obj": "data3", "p.obj": "data1"}},
+		})
+}
@@ -0,0 +1,175 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"github.com/casbin/casbin/v2/constant"
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// domainEnforcer is the part of the enforcer API a DomainView calls.
+type domainEnforcer interface {
+	Enforce(rvals ...interface{}) (bool, error)
+	AddPolicy(params ...interface{}) (bool, error)
+	RemovePolicy(params ...interface{}) (bool, error)
+	RemoveFilteredPolicy(fieldIndex int, fieldValues ...string) (bool, error)
+	GetUsersForRoleInDomain(name string, domain string) []string
+	GetRolesForUserInDomain(name string, domain string) []string
+	GetPermissionsForUserInDomain(user string, domain string) [][]string
+	AddRoleForUserInDomain(user string, role string, domain string) (bool, error)
+	DeleteRoleForUserInDomain(user string, role string, domain string) (bool, error)
+	DeleteRolesForUserInDomain(user string, domain string) (bool, error)
+}
+
+// DomainView is the RBAC API of an enforcer scoped to a domain, see Enforcer.ScopedToDomain.
+// The domain is inserted into the requests and the rules at the position of the dom token of
+// the definitions r and p, which are looked up when the view is created.
+type DomainView struct {
+	e      domainEnforcer
+	domain string
+	// rIndex and pIndex are the positions of the dom token in r and p, -1 if there is none.
+	rIndex int
+	pIndex int
+}
+
+// ScopedToDomain returns a view of the enforcer scoped to the domain, whose RBAC API takes no domain parameter,
+// e.g. e.ScopedToDomain("domain1").AddRoleForUser("alice", "admin") is e.AddRoleForUserInDomain("alice", "admin", "domain1").
+// The view shares the enforcer and its policy, creating it is cheap. A view created before the model is changed
+// by SetModel or LoadModel keeps using the positions of the domain in the previous model.
+func (e *Enforcer) ScopedToDomain(domain string) *DomainView {
+	return newDomainView(e, e.model, domain)
+}
+
+func newDomainView(e domainEnforcer, m model.Model, domain string) *DomainView {
+	return &DomainView{
+		e:      e,
+		domain: domain,
+		rIndex: domainTokenIndex(m, "r", "r"),
+		pIndex: domainTokenIndex(m, "p", "p"),
+	}
+}
+
+// domainTokenIndex returns the position of the dom token in the definition of ptype, -1 if there is none.
+func domainTokenIndex(m model.Model, sec string, ptype string) int {
+	ast, ok := m[sec][ptype]
+	if !ok {
+		return -1
+	}
+	if index, ok := ast.FieldIndexMap[constant.DomainIndex]; ok {
+		return index
+	}
+	for i, token := range ast.Tokens {
+		if token == ptype+"_"+constant.DomainIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+// Domain returns the domain of the view.
+func (v *DomainView) Domain() string {
+	return v.domain
+}
+
+// Enforce decides whether a "subject" can access a "object" with the operation "action" inside the domain,
+// input parameters are the request values without the domain, usually: (sub, obj, act).
+func (v *DomainView) Enforce(rvals ...interface{}) (bool, error) {
+	if v.rIndex < 0 || v.rIndex > len(rvals) {
+		return false, &Err.ErrTokenNotFound{PType: "r", Token: constant.DomainIndex}
+	}
+	request := make([]interface{}, 0, len(rvals)+1)
+	request = append(request, rvals[:v.rIndex]...)
+	request = append(request, v.domain)
+	return v.e.Enforce(append(request, rvals[v.rIndex:]...)...)
+}
+
+// GetRolesForUser gets the roles that a user has inside the domain, sorted lexicographically.
+func (v *DomainView) GetRolesForUser(name string) []string {
+	return v.e.GetRolesForUserInDomain(name, v.domain)
+}
+
+// GetUsersForRole gets the users that have a role inside the domain, sorted lexicographically.
+func (v *DomainView) GetUsersForRole(name string) []string {
+	return v.e.GetUsersForRoleInDomain(name, v.domain)
+}
+
+// AddRoleForUser adds a role for a user inside the domain.
+// Returns false if the user already has the role (aka not affected).
+func (v *DomainView) AddRoleForUser(user string, role string) (bool, error) {
+	return v.e.AddRoleForUserInDomain(user, role, v.domain)
+}
+
+// DeleteRoleForUser deletes a role for a user inside the domain.
+// Returns false if the user does not have the role (aka not affected).
+func (v *DomainView) DeleteRoleForUser(user string, role string) (bool, error) {
+	return v.e.DeleteRoleForUserInDomain(user, role, v.domain)
+}
+
+// GetPermissionsForUser gets the permissions for a user or role inside the domain.
+func (v *DomainView) GetPermissionsForUser(user string) [][]string {
+	return v.e.GetPermissionsForUserInDomain(user, v.domain)
+}
+
+// AddPermissionForUser adds a permission for a user or role inside the domain, the permission is
+// the fields of the rule after the subject without the domain, usually: (obj, act).
+// Returns false if the user or role already has the permission (aka not affected).
+func (v *DomainView) AddPermissionForUser(user string, permission ...string) (bool, error) {
+	rule, err := v.rule(user, permission)
+	if err != nil {
+		return false, err
+	}
+	return v.e.AddPolicy(rule)
+}
+
+// DeletePermissionForUser deletes a permission for a user or role inside the domain.
+// Returns false if the user or role does not have the permission (aka not affected).
+func (v *DomainView) DeletePermissionForUser(user string, permission ...string) (bool, error) {
+	rule, err := v.rule(user, permission)
+	if err != nil {
+		return false, err
+	}
+	return v.e.RemovePolicy(rule)
+}
+
+// DeleteUser deletes the roles and the permissions of a user inside the domain, the user keeps those of the other domains.
+// Returns false if the user does not have any roles or permissions inside the domain (aka not affected).
+func (v *DomainView) DeleteUser(user string) (bool, error) {
+	if v.pIndex < 1 {
+		return false, &Err.ErrTokenNotFound{PType: "p", Token: constant.DomainIndex}
+	}
+	rolesDeleted, err := v.e.DeleteRolesForUserInDomain(user, v.domain)
+	if err != nil {
+		return rolesDeleted, err
+	}
+
+	// the fields between the subject and the domain match any value.
+	fieldValues := make([]string, v.pIndex+1)
+	fieldValues[0], fieldValues[v.pIndex] = user, v.domain
+	permissionsDeleted, err := v.e.RemoveFilteredPolicy(0, fieldValues...)
+	return rolesDeleted || permissionsDeleted, err
+}
+
+// rule returns the p rule of the permission of the user with the domain inserted.
+func (v *DomainView) rule(user string, permission []string) ([]string, error) {
+	if v.pIndex < 1 || v.pIndex > len(permission)+1 {
+		return nil, &Err.ErrTokenNotFound{PType: "p", Token: constant.DomainIndex}
+	}
+	rule := make([]string, 0, len(permission)+2)
+	rule = append(rule, user)
+	rule = append(rule, permission[:v.pIndex-1]...)
+	rule = append(rule, v.domain)
+	return append(rule, permission[v.pIndex-1:]...), nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestScopedToDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	v := e.ScopedToDomain("domain1")
+
+	// A scoped request is the request with the domain inserted.
+	for _, sub := range []string{"alice", "bob", "admin"} {
+		for _, obj := range []string{"data1", "data2"} {
+			for _, act := range []string{"read", "write"} {
+				res, _ := e.Enforce(sub, "domain1", obj, act)
+				testScopedEnforce(t, v, sub, obj, act, res)
+			}
+		}
+	}
+
+	testSortedList(t, "GetRolesForUser", v.GetRolesForUser("alice"), []string{"admin"})
+	testSortedList(t, "GetRolesForUser", v.GetRolesForUser("bob"), []string{})
+	testSortedList(t, "GetUsersForRole", v.GetUsersForRole("admin"), []string{"alice"})
+
+	// The mutations land in the domain.
+	_, _ = v.AddRoleForUser("bob", "admin")
+	_, _ = v.AddPermissionForUser("bob", "data3", "read")
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "admin", "domain1"}, {"bob", "admin", "domain2"}, {"bob", "admin", "domain1"}})
+	testHasPolicy(t, e, []string{"bob", "domain1", "data3", "read"}, true)
+	testScopedEnforce(t, v, "bob", "data1", "write", true)
+	testDomainEnforce(t, e, "bob", "domain2", "data3", "read", false)
+	testGetPermissions(t, e, "bob", [][]string{{"bob", "domain1", "data3", "read"}}, "domain1")
+	if res := v.GetPermissionsForUser("bob"); len(res) != 3 {
+		t.Errorf("GetPermissionsForUser: %v, supposed to be the 2 permissions of admin and the 1 of bob", res)
+	}
+
+	_, _ = v.DeletePermissionForUser("bob", "data3", "read")
+	testHasPolicy(t, e, []string{"bob", "domain1", "data3", "read"}, false)
+	_, _ = v.AddPermissionForUser("bob", "data3", "read")
+	_, _ = e.AddPolicy("bob", "domain2", "data3", "read")
+	if ok, err := v.DeleteUser("bob"); !ok || err != nil {
+		t.Errorf("DeleteUser: %t, %v, supposed to be true, <nil>", ok, err)
+	}
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "admin", "domain1"}, {"bob", "admin", "domain2"}})
+	testHasPolicy(t, e, []string{"bob", "domain1", "data3", "read"}, false)
+	testHasPolicy(t, e, []string{"bob", "domain2", "data3", "read"}, true)
+	if ok, _ := v.DeleteUser("bob"); ok {
+		t.Error("DeleteUser should not affect a user without roles or permissions in the domain")
+	}
+
+	// A model without domains has no scoped requests.
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	var notFound *Err.ErrTokenNotFound
+	if _, err := e.ScopedToDomain("domain1").Enforce("alice", "data1", "read"); !errors.As(err, &notFound) {
+		t.Errorf("Enforce error: %v, supposed to be an *errors.ErrTokenNotFound", err)
+	}
+}
+
+func testScopedEnforce(t *testing.T, v *DomainView, sub string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := v.Enforce(sub, obj, act); err != nil || myRes != res {
+		t.Errorf("%s, %s, %s, %s: %t, %v, supposed to be %t", sub, v.Domain(), obj, act, myRes, err, res)
+	}
+}
+
+func TestScopedToDomainTokenPositions(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act, dom
+
+[policy_definition]
+p = sub, obj, act, dom
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	v := e.ScopedToDomain("domain1")
+	_, _ = v.AddRoleForUser("alice", "admin")
+	_, _ = v.AddPermissionForUser("admin", "data1", "read")
+
+	testGetPolicy(t, e, [][]string{{"admin", "data1", "read", "domain1"}})
+	if res, _ := e.Enforce("alice", "data1", "read", "domain1"); !res {
+		t.Error("alice, data1, read, domain1: false, supposed to be true")
+	}
+	testScopedEnforce(t, v, "alice", "data1", "read", true)
+	testScopedEnforce(t, e.ScopedToDomain("domain2"), "alice", "data1", "read", false)
+
+	_, _ = v.DeleteUser("admin")
+	testGetPolicy(t, e, [][]string{})
+}
+
+func TestSyncedScopedToDomain(t *testing.T) {
+	e, _ := NewSyncedEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	v := e.ScopedToDomain("domain2")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, _ = v.Enforce("bob", "data2", "read")
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = v.AddRoleForUser("carol", "admin")
+		}()
+	}
+	wg.Wait()
+
+	testScopedEnforce(t, v, "carol", "data2", "write", true)
+	testSortedList(t, "GetUsersForRole", v.GetUsersForRole("admin"), []string{"bob", "carol"})
+}
@@ -16,12 +16,27 @@ package effector
 
 import (
 	"errors"
+	"regexp"
+	"sync"
 
+	"github.com/Knetic/govaluate"
 	"github.com/casbin/casbin/v2/constant"
 )
 
+var errUnsupportedEffect = errors.New("unsupported effect")
+
+// effectTermRegex matches the terms of a request-conditioned effect, e.g. "count(where (p_eft == allow))".
+var effectTermRegex = regexp.MustCompile(`\b(some|count)\(where \(\w+_eft == (allow|deny)\)\)`)
+
 // DefaultEffector is default effector for Casbin.
+//
+// Besides the effects in the constant package, it supports boolean expressions combining the request tokens
+// with the terms some(where (p_eft == allow)), some(where (p_eft == deny)) and their count(...) variants,
+// which are the number of matched allow or deny rules. Such an effect allows the request if it evaluates to
+// true once all the rules have been matched, and denies it otherwise.
 type DefaultEffector struct {
+	// expressions caches the compiled request-conditioned effects by their expression.
+	expressions sync.Map
 }
 
 // NewDefaultEffector is the constructor for DefaultEffector.
@@ -32,6 +47,12 @@ func NewDefaultEffector() *DefaultEffector {
 
 // MergeEffects merges all matching results collected by the enforcer into a single decision.
 func (e *DefaultEffector) MergeEffects(expr string, effects []Effect, matches []float64, policyIndex int, policyLength int) (Effect, int, error) {
+	return e.MergeEffectsWithRequest(expr, effects, matches, policyIndex, policyLength, nil)
+}
+
+// MergeEffectsWithRequest merges all matching results collected by the enforcer into a single decision,
+// request resolves the request tokens a request-conditioned effect references.
+func (e *DefaultEffector) MergeEffectsWithRequest(expr string, effects []Effect, matches []float64, policyIndex int, policyLength int, request govaluate.Parameters) (Effect, int, error) {
 	result := Indeterminate
 	explainIndex := -1
 
@@ -102,8 +123,98 @@ func (e *DefaultEffector) MergeEffects(expr string, effects []Effect, matches []
 			}
 		}
 	default:
-		return Deny, -1, errors.New("unsupported effect")
+		return e.mergeConditionalEffects(expr, effects, matches, policyIndex, policyLength, request)
 	}
 
 	return result, explainIndex, nil
 }
+
+// mergeConditionalEffects merges the matching results for a request-conditioned effect,
+// the decision is only taken once all the rules have been matched.
+func (e *DefaultEffector) mergeConditionalEffects(expr string, effects []Effect, matches []float64, policyIndex int, policyLength int, request govaluate.Parameters) (Effect, int, error) {
+	expression, err := e.getExpression(expr)
+	if err != nil {
+		return Deny, -1, err
+	}
+	if policyIndex < policyLength-1 {
+		return Indeterminate, -1, nil
+	}
+
+	params := effectParameters{request: request, firstAllow: -1, firstDeny: -1}
+	for i, eft := range effects {
+		if matches[i] == 0 {
+			continue
+		}
+		switch eft {
+		case Allow:
+			if params.allows == 0 {
+				params.firstAllow = i
+			}
+			params.allows++
+		case Deny:
+			if params.denies == 0 {
+				params.firstDeny = i
+			}
+			params.denies++
+		}
+	}
+
+	res, err := expression.Eval(params)
+	if err != nil {
+		return Deny, -1, err
+	}
+	allowed, ok := res.(bool)
+	if !ok {
+		return Deny, -1, errors.New("effect result should be bool")
+	}
+	if allowed {
+		return Allow, params.firstAllow, nil
+	}
+	return Deny, params.firstDeny, nil
+}
+
+func (e *DefaultEffector) getExpression(expr string) (*govaluate.EvaluableExpression, error) {
+	if expression, ok := e.expressions.Load(expr); ok {
+		return expression.(*govaluate.EvaluableExpression), nil
+	}
+
+	if !effectTermRegex.MatchString(expr) {
+		return nil, errUnsupportedEffect
+	}
+	replaced := effectTermRegex.ReplaceAllStringFunc(expr, func(term string) string {
+		m := effectTermRegex.FindStringSubmatch(term)
+		return "eft_" + m[1] + "_" + m[2]
+	})
+	expression, err := govaluate.NewEvaluableExpression(replaced)
+	if err != nil {
+		return nil, errUnsupportedEffect
+	}
+	e.expressions.Store(expr, expression)
+	return expression, nil
+}
+
+// effectParameters resolves the terms of a request-conditioned effect, and the request tokens through request.
+type effectParameters struct {
+	request    govaluate.Parameters
+	allows     int
+	denies     int
+	firstAllow int
+	firstDeny  int
+}
+
+func (p effectParameters) Get(name string) (interface{}, error) {
+	switch name {
+	case "eft_some_allow":
+		return p.allows > 0, nil
+	case "eft_some_deny":
+		return p.denies > 0, nil
+	case "eft_count_allow":
+		return float64(p.allows), nil
+	case "eft_count_deny":
+		return float64(p.denies), nil
+	}
+	if p.request == nil {
+		return nil, errors.New("No parameter '" + name + "' found.")
+	}
+	return p.request.Get(name)
+}
@@ -14,6 +14,8 @@
 
 package effector
 
+import "github.com/Knetic/govaluate"
+
 // Effect is the result for a policy rule.
 type Effect int
 
@@ -29,3 +31,12 @@ type Effector interface {
 	// MergeEffects merges all matching results collected by the enforcer into a single decision.
 	MergeEffects(expr string, effects []Effect, matches []float64, policyIndex int, policyLength int) (Effect, int, error)
 }
+
+// RequestEffector is an Effector whose effect expression can reference the request, like r_risk in
+// "some(where (p_eft == allow)) && (r_risk != 'high' || count(where (p_eft == allow)) >= 2)".
+// The enforcer calls MergeEffectsWithRequest instead of MergeEffects if its effector implements it.
+type RequestEffector interface {
+	Effector
+	// MergeEffectsWithRequest merges all matching results like MergeEffects, request resolves the request tokens by name.
+	MergeEffectsWithRequest(expr string, effects []Effect, matches []float64, policyIndex int, policyLength int, request govaluate.Parameters) (Effect, int, error)
+}
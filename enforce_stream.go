@@ -0,0 +1,93 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// EnforceResult is the decision for a request of EnforceStream.
+type EnforceResult struct {
+	// Index is the position of the request in the stream, starting at 0.
+	Index int
+	// Request is the request as it was received.
+	Request []interface{}
+	// Allowed is the decision, false if Err is not nil.
+	Allowed bool
+	Err     error
+}
+
+// EnforceStream decides the requests received from reqs with a pool of GOMAXPROCS workers and sends the results
+// as they are decided, not in the order of the requests, use their Index to match them.
+// The result channel is closed once reqs is closed and all its requests are decided, or once ctx is done;
+// the requests being decided then fail with the error of ctx.
+func (e *Enforcer) EnforceStream(ctx context.Context, reqs <-chan []interface{}) <-chan EnforceResult {
+	return enforceStream(ctx, reqs, e.EnforceCtx)
+}
+
+// enforceStream decides the requests of reqs with enforce, see EnforceStream.
+func enforceStream(ctx context.Context, reqs <-chan []interface{}, enforce func(ctx context.Context, rvals ...interface{}) (bool, error)) <-chan EnforceResult {
+	type indexedRequest struct {
+		index   int
+		request []interface{}
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	jobs := make(chan indexedRequest, workers)
+	results := make(chan EnforceResult, workers)
+
+	go func() {
+		defer close(jobs)
+		for index := 0; ; index++ {
+			select {
+			case <-ctx.Done():
+				return
+			case request, ok := <-reqs:
+				if !ok {
+					return
+				}
+				select {
+				case jobs <- indexedRequest{index: index, request: request}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				allowed, err := enforce(ctx, job.request...)
+				select {
+				case results <- EnforceResult{Index: job.index, Request: job.request, Allowed: allowed, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
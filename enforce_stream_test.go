@@ -0,0 +1,98 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func testEnforceStream(t *testing.T, e IEnforcer, requests [][]interface{}) {
+	t.Helper()
+	reqs := make(chan []interface{})
+	go func() {
+		defer close(reqs)
+		for _, request := range requests {
+			reqs <- request
+		}
+	}()
+
+	streamer, ok := e.(IContextEnforcer)
+	if !ok {
+		t.Fatalf("%T does not implement IContextEnforcer", e)
+	}
+	seen := make([]bool, len(requests))
+	for result := range streamer.EnforceStream(context.Background(), reqs) {
+		if seen[result.Index] {
+			t.Errorf("request %d decided twice", result.Index)
+		}
+		seen[result.Index] = true
+		if fmt.Sprint(result.Request) != fmt.Sprint(requests[result.Index]) {
+			t.Errorf("request %d: %v, supposed to be %v", result.Index, result.Request, requests[result.Index])
+		}
+		expected, _ := e.Enforce(requests[result.Index]...)
+		if result.Allowed != expected || result.Err != nil {
+			t.Errorf("%v: %t, %v, supposed to be %t", result.Request, result.Allowed, result.Err, expected)
+		}
+	}
+	for i, ok := range seen {
+		if !ok {
+			t.Errorf("request %d was not decided", i)
+		}
+	}
+}
+
+func TestEnforceStream(t *testing.T) {
+	var requests [][]interface{}
+	for i := 0; i < 100; i++ {
+		for _, sub := range []string{"alice", "bob", "eve"} {
+			requests = append(requests, []interface{}{sub, fmt.Sprintf("data%d", i%3), "read"})
+		}
+	}
+
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testEnforceStream(t, e, requests)
+	se, _ := NewSyncedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testEnforceStream(t, se, requests)
+
+	// an invalid request gets its error.
+	reqs := make(chan []interface{}, 1)
+	reqs <- []interface{}{"alice", "data1"}
+	close(reqs)
+	for result := range e.EnforceStream(context.Background(), reqs) {
+		if result.Err == nil {
+			t.Errorf("%v: supposed to fail for a request of the wrong size", result.Request)
+		}
+	}
+}
+
+func TestEnforceStreamCancel(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	ctx, cancel := context.WithCancel(context.Background())
+	reqs := make(chan []interface{})
+	results := e.EnforceStream(ctx, reqs)
+
+	reqs <- []interface{}{"alice", "data1", "read"}
+	if result := <-results; !result.Allowed || result.Index != 0 {
+		t.Errorf("first result: %+v", result)
+	}
+
+	// the results are closed once ctx is done, although reqs is still open.
+	cancel()
+	for result := range results {
+		t.Errorf("no result supposed to be sent after cancel, got %+v", result)
+	}
+}
@@ -15,18 +15,28 @@
 package casbin
 
 import (
+	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"runtime/debug"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/constant"
 	"github.com/casbin/casbin/v2/effector"
+	Err "github.com/casbin/casbin/v2/errors"
 	"github.com/casbin/casbin/v2/log"
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/persist/cache"
 	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
 	"github.com/casbin/casbin/v2/rbac"
 	defaultrolemanager "github.com/casbin/casbin/v2/rbac/default-role-manager"
 	"github.com/casbin/casbin/v2/util"
@@ -43,15 +53,86 @@ type Enforcer struct {
 	watcher    persist.Watcher
 	dispatcher persist.Dispatcher
 	rmMap      map[string]rbac.RoleManager
-	matcherMap sync.Map
+	// matcherMap holds the *sync.Map of the compiled matcher expressions,
+	// it is replaced as a whole so that an invalidation never races with a concurrent enforce.
+	matcherMap *atomic.Value
+	// sharedMatcherMap holds the *sync.Map of the compiled matchers shared by the enforcers of an EnforcerPool,
+	// used instead of matcherMap for the matchers not calling eval(), nil for the other enforcers.
+	sharedMatcherMap *atomic.Value
+	// roleFunctions holds the roleFunctions built by getRoleFunctions, they are discarded with the compiled matchers.
+	roleFunctions atomic.Value
+
+	writeCoalescer *writeCoalescer
+
+	standbyMu sync.Mutex
+	standby   *standbyPolicy
+
+	concurrency concurrencyCheck
 
 	enabled              bool
 	autoSave             bool
 	autoBuildRoleLinks   bool
 	autoNotifyWatcher    bool
 	autoNotifyDispatcher bool
+	deterministicOutput  bool
+	allowExtraFields     bool
+	allowEmptyFields     bool
+	strictMode           bool
+	// autoSaveForPtype overrides autoSave for some ptypes, keyed by "sec.ptype", see SetAutoSaveForPtype.
+	autoSaveForPtype      map[string]bool
+	notifyWithoutAutoSave bool
+	// watcherDiffThreshold is the number of rules above which the watcher is sent Update instead of the rules,
+	// see SetWatcherDiffThreshold.
+	watcherDiffThreshold int
+	saveOrdering         SaveOrdering
+	dryRun               bool
+	recoverFromPanic     bool
+	strictMatcherTypes   bool
+	// evaluationErrorPolicy and evaluationErrorHandler control the enforcements failing for a rule,
+	// see SetEvaluationErrorPolicy.
+	evaluationErrorPolicy  EvaluationErrorPolicy
+	evaluationErrorHandler func(ptype string, index int, rule []string, err error)
+	// quotaStore keeps the uses counted by quotaAllow, see SetQuotaStore.
+	quotaStore QuotaStore
+	// validateEvalRules controls whether the fields of the rules given to eval() are parsed when they are stored.
+	validateEvalRules bool
+	// policyValidator checks the rules before they are stored, see SetPolicyValidator.
+	policyValidator func(ptype string, rule []string) error
+	loadValidation  LoadValidation
+	// loadErrorHandler is given the malformed rules found by LoadPolicy, see SetLoadErrorHandler.
+	loadErrorHandler persist.LoadErrorHandler
+	// loadProgress is given the progress of loading the policy, see SetLoadProgressCallback.
+	loadProgress func(loaded int)
+	// syncAttempts, syncBackoff and onSyncFailure control the reloads of the policy after an update notification,
+	// see SetWatcherCallbackRetry.
+	syncAttempts  int
+	syncBackoff   time.Duration
+	onSyncFailure func(err error)
+	syncMu        sync.Mutex
+	syncStatus    SyncStatus
+	// globals holds the map[string]interface{} of the global parameters, it is replaced as a whole on every change
+	// so that an enforce sees the same values all along, see SetGlobalParameter.
+	globals   atomic.Value
+	globalsMu sync.Mutex
+	// decisionOverride holds the decisionOverride set by SetDecisionOverride, it is swapped as a whole.
+	decisionOverride atomic.Value
+	// policyGeneration is increased by every change of the policy, see GetPolicyGeneration.
+	policyGeneration     uint64
+	policyHashMu         sync.Mutex
+	policyHash           string
+	policyHashGeneration uint64
+	// defaultRoles are the roles of "g" every subject has, keyed by domain, see AddDefaultRole.
+	defaultRoles map[string][]string
+	// ruleUsage counts the matches of the rules while trackRuleUsage is set, see EnableRuleUsageTracking.
+	ruleUsage      *ruleUsageTracker
+	trackRuleUsage bool
 
 	logger log.Logger
+	// functions are the custom functions given to NewEnforcer, added whenever the model is loaded.
+	functions map[string]govaluate.ExpressionFunction
+	// logSampleRate and logSampleCount sample the logged decisions, see SetLogSampleRate.
+	logSampleRate  int64
+	logSampleCount uint64
 }
 
 // EnforceContext is used as the first element of the parameter "rvals" in method "enforce"
@@ -73,6 +154,9 @@ type EnforceContext struct {
 // 	a := mysqladapter.NewDBAdapter("mysql", "mysql_username:mysql_password@tcp(127.0.0.1:3306)/")
 // 	e := casbin.NewEnforcer("path/to/basic_model.conf", a)
 //
+// Custom functions can be given after the model and the adapter as a map[string]govaluate.ExpressionFunction,
+// they are then added before the functions required by the [functions] section of the model are verified:
+// NewEnforcer fails with an *errors.ErrMissingFunctions for a required function that is not added.
 func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 	e := &Enforcer{logger: &log.DefaultLogger{}}
 
@@ -94,6 +178,14 @@ func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 		}
 	}
 
+	if paramLen-parsedParamLen >= 1 {
+		functions, ok := params[paramLen-parsedParamLen-1].(map[string]govaluate.ExpressionFunction)
+		if ok {
+			e.functions = functions
+			parsedParamLen++
+		}
+	}
+
 	if paramLen-parsedParamLen == 2 {
 		switch p0 := params[0].(type) {
 		case string:
@@ -142,6 +234,61 @@ func NewEnforcer(params ...interface{}) (*Enforcer, error) {
 	return e, nil
 }
 
+// NewEnforcerFromCombinedFile creates an enforcer from a single file holding both the model and the policy.
+// The model text goes under a [model] line and the policy lines go under a [policy] line, for example:
+//
+//	[model]
+//	[request_definition]
+//	r = sub, obj, act
+//	...
+//	[policy]
+//	p, alice, data1, read
+//
+// Lines before the first block marker are treated as part of the model.
+// The policy is held by an in-memory string adapter, so the file is only read: the changes of the policy,
+// whether auto-saved or saved by SavePolicy, are kept in memory and LoadPolicy reloads them, not the file.
+func NewEnforcerFromCombinedFile(path string, params ...interface{}) (*Enforcer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	modelText, policyText, err := splitCombinedText(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := model.NewModelFromString(modelText)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEnforcer(append([]interface{}{m, stringadapter.NewAdapter(policyText)}, params...)...)
+}
+
+func splitCombinedText(text string) (string, string, error) {
+	var modelText, policyText strings.Builder
+	current := &modelText
+	hasPolicy := false
+	for _, line := range strings.Split(text, "\n") {
+		switch strings.TrimSpace(line) {
+		case "[model]":
+			current = &modelText
+			continue
+		case "[policy]":
+			current = &policyText
+			hasPolicy = true
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+	if !hasPolicy {
+		return "", "", errors.New("missing [policy] block in combined file")
+	}
+	return modelText.String(), policyText.String(), nil
+}
+
 // InitWithFile initializes an enforcer with a model file and a policy file.
 func (e *Enforcer) InitWithFile(modelPath string, policyPath string) error {
 	a := fileadapter.NewAdapter(policyPath)
@@ -171,9 +318,12 @@ func (e *Enforcer) InitWithModelAndAdapter(m model.Model, adapter persist.Adapte
 	e.model = m
 	m.SetLogger(e.logger)
 	e.model.PrintModel()
-	e.fm = model.LoadFunctionMap()
+	e.loadFunctionMap()
 
 	e.initialize()
+	if err := e.VerifyFunctions(); err != nil {
+		return err
+	}
 
 	// Do not initialize the full policy when using a filtered adapter
 	fa, ok := e.adapter.(persist.FilteredAdapter)
@@ -200,14 +350,68 @@ func (e *Enforcer) initialize() {
 	e.rmMap = map[string]rbac.RoleManager{}
 	e.eft = effector.NewDefaultEffector()
 	e.watcher = nil
-	e.matcherMap = sync.Map{}
+	e.matcherMap = &atomic.Value{}
+	e.invalidateMatcherMap()
 
 	e.enabled = true
 	e.autoSave = true
+	e.autoSaveForPtype = map[string]bool{}
+	e.notifyWithoutAutoSave = true
 	e.autoBuildRoleLinks = true
 	e.autoNotifyWatcher = true
 	e.autoNotifyDispatcher = true
+	e.recoverFromPanic = true
+	e.standby = nil
 	e.initRmMap()
+	e.logMissingFunctions()
+}
+
+// loadFunctionMap resets the functions to the built-in ones and the ones given to NewEnforcer.
+func (e *Enforcer) loadFunctionMap() {
+	e.fm = model.LoadFunctionMap()
+	for name, function := range e.functions {
+		e.fm.AddFunction(name, function)
+	}
+}
+
+// logMissingFunctions logs the functions required by the model or called by its matchers that are not added yet,
+// SetModel, which cannot fail, then leaves them to VerifyFunctions and the enforcements.
+func (e *Enforcer) logMissingFunctions() {
+	if e.logger == nil || !e.logger.IsEnabled() {
+		return
+	}
+
+	functions := e.getFunctions(context.Background())
+	var missing [][]string
+	if err, ok := checkRequiredFunctions(e.model.GetRequiredFunctions(), functions).(*Err.ErrMissingFunctions); ok {
+		for _, name := range err.Names {
+			missing = append(missing, []string{"f", "required", "missing function: " + name})
+		}
+	}
+	for key, ast := range e.model["m"] {
+		for _, name := range util.GetFunctionCalls(ast.Value) {
+			if _, ok := functions[name]; !ok && name != "eval" {
+				missing = append(missing, []string{"m", key, "undefined function: " + name})
+			}
+		}
+	}
+	if len(missing) > 0 {
+		e.logger.LogModel(missing)
+	}
+}
+
+// checkRequiredFunctions returns an *errors.ErrMissingFunctions listing the required functions missing from functions.
+func checkRequiredFunctions(required []string, functions map[string]govaluate.ExpressionFunction) error {
+	var missing []string
+	for _, name := range required {
+		if _, ok := functions[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return &Err.ErrMissingFunctions{Names: missing}
+	}
+	return nil
 }
 
 // LoadModel reloads the model from the model CONF file.
@@ -221,11 +425,11 @@ func (e *Enforcer) LoadModel() error {
 	e.model.SetLogger(e.logger)
 
 	e.model.PrintModel()
-	e.fm = model.LoadFunctionMap()
+	e.loadFunctionMap()
 
 	e.initialize()
 
-	return nil
+	return e.VerifyFunctions()
 }
 
 // GetModel gets the current model.
@@ -236,7 +440,8 @@ func (e *Enforcer) GetModel() model.Model {
 // SetModel sets the current model.
 func (e *Enforcer) SetModel(m model.Model) {
 	e.model = m
-	e.fm = model.LoadFunctionMap()
+	e.bumpPolicyGeneration()
+	e.loadFunctionMap()
 
 	e.model.SetLogger(e.logger)
 	e.initialize()
@@ -260,7 +465,87 @@ func (e *Enforcer) SetWatcher(watcher persist.Watcher) error {
 		return nil
 	} else {
 		// In case the Watcher wants to use a customized callback function, call `SetUpdateCallback` after `SetWatcher`.
-		return watcher.SetUpdateCallback(func(string) { _ = e.LoadPolicy() })
+		return watcher.SetUpdateCallback(func(string) { e.syncPolicy(e.LoadPolicy) })
+	}
+}
+
+// SyncStatus is the state of the reloads of the policy after the update notifications of the watcher
+// and the ticks of the auto-load, see GetSyncStatus.
+type SyncStatus struct {
+	// Stale is whether the last reload failed after all its attempts, the policy in use is then the one loaded before.
+	Stale bool
+	// Failures is the number of failed attempts since the last successful reload.
+	Failures int
+	// LastError is the error of the last failed attempt.
+	LastError error
+	// LastSync is the time of the last successful reload.
+	LastSync time.Time
+}
+
+// SetWatcherCallbackRetry makes the reload of the policy after an update notification try attempts times,
+// waiting backoff before the second attempt and twice as long before every next one. It is tried once by default.
+// The policy is loaded into a new model which replaces the one in use only on success, so a failed reload keeps the
+// previous policy; the enforcer is then stale until a reload succeeds, on the next notification or auto-load tick.
+func (e *Enforcer) SetWatcherCallbackRetry(attempts int, backoff time.Duration) {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	e.syncAttempts = attempts
+	e.syncBackoff = backoff
+}
+
+// OnSyncFailure sets the function called with the error of the last attempt when a reload of the policy
+// after an update notification fails after all its attempts.
+func (e *Enforcer) OnSyncFailure(fn func(err error)) {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	e.onSyncFailure = fn
+}
+
+// IsPolicyStale reports whether the last reload of the policy after an update notification or an auto-load tick failed.
+func (e *Enforcer) IsPolicyStale() bool {
+	return e.GetSyncStatus().Stale
+}
+
+// GetSyncStatus returns the state of the reloads of the policy after the update notifications and the auto-load ticks.
+func (e *Enforcer) GetSyncStatus() SyncStatus {
+	e.syncMu.Lock()
+	defer e.syncMu.Unlock()
+	return e.syncStatus
+}
+
+// syncPolicy reloads the policy with load, retrying it as set by SetWatcherCallbackRetry, and records the outcome.
+func (e *Enforcer) syncPolicy(load func() error) {
+	e.syncMu.Lock()
+	attempts, backoff, onFailure := e.syncAttempts, e.syncBackoff, e.onSyncFailure
+	e.syncMu.Unlock()
+
+	var err error
+	for i := 0; i < attempts || i == 0; i++ {
+		if i > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var skipped *Err.MultiError
+		if err = load(); err == nil || errors.As(err, &skipped) {
+			// the policy is loaded even if malformed rules were skipped.
+			err = nil
+			break
+		}
+		e.syncMu.Lock()
+		e.syncStatus.Failures++
+		e.syncStatus.LastError = err
+		e.syncMu.Unlock()
+	}
+
+	e.syncMu.Lock()
+	if err == nil {
+		e.syncStatus = SyncStatus{LastSync: time.Now()}
+	} else {
+		e.syncStatus.Stale = true
+	}
+	e.syncMu.Unlock()
+	if err != nil && onFailure != nil {
+		onFailure(err)
 	}
 }
 
@@ -279,9 +564,33 @@ func (e *Enforcer) SetRoleManager(rm rbac.RoleManager) {
 	e.rmMap["g"] = rm
 }
 
-// SetNamedRoleManager sets the role manager for the named policy.
+// SetNamedRoleManager sets the role manager for the named grouping policy, e.g. "g2",
+// and rebuilds its role links from the current grouping rules with the new role manager.
+// A ptype without grouping definition or a nil role manager is ignored, see TrySetNamedRoleManager.
 func (e *Enforcer) SetNamedRoleManager(ptype string, rm rbac.RoleManager) {
+	_ = e.TrySetNamedRoleManager(ptype, rm)
+}
+
+// TrySetNamedRoleManager is SetNamedRoleManager returning an error for a ptype without grouping definition,
+// a nil role manager or a failure to rebuild the role links, in which case the role manager is not changed.
+func (e *Enforcer) TrySetNamedRoleManager(ptype string, rm rbac.RoleManager) error {
+	if _, ok := e.model["g"][ptype]; !ok {
+		return fmt.Errorf("grouping policy definition %s does not exist", ptype)
+	}
+	if rm == nil {
+		return errors.New("role manager should not be nil")
+	}
+
+	if err := rm.Clear(); err != nil {
+		return err
+	}
+	if err := e.model.BuildNamedRoleLinks(ptype, rm); err != nil {
+		return err
+	}
 	e.rmMap[ptype] = rm
+	// the compiled matchers hold the role function of the previous role manager
+	e.invalidateMatcherMap()
+	return nil
 }
 
 // SetEffector sets the current effector.
@@ -291,15 +600,24 @@ func (e *Enforcer) SetEffector(eft effector.Effector) {
 
 // ClearPolicy clears all policy.
 func (e *Enforcer) ClearPolicy() {
+	defer e.beginChange()()
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		_ = e.dispatcher.ClearPolicy()
 		return
 	}
 	e.model.ClearPolicy()
+	e.bumpPolicyGeneration()
 }
 
 // LoadPolicy reloads the policy from file/database.
 func (e *Enforcer) LoadPolicy() error {
+	defer e.beginChange()()
+
+	if err := e.FlushWrites(); err != nil {
+		return err
+	}
+
 	needToRebuild := false
 	newModel := e.model.Copy()
 	newModel.ClearPolicy()
@@ -313,7 +631,18 @@ func (e *Enforcer) LoadPolicy() error {
 		}
 	}()
 
-	if err = e.adapter.LoadPolicy(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+	skipped, err := e.loadPolicyFromAdapter(newModel)
+	if err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+		return err
+	}
+
+	if e.strictMode {
+		if err = checkEmptyPolicyFields(newModel); err != nil {
+			return err
+		}
+	}
+
+	if err = e.validateLoadedPolicy(newModel); err != nil {
 		return err
 	}
 
@@ -339,10 +668,189 @@ func (e *Enforcer) LoadPolicy() error {
 		}
 	}
 	e.model = newModel
+	e.bumpPolicyGeneration()
+	// the compiled matchers memorize the results of the role functions
+	e.invalidateMatcherMap()
+	if skipped != nil {
+		return skipped
+	}
+	return nil
+}
+
+// SetGlobalParameter sets a value the matchers can use as g_name, e.g. g_env for SetGlobalParameter("env", "prod"),
+// like an attribute of every request that is neither a request value nor a policy field.
+// It can be changed at any time, an enforcement uses the values set when it starts.
+func (e *Enforcer) SetGlobalParameter(name string, value interface{}) {
+	e.globalsMu.Lock()
+	defer e.globalsMu.Unlock()
+	globals := map[string]interface{}{name: value}
+	for k, v := range e.getGlobalParameters() {
+		if k != name {
+			globals[k] = v
+		}
+	}
+	e.globals.Store(globals)
+}
+
+// getGlobalParameters returns the global parameters, it must not be modified.
+func (e *Enforcer) getGlobalParameters() map[string]interface{} {
+	globals, _ := e.globals.Load().(map[string]interface{})
+	return globals
+}
+
+// SetLoadErrorHandler sets the function LoadPolicy gives the malformed rules to, with their line number and raw text,
+// instead of failing on the first one. The handler returns true to skip the rule or false to abort loading with the error.
+// When rules were skipped, LoadPolicy loads the policy without them and returns an *errors.MultiError counting them
+// per kind of error. Only the adapters implementing persist.ErrorHandlingAdapter, like the file adapter, support it.
+func (e *Enforcer) SetLoadErrorHandler(fn func(line int, raw string, err error) (skip bool)) {
+	e.loadErrorHandler = fn
+}
+
+// SetLoadProgressCallback sets the function given the number of rules loaded so far while the policy is loaded,
+// e.g. to report the startup of a service loading a large policy. Only the adapters implementing
+// persist.ProgressAdapter report the progress, and not while a load error handler is set, see SetLoadErrorHandler.
+func (e *Enforcer) SetLoadProgressCallback(fn func(loaded int)) {
+	e.loadProgress = fn
+}
+
+// loadPolicyWithProgress loads the policy into m, giving the progress to the load progress callback
+// if the adapter supports it.
+func (e *Enforcer) loadPolicyWithProgress(m model.Model) error {
+	adapter, ok := e.adapter.(persist.ProgressAdapter)
+	if !ok || e.loadProgress == nil {
+		return e.adapter.LoadPolicy(m)
+	}
+	return adapter.LoadPolicyWithProgress(m, e.loadProgress)
+}
+
+// loadPolicyFromAdapter loads the policy into m, giving the malformed rules to the load error handler if the adapter
+// supports it. It returns the rules the handler skipped, nil if there are none.
+func (e *Enforcer) loadPolicyFromAdapter(m model.Model) (*Err.MultiError, error) {
+	adapter, ok := e.adapter.(persist.ErrorHandlingAdapter)
+	if !ok || e.loadErrorHandler == nil {
+		return nil, e.loadPolicyWithProgress(m)
+	}
+
+	var skipped *Err.MultiError
+	err := adapter.LoadPolicyWithErrorHandler(m, func(line int, raw string, err error) bool {
+		if !e.loadErrorHandler(line, raw, err) {
+			return false
+		}
+		if skipped == nil {
+			skipped = &Err.MultiError{}
+		}
+		skipped.Add(loadErrorKind(err), err)
+		return true
+	})
+	return skipped, err
+}
+
+// loadErrorKind returns the kind of error a malformed rule is counted under.
+func loadErrorKind(err error) string {
+	switch err := err.(type) {
+	case *Err.ErrInvalidRule:
+		if err.Reason == "ptype is not defined" {
+			return err.Reason
+		}
+		return "wrong number of fields"
+	case *csv.ParseError:
+		return "malformed line"
+	}
+	return err.Error()
+}
+
+// standbyPolicy is a policy loaded next to the one in use, see LoadPolicyIntoStandby.
+type standbyPolicy struct {
+	model model.Model
+	rmMap map[string]rbac.RoleManager
+}
+
+// emptyCopier is implemented by the role managers that can be copied without their links, like the default one.
+type emptyCopier interface {
+	CopyEmpty() rbac.RoleManager
+}
+
+// LoadPolicyIntoStandby loads the policy from file/database into a standby model with its own role links,
+// the enforcer keeps serving the policy in use until SwapStandby.
+// The role managers must implement CopyEmpty() rbac.RoleManager when the role links are built automatically.
+func (e *Enforcer) LoadPolicyIntoStandby() error {
+	if err := e.FlushWrites(); err != nil {
+		return err
+	}
+
+	newModel := e.model.Copy()
+	newModel.ClearPolicy()
+	if err := e.loadPolicyWithProgress(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+		return err
+	}
+
+	if e.strictMode {
+		if err := checkEmptyPolicyFields(newModel); err != nil {
+			return err
+		}
+	}
+
+	if err := e.validateLoadedPolicy(newModel); err != nil {
+		return err
+	}
+
+	if err := newModel.SortPoliciesBySubjectHierarchy(); err != nil {
+		return err
+	}
+
+	if err := newModel.SortPoliciesByPriority(); err != nil {
+		return err
+	}
+
+	newRmMap := e.rmMap
+	if e.autoBuildRoleLinks {
+		newRmMap = make(map[string]rbac.RoleManager, len(e.rmMap))
+		for ptype, rm := range e.rmMap {
+			copier, ok := rm.(emptyCopier)
+			if !ok {
+				return fmt.Errorf("the role manager of %s cannot be copied without its links", ptype)
+			}
+			newRmMap[ptype] = copier.CopyEmpty()
+		}
+		if err := newModel.BuildRoleLinks(newRmMap); err != nil {
+			return err
+		}
+	}
+
+	e.standbyMu.Lock()
+	defer e.standbyMu.Unlock()
+	e.standby = &standbyPolicy{model: newModel, rmMap: newRmMap}
+	return nil
+}
+
+// SwapStandby replaces the policy in use with the one loaded by LoadPolicyIntoStandby,
+// so that enforcing sees either the whole previous policy or the whole new one.
+func (e *Enforcer) SwapStandby() error {
+	defer e.beginChange()()
+
+	e.standbyMu.Lock()
+	standby := e.standby
+	e.standby = nil
+	e.standbyMu.Unlock()
+	if standby == nil {
+		return errors.New("no standby policy, call LoadPolicyIntoStandby first")
+	}
+
+	e.model = standby.model
+	e.rmMap = standby.rmMap
+	e.bumpPolicyGeneration()
+	// the compiled matchers memorize the results of the role functions
+	e.invalidateMatcherMap()
 	return nil
 }
 
 func (e *Enforcer) loadFilteredPolicy(filter interface{}) error {
+	defer e.beginChange()()
+
+	if err := e.FlushWrites(); err != nil {
+		return err
+	}
+
 	var filteredAdapter persist.FilteredAdapter
 
 	// Attempt to cast the Adapter as a FilteredAdapter
@@ -356,6 +864,16 @@ func (e *Enforcer) loadFilteredPolicy(filter interface{}) error {
 		return err
 	}
 
+	if e.strictMode {
+		if err := checkEmptyPolicyFields(e.model); err != nil {
+			return err
+		}
+	}
+
+	if err := e.validateLoadedPolicy(e.model); err != nil {
+		return err
+	}
+
 	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
 		return err
 	}
@@ -364,6 +882,7 @@ func (e *Enforcer) loadFilteredPolicy(filter interface{}) error {
 		return err
 	}
 
+	e.bumpPolicyGeneration()
 	e.initRmMap()
 	e.model.PrintPolicy()
 	if e.autoBuildRoleLinks {
@@ -401,19 +920,50 @@ func (e *Enforcer) SavePolicy() error {
 	if e.IsFiltered() {
 		return errors.New("cannot save a filtered policy")
 	}
-	if err := e.adapter.SavePolicy(e.model); err != nil {
+	if err := e.FlushWrites(); err != nil {
 		return err
 	}
-	if e.watcher != nil {
-		var err error
-		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
-			err = watcher.UpdateForSavePolicy(e.model)
-		} else {
-			err = e.watcher.Update()
-		}
+	if e.dryRun {
+		e.logDryRun("", "", "SavePolicy")
+		return nil
+	}
+	if err := e.adapter.SavePolicy(e.modelToSave()); err != nil {
 		return err
 	}
-	return nil
+	return e.notifySavePolicy()
+}
+
+// SaveFilteredPolicy saves the rules of the current policy that match the filter back to file/database,
+// e.g. after changing the policy loaded by LoadFilteredPolicy(filter). The stored rules matching the filter
+// are replaced and the other stored rules are kept, the rules of the current policy that do not match
+// the filter are not saved. The adapter must implement persist.FilteredSaveAdapter.
+func (e *Enforcer) SaveFilteredPolicy(filter interface{}) error {
+	adapter, ok := e.adapter.(persist.FilteredSaveAdapter)
+	if !ok {
+		return errors.New("saving filtered policies is not supported by this adapter")
+	}
+	if err := e.FlushWrites(); err != nil {
+		return err
+	}
+	if e.dryRun {
+		e.logDryRun("", "", "SaveFilteredPolicy", filter)
+		return nil
+	}
+	if err := adapter.SaveFilteredPolicy(e.modelToSave(), filter); err != nil {
+		return err
+	}
+	return e.notifySavePolicy()
+}
+
+// notifySavePolicy notifies the watcher that the policy was saved.
+func (e *Enforcer) notifySavePolicy() error {
+	if e.watcher == nil {
+		return nil
+	}
+	if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		return watcher.UpdateForSavePolicy(e.model)
+	}
+	return e.watcher.Update()
 }
 
 func (e *Enforcer) initRmMap() {
@@ -436,132 +986,450 @@ func (e *Enforcer) EnableLog(enable bool) {
 	e.logger.EnableLog(enable)
 }
 
+// SetLogSampleRate makes the logger log only 1 in n enforcement decisions to reduce the log volume at a high
+// request rate, the enforcements failing with an error are always logged. n <= 1 logs every decision.
+func (e *Enforcer) SetLogSampleRate(n int) {
+	atomic.StoreInt64(&e.logSampleRate, int64(n))
+}
+
+// sampleEnforceLog reports whether the current decision is logged, see SetLogSampleRate.
+func (e *Enforcer) sampleEnforceLog() bool {
+	n := atomic.LoadInt64(&e.logSampleRate)
+	return n <= 1 || (atomic.AddUint64(&e.logSampleCount, 1)-1)%uint64(n) == 0
+}
+
 // IsLogEnabled returns the current logger's enabled status.
 func (e *Enforcer) IsLogEnabled() bool {
 	return e.logger.IsEnabled()
 }
 
-// EnableAutoNotifyWatcher controls whether to save a policy rule automatically notify the Watcher when it is added or removed.
-func (e *Enforcer) EnableAutoNotifyWatcher(enable bool) {
-	e.autoNotifyWatcher = enable
+// AllowExtraFields controls whether the rules added or updated with the management API may have more fields
+// than their ptype defines. The extra trailing fields are stored with the rule but ignored by the matchers.
+func (e *Enforcer) AllowExtraFields(allow bool) {
+	e.allowExtraFields = allow
 }
 
-// EnableAutoNotifyDispatcher controls whether to save a policy rule automatically notify the Dispatcher when it is added or removed.
-func (e *Enforcer) EnableAutoNotifyDispatcher(enable bool) {
-	e.autoNotifyDispatcher = enable
+// SetCompareMetadata controls whether the authorization rules that differ only in their metadata fields are
+// distinct rules. By default they are duplicates: AddPolicy does not add a rule whose non-metadata fields are
+// already in the policy, and HasPolicy and RemovePolicy ignore the metadata. Call it before loading the policy.
+func (e *Enforcer) SetCompareMetadata(compare bool) {
+	e.model.SetCompareMetadata(compare)
 }
 
-// EnableAutoSave controls whether to save a policy rule automatically to the adapter when it is added or removed.
-func (e *Enforcer) EnableAutoSave(autoSave bool) {
-	e.autoSave = autoSave
+// AllowEmptyFields controls whether the rules added or updated with the management API may have empty fields.
+func (e *Enforcer) AllowEmptyFields(allow bool) {
+	e.allowEmptyFields = allow
 }
 
-// EnableAutoBuildRoleLinks controls whether to rebuild the role inheritance relations when a role is added or deleted.
-func (e *Enforcer) EnableAutoBuildRoleLinks(autoBuildRoleLinks bool) {
-	e.autoBuildRoleLinks = autoBuildRoleLinks
+// SetStrictMode controls whether empty values are rejected instead of being matched like any other value.
+// In strict mode, Enforce returns an Err.ErrEmptyRequestValue for a nil or empty string request value,
+// and loading a policy fails with an Err.ErrEmptyPolicyField if a rule has an empty field. It is off by default.
+func (e *Enforcer) SetStrictMode(strict bool) {
+	e.strictMode = strict
 }
 
-// BuildRoleLinks manually rebuild the role inheritance relations.
-func (e *Enforcer) BuildRoleLinks() error {
-	for _, rm := range e.rmMap {
-		err := rm.Clear()
-		if err != nil {
-			return err
-		}
-	}
+// LoadValidation tells what loading a policy does with the rules the policy validator rejects, see SetPolicyValidator.
+type LoadValidation int
 
-	return e.model.BuildRoleLinks(e.rmMap)
-}
+const (
+	// LoadValidationOff loads the rules without validating them, it is the default.
+	LoadValidationOff LoadValidation = iota
+	// LoadValidationWarn logs the rejected rules and loads them anyway.
+	LoadValidationWarn
+	// LoadValidationReject fails the loading with an Err.ErrInvalidRule for the first rejected rule.
+	LoadValidationReject
+)
 
-// BuildIncrementalRoleLinks provides incremental build the role inheritance relations.
-func (e *Enforcer) BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error {
-	e.invalidateMatcherMap()
-	return e.model.BuildIncrementalRoleLinks(e.rmMap, op, "g", ptype, rules)
+// SaveOrdering tells the order SavePolicy gives the rules of a ptype to the adapter in, see SetSaveOrdering.
+type SaveOrdering int
+
+const (
+	// SaveInsertionOrder saves the rules in the order they were loaded or added, it is the default.
+	SaveInsertionOrder SaveOrdering = iota
+	// SaveSorted saves the rules sorted lexicographically, field by field, so the same policy is saved
+	// the same way whatever order it was loaded or added in.
+	SaveSorted
+)
+
+// SetSaveOrdering sets the order SavePolicy and SaveFilteredPolicy save the rules of a ptype in, e.g. SaveSorted
+// to diff the saved policies. The ptypes are saved in the order of persist.SortedPtypes whatever the ordering.
+func (e *Enforcer) SetSaveOrdering(ordering SaveOrdering) {
+	e.saveOrdering = ordering
 }
 
-// NewEnforceContext Create a default structure based on the suffix
-func NewEnforceContext(suffix string) EnforceContext {
-	return EnforceContext{
-		RType: "r" + suffix,
-		PType: "p" + suffix,
-		EType: "e" + suffix,
-		MType: "m" + suffix,
+// modelToSave returns the model to give the adapter when saving the policy, a sorted copy for SaveSorted.
+func (e *Enforcer) modelToSave() model.Model {
+	if e.saveOrdering != SaveSorted {
+		return e.model
 	}
+	m := e.model.Copy()
+	m.SortPolicies()
+	return m
 }
 
-func (e *Enforcer) invalidateMatcherMap() {
-	e.matcherMap = sync.Map{}
+// EvaluationErrorPolicy tells what an enforcement does when the matcher fails for a rule, see SetEvaluationErrorPolicy.
+type EvaluationErrorPolicy int
+
+const (
+	// EvaluationErrorOut fails the enforcement with the error, it is the default.
+	EvaluationErrorOut EvaluationErrorPolicy = iota
+	// EvaluationDenyAndReport reports the error to the evaluation error handler and goes on with the other rules,
+	// the rule that failed does not match, or denies the request if its effect is deny.
+	EvaluationDenyAndReport
+)
+
+// SetEvaluationErrorPolicy sets what an enforcement does when the matcher fails for a rule, e.g. because of
+// a malformed rule or a function returning an error for its values. The errors that do not depend on the rule,
+// like a matcher calling an unknown function or a request with the wrong number of values, always fail it.
+func (e *Enforcer) SetEvaluationErrorPolicy(policy EvaluationErrorPolicy) {
+	e.evaluationErrorPolicy = policy
 }
 
-// enforce use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
-func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interface{}) (ok bool, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
-		}
-	}()
+// SetEvaluationErrorHandler sets the function given the errors of the rules with EvaluationDenyAndReport,
+// with the ptype of the rule and its index among the rules of the ptype. They are logged if it is nil.
+func (e *Enforcer) SetEvaluationErrorHandler(fn func(ptype string, index int, rule []string, err error)) {
+	e.evaluationErrorHandler = fn
+}
 
-	if !e.enabled {
-		return true, nil
+// reportEvaluationError reports the error of the rule to the evaluation error handler or the logger.
+func (e *Enforcer) reportEvaluationError(ptype string, index int, rule []string, err error) {
+	if e.evaluationErrorHandler != nil {
+		e.evaluationErrorHandler(ptype, index, rule, err)
+		return
 	}
+	e.logger.LogModel([][]string{{"p", ptype, fmt.Sprintf("evaluation of rule %d %v failed: %s", index, rule, err)}})
+}
 
-	functions := e.fm.GetFunctions()
-	if _, ok := e.model["g"]; ok {
-		for key, ast := range e.model["g"] {
-			rm := ast.RM
-			functions[key] = util.GenerateGFunction(rm)
-		}
-	}
+// SetPolicyValidator sets the function checking the rules before they are stored by the management API,
+// e.g. that the action is in an allowlist. It is given the ptype and the rule, a non-nil error rejects the rule
+// with an Err.ErrInvalidRule wrapping it, and no rule of a batch is added if one is rejected.
+// The loaded rules are only checked if SetPolicyValidationOnLoad asks for it.
+func (e *Enforcer) SetPolicyValidator(fn func(ptype string, rule []string) error) {
+	e.policyValidator = fn
+}
 
-	var (
-		rType = "r"
-		pType = "p"
-		eType = "e"
-		mType = "m"
-	)
-	if len(rvals) != 0 {
-		switch rvals[0].(type) {
-		case EnforceContext:
-			enforceContext := rvals[0].(EnforceContext)
-			rType = enforceContext.RType
-			pType = enforceContext.PType
-			eType = enforceContext.EType
-			mType = enforceContext.MType
-			rvals = rvals[1:]
-		default:
-			break
+// SetPolicyValidationOnLoad controls what loading a policy does with the rules the policy validator rejects.
+func (e *Enforcer) SetPolicyValidationOnLoad(validation LoadValidation) {
+	e.loadValidation = validation
+}
+
+// validateLoadedPolicy checks the expressions of the loaded rules given to eval() if their validation is enabled,
+// and the loaded rules with the policy validator according to the load validation.
+func (e *Enforcer) validateLoadedPolicy(m model.Model) error {
+	if e.validateEvalRules {
+		for _, ptype := range sortedPTypes(m["p"]) {
+			for _, rule := range m["p"][ptype].Policy {
+				if _, err := e.parseEvalFields(m, ptype, rule); err != nil {
+					return &Err.ErrInvalidRule{PType: ptype, Expected: len(m["p"][ptype].Tokens), Rule: rule, Reason: err.Error(), Err: err}
+				}
+			}
 		}
 	}
+	if e.policyValidator == nil || e.loadValidation == LoadValidationOff {
+		return nil
+	}
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range sortedPTypes(m[sec]) {
+			for _, rule := range m[sec][ptype].Policy {
+				err := e.policyValidator(ptype, rule)
+				if err == nil {
+					continue
+				}
+				if e.loadValidation == LoadValidationReject {
+					return &Err.ErrInvalidRule{PType: ptype, Expected: len(m[sec][ptype].Tokens), Rule: rule, Reason: err.Error(), Err: err}
+				}
+				e.logger.LogModel([][]string{{sec, ptype, fmt.Sprintf("invalid rule %v: %s", rule, err)}})
+			}
+		}
+	}
+	return nil
+}
 
-	var expString string
-	if matcher == "" {
-		expString = e.model["m"][mType].Value
-	} else {
-		expString = util.RemoveComments(util.EscapeAssertion(matcher))
+// checkEmptyPolicyFields returns an Err.ErrEmptyPolicyField for the first loaded rule with an empty field.
+func checkEmptyPolicyFields(m model.Model) error {
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range sortedPTypes(m[sec]) {
+			for i, rule := range m[sec][ptype].Policy {
+				for j, field := range rule {
+					if field == "" {
+						return &Err.ErrEmptyPolicyField{PType: ptype, Index: i, Field: j, Rule: rule}
+					}
+				}
+			}
+		}
 	}
+	return nil
+}
+
+// EnableAutoNotifyWatcher controls whether to save a policy rule automatically notify the Watcher when it is added or removed.
+func (e *Enforcer) EnableAutoNotifyWatcher(enable bool) {
+	e.autoNotifyWatcher = enable
+}
+
+// EnableAutoNotifyDispatcher controls whether to save a policy rule automatically notify the Dispatcher when it is added or removed.
+func (e *Enforcer) EnableAutoNotifyDispatcher(enable bool) {
+	e.autoNotifyDispatcher = enable
+}
+
+// EnableAutoSave controls whether to save a policy rule automatically to the adapter when it is added or removed.
+func (e *Enforcer) EnableAutoSave(autoSave bool) {
+	e.autoSave = autoSave
+}
 
-	rTokens := make(map[string]int, len(e.model["r"][rType].Tokens))
-	for i, token := range e.model["r"][rType].Tokens {
-		rTokens[token] = i
+// SetAutoSaveForPtype controls whether to save the rules of a ptype automatically to the adapter, overriding EnableAutoSave
+// for it, e.g. SetAutoSaveForPtype("g", "g", false) keeps the role assignments in memory when they are managed by another service.
+func (e *Enforcer) SetAutoSaveForPtype(sec string, ptype string, enabled bool) {
+	e.autoSaveForPtype[sec+"."+ptype] = enabled
+}
+
+// SetDryRun controls whether the enforcer runs without ever writing to the adapter, e.g. in a staging environment.
+// In dry-run mode the policy changes are applied in memory and succeed, but the adapter calls that would have saved
+// them, including SavePolicy, are skipped and logged instead. Unlike with EnableAutoSave(false), UpdateFilteredPolicies
+// still updates the policy in memory, it finds the rules to replace there instead of asking the adapter.
+func (e *Enforcer) SetDryRun(dryRun bool) {
+	e.dryRun = dryRun
+}
+
+// SetRecoverFromPanic controls whether a panic during an enforcement, e.g. in a function added with AddFunction,
+// is returned by Enforce as an error instead of crashing the goroutine. It is enabled by default, the error
+// of a function that panicked is an *errors.ErrFunctionPanic naming the function.
+func (e *Enforcer) SetRecoverFromPanic(recoverFromPanic bool) {
+	e.recoverFromPanic = recoverFromPanic
+	e.invalidateMatcherMap()
+}
+
+// EnableNotifyWithoutAutoSave controls whether to notify the Watcher of the changes that are not saved automatically
+// to the adapter, it is enabled by default.
+func (e *Enforcer) EnableNotifyWithoutAutoSave(enable bool) {
+	e.notifyWithoutAutoSave = enable
+}
+
+// SetWatcherDiffThreshold sets the number of rules above which a change is notified with a plain Watcher.Update,
+// making the other instances reload the whole policy, instead of the WatcherEx or UpdatableWatcher call carrying
+// the rules, e.g. for a bulk change too large to send. An update counts both its old and new rules.
+// A threshold of 0 or less, the default, always sends the rules.
+func (e *Enforcer) SetWatcherDiffThreshold(maxRules int) {
+	e.watcherDiffThreshold = maxRules
+}
+
+// EnableStringInterning controls whether the identical field values of the policy rules share their storage
+// to save memory, see model.Model.EnableStringInterning. It applies to the current model only.
+func (e *Enforcer) EnableStringInterning(enable bool) {
+	e.model.EnableStringInterning(enable)
+}
+
+// EnablePermissionIndex controls whether an index from the subjects of the rules to their rules is kept up to date
+// with the policy, so that GetImplicitPermissionsForUser and the like only visit the rules of the user and its roles,
+// see model.Model.EnablePermissionIndex. It applies to the current model only.
+func (e *Enforcer) EnablePermissionIndex(enable bool) {
+	e.model.EnablePermissionIndex(enable)
+}
+
+// EnableAutoBuildRoleLinks controls whether to rebuild the role inheritance relations when a role is added or deleted.
+func (e *Enforcer) EnableAutoBuildRoleLinks(autoBuildRoleLinks bool) {
+	e.autoBuildRoleLinks = autoBuildRoleLinks
+}
+
+// SetDeterministicOutput controls whether the GetAll* value lists, e.g. GetAllSubjects() and GetAllRoles(),
+// are sorted lexicographically instead of being returned in their order of first appearance in the policy.
+func (e *Enforcer) SetDeterministicOutput(enable bool) {
+	e.deterministicOutput = enable
+}
+
+func (e *Enforcer) sortIfDeterministic(values []string) []string {
+	if e.deterministicOutput {
+		sort.Strings(values)
 	}
-	pTokens := make(map[string]int, len(e.model["p"][pType].Tokens))
-	for i, token := range e.model["p"][pType].Tokens {
-		pTokens[token] = i
+	return values
+}
+
+// sortedRmTypes returns the ptypes of the role managers in lexicographical order,
+// so that results merged from several role managers come out in a stable order.
+func (e *Enforcer) sortedRmTypes() []string {
+	ptypes := make([]string, 0, len(e.rmMap))
+	for ptype := range e.rmMap {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
+// BuildRoleLinks manually rebuild the role inheritance relations.
+func (e *Enforcer) BuildRoleLinks() error {
+	defer e.beginChange()()
+
+	for _, rm := range e.rmMap {
+		err := rm.Clear()
+		if err != nil {
+			return err
+		}
 	}
 
-	parameters := enforceParameters{
-		rTokens: rTokens,
-		rVals:   rvals,
+	e.invalidateMatcherMap()
+	return e.model.BuildRoleLinks(e.rmMap)
+}
 
-		pTokens: pTokens,
+// BuildIncrementalRoleLinks provides incremental build the role inheritance relations.
+// It adds or removes the links of the rules of any grouping ptype, e.g. "g2", without rebuilding the other links.
+func (e *Enforcer) BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error {
+	if _, ok := e.model["g"][ptype]; !ok {
+		return fmt.Errorf("grouping policy definition %s does not exist", ptype)
+	}
+	if _, ok := e.rmMap[ptype]; !ok {
+		return fmt.Errorf("role manager of %s does not exist", ptype)
 	}
+	e.invalidateMatcherMap()
+	return e.model.BuildIncrementalRoleLinks(e.rmMap, op, "g", ptype, rules)
+}
 
-	hasEval := util.HasEval(expString)
-	if hasEval {
-		functions["eval"] = generateEvalFunction(functions, &parameters)
+// RebuildRoleLinks rebuilds the role links of all the grouping ptypes from scratch, e.g. after loading the policy
+// with the automatic build disabled by EnableAutoBuildRoleLinks. The grouping rule mutations always update
+// the role links incrementally.
+func (e *Enforcer) RebuildRoleLinks() error {
+	return e.BuildRoleLinks()
+}
+
+// NewEnforceContext Create a default structure based on the suffix
+func NewEnforceContext(suffix string) EnforceContext {
+	return EnforceContext{
+		RType: "r" + suffix,
+		PType: "p" + suffix,
+		EType: "e" + suffix,
+		MType: "m" + suffix,
 	}
+}
+
+// DefaultEnforceContext selects the r, p, e and m definitions, which is what Enforce uses without a context.
+var DefaultEnforceContext = NewEnforceContext("")
+
+// getEnforceContext takes the EnforceContext (or *EnforceContext) off the front of rvals,
+// the default one is returned if rvals does not start with a context.
+func getEnforceContext(rvals []interface{}) (EnforceContext, []interface{}) {
+	if len(rvals) != 0 {
+		switch enforceContext := rvals[0].(type) {
+		case EnforceContext:
+			return enforceContext, rvals[1:]
+		case *EnforceContext:
+			if enforceContext != nil {
+				return *enforceContext, rvals[1:]
+			}
+		}
+	}
+	return DefaultEnforceContext, rvals
+}
+
+// checkEnforceContext checks that the model defines the definitions the context selects,
+// the matcher is only checked if it is used and the effect if it is needed.
+func (e *Enforcer) checkEnforceContext(enforceContext EnforceContext, checkMatcher bool, checkEffect bool) error {
+	assertions := [][2]string{{"r", enforceContext.RType}, {"p", enforceContext.PType}}
+	if checkEffect {
+		assertions = append(assertions, [2]string{"e", enforceContext.EType})
+	}
+	if checkMatcher {
+		assertions = append(assertions, [2]string{"m", enforceContext.MType})
+	}
+	for _, assertion := range assertions {
+		if _, ok := e.model[assertion[0]][assertion[1]]; !ok {
+			return &Err.ErrAssertionNotFound{Sec: assertion[0], Key: assertion[1]}
+		}
+	}
+	return nil
+}
+
+// invalidateMatcherMap discards the compiled matchers and the role functions they use.
+func (e *Enforcer) invalidateMatcherMap() {
+	// the role functions are discarded first, a matcher compiled with the previous ones then goes
+	// into the map already discarded.
+	e.roleFunctions.Store(roleFunctions{})
+	e.matcherMap.Store(&sync.Map{})
+}
+
+// invalidateFunctions discards the compiled matchers after the functions changed, including the ones shared
+// with the other enforcers of an EnforcerPool, which share the functions.
+func (e *Enforcer) invalidateFunctions() {
+	if e.sharedMatcherMap != nil {
+		e.sharedMatcherMap.Store(&sync.Map{})
+	}
+	e.invalidateMatcherMap()
+}
+
+// enforce use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
+// Only the rules accepted by scope are evaluated, all the rules are evaluated when scope is nil.
+// The context functions called by the matcher are given ctx, the enforcement stops with its error once it is done.
+// When ctx holds a match collector, see GetMatchingPolicies, every rule is evaluated and given to the collector
+// if it matches, and the decision is neither overridden nor logged.
+func (e *Enforcer) enforce(ctx context.Context, matcher string, scope func(rule []string) bool, explain *MatchedRule, rvals ...interface{}) (ok bool, err error) {
+	defer func() {
+		if e.recoverFromPanic {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+			}
+		}
+		if err != nil {
+			e.logger.LogEnforce(matcher, rvals, false, [][]string{{"error: " + err.Error()}})
+		}
+	}()
+
+	collect, _ := ctx.Value(matchCollectorKey{}).(func(rule []string))
+	if collect == nil {
+		if res, overridden := e.overrideDecision(matcher, rvals); overridden {
+			// the override may change at any time, its decisions are not cached.
+			return cache.DoNotCache(ctx, res).(bool), nil
+		}
+
+		if !e.enabled {
+			return true, nil
+		}
+	}
+
+	if changed := e.beginEnforce(); changed != nil {
+		defer func() {
+			if changeErr := changed(); changeErr != nil && err == nil {
+				ok, err = false, changeErr
+			}
+		}()
+	}
+
+	var quotas *quotaUsage
+	if store := e.quotaStore; store != nil && collect == nil {
+		ctx, quotas = withQuotaUsage(ctx)
+		defer func() {
+			if ok && err == nil {
+				ok, err = quotas.use(store)
+			}
+		}()
+	}
+
+	// load the compiled expressions before the functions, an expression compiled with functions
+	// that changed meanwhile then goes into the map AddFunction has already discarded.
+	matcherMap := e.matcherMap.Load().(*sync.Map)
+	if e.sharedMatcherMap != nil {
+		matcherMap = e.sharedMatcherMap.Load().(*sync.Map)
+		// the shared role functions find the enforcer in the context of the call, see sharedRoleFunction.
+		ctx = context.WithValue(ctx, enforcerKey{}, e)
+	}
+
+	enforceContext, rvals := getEnforceContext(rvals)
+	if err := e.checkEnforceContext(enforceContext, matcher == "", collect == nil); err != nil {
+		return false, err
+	}
+	rType, pType, eType, mType := enforceContext.RType, enforceContext.PType, enforceContext.EType, enforceContext.MType
+
+	var expString string
+	if matcher == "" {
+		expString = e.model["m"][mType].Value
+	} else {
+		expString = util.RemoveComments(util.EscapeAssertion(matcher))
+	}
+
+	buffer := e.getEnforceBuffer(e.model["r"][rType].Tokens, e.model["p"][pType].Tokens, rvals)
+	defer putEnforceBuffer(buffer)
+	parameters := &buffer.parameters
+
+	parameters.ctx = ctx
+
 	var expression *govaluate.EvaluableExpression
-	expression, err = e.getAndStoreMatcherExpression(hasEval, expString, functions)
+	expression, err = e.getMatcherExpression(matcherMap, expString, ctx, parameters)
 	if err != nil {
 		return false, err
 	}
@@ -574,6 +1442,18 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			rvals)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	if e.strictMode {
+		for i, rval := range rvals {
+			if str, ok := rval.(string); rval == nil || ok && str == "" {
+				return false, &Err.ErrEmptyRequestValue{Token: e.model["r"][rType].Tokens[i], Index: i}
+			}
+		}
+	}
+
 	var policyEffects []effector.Effect
 	var matcherResults []float64
 
@@ -581,43 +1461,41 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 	var explainIndex int
 
 	if policyLen := len(e.model["p"][pType].Policy); policyLen != 0 && strings.Contains(expString, pType+"_") {
-		policyEffects = make([]effector.Effect, policyLen)
-		matcherResults = make([]float64, policyLen)
+		policyEffects, matcherResults = buffer.results(policyLen)
+		var usage []*ruleCounter
+		if e.trackRuleUsage && collect == nil {
+			usage = e.ruleUsage.countersFor(e.model, e.GetPolicyGeneration(), pType)
+		}
 
 		for policyIndex, pvals := range e.model["p"][pType].Policy {
 			// log.LogPrint("Policy Rule: ", pvals)
-			if len(e.model["p"][pType].Tokens) != len(pvals) {
-				return false, fmt.Errorf(
+			if !e.model["p"][pType].IsValidPolicySize(pvals) {
+				sizeErr := fmt.Errorf(
 					"invalid policy size: expected %d, got %d, pvals: %v",
 					len(e.model["p"][pType].Tokens),
 					len(pvals),
 					pvals)
-			}
-
-			parameters.pVals = pvals
-
-			result, err := expression.Eval(parameters)
-			// log.LogPrint("Result: ", result)
-
-			if err != nil {
-				return false, err
-			}
-
-			// set to no-match at first
-			matcherResults[policyIndex] = 0
-			switch result := result.(type) {
-			case bool:
-				if result {
-					matcherResults[policyIndex] = 1
+				if e.evaluationErrorPolicy != EvaluationDenyAndReport {
+					return false, sizeErr
 				}
-			case float64:
-				if result != 0 {
-					matcherResults[policyIndex] = 1
+				// the malformed rule does not match.
+				e.reportEvaluationError(pType, policyIndex, pvals, sizeErr)
+				policyEffects[policyIndex], matcherResults[policyIndex] = effector.Indeterminate, 0
+				if collect != nil {
+					continue
 				}
-			default:
-				return false, errors.New("matcher result should be bool, int or float")
+				effect, explainIndex, err = e.mergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, policyIndex, policyLen, parameters)
+				if err != nil {
+					return false, err
+				}
+				if effect != effector.Indeterminate {
+					break
+				}
+				continue
 			}
 
+			parameters.pVals = pvals
+
 			if j, ok := parameters.pTokens[pType+"_eft"]; ok {
 				eft := parameters.pVals[j]
 				if eft == "allow" {
@@ -631,11 +1509,57 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 				policyEffects[policyIndex] = effector.Allow
 			}
 
+			// set to no-match at first
+			matcherResults[policyIndex] = 0
+			// the rules are all evaluated while collecting or counting their matches, skipped rules would look unused.
+			if (scope == nil || scope(pvals)) && (collect != nil || usage != nil || !e.canSkipMatcher(e.model["e"][eType].Value, policyEffects[policyIndex])) {
+				if err := ctx.Err(); err != nil {
+					return false, err
+				}
+				if quotas != nil {
+					quotas.evaluate(policyIndex)
+				}
+
+				result, err := expression.Eval(parameters)
+				// log.LogPrint("Result: ", result)
+
+				if err != nil {
+					if e.evaluationErrorPolicy != EvaluationDenyAndReport {
+						return false, err
+					}
+					// the rule does not match, unless it denies.
+					e.reportEvaluationError(pType, policyIndex, pvals, err)
+					result = policyEffects[policyIndex] == effector.Deny
+				}
+
+				switch result := result.(type) {
+				case bool:
+					if result {
+						matcherResults[policyIndex] = 1
+					}
+				case float64:
+					if result != 0 {
+						matcherResults[policyIndex] = 1
+					}
+				default:
+					return false, errors.New("matcher result should be bool, int or float")
+				}
+				if usage != nil && matcherResults[policyIndex] != 0 {
+					usage[policyIndex].matched()
+				}
+			}
+			if collect != nil {
+				if matcherResults[policyIndex] != 0 {
+					collect(pvals)
+				}
+				continue
+			}
+
 			//if e.model["e"]["e"].Value == "priority(p_eft) || deny" {
 			//	break
 			//}
 
-			effect, explainIndex, err = e.eft.MergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, policyIndex, policyLen)
+			effect, explainIndex, err = e.mergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, policyIndex, policyLen, parameters)
 			if err != nil {
 				return false, err
 			}
@@ -644,8 +1568,12 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			}
 		}
 	} else {
+		if collect != nil {
+			// no rule to collect.
+			return false, nil
+		}
 
-		if hasEval && len(e.model["p"][pType].Policy) == 0 {
+		if util.HasEval(expString) && len(e.model["p"][pType].Policy) == 0 {
 			return false, errors.New("please make sure rule exists in policy when using eval() in matcher")
 		}
 
@@ -667,23 +1595,27 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 			policyEffects[0] = effector.Indeterminate
 		}
 
-		effect, explainIndex, err = e.eft.MergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, 0, 1)
+		effect, explainIndex, err = e.mergeEffects(e.model["e"][eType].Value, policyEffects, matcherResults, 0, 1, parameters)
 		if err != nil {
 			return false, err
 		}
 	}
 
-	var logExplains [][]string
+	if quotas != nil {
+		quotas.decide(explainIndex)
+	}
 
-	if explains != nil {
-		if len(*explains) > 0 {
-			logExplains = append(logExplains, *explains)
-		}
+	var logExplains [][]string
 
-		if explainIndex != -1 && len(e.model["p"][pType].Policy) > explainIndex {
-			*explains = e.model["p"][pType].Policy[explainIndex]
-			logExplains = append(logExplains, *explains)
+	if explain != nil && explainIndex != -1 && len(e.model["p"][pType].Policy) > explainIndex {
+		*explain = MatchedRule{
+			PType:  pType,
+			Tokens: e.model["p"][pType].Tokens,
+			Values: e.model["p"][pType].Policy[explainIndex],
+			Effect: policyEffects[explainIndex],
+			Index:  explainIndex,
 		}
+		logExplains = append(logExplains, explain.Values)
 	}
 
 	// effect -> result
@@ -691,57 +1623,417 @@ func (e *Enforcer) enforce(matcher string, explains *[]string, rvals ...interfac
 	if effect == effector.Allow {
 		result = true
 	}
-	e.logger.LogEnforce(expString, rvals, result, logExplains)
+	if collect == nil && e.logger.IsEnabled() && e.sampleEnforceLog() {
+		e.logger.LogEnforce(expString, rvals, result, logExplains)
+	}
 
 	return result, nil
 }
 
-func (e *Enforcer) getAndStoreMatcherExpression(hasEval bool, expString string, functions map[string]govaluate.ExpressionFunction) (*govaluate.EvaluableExpression, error) {
-	var expression *govaluate.EvaluableExpression
-	var err error
-	var cachedExpression, isPresent = e.matcherMap.Load(expString)
+// canSkipMatcher reports whether the matcher does not need to be evaluated for a rule with the given effect,
+// because the rule can never decide the result of the policy effect: only an allow rule can grant access
+// under allow-override, and only a deny rule can revoke it under deny-override.
+// Custom effectors are always given every matcher result.
+func (e *Enforcer) canSkipMatcher(policyEffect string, eft effector.Effect) bool {
+	if _, ok := e.eft.(*effector.DefaultEffector); !ok {
+		return false
+	}
 
-	if !hasEval && isPresent {
-		expression = cachedExpression.(*govaluate.EvaluableExpression)
-	} else {
-		expression, err = govaluate.NewEvaluableExpressionWithFunctions(expString, functions)
-		if err != nil {
+	switch policyEffect {
+	case constant.AllowOverrideEffect:
+		return eft != effector.Allow
+	case constant.DenyOverrideEffect:
+		return eft != effector.Deny
+	default:
+		return false
+	}
+}
+
+// getFunctions returns the functions the matchers can call: the function map with the context functions bound to ctx,
+// and the role functions of the role definitions.
+func (e *Enforcer) getFunctions(ctx context.Context) map[string]govaluate.ExpressionFunction {
+	functions := e.getContextArgumentFunctions()
+	for name := range e.contextArgumentFunctionNames() {
+		functions[name] = bindContextArgument(ctx, functions[name])
+	}
+	return functions
+}
+
+// getContextArgumentFunctions returns the functions like getFunctions, except that the context functions and
+// the role functions take the context as their first argument, see passContextParameter.
+func (e *Enforcer) getContextArgumentFunctions() map[string]govaluate.ExpressionFunction {
+	functions := e.fm.GetFunctions()
+	for name, function := range e.fm.GetContextFunctions() {
+		functions[name] = takeContextArgument(function)
+	}
+	if e.recoverFromPanic {
+		for name, function := range functions {
+			functions[name] = recoverFunction(name, function)
+		}
+	}
+	for key, function := range e.getRoleFunctions() {
+		functions[key] = function
+	}
+	return functions
+}
+
+// roleFunctions wraps the role functions stored in Enforcer.roleFunctions, nil until they are built.
+type roleFunctions struct {
+	functions map[string]govaluate.ExpressionFunction
+}
+
+// getRoleFunctions returns the role functions of the role definitions, taking the context as their first argument.
+// They are built once for the compiled matchers, so that they memorize the links until the matchers are discarded.
+func (e *Enforcer) getRoleFunctions() map[string]govaluate.ExpressionFunction {
+	if built, _ := e.roleFunctions.Load().(roleFunctions); built.functions != nil {
+		return built.functions
+	}
+
+	functions := map[string]govaluate.ExpressionFunction{}
+	for key, ast := range e.model["g"] {
+		if rm, ok := ast.RM.(rbac.ContextRoleManager); ok {
+			functions[key] = util.GenerateContextGFunction(rm)
+		} else {
+			g := util.GenerateGFunction(ast.RM)
+			functions[key] = takeContextArgument(func(_ context.Context, args ...interface{}) (interface{}, error) {
+				return g(args...)
+			})
+		}
+		if key == "g" && len(e.defaultRoles) != 0 {
+			functions[key] = e.withDefaultRoles(functions[key])
+		}
+	}
+	e.roleFunctions.Store(roleFunctions{functions: functions})
+	return functions
+}
+
+// enforcerKey is the context key of the enforcer of the call, see sharedRoleFunction.
+type enforcerKey struct{}
+
+// sharedRoleFunction returns the role function of the matchers shared by the enforcers of an EnforcerPool,
+// which calls the role function of the enforcer found in the context, its first argument.
+func sharedRoleFunction(key string) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		var e *Enforcer
+		if len(args) != 0 {
+			if ctx, ok := args[0].(context.Context); ok {
+				e, _ = ctx.Value(enforcerKey{}).(*Enforcer)
+			}
+		}
+		if e == nil {
+			return nil, fmt.Errorf("%s: the enforcer of the call is missing from its context", key)
+		}
+		return e.getRoleFunctions()[key](args...)
+	}
+}
+
+// contextArgumentFunctionNames returns the names of the functions taking the context as their first argument
+// in getContextArgumentFunctions.
+func (e *Enforcer) contextArgumentFunctionNames() map[string]bool {
+	names := map[string]bool{}
+	for name := range e.fm.GetContextFunctions() {
+		names[name] = true
+	}
+	for key := range e.model["g"] {
+		names[key] = true
+	}
+	return names
+}
+
+// takeContextArgument turns the context function into an expression function taking the context as its first argument.
+func takeContextArgument(function model.ContextFunction) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("the context argument is missing")
+		}
+		ctx, ok := args[0].(context.Context)
+		if !ok {
+			ctx = context.Background()
+		}
+		return function(ctx, args[1:]...)
+	}
+}
+
+// bindContextArgument turns the function taking the context as its first argument into one called with ctx.
+func bindContextArgument(ctx context.Context, function govaluate.ExpressionFunction) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		return function(append([]interface{}{ctx}, args...)...)
+	}
+}
+
+// passContextParameter passes the context of the call, the contextParameter parameter, as the first argument
+// of the functions taking it, e.g. "g(r_sub, p_sub)" becomes "g(casbin_ctx, r_sub, p_sub)". The compiled matcher
+// then serves the calls of every context.
+func (e *Enforcer) passContextParameter(expString string) string {
+	names := e.contextArgumentFunctionNames()
+	var b strings.Builder
+	var quote byte
+	start := -1
+	for i := 0; i < len(expString); i++ {
+		c := expString[i]
+		b.WriteByte(c)
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(expString) {
+				i++
+				b.WriteByte(expString[i])
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' && start >= 0 && names[expString[start:i]]:
+			if strings.HasPrefix(strings.TrimLeft(expString[i+1:], " "), ")") {
+				b.WriteString(contextParameter)
+			} else {
+				b.WriteString(contextParameter + ", ")
+			}
+		}
+		if c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+			if start < 0 {
+				start = i
+			}
+		} else {
+			start = -1
+		}
+	}
+	return b.String()
+}
+
+// recoverFunction wraps the function so that it returns an *Err.ErrFunctionPanic instead of panicking.
+func recoverFunction(name string, function govaluate.ExpressionFunction) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (res interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				res, err = nil, &Err.ErrFunctionPanic{Name: name, Value: r, Stack: string(debug.Stack())}
+			}
+		}()
+		return function(args...)
+	}
+}
+
+// withDefaultRoles wraps the g(ctx, _, _[, _]) function so that every subject also has the default roles
+// and the roles they inherit.
+func (e *Enforcer) withDefaultRoles(g govaluate.ExpressionFunction) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		res, err := g(args...)
+		if err != nil || res == true || len(args) < 3 {
+			return res, err
+		}
+		domain := ""
+		if len(args) > 3 {
+			domain, _ = args[3].(string)
+		}
+		for _, role := range e.defaultRoles[domain] {
+			if role == args[2] {
+				return true, nil
+			}
+			if res, err := g(append([]interface{}{args[0], role}, args[2:]...)...); err != nil || res == true {
+				return res, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// getMatcherExpression returns the compiled expression of the matcher. A matcher calling eval() is compiled for every
+// call, with the functions bound to ctx and parameters. The other matchers are compiled once, the functions taking
+// the context get the one of the call from its parameters, see passContextParameter.
+func (e *Enforcer) getMatcherExpression(matcherMap *sync.Map, expString string, ctx context.Context, parameters *enforceParameters) (*govaluate.EvaluableExpression, error) {
+	hasEval := util.HasEval(expString)
+	key := expString
+	if e.sharedMatcherMap != nil {
+		// the enforcers sharing the compiled matchers do not compile them the same way with these settings.
+		key = fmt.Sprintf("%t,%t,%s", e.recoverFromPanic, e.strictMatcherTypes, expString)
+	}
+	return e.getAndStoreMatcherExpression(matcherMap, hasEval, key, func() (string, map[string]govaluate.ExpressionFunction, error) {
+		if hasEval {
+			functions := e.getFunctions(ctx)
+			if err := checkRequiredFunctions(e.model.GetRequiredFunctions(), functions); err != nil {
+				return "", nil, err
+			}
+			functions["eval"] = generateEvalFunction(functions, parameters)
+			return expString, functions, nil
+		}
+
+		functions := e.getContextArgumentFunctions()
+		if e.sharedMatcherMap != nil {
+			for key := range e.model["g"] {
+				functions[key] = sharedRoleFunction(key)
+			}
+		}
+		if err := checkRequiredFunctions(e.model.GetRequiredFunctions(), functions); err != nil {
+			return "", nil, err
+		}
+		return e.passContextParameter(expString), functions, nil
+	})
+}
+
+// getAndStoreMatcherExpression returns the expression compiled by a previous call and stored under key,
+// the functions are only built to compile it when it is not in matcherMap or has to be compiled for every call.
+// getFunctions also returns the expression to compile.
+// The expressions compiled for a single call are not stored.
+func (e *Enforcer) getAndStoreMatcherExpression(matcherMap *sync.Map, compileEachCall bool, key string, getFunctions func() (string, map[string]govaluate.ExpressionFunction, error)) (*govaluate.EvaluableExpression, error) {
+	if cachedExpression, isPresent := matcherMap.Load(key); isPresent && !compileEachCall {
+		return cachedExpression.(*govaluate.EvaluableExpression), nil
+	}
+
+	compiled, functions, err := getFunctions()
+	if err != nil {
+		return nil, err
+	}
+	expression, err := govaluate.NewEvaluableExpressionWithFunctions(compiled, functions)
+	if err != nil {
+		return nil, suggestFunction(err, functions)
+	}
+	if e.strictMatcherTypes {
+		if expression, err = withStrictTypes(expression); err != nil {
 			return nil, err
 		}
-		e.matcherMap.Store(expString, expression)
+	}
+	if !compileEachCall {
+		matcherMap.Store(key, expression)
 	}
 	return expression, nil
 }
 
+// mergeEffects merges the matching results with the effector, passing it the request if it can use it.
+func (e *Enforcer) mergeEffects(expr string, effects []effector.Effect, matches []float64, policyIndex int, policyLength int, request govaluate.Parameters) (effector.Effect, int, error) {
+	if eft, ok := e.eft.(effector.RequestEffector); ok {
+		return eft.MergeEffectsWithRequest(expr, effects, matches, policyIndex, policyLength, request)
+	}
+	return e.eft.MergeEffects(expr, effects, matches, policyIndex, policyLength)
+}
+
+// suggestFunction adds the closest function name to an "Undefined function" error of the matcher.
+func suggestFunction(err error, functions map[string]govaluate.ExpressionFunction) error {
+	const prefix = "Undefined function "
+	if !strings.HasPrefix(err.Error(), prefix) {
+		return err
+	}
+
+	name := strings.TrimPrefix(err.Error(), prefix)
+	names := make([]string, 0, len(functions))
+	for fn := range functions {
+		names = append(names, fn)
+	}
+	sort.Strings(names)
+
+	suggestion, minDistance := "", -1
+	for _, fn := range names {
+		if distance := util.EditDistance(name, fn); minDistance == -1 || distance < minDistance {
+			suggestion, minDistance = fn, distance
+		}
+	}
+	if suggestion == "" {
+		return err
+	}
+	return fmt.Errorf("%s, did you mean %s?", err, suggestion)
+}
+
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *Enforcer) Enforce(rvals ...interface{}) (bool, error) {
-	return e.enforce("", nil, rvals...)
+	return e.enforce(context.Background(), "", nil, nil, rvals...)
+}
+
+// EnforceCtx decides whether a "subject" can access a "object" with the operation "action" like Enforce(),
+// the context functions added by AddContextFunction and the role managers implementing rbac.ContextRoleManager
+// are given ctx. The enforcement fails with the error of ctx, e.g. context.DeadlineExceeded, once it is done.
+func (e *Enforcer) EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error) {
+	return e.enforce(ctx, "", nil, nil, rvals...)
 }
 
 // EnforceWithMatcher use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
 func (e *Enforcer) EnforceWithMatcher(matcher string, rvals ...interface{}) (bool, error) {
-	return e.enforce(matcher, nil, rvals...)
+	return e.enforce(context.Background(), matcher, nil, nil, rvals...)
+}
+
+// EnforceInScope decides whether a "subject" can access a "object" with the operation "action" like Enforce(),
+// but only the policy rules for which scope returns true are taken into account, e.g. the rules of one tenant.
+// The rules outside the scope are treated as if they did not match the request.
+func (e *Enforcer) EnforceInScope(scope func(rule []string) bool, rvals ...interface{}) (bool, error) {
+	return e.enforce(context.Background(), "", scope, nil, rvals...)
+}
+
+// EnforceWithPtype decides whether a "subject" can access a "object" with the operation "action" against the
+// policy definition ptype, e.g. "p2", using the correspondingly named matcher "m2", effect "e2" and request "r2".
+// The effect and the request definition fall back to "e" and "r" when the model does not define the named ones.
+func (e *Enforcer) EnforceWithPtype(ptype string, rvals ...interface{}) (bool, error) {
+	if _, ok := e.model["p"][ptype]; !ok {
+		return false, fmt.Errorf("policy definition %s does not exist", ptype)
+	}
+
+	enforceContext := NewEnforceContext(strings.TrimPrefix(ptype, "p"))
+	if _, ok := e.model["m"][enforceContext.MType]; !ok {
+		return false, fmt.Errorf("matcher %s for policy definition %s does not exist", enforceContext.MType, ptype)
+	}
+	if _, ok := e.model["e"][enforceContext.EType]; !ok {
+		enforceContext.EType = "e"
+	}
+	if _, ok := e.model["r"][enforceContext.RType]; !ok {
+		enforceContext.RType = "r"
+	}
+
+	return e.enforce(context.Background(), "", nil, nil, append([]interface{}{enforceContext}, rvals...)...)
+}
+
+// MatchedRule is the policy rule that decided an enforcement, see EnforceExStructured.
+type MatchedRule struct {
+	// PType is the ptype of the rule, e.g. "p2".
+	PType string
+	// Tokens are the names of the fields in the definition of the ptype, in order, e.g. "sub", "obj", "act".
+	Tokens []string
+	// Values are the fields of the rule, in the order of Tokens, followed by its extra fields if any.
+	Values []string
+	// Effect is the effect of the rule, effector.Allow unless the ptype has an eft field.
+	Effect effector.Effect
+	// Index is the index of the rule in the policy of its ptype.
+	Index int
 }
 
 // EnforceEx explain enforcement by informing matched rules
 func (e *Enforcer) EnforceEx(rvals ...interface{}) (bool, []string, error) {
-	explain := []string{}
-	result, err := e.enforce("", &explain, rvals...)
-	return result, explain, err
+	explain := MatchedRule{Values: []string{}}
+	result, err := e.enforce(context.Background(), "", nil, &explain, rvals...)
+	return result, explain.Values, err
 }
 
 // EnforceExWithMatcher use a custom matcher and explain enforcement by informing matched rules
 func (e *Enforcer) EnforceExWithMatcher(matcher string, rvals ...interface{}) (bool, []string, error) {
-	explain := []string{}
-	result, err := e.enforce(matcher, &explain, rvals...)
-	return result, explain, err
+	explain := MatchedRule{Values: []string{}}
+	result, err := e.enforce(context.Background(), matcher, nil, &explain, rvals...)
+	return result, explain.Values, err
+}
+
+// EnforceExStructured explains enforcement like EnforceEx, but informs the matched rule along with its ptype,
+// the names of its fields and its effect, so that it can be rendered without knowing the model.
+// The matched rule is nil if no rule decided the enforcement.
+func (e *Enforcer) EnforceExStructured(rvals ...interface{}) (bool, *MatchedRule, error) {
+	return e.enforceExStructured(context.Background(), rvals...)
+}
+
+func (e *Enforcer) enforceExStructured(ctx context.Context, rvals ...interface{}) (bool, *MatchedRule, error) {
+	var explain MatchedRule
+	result, err := e.enforce(ctx, "", nil, &explain, rvals...)
+	if explain.Values == nil {
+		return result, nil, err
+	}
+
+	tokens := make([]string, len(explain.Tokens))
+	for i, token := range explain.Tokens {
+		tokens[i] = strings.TrimPrefix(token, explain.PType+"_")
+	}
+	explain.Tokens = tokens
+	explain.Values = deepCopyPolicy(explain.Values)
+	return result, &explain, err
 }
 
 // BatchEnforce enforce in batches
 func (e *Enforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 	var results []bool
 	for _, request := range requests {
-		result, err := e.enforce("", nil, request...)
+		result, err := e.enforce(context.Background(), "", nil, nil, request...)
 		if err != nil {
 			return results, err
 		}
@@ -754,7 +2046,7 @@ func (e *Enforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 func (e *Enforcer) BatchEnforceWithMatcher(matcher string, requests [][]interface{}) ([]bool, error) {
 	var results []bool
 	for _, request := range requests {
-		result, err := e.enforce(matcher, nil, request...)
+		result, err := e.enforce(context.Background(), matcher, nil, nil, request...)
 		if err != nil {
 			return results, err
 		}
@@ -763,6 +2055,24 @@ func (e *Enforcer) BatchEnforceWithMatcher(matcher string, requests [][]interfac
 	return results, nil
 }
 
+// GetMatchingPolicies returns all the policy rules whose matcher evaluates to true for the request,
+// regardless of the policy effect. Compared to EnforceEx(), which only reports the deciding rule,
+// this function reports every matched rule. Input parameters are the same as Enforce().
+func (e *Enforcer) GetMatchingPolicies(rvals ...interface{}) ([][]string, error) {
+	res := [][]string{}
+	ctx := context.WithValue(context.Background(), matchCollectorKey{}, func(rule []string) {
+		res = append(res, deepCopyPolicy(rule))
+	})
+	if _, err := e.enforce(ctx, "", nil, nil, rvals...); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// matchCollectorKey is the context key of the function an enforcement gives the matched rules to,
+// see GetMatchingPolicies.
+type matchCollectorKey struct{}
+
 // AddNamedMatchingFunc add MatchingFunc by ptype RoleManager
 func (e *Enforcer) AddNamedMatchingFunc(ptype, name string, fn rbac.MatchingFunc) bool {
 	if rm, ok := e.rmMap[ptype]; ok {
@@ -788,6 +2098,80 @@ type enforceParameters struct {
 
 	pTokens map[string]int
 	pVals   []string
+
+	// globals are the global parameters keyed by name without the "g_" prefix, see SetGlobalParameter.
+	globals map[string]interface{}
+	// ctx is the context of the call, the value of contextParameter.
+	ctx context.Context
+}
+
+// contextParameter is the parameter of the compiled matchers passing the context of the call
+// to the functions taking it, see passContextParameter.
+const contextParameter = "casbin_ctx"
+
+// enforceBuffer holds the allocations of a single enforce call, it is reused through enforceBufferPool.
+type enforceBuffer struct {
+	parameters     enforceParameters
+	policyEffects  []effector.Effect
+	matcherResults []float64
+}
+
+var enforceBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &enforceBuffer{
+			parameters: enforceParameters{
+				rTokens: make(map[string]int),
+				pTokens: make(map[string]int),
+			},
+		}
+	},
+}
+
+// getEnforceBuffer takes a buffer from the pool and fills its parameters with the given tokens and request values,
+// and the global parameters of the enforcer.
+func (e *Enforcer) getEnforceBuffer(rTokens []string, pTokens []string, rvals []interface{}) *enforceBuffer {
+	buffer := enforceBufferPool.Get().(*enforceBuffer)
+	buffer.parameters.globals = e.getGlobalParameters()
+	for i, token := range rTokens {
+		buffer.parameters.rTokens[token] = i
+	}
+	for i, token := range pTokens {
+		buffer.parameters.pTokens[token] = i
+	}
+	buffer.parameters.rVals = rvals
+	return buffer
+}
+
+// putEnforceBuffer resets the buffer and puts it back to the pool.
+// The request and policy values are dropped so that the pool does not keep them alive.
+func putEnforceBuffer(buffer *enforceBuffer) {
+	for token := range buffer.parameters.rTokens {
+		delete(buffer.parameters.rTokens, token)
+	}
+	for token := range buffer.parameters.pTokens {
+		delete(buffer.parameters.pTokens, token)
+	}
+	buffer.parameters.rVals = nil
+	buffer.parameters.pVals = nil
+	buffer.parameters.globals = nil
+	buffer.parameters.ctx = nil
+	enforceBufferPool.Put(buffer)
+}
+
+// results returns zeroed policy effect and matcher result slices of length n.
+func (b *enforceBuffer) results(n int) ([]effector.Effect, []float64) {
+	if cap(b.policyEffects) < n {
+		b.policyEffects = make([]effector.Effect, n)
+		b.matcherResults = make([]float64, n)
+	} else {
+		b.policyEffects = b.policyEffects[:n]
+		b.matcherResults = b.matcherResults[:n]
+		for i := range b.policyEffects {
+			b.policyEffects[i] = effector.Allow
+			b.matcherResults[i] = 0
+		}
+	}
+	return b.policyEffects, b.matcherResults
 }
 
 // implements govaluate.Parameters
@@ -809,7 +2193,18 @@ func (p enforceParameters) Get(name string) (interface{}, error) {
 			return nil, errors.New("No parameter '" + name + "' found.")
 		}
 		return p.rVals[i], nil
+	case 'g':
+		if value, ok := p.globals[strings.TrimPrefix(name, "g_")]; ok && strings.HasPrefix(name, "g_") {
+			return value, nil
+		}
+		return nil, errors.New("No parameter '" + name + "' found.")
 	default:
+		if name == contextParameter {
+			if p.ctx == nil {
+				return context.Background(), nil
+			}
+			return p.ctx, nil
+		}
 		return nil, errors.New("No parameter '" + name + "' found.")
 	}
 }
@@ -15,10 +15,13 @@
 package casbin
 
 import (
+	"bytes"
+	"context"
 	"hash/fnv"
-	"strings"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/casbin/casbin/v2/persist/cache"
 )
@@ -28,16 +31,71 @@ var shardPartitions = 32
 // CachedEnforcer wraps Enforcer and provides decision cache
 type CachedEnforcer struct {
 	*Enforcer
-	expireTime  uint
+	expireTime  time.Duration
 	cache       []cache.Cache
 	enableCache int32
-	locker      []*sync.RWMutex
+	locker      []*shardLocker
+	cacheBypass func(rvals ...interface{}) bool
+	// decisionLoader holds the decisionLoader tried for the cache misses before the enforcer, see SetDecisionLoader.
+	decisionLoader atomic.Value
+
+	// decisionCache caches the decisions of EnforceExStructured, see SetDecisionCache.
+	decisionCache  cache.ValueCache
+	decisionLocker sync.RWMutex
+
+	// inflight holds the evaluations of the cache misses in progress, keyed by cache key, see enforceOnce.
+	inflight       map[string]*inflightEnforce
+	inflightLocker sync.Mutex
+
+	// swapLocker is held for writing by SwapStandby and for reading by the evaluations, so that an evaluation
+	// sees either policy but not a mix of them and does not cache its decision after the swap.
+	swapLocker sync.RWMutex
+}
+
+// inflightEnforce is an evaluation of a cache miss the callers missing the same key wait for.
+type inflightEnforce struct {
+	done chan struct{}
+	res  bool
+	err  error
+}
+
+// EnforceDecision is a decision of CachedEnforcer.EnforceExStructured as stored in its decision cache.
+type EnforceDecision struct {
+	Result bool
+	// MatchedRule is the policy rule that decided the enforcement, nil if no rule did.
+	MatchedRule *MatchedRule
 }
 
 type CacheableParam interface {
 	GetCacheKey() string
 }
 
+// NoCache can be passed among the request values of CachedEnforcer.Enforce to evaluate the request
+// fresh, without reading or writing the cache, e.g. e.Enforce(casbin.NoCache{}, "alice", "data1", "read").
+// It is removed from the request values before they are enforced.
+type NoCache struct{}
+
+// stripNoCache returns rvals without the NoCache values and whether there were any.
+func stripNoCache(rvals []interface{}) ([]interface{}, bool) {
+	n := 0
+	for _, rval := range rvals {
+		if _, ok := rval.(NoCache); ok {
+			n++
+		}
+	}
+	if n == 0 {
+		return rvals, false
+	}
+
+	stripped := make([]interface{}, 0, len(rvals)-n)
+	for _, rval := range rvals {
+		if _, ok := rval.(NoCache); !ok {
+			stripped = append(stripped, rval)
+		}
+	}
+	return stripped, true
+}
+
 // NewCachedEnforcer creates a cached enforcer via file or DB.
 func NewCachedEnforcer(params ...interface{}) (*CachedEnforcer, error) {
 	e := &CachedEnforcer{}
@@ -48,48 +106,301 @@ func NewCachedEnforcer(params ...interface{}) (*CachedEnforcer, error) {
 	}
 
 	e.enableCache = 1
+	e.expireTime = 0
 	for i := 0; i < shardPartitions; i++ {
-		e.locker = append(e.locker, new(sync.RWMutex))
-		cache := cache.DefaultCache(make(map[string]bool))
-		e.cache = append(e.cache, &cache)
+		e.locker = append(e.locker, newShardLocker())
+		e.cache = append(e.cache, cache.NewTTLCache())
 	}
 	return e, nil
 }
 
 // EnableCache determines whether to enable cache on Enforce(). When enableCache is enabled, cached result (true | false) will be returned for previous decisions.
+// The decisions cached before the cache was disabled are deleted when it is enabled again, the policy may have changed meanwhile.
 func (e *CachedEnforcer) EnableCache(enableCache bool) {
 	var enabled int32
 	if enableCache {
 		enabled = 1
+		if atomic.LoadInt32(&e.enableCache) == 0 {
+			// nothing reads or writes the cache while it is disabled
+			_ = e.InvalidateCache()
+		}
 	}
 	atomic.StoreInt32(&e.enableCache, enabled)
 }
 
+// EnableCacheAndClear is like EnableCache() but also deletes the cached decisions right away,
+// e.g. to free their memory when disabling the cache.
+func (e *CachedEnforcer) EnableCacheAndClear(enableCache bool) error {
+	e.EnableCache(enableCache)
+	return e.InvalidateCache()
+}
+
+// ScopedToDomain returns a view of the enforcer scoped to the domain, whose requests use the cache like Enforce,
+// see Enforcer.ScopedToDomain.
+func (e *CachedEnforcer) ScopedToDomain(domain string) *DomainView {
+	return newDomainView(e, e.model, domain)
+}
+
+// SetCacheBypass sets a predicate of the request values, the requests it returns true for are always
+// evaluated fresh, without reading or writing the cache, e.g. the requests of a superuser.
+// It should be set before the enforcer is used concurrently, nil removes it.
+func (e *CachedEnforcer) SetCacheBypass(bypass func(rvals ...interface{}) bool) {
+	e.cacheBypass = bypass
+}
+
+// decisionLoader wraps the function set by SetDecisionLoader, an atomic.Value cannot hold nil.
+type decisionLoader struct {
+	fn func(key string) (res bool, found bool, err error)
+}
+
+// SetDecisionLoader sets the function the cache misses of Enforce and BatchEnforce are given to before they are
+// evaluated, e.g. to read the decisions of a cache shared by several processes. The loader returns the decision
+// and whether it found one for the cache key, a decision it found is cached like the evaluated ones and the request
+// is evaluated by the enforcer otherwise. When the loader fails, the request is evaluated by the enforcer too but
+// its decision is not cached, so that the next miss asks the loader again; the loader should report its errors itself.
+// It can be set or removed with nil at any time, the enforcements in progress use the loader they started with.
+func (e *CachedEnforcer) SetDecisionLoader(loader func(key string) (res bool, found bool, err error)) {
+	e.decisionLoader.Store(decisionLoader{fn: loader})
+}
+
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 // if rvals is not string , ingore the cache
+// if rvals contains NoCache, the cache is neither read nor written
+// if a context function of the matcher returns cache.DoNotCache, the decision is not cached
+// the decisions of the override set by SetDecisionOverride are neither read from nor written to the cache
 func (e *CachedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
-	if atomic.LoadInt32(&e.enableCache) == 0 {
-		return e.Enforcer.Enforce(rvals...)
+	rvals, noCache := stripNoCache(rvals)
+	if noCache || atomic.LoadInt32(&e.enableCache) == 0 || (e.cacheBypass != nil && e.cacheBypass(rvals...)) {
+		return e.enforceUncached(rvals)
 	}
 
 	key, ok := e.getKey(rvals...)
 	if !ok {
-		return e.Enforcer.Enforce(rvals...)
+		return e.enforceUncached(rvals)
 	}
 
 	if res, err := e.getCachedResult(key); err == nil {
-		return res, nil
+		return e.overrideCachedDecision(res, rvals), nil
 	} else if err != cache.ErrNoSuchKey {
 		return res, err
 	}
 
-	res, err := e.Enforcer.Enforce(rvals...)
+	return e.enforceOnce(key, rvals)
+}
+
+// BatchEnforce enforces the requests like Enforce, using the cache. The requests sharing a cache key, in the batch
+// or in batches and requests running concurrently, are evaluated once and share the decision.
+func (e *CachedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
+	var results []bool
+	decided := make(map[string]bool)
+	for _, request := range requests {
+		rvals, noCache := stripNoCache(request)
+		key, ok := "", false
+		if !noCache && atomic.LoadInt32(&e.enableCache) != 0 && (e.cacheBypass == nil || !e.cacheBypass(rvals...)) {
+			key, ok = e.getKey(rvals...)
+		}
+		if !ok {
+			result, err := e.enforceUncached(rvals)
+			if err != nil {
+				return results, err
+			}
+			results = append(results, result)
+			continue
+		}
+
+		result, seen := decided[key]
+		if !seen {
+			var err error
+			if result, err = e.getCachedResult(key); err == nil {
+				result = e.overrideCachedDecision(result, rvals)
+			} else if err == cache.ErrNoSuchKey {
+				result, err = e.enforceOnce(key, rvals)
+			}
+			if err != nil {
+				return results, err
+			}
+			decided[key] = result
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// enforceOnce evaluates a request that missed the cache and caches the decision. The callers missing the same key
+// meanwhile wait for the first one and share its decision instead of evaluating the request again.
+// The decision loader, if any, is tried before the request is evaluated.
+func (e *CachedEnforcer) enforceOnce(key string, rvals []interface{}) (bool, error) {
+	e.inflightLocker.Lock()
+	if call, ok := e.inflight[key]; ok {
+		e.inflightLocker.Unlock()
+		<-call.done
+		return call.res, call.err
+	}
+	call := &inflightEnforce{done: make(chan struct{})}
+	if e.inflight == nil {
+		e.inflight = make(map[string]*inflightEnforce)
+	}
+	e.inflight[key] = call
+	e.inflightLocker.Unlock()
+
+	defer func() {
+		e.inflightLocker.Lock()
+		delete(e.inflight, key)
+		e.inflightLocker.Unlock()
+		close(call.done)
+	}()
+
+	// an evaluation of the key may have finished between the cache miss and now.
+	if res, err := e.getCachedResult(key); err != cache.ErrNoSuchKey {
+		call.res, call.err = res, err
+		return res, err
+	}
+
+	// the decision is not cached if the policy changed while it was made, it may be the one of the previous policy.
+	e.swapLocker.RLock()
+	defer e.swapLocker.RUnlock()
+	generation := e.GetPolicyGeneration()
+
+	loaded := true
+	if loader, _ := e.decisionLoader.Load().(decisionLoader); loader.fn != nil {
+		res, found, err := loader.fn(key)
+		if err == nil && found {
+			call.res, call.err = res, e.setCachedResult(key, res, e.expireTime)
+			return call.res, call.err
+		}
+		// the local decision of a request the loader failed for may not be the shared one, it is not cached.
+		loaded = err == nil
+	}
+
+	ctx, cacheable := e.cacheabilityContext()
+	call.res, call.err = e.Enforcer.EnforceCtx(ctx, rvals...)
+	if call.err != nil {
+		return false, call.err
+	}
+	if !loaded || !cacheable() || e.GetPolicyGeneration() != generation {
+		return call.res, nil
+	}
+	call.err = e.setCachedResult(key, call.res, e.expireTime)
+	return call.res, call.err
+}
+
+// enforceUncached evaluates a request that does not use the cache.
+func (e *CachedEnforcer) enforceUncached(rvals []interface{}) (bool, error) {
+	e.swapLocker.RLock()
+	defer e.swapLocker.RUnlock()
+	return e.Enforcer.Enforce(rvals...)
+}
+
+// overrideCachedDecision returns the decision of the override set by SetDecisionOverride for a request found
+// in the cache, if it overrides the request, the cached decision otherwise. The requests missing the cache are
+// overridden by the enforcement, which does not let them be cached.
+func (e *CachedEnforcer) overrideCachedDecision(cached bool, rvals []interface{}) bool {
+	if res, overridden := e.overrideDecision("", rvals); overridden {
+		return res
+	}
+	return cached
+}
+
+// cacheabilityContext returns the context a request missing the cache is enforced with, in which the context
+// functions and the override can mark the decision as not cacheable with cache.DoNotCache,
+// and whether the decision can be cached.
+func (e *CachedEnforcer) cacheabilityContext() (context.Context, func() bool) {
+	return cache.WithCacheability(context.Background())
+}
+
+// EnforceExStructured explains enforcement like Enforcer.EnforceExStructured, the decisions are cached in the
+// decision cache along with their matched rule once it is set by SetDecisionCache.
+// The matched rule of a cached decision is shared by the callers and must not be modified.
+func (e *CachedEnforcer) EnforceExStructured(rvals ...interface{}) (bool, *MatchedRule, error) {
+	rvals, noCache := stripNoCache(rvals)
+	if noCache || atomic.LoadInt32(&e.enableCache) == 0 || (e.cacheBypass != nil && e.cacheBypass(rvals...)) {
+		e.swapLocker.RLock()
+		defer e.swapLocker.RUnlock()
+		return e.Enforcer.EnforceExStructured(rvals...)
+	}
+
+	key, ok := e.getKey(rvals...)
+	if !ok {
+		e.swapLocker.RLock()
+		defer e.swapLocker.RUnlock()
+		return e.Enforcer.EnforceExStructured(rvals...)
+	}
+
+	if decision, err := e.getCachedDecision(key); err == nil {
+		if res, overridden := e.overrideDecision("", rvals); overridden {
+			return res, nil, nil
+		}
+		return decision.Result, decision.MatchedRule, nil
+	} else if err != cache.ErrNoSuchKey {
+		return false, nil, err
+	}
+
+	e.swapLocker.RLock()
+	defer e.swapLocker.RUnlock()
+	generation := e.GetPolicyGeneration()
+	ctx, cacheable := e.cacheabilityContext()
+	res, rule, err := e.enforceExStructured(ctx, rvals...)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
+	if !cacheable() || e.GetPolicyGeneration() != generation {
+		return res, rule, nil
+	}
+
+	err = e.setCachedDecision(key, EnforceDecision{Result: res, MatchedRule: rule}, e.expireTime)
+	return res, rule, err
+}
 
-	err = e.setCachedResult(key, res, e.expireTime)
-	return res, err
+// SetDecisionCache sets the cache of the decisions of EnforceExStructured, which are not cached until it is set.
+// The decisions are stored as EnforceDecision values and are deleted along with the decisions of Enforce.
+func (e *CachedEnforcer) SetDecisionCache(c cache.ValueCache) {
+	e.decisionLocker.Lock()
+	defer e.decisionLocker.Unlock()
+	e.decisionCache = c
+}
+
+// getCachedDecision returns cache.ErrNoSuchKey if there's no decision cache.
+func (e *CachedEnforcer) getCachedDecision(key string) (EnforceDecision, error) {
+	e.decisionLocker.RLock()
+	defer e.decisionLocker.RUnlock()
+	if e.decisionCache == nil {
+		return EnforceDecision{}, cache.ErrNoSuchKey
+	}
+	decision, err := e.decisionCache.Get(key)
+	if err != nil {
+		return EnforceDecision{}, err
+	}
+	return decision.(EnforceDecision), nil
+}
+
+func (e *CachedEnforcer) setCachedDecision(key string, decision EnforceDecision, extra ...interface{}) error {
+	e.decisionLocker.Lock()
+	defer e.decisionLocker.Unlock()
+	if e.decisionCache == nil {
+		return nil
+	}
+	return e.decisionCache.Set(key, decision, extra...)
+}
+
+func (e *CachedEnforcer) deleteCachedDecision(key string) error {
+	e.decisionLocker.Lock()
+	defer e.decisionLocker.Unlock()
+	if e.decisionCache == nil {
+		return nil
+	}
+	if err := e.decisionCache.Delete(key); err != nil && err != cache.ErrNoSuchKey {
+		return err
+	}
+	return nil
+}
+
+func (e *CachedEnforcer) clearCachedDecisions() error {
+	e.decisionLocker.Lock()
+	defer e.decisionLocker.Unlock()
+	if e.decisionCache == nil {
+		return nil
+	}
+	return e.decisionCache.Clear()
 }
 
 func (e *CachedEnforcer) LoadPolicy() error {
@@ -99,10 +410,34 @@ func (e *CachedEnforcer) LoadPolicy() error {
 				return err
 			}
 		}
+		if err := e.clearCachedDecisions(); err != nil {
+			return err
+		}
 	}
 	return e.Enforcer.LoadPolicy()
 }
 
+// SwapStandby replaces the policy in use with the one loaded by LoadPolicyIntoStandby and deletes the cached
+// decisions, no decision of the previous policy is served from the cache once it returns.
+// It waits for the evaluations in progress to end, so that none of them caches a decision of the previous policy.
+func (e *CachedEnforcer) SwapStandby() error {
+	e.swapLocker.Lock()
+	defer e.swapLocker.Unlock()
+	for i := 0; i < shardPartitions; i++ {
+		e.locker[i].Lock()
+		defer e.locker[i].Unlock()
+	}
+	if err := e.Enforcer.SwapStandby(); err != nil {
+		return err
+	}
+	for i := 0; i < shardPartitions; i++ {
+		if err := e.cache[i].Clear(); err != nil {
+			return err
+		}
+	}
+	return e.clearCachedDecisions()
+}
+
 func getShardIdx(s string) int {
 	h := fnv.New32a()
 	if _, err := h.Write([]byte(s)); err != nil {
@@ -119,6 +454,9 @@ func (e *CachedEnforcer) RemovePolicy(params ...interface{}) (bool, error) {
 			if err := e.cache[idx].Delete(key); err != nil && err != cache.ErrNoSuchKey {
 				return false, err
 			}
+			if err := e.deleteCachedDecision(key); err != nil {
+				return false, err
+			}
 		}
 	}
 	return e.Enforcer.RemovePolicy(params...)
@@ -137,6 +475,9 @@ func (e *CachedEnforcer) RemovePolicies(rules [][]string) (bool, error) {
 				if err := e.cache[idx].Delete(key); err != nil && err != cache.ErrNoSuchKey {
 					return false, err
 				}
+				if err := e.deleteCachedDecision(key); err != nil {
+					return false, err
+				}
 			}
 		}
 	}
@@ -150,8 +491,32 @@ func (e *CachedEnforcer) getCachedResult(key string) (res bool, err error) {
 	return e.cache[idx].Get(key)
 }
 
+// SetExpireTime sets the survival time of the decisions cached from now on in seconds.
+// Deprecated: use SetCacheTTL.
 func (e *CachedEnforcer) SetExpireTime(expireTime uint) {
-	e.expireTime = expireTime
+	e.SetCacheTTL(time.Duration(expireTime) * time.Second)
+}
+
+// SetCacheTTL sets the survival time of the decisions cached from now on, it is passed to
+// cache.Cache.Set as the first extra parameter, a time.Duration, which the caches set by SetCache
+// must accept like the ones of the cache package do. A ttl of 0 or less keeps them until invalidated.
+func (e *CachedEnforcer) SetCacheTTL(ttl time.Duration) {
+	e.expireTime = ttl
+}
+
+// GetCachedDecision returns the cached decision for the cache key and how long it has left, for debugging.
+// The key of a request is returned by GetCacheKey.
+// The remaining time is 0 if the decision never expires or the cache does not implement cache.CacheWithTTL.
+// cache.ErrNoSuchKey is returned if there's no such decision cached.
+func (e *CachedEnforcer) GetCachedDecision(key string) (bool, time.Duration, error) {
+	idx := getShardIdx(key)
+	e.locker[idx].RLock()
+	defer e.locker[idx].RUnlock()
+	if c, ok := e.cache[idx].(cache.CacheWithTTL); ok {
+		return c.GetWithTTL(key)
+	}
+	res, err := e.cache[idx].Get(key)
+	return res, 0, err
 }
 
 func (e *CachedEnforcer) SetCache(key string, c cache.Cache) {
@@ -166,22 +531,63 @@ func (e *CachedEnforcer) setCachedResult(key string, res bool, extra ...interfac
 	return e.cache[idx].Set(key, res, extra...)
 }
 
+// keyBufferPool reuses the buffers getKey builds the cache keys in.
+var keyBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// GetCacheKey returns the key the decision for the request values is cached under, see GetCachedDecision.
+// It returns false if the request cannot be cached, e.g. because of a value that is not a string or
+// a CacheableParam.
+func (e *CachedEnforcer) GetCacheKey(params ...interface{}) (string, bool) {
+	return e.getKey(params...)
+}
+
+// getKey encodes the request values into the cache key. Every value is written behind a tag of its kind and
+// its length, e.g. "s5:alice", so that distinct requests never share a key, whatever bytes the values contain.
 func (e *CachedEnforcer) getKey(params ...interface{}) (string, bool) {
-	key := strings.Builder{}
+	key := keyBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		key.Reset()
+		keyBufferPool.Put(key)
+	}()
 	for _, param := range params {
 		switch typedParam := param.(type) {
 		case string:
-			key.WriteString(typedParam)
+			writeKeyPart(key, 's', typedParam)
 		case CacheableParam:
-			key.WriteString(typedParam.GetCacheKey())
+			writeKeyPart(key, 'c', typedParam.GetCacheKey())
+		case EnforceContext:
+			writeEnforceContextKey(key, typedParam)
+		case *EnforceContext:
+			if typedParam == nil {
+				return "", false
+			}
+			writeEnforceContextKey(key, *typedParam)
 		default:
 			return "", false
 		}
-		key.WriteString("$$")
 	}
 	return key.String(), true
 }
 
+// writeKeyPart writes the tag, the length of the value and the value.
+func writeKeyPart(key *bytes.Buffer, tag byte, value string) {
+	key.WriteByte(tag)
+	key.WriteString(strconv.Itoa(len(value)))
+	key.WriteByte(':')
+	key.WriteString(value)
+}
+
+// writeEnforceContextKey writes the definitions the context selects.
+func writeEnforceContextKey(key *bytes.Buffer, enforceContext EnforceContext) {
+	for _, ptype := range []string{enforceContext.RType, enforceContext.PType, enforceContext.EType, enforceContext.MType} {
+		writeKeyPart(key, 'x', ptype)
+	}
+}
+
 // InvalidateCache deletes all the existing cached decisions.
 func (e *CachedEnforcer) InvalidateCache() error {
 	for i := 0; i < shardPartitions; i++ {
@@ -191,5 +597,149 @@ func (e *CachedEnforcer) InvalidateCache() error {
 			return err
 		}
 	}
-	return nil
+	return e.clearCachedDecisions()
+}
+
+// SetGlobalParameter sets a value the matchers can use as g_name and deletes the cached decisions,
+// which may depend on the previous value.
+func (e *CachedEnforcer) SetGlobalParameter(name string, value interface{}) {
+	e.Enforcer.SetGlobalParameter(name, value)
+	_ = e.InvalidateCache()
+}
+
+// AddDefaultRole makes every subject have the role like Enforcer.AddDefaultRole and deletes the cached decisions,
+// which did not take the role into account.
+func (e *CachedEnforcer) AddDefaultRole(role string, domain ...string) {
+	e.Enforcer.AddDefaultRole(role, domain...)
+	_ = e.InvalidateCache()
+}
+
+// DeleteDefaultRole removes a role added by AddDefaultRole and deletes the cached decisions, which may depend on it.
+func (e *CachedEnforcer) DeleteDefaultRole(role string, domain ...string) {
+	e.Enforcer.DeleteDefaultRole(role, domain...)
+	_ = e.InvalidateCache()
+}
+
+// ShardStat reports the size and the lock contention of a single cache shard.
+type ShardStat struct {
+	// Size is the number of cached decisions, or -1 if the shard's cache cannot report it.
+	Size int
+	// Acquired is the number of times the shard lock has been taken.
+	Acquired uint64
+	// Contended is the number of acquisitions that could not take the lock right away and had to wait.
+	Contended uint64
+}
+
+// ShardStats returns the per-shard cache size and lock contention counters,
+// which helps deciding whether the number of shards is large enough for the workload.
+func (e *CachedEnforcer) ShardStats() []ShardStat {
+	stats := make([]ShardStat, shardPartitions)
+	for i := 0; i < shardPartitions; i++ {
+		stats[i].Acquired = atomic.LoadUint64(&e.locker[i].acquired)
+		stats[i].Contended = atomic.LoadUint64(&e.locker[i].contended)
+		stats[i].Size = -1
+		e.locker[i].RLock()
+		if c, ok := e.cache[i].(interface{ Len() int }); ok {
+			stats[i].Size = c.Len()
+		}
+		e.locker[i].RUnlock()
+	}
+	return stats
+}
+
+// shardLocker is a readers-writer lock that counts how often it is taken and how often it could not be taken
+// right away, because another holder was active or a writer was waiting.
+// Waiting writers block the new readers, so that the readers cannot starve them.
+type shardLocker struct {
+	// state is the number of readers holding the lock, -1 while a writer holds it.
+	state int32
+	// writers is the number of writers waiting for the lock, waiters the number of callers waiting on cond.
+	writers int32
+	waiters int32
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	acquired  uint64
+	contended uint64
+}
+
+func newShardLocker() *shardLocker {
+	l := &shardLocker{}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// TryLock takes the lock for writing if it is free, and reports whether it did.
+func (l *shardLocker) TryLock() bool {
+	if !atomic.CompareAndSwapInt32(&l.state, 0, -1) {
+		return false
+	}
+	atomic.AddUint64(&l.acquired, 1)
+	return true
+}
+
+// TryRLock takes the lock for reading if no writer holds it or waits for it, and reports whether it did.
+func (l *shardLocker) TryRLock() bool {
+	for {
+		state := atomic.LoadInt32(&l.state)
+		if state < 0 || atomic.LoadInt32(&l.writers) > 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&l.state, state, state+1) {
+			atomic.AddUint64(&l.acquired, 1)
+			return true
+		}
+	}
+}
+
+func (l *shardLocker) Lock() {
+	if l.TryLock() {
+		return
+	}
+	atomic.AddUint64(&l.contended, 1)
+	atomic.AddInt32(&l.writers, 1)
+	l.wait(l.TryLock)
+	atomic.AddInt32(&l.writers, -1)
+}
+
+func (l *shardLocker) Unlock() {
+	atomic.StoreInt32(&l.state, 0)
+	l.wake()
+}
+
+func (l *shardLocker) RLock() {
+	if l.TryRLock() {
+		return
+	}
+	atomic.AddUint64(&l.contended, 1)
+	l.wait(l.TryRLock)
+}
+
+func (l *shardLocker) RUnlock() {
+	if atomic.AddInt32(&l.state, -1) == 0 {
+		l.wake()
+	}
+}
+
+// wait waits until try takes the lock.
+func (l *shardLocker) wait(try func() bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// waiters is counted before trying, so that a release after the try sees it and wakes the caller up.
+	atomic.AddInt32(&l.waiters, 1)
+	defer atomic.AddInt32(&l.waiters, -1)
+	for !try() {
+		l.cond.Wait()
+	}
+}
+
+// wake wakes the waiting callers up after the lock was released.
+func (l *shardLocker) wake() {
+	if atomic.LoadInt32(&l.waiters) == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.cond.Broadcast()
+	l.mu.Unlock()
 }
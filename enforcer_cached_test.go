@@ -14,7 +14,20 @@
 
 package casbin
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist/cache"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+	"github.com/casbin/casbin/v2/util"
+)
 
 func testEnforceCache(t *testing.T, e *CachedEnforcer, sub string, obj interface{}, act string, res bool) {
 	t.Helper()
@@ -58,3 +71,669 @@ func TestCache(t *testing.T) {
 	testEnforceCache(t, e, "alice", "data2", "read", true)
 	testEnforceCache(t, e, "alice", "data2", "write", true)
 }
+
+func TestCacheShardStats(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = e.Enforce(fmt.Sprintf("user%d", j%10), "data1", "read")
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := e.ShardStats()
+	if len(stats) != shardPartitions {
+		t.Fatalf("got %d shard stats, supposed to be %d", len(stats), shardPartitions)
+	}
+
+	var size int
+	var acquired, contended uint64
+	for _, stat := range stats {
+		size += stat.Size
+		acquired += stat.Acquired
+		contended += stat.Contended
+	}
+	if size != 10 {
+		t.Errorf("cached decisions: %d, supposed to be 10", size)
+	}
+	if acquired < 800 {
+		t.Errorf("lock acquisitions: %d, supposed to be at least 800", acquired)
+	}
+	if contended > acquired {
+		t.Errorf("contended acquisitions %d should not exceed total acquisitions %d", contended, acquired)
+	}
+}
+
+func TestCacheShardContention(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	key, _ := e.getKey("alice", "data1", "read")
+	idx := getShardIdx(key)
+
+	// Hold the shard of the request, so that the enforcement has to wait for it.
+	e.locker[idx].Lock()
+	done := make(chan bool)
+	go func() {
+		res, _ := e.Enforce("alice", "data1", "read")
+		done <- res
+	}()
+	for atomic.LoadInt32(&e.locker[idx].waiters) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	e.locker[idx].Unlock()
+	if !<-done {
+		t.Error("alice, data1, read: false, supposed to be true")
+	}
+
+	stats := e.ShardStats()
+	if stats[idx].Contended != 1 {
+		t.Errorf("contended acquisitions of shard %d: %d, supposed to be 1", idx, stats[idx].Contended)
+	}
+	for i, stat := range stats {
+		if i != idx && stat.Contended != 0 {
+			t.Errorf("contended acquisitions of shard %d: %d, supposed to be 0", i, stat.Contended)
+		}
+	}
+
+	// A waiting writer blocks the new readers until it got the lock.
+	e.locker[idx].RLock()
+	go func() {
+		e.locker[idx].Lock()
+		e.locker[idx].Unlock()
+	}()
+	for atomic.LoadInt32(&e.locker[idx].writers) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if e.locker[idx].TryRLock() {
+		t.Error("a reader took the lock while a writer was waiting for it")
+	}
+	e.locker[idx].RUnlock()
+	e.locker[idx].RLock()
+	e.locker[idx].RUnlock()
+}
+
+// extraRecordingCache is a cache without TTL support that records the extra parameters of Set.
+type extraRecordingCache struct {
+	c     *cache.DefaultCache
+	extra []interface{}
+}
+
+func (c *extraRecordingCache) Set(key string, value bool, extra ...interface{}) error {
+	c.extra = extra
+	return c.c.Set(key, value, extra...)
+}
+
+func (c *extraRecordingCache) Get(key string) (bool, error) {
+	return c.c.Get(key)
+}
+
+func (c *extraRecordingCache) Delete(key string) error {
+	return c.c.Delete(key)
+}
+
+func (c *extraRecordingCache) Clear() error {
+	return c.c.Clear()
+}
+
+func TestCacheTTL(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	key, _ := e.GetCacheKey("alice", "data1", "read")
+
+	defaultCache := cache.DefaultCache(make(map[string]bool))
+	c := &extraRecordingCache{c: &defaultCache}
+	e.SetCache(key, c)
+
+	// SetExpireTime is SetCacheTTL in seconds, both pass a time.Duration.
+	e.SetExpireTime(5)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	if len(c.extra) != 1 || c.extra[0] != 5*time.Second {
+		t.Errorf("Set extra: %v, supposed to be [5s]", c.extra)
+	}
+	_ = e.InvalidateCache()
+	e.SetCacheTTL(time.Minute)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	if len(c.extra) != 1 || c.extra[0] != time.Minute {
+		t.Errorf("Set extra: %v, supposed to be [1m0s]", c.extra)
+	}
+	// A cache without TTL support reports 0 for the remaining time.
+	if res, ttl, err := e.GetCachedDecision(key); err != nil || !res || ttl != 0 {
+		t.Errorf("GetCachedDecision: %t, %s, %v, supposed to be true, 0s, <nil>", res, ttl, err)
+	}
+
+	e, _ = NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	if _, _, err := e.GetCachedDecision(key); err != cache.ErrNoSuchKey {
+		t.Errorf("GetCachedDecision error: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+	}
+
+	e.SetCacheTTL(time.Hour)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "alice", "data1", "write", false)
+	if res, ttl, err := e.GetCachedDecision(key); err != nil || !res || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetCachedDecision: %t, %s, %v, supposed to be true, at most 1h, <nil>", res, ttl, err)
+	}
+	if res, ttl, err := e.GetCachedDecision(cacheKey(e, "alice", "data1", "write")); err != nil || res || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetCachedDecision: %t, %s, %v, supposed to be false, at most 1h, <nil>", res, ttl, err)
+	}
+
+	e.SetCacheTTL(0)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	if res, ttl, err := e.GetCachedDecision(cacheKey(e, "bob", "data2", "write")); err != nil || !res || ttl != 0 {
+		t.Errorf("GetCachedDecision: %t, %s, %v, supposed to be true, 0s, <nil>", res, ttl, err)
+	}
+}
+
+func TestCacheNoCache(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	// A bypassed call neither reads nor writes the cache.
+	if res, err := e.Enforce(NoCache{}, "alice", "data1", "read"); err != nil || !res {
+		t.Errorf("bypassed call: %t, %v, supposed to be true, <nil>", res, err)
+	}
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testShardSize(t, e, 1)
+
+	// Change the policy behind the cache's back: cached calls keep the stale decision, bypassed calls don't.
+	e.GetModel().RemovePolicy("p", "p", []string{"alice", "data1", "read"})
+	if res, _ := e.Enforce(NoCache{}, "alice", "data1", "read"); res {
+		t.Error("bypassed call: true, supposed to be false")
+	}
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	if res, _ := e.Enforce("alice", NoCache{}, "data1", "read"); res {
+		t.Error("bypassed call: true, supposed to be false")
+	}
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testShardSize(t, e, 1)
+
+	// The sentinel is removed before an enforce context is looked for.
+	enforceContext := NewEnforceContext("")
+	if res, err := e.Enforce(NoCache{}, enforceContext, "bob", "data2", "write"); err != nil || !res {
+		t.Errorf("bypassed call with enforce context: %t, %v, supposed to be true, <nil>", res, err)
+	}
+
+	e.EnableCache(false)
+	if res, err := e.Enforce(NoCache{}, "bob", "data2", "write"); err != nil || !res {
+		t.Errorf("bypassed call with the cache disabled: %t, %v, supposed to be true, <nil>", res, err)
+	}
+	testShardSize(t, e, 1)
+}
+
+// cacheKey returns the cache key of the request, which must be cacheable.
+func cacheKey(e *CachedEnforcer, params ...interface{}) string {
+	key, _ := e.GetCacheKey(params...)
+	return key
+}
+
+type cacheKeyParam string
+
+func (p cacheKeyParam) GetCacheKey() string {
+	return string(p)
+}
+
+func TestCacheKeyCollisions(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	requests := [][]interface{}{
+		{"alice", "data1", "read"},
+		{"alice$$data1", "read"},
+		{"alice", "data1$$read"},
+		{"alice$$data1$$read"},
+		{"alice$$data1$$read", ""},
+		{"", "alice$$data1$$read"},
+		{"s5:alice", "data1", "read"},
+		{"alice", "s5:data1", "read"},
+		{"alice\x00", "data1", "read"},
+		{cacheKeyParam("alice"), "data1", "read"},
+		{EnforceContext{RType: "r", PType: "p", EType: "e", MType: "m"}, "alice", "data1", "read"},
+		{EnforceContext{RType: "r", PType: "p", EType: "e", MType: "m2"}, "alice", "data1", "read"},
+		{EnforceContext{RType: "r", PType: "p", EType: "e", MType: "m"}, "alice", "data1read"},
+		{"a", "b", "c", ""},
+		{"a", "b", "c"},
+	}
+	keys := map[string]int{}
+	for i, request := range requests {
+		key, ok := e.GetCacheKey(request...)
+		if !ok {
+			t.Fatalf("request %v should be cacheable", request)
+		}
+		if j, ok := keys[key]; ok {
+			t.Errorf("requests %v and %v share the cache key %q", requests[j], request, key)
+		}
+		keys[key] = i
+	}
+}
+
+func testShardSize(t *testing.T, e *CachedEnforcer, res int) {
+	t.Helper()
+	size := 0
+	for _, stat := range e.ShardStats() {
+		size += stat.Size
+	}
+	if size != res {
+		t.Errorf("cached decisions: %d, supposed to be %d", size, res)
+	}
+}
+
+func TestCacheBypass(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	_, _ = e.AddRoleForUser("root", "data2_admin")
+	e.SetCacheBypass(func(rvals ...interface{}) bool {
+		return len(rvals) > 0 && rvals[0] == "root"
+	})
+
+	testEnforceCache(t, e, "root", "data2", "read", true)
+	testEnforceCache(t, e, "root", "data2", "write", true)
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+	testShardSize(t, e, 1)
+
+	// Behind the cache's back, the bypassed subject sees the change right away, the others keep the cached decision.
+	e.GetModel().RemovePolicy("p", "p", []string{"data2_admin", "data2", "read"})
+	testEnforceCache(t, e, "root", "data2", "read", false)
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+	testShardSize(t, e, 1)
+
+	e.SetCacheBypass(nil)
+	testEnforceCache(t, e, "root", "data2", "write", true)
+	testShardSize(t, e, 2)
+}
+
+func TestCacheEnforceContext(t *testing.T) {
+	m, _ := model.NewModelFromString(twoMatchersModel)
+	e, _ := NewCachedEnforcer(m)
+	_, _ = e.AddPolicy("alice", "/data/*", "read")
+	keyMatchContext := NewEnforceContext("")
+	keyMatchContext.MType = "m2"
+
+	// The same request values are cached apart for each context, in any order.
+	for i := 0; i < 2; i++ {
+		testEnforceCache(t, e, "alice", "/data/1", "read", false)
+		if res, _ := e.Enforce(keyMatchContext, "alice", "/data/1", "read"); !res {
+			t.Error("alice, /data/1, read with m2: false, supposed to be true")
+		}
+		if res, _ := e.Enforce(&keyMatchContext, "alice", "/data/1", "read"); !res {
+			t.Error("alice, /data/1, read with *m2: false, supposed to be true")
+		}
+	}
+	testShardSize(t, e, 2)
+}
+
+func TestCacheSwapStandby(t *testing.T) {
+	a := stringadapter.NewAdapter("p, role1, data1, read\ng, alice, role1")
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", a)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+
+	a.Line = "p, role2, data2, read\ng, alice, role2"
+	if err := e.LoadPolicyIntoStandby(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+
+	// The cached decisions of the previous policy are deleted by the swap.
+	if err := e.SwapStandby(); err != nil {
+		t.Fatal(err)
+	}
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+}
+
+func TestCacheSwapStandbyConcurrent(t *testing.T) {
+	a := stringadapter.NewAdapter("p, role1, data1, read\ng, alice, role1")
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", a)
+	a.Line = "p, role2, data2, read\ng, alice, role2"
+	if err := e.LoadPolicyIntoStandby(); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, _ = e.Enforce("alice", "data1", "read")
+				_, _ = e.Enforce(NoCache{}, "alice", "data2", "read")
+			}
+		}()
+	}
+	if err := e.SwapStandby(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+
+	// No evaluation of the previous policy cached its decision after the swap.
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+	testEnforceCache(t, e, "alice", "data2", "read", true)
+}
+
+func TestCacheGenerationChange(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && change(r.sub)
+`)
+	e, _ := NewCachedEnforcer(m, stringadapter.NewAdapter("p, alice, data1, read"))
+	changes := 0
+	e.AddFunction("change", func(args ...interface{}) (interface{}, error) {
+		if changes > 0 {
+			changes--
+			e.bumpPolicyGeneration()
+		}
+		return true, nil
+	})
+
+	// The decision made while the policy changed is not cached, the next one is.
+	changes = 1
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testShardSize(t, e, 1)
+}
+
+func TestCacheReenable(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	testShardSize(t, e, 2)
+
+	// The policy changes while the cache is disabled, the decisions cached before are not served again.
+	e.EnableCache(false)
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+	testShardSize(t, e, 2)
+	e.EnableCache(true)
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+
+	// Enabling the enabled cache keeps the decisions.
+	e.EnableCache(true)
+	testShardSize(t, e, 2)
+
+	if err := e.EnableCacheAndClear(false); err != nil {
+		t.Fatal(err)
+	}
+	testShardSize(t, e, 0)
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	testShardSize(t, e, 0)
+}
+
+func testEnforceCacheStructured(t *testing.T, e *CachedEnforcer, sub string, obj string, act string, res bool, rule []string) {
+	t.Helper()
+	myRes, myRule, err := e.EnforceExStructured(sub, obj, act)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var myValues []string
+	if myRule != nil {
+		myValues = myRule.Values
+	}
+	if myRes != res || !util.ArrayEquals(myValues, rule) {
+		t.Errorf("%s, %s, %s: %t, %v, supposed to be %t, %v", sub, obj, act, myRes, myValues, res, rule)
+	}
+}
+
+func TestCacheDecisions(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	// Without a decision cache, the decisions are not cached.
+	testEnforceCacheStructured(t, e, "alice", "data2", "read", true, []string{"data2_admin", "data2", "read"})
+	_, _ = e.Enforcer.RemovePolicy("data2_admin", "data2", "read")
+	testEnforceCacheStructured(t, e, "alice", "data2", "read", false, nil)
+	_, _ = e.Enforcer.AddPolicy("data2_admin", "data2", "read")
+
+	c := cache.NewDefaultValueCache()
+	e.SetDecisionCache(c)
+	testEnforceCacheStructured(t, e, "alice", "data2", "read", true, []string{"data2_admin", "data2", "read"})
+	testEnforceCacheStructured(t, e, "bob", "data1", "read", false, nil)
+	decision, err := c.Get(cacheKey(e, "alice", "data2", "read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := decision.(EnforceDecision); !d.Result || d.MatchedRule == nil || d.MatchedRule.PType != "p" || !util.ArrayEquals(d.MatchedRule.Tokens, []string{"sub", "obj", "act"}) {
+		t.Errorf("cached decision: %+v, supposed to be true with the rule [data2_admin data2 read] of p", d)
+	}
+
+	// The cached decision is served until it is invalidated.
+	_, _ = e.Enforcer.RemovePolicy("data2_admin", "data2", "read")
+	testEnforceCacheStructured(t, e, "alice", "data2", "read", true, []string{"data2_admin", "data2", "read"})
+	if err := e.InvalidateCache(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("decision cache size: %d, supposed to be 0", c.Len())
+	}
+	testEnforceCacheStructured(t, e, "alice", "data2", "read", false, nil)
+
+	// The decisions of Enforce are still cached as bool values.
+	testEnforceCache(t, e, "bob", "data2", "write", true)
+	if res, _, err := e.GetCachedDecision(cacheKey(e, "bob", "data2", "write")); !res || err != nil {
+		t.Errorf("cached decision: %t, %v, supposed to be true", res, err)
+	}
+}
+
+func TestCacheBatchEnforceConcurrent(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = slowMatch(r.sub, r.obj, r.act)
+`)
+	e, _ := NewCachedEnforcer(m)
+
+	var mu sync.Mutex
+	evaluations := make(map[string]int)
+	e.AddFunction("slowMatch", func(args ...interface{}) (interface{}, error) {
+		mu.Lock()
+		evaluations[fmt.Sprint(args...)]++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return args[0] == "alice", nil
+	})
+
+	// The batches share the keys of alice and bob, alice twice in the first batch.
+	batches := [][][]interface{}{
+		{{"alice", "data1", "read"}, {"bob", "data1", "read"}, {"alice", "data1", "read"}, {"carol", "data1", "read"}},
+		{{"bob", "data1", "read"}, {"alice", "data1", "read"}, {"dave", "data1", "read"}},
+	}
+	expected := [][]bool{{true, false, true, false}, {false, true, false}}
+
+	var wg sync.WaitGroup
+	results := make([][]bool, len(batches))
+	errs := make([]error, len(batches))
+	for i := range batches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = e.BatchEnforce(batches[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range batches {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if fmt.Sprint(results[i]) != fmt.Sprint(expected[i]) {
+			t.Errorf("batch %d: %v, supposed to be %v", i, results[i], expected[i])
+		}
+	}
+	for key, n := range evaluations {
+		if n != 1 {
+			t.Errorf("%s evaluated %d times, supposed to be once", key, n)
+		}
+	}
+	if len(evaluations) != 4 {
+		t.Errorf("%d requests evaluated, supposed to be 4", len(evaluations))
+	}
+
+	// The batch decisions are cached.
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "dave", "data1", "read", false)
+	if len(evaluations) != 4 {
+		t.Errorf("%d requests evaluated, supposed to be 4", len(evaluations))
+	}
+}
+
+func TestCacheDoNotCache(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && workingHours(r.sub)
+`)
+	e, _ := NewCachedEnforcer(m, stringadapter.NewAdapter("p, alice, data1, read\np, bob, data2, write"))
+	e.SetDecisionCache(cache.NewDefaultValueCache())
+
+	hour := 10
+	e.AddContextFunction("workingHours", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		// bob works at any time, the decisions of the others depend on the time.
+		if args[0] == "bob" {
+			return true, nil
+		}
+		return cache.DoNotCache(ctx, hour < 18), nil
+	})
+
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCacheStructured(t, e, "alice", "data1", "read", true, []string{"alice", "data1", "read"})
+	if _, _, err := e.GetCachedDecision(cacheKey(e, "alice", "data1", "read")); err != cache.ErrNoSuchKey {
+		t.Errorf("cached decision error: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+	}
+	hour = 20
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+	testEnforceCacheStructured(t, e, "alice", "data1", "read", false, nil)
+	if res, err := e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"bob", "data2", "write"}}); err != nil || fmt.Sprint(res) != "[false true]" {
+		t.Errorf("BatchEnforce: %v, %v, supposed to be [false true]", res, err)
+	}
+	hour = 10
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+
+	// the decisions not marked are cached.
+	if res, _, err := e.GetCachedDecision(cacheKey(e, "bob", "data2", "write")); !res || err != nil {
+		t.Errorf("cached decision: %t, %v, supposed to be true", res, err)
+	}
+}
+
+func TestCacheDecisionLoader(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = localMatch(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewCachedEnforcer(m, stringadapter.NewAdapter("p, alice, data1, read\np, bob, data2, write"))
+
+	evaluations := 0
+	e.AddFunction("localMatch", func(args ...interface{}) (interface{}, error) {
+		evaluations++
+		return args[0] == args[1], nil
+	})
+
+	// the shared cache knows the decision of carol, which the local policy denies, and fails for dave.
+	loads := map[string]int{}
+	e.SetDecisionLoader(func(key string) (bool, bool, error) {
+		loads[key]++
+		switch key {
+		case cacheKey(e, "carol", "data1", "read"):
+			return true, true, nil
+		case cacheKey(e, "dave", "data1", "read"):
+			return false, false, errors.New("coordinator unavailable")
+		}
+		return false, false, nil
+	})
+
+	testEnforceCache(t, e, "carol", "data1", "read", true)
+	testEnforceCache(t, e, "carol", "data1", "read", true)
+	if evaluations != 0 || loads[cacheKey(e, "carol", "data1", "read")] != 1 {
+		t.Errorf("%d evaluations and %d loads, supposed to be 0 and 1", evaluations, loads[cacheKey(e, "carol", "data1", "read")])
+	}
+	if res, _, err := e.GetCachedDecision(cacheKey(e, "carol", "data1", "read")); !res || err != nil {
+		t.Errorf("cached decision: %t, %v, supposed to be true", res, err)
+	}
+
+	// the decisions the loader does not find are evaluated.
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	if evaluations == 0 || loads[cacheKey(e, "alice", "data1", "read")] != 1 {
+		t.Errorf("%d evaluations and %d loads, supposed to be evaluated once loaded", evaluations, loads[cacheKey(e, "alice", "data1", "read")])
+	}
+	if res, err := e.BatchEnforce([][]interface{}{{"carol", "data1", "read"}, {"bob", "data2", "write"}}); err != nil || fmt.Sprint(res) != "[true true]" {
+		t.Errorf("BatchEnforce: %v, %v, supposed to be [true true]", res, err)
+	}
+
+	// the requests the loader fails for are evaluated, but not cached so that the loader is asked again.
+	evaluations = 0
+	testEnforceCache(t, e, "dave", "data1", "read", false)
+	testEnforceCache(t, e, "dave", "data1", "read", false)
+	if evaluations == 0 || loads[cacheKey(e, "dave", "data1", "read")] != 2 {
+		t.Errorf("%d evaluations and %d loads, supposed to be evaluated and loaded twice", evaluations, loads[cacheKey(e, "dave", "data1", "read")])
+	}
+	if _, _, err := e.GetCachedDecision(cacheKey(e, "dave", "data1", "read")); err != cache.ErrNoSuchKey {
+		t.Errorf("cached decision: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+	}
+
+	e.SetDecisionLoader(nil)
+	evaluations = 0
+	testEnforceCache(t, e, "dave", "data1", "read", false)
+	if evaluations == 0 || loads[cacheKey(e, "dave", "data1", "read")] != 2 {
+		t.Error("the request should be evaluated without loader")
+	}
+	if res, _, err := e.GetCachedDecision(cacheKey(e, "dave", "data1", "read")); res || err != nil {
+		t.Errorf("cached decision: %t, %v, supposed to be false", res, err)
+	}
+}
+
+func TestCacheDecisionLoaderConcurrentSet(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.SetDecisionLoader(func(key string) (bool, bool, error) { return false, false, nil })
+			e.SetDecisionLoader(nil)
+		}()
+		go func(i int) {
+			defer wg.Done()
+			if _, err := e.Enforce(fmt.Sprintf("user%d", i), "data1", "read"); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -1,6 +1,8 @@
 package casbin
 
 import (
+	"fmt"
+
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 )
@@ -47,6 +49,9 @@ func (d *DistributedEnforcer) AddPoliciesSelf(shouldPersist func() bool, sec str
 	}
 
 	affected = d.model.AddPoliciesWithAffected(sec, ptype, rules)
+	if len(affected) != 0 {
+		d.bumpPolicyGeneration()
+	}
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, affected)
@@ -55,6 +60,10 @@ func (d *DistributedEnforcer) AddPoliciesSelf(shouldPersist func() bool, sec str
 		}
 	}
 
+	if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return affected, err
+	}
+
 	return affected, nil
 }
 
@@ -72,12 +81,18 @@ func (d *DistributedEnforcer) RemovePoliciesSelf(shouldPersist func() bool, sec
 	}
 
 	affected = d.model.RemovePoliciesWithAffected(sec, ptype, rules)
+	if len(affected) != 0 {
+		d.bumpPolicyGeneration()
+	}
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, affected)
 		if err != nil {
 			return affected, err
 		}
+		if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+			return affected, err
+		}
 	}
 
 	return affected, err
@@ -97,6 +112,9 @@ func (d *DistributedEnforcer) RemoveFilteredPolicySelf(shouldPersist func() bool
 	}
 
 	_, affected = d.model.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+	if len(affected) != 0 {
+		d.bumpPolicyGeneration()
+	}
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, affected)
@@ -105,6 +123,10 @@ func (d *DistributedEnforcer) RemoveFilteredPolicySelf(shouldPersist func() bool
 		}
 	}
 
+	if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return affected, err
+	}
+
 	return affected, nil
 }
 
@@ -120,6 +142,7 @@ func (d *DistributedEnforcer) ClearPolicySelf(shouldPersist func() bool) error {
 	}
 
 	d.model.ClearPolicy()
+	d.bumpPolicyGeneration()
 
 	return nil
 }
@@ -139,6 +162,7 @@ func (d *DistributedEnforcer) UpdatePolicySelf(shouldPersist func() bool, sec st
 	if !ruleUpdated {
 		return ruleUpdated, nil
 	}
+	d.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{oldRule}) // remove the old rule
@@ -151,6 +175,10 @@ func (d *DistributedEnforcer) UpdatePolicySelf(shouldPersist func() bool, sec st
 		}
 	}
 
+	if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return ruleUpdated, err
+	}
+
 	return ruleUpdated, nil
 }
 
@@ -169,6 +197,7 @@ func (d *DistributedEnforcer) UpdatePoliciesSelf(shouldPersist func() bool, sec
 	if !ruleUpdated {
 		return ruleUpdated, nil
 	}
+	d.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := d.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, oldRules) // remove the old rule
@@ -181,6 +210,10 @@ func (d *DistributedEnforcer) UpdatePoliciesSelf(shouldPersist func() bool, sec
 		}
 	}
 
+	if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return ruleUpdated, err
+	}
+
 	return ruleUpdated, nil
 }
 
@@ -201,6 +234,7 @@ func (d *DistributedEnforcer) UpdateFilteredPoliciesSelf(shouldPersist func() bo
 
 	ruleChanged := !d.model.RemovePolicies(sec, ptype, oldRules)
 	d.model.AddPolicies(sec, ptype, newRules)
+	d.bumpPolicyGeneration()
 	ruleChanged = ruleChanged && len(newRules) != 0
 	if !ruleChanged {
 		return ruleChanged, nil
@@ -217,5 +251,61 @@ func (d *DistributedEnforcer) UpdateFilteredPoliciesSelf(shouldPersist func() bo
 		}
 	}
 
+	if err := d.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return true, err
+	}
+
 	return true, nil
 }
+
+// SelfLoadPolicyFromRules provides a method for dispatcher to replace the whole current policy with the given rules,
+// which are keyed by ptype, e.g. "p", "p2", "g". The adapter, watcher and dispatcher are not involved,
+// so it can be used to restore a snapshot taken by GetPolicySnapshot. The role links are rebuilt from the new rules.
+func (d *DistributedEnforcer) SelfLoadPolicyFromRules(rules map[string][][]string) error {
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	newModel := d.model.Copy()
+	newModel.ClearPolicy()
+
+	for ptype, ptypeRules := range rules {
+		if ptype == "" {
+			return fmt.Errorf("invalid policy type: %q", ptype)
+		}
+		sec := ptype[:1]
+		if _, ok := newModel[sec][ptype]; !ok {
+			return fmt.Errorf("policy type %s is not defined in the model", ptype)
+		}
+		for _, rule := range ptypeRules {
+			ok, err := newModel.HasPolicyEx(sec, ptype, rule)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+			newModel.AddPolicy(sec, ptype, deepCopyPolicy(rule))
+		}
+	}
+
+	if err := newModel.SortPoliciesBySubjectHierarchy(); err != nil {
+		return err
+	}
+
+	if err := newModel.SortPoliciesByPriority(); err != nil {
+		return err
+	}
+
+	d.model = newModel
+	d.bumpPolicyGeneration()
+	// the role links of the replaced policy are stale whether or not they are built automatically
+	return d.Enforcer.BuildRoleLinks()
+}
+
+// GetPolicySnapshot returns a copy of all the current policy rules keyed by ptype,
+// in the form accepted by SelfLoadPolicyFromRules.
+func (d *DistributedEnforcer) GetPolicySnapshot() PolicySnapshot {
+	d.m.RLock()
+	defer d.m.RUnlock()
+	return d.Enforcer.GetPolicySnapshot()
+}
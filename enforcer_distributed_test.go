@@ -0,0 +1,102 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin/v2/util"
+)
+
+func TestDistributedPolicySnapshot(t *testing.T) {
+	src, _ := NewDistributedEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	dst, _ := NewDistributedEnforcer("examples/rbac_with_domains_model.conf")
+
+	snapshot := src.GetPolicySnapshot()
+	if err := dst.SelfLoadPolicyFromRules(snapshot); err != nil {
+		t.Fatalf("SelfLoadPolicyFromRules: %v", err)
+	}
+
+	if !util.Array2DEquals(src.GetPolicy(), dst.GetPolicy()) {
+		t.Errorf("policy %v supposed to be %v", dst.GetPolicy(), src.GetPolicy())
+	}
+	if !util.Array2DEquals(src.GetGroupingPolicy(), dst.GetGroupingPolicy()) {
+		t.Errorf("grouping policy %v supposed to be %v", dst.GetGroupingPolicy(), src.GetGroupingPolicy())
+	}
+
+	requests := [][]interface{}{
+		{"alice", "domain1", "data1", "read"},
+		{"alice", "domain1", "data1", "write"},
+		{"alice", "domain1", "data2", "read"},
+		{"bob", "domain2", "data2", "read"},
+		{"bob", "domain2", "data2", "write"},
+		{"bob", "domain1", "data1", "read"},
+	}
+	expected, _ := src.BatchEnforce(requests)
+	testBatchEnforce(t, dst.Enforcer, requests, expected)
+
+	// mutating the snapshot must not leak into the enforcers.
+	snapshot["p"][0][0] = "mallory"
+	if src.HasPolicy("mallory", "domain1", "data1", "read") || dst.HasPolicy("mallory", "domain1", "data1", "read") {
+		t.Errorf("snapshot should be a deep copy")
+	}
+
+	if err := dst.SelfLoadPolicyFromRules(map[string][][]string{"p5": {{"alice"}}}); err == nil {
+		t.Errorf("SelfLoadPolicyFromRules should fail for an undefined ptype")
+	}
+	testBatchEnforce(t, dst.Enforcer, requests, expected)
+}
+
+func TestDistributedSelfLoadPolicyFromRulesRoleLinks(t *testing.T) {
+	e, _ := NewDistributedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoBuildRoleLinks(false)
+
+	// alice loses data2_admin, bob gains it, the role links follow without the automatic build.
+	rules := map[string][][]string{
+		"p": {{"data2_admin", "data2", "read"}},
+		"g": {{"bob", "data2_admin"}},
+	}
+	if err := e.SelfLoadPolicyFromRules(rules); err != nil {
+		t.Fatalf("SelfLoadPolicyFromRules: %v", err)
+	}
+	testEnforce(t, e.Enforcer, "alice", "data2", "read", false)
+	testEnforce(t, e.Enforcer, "bob", "data2", "read", true)
+}
+
+func TestDistributedSelfLoadPolicyFromRulesConcurrentEnforce(t *testing.T) {
+	e, _ := NewDistributedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	snapshot := e.GetPolicySnapshot()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := e.SelfLoadPolicyFromRules(snapshot); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := e.Enforce("alice", "data2", "read"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	testEnforceSync(t, e.SyncedEnforcer, "alice", "data2", "read", true)
+}
@@ -15,6 +15,9 @@
 package casbin
 
 import (
+	"context"
+	"time"
+
 	"github.com/Knetic/govaluate"
 	"github.com/casbin/casbin/v2/effector"
 	"github.com/casbin/casbin/v2/model"
@@ -162,3 +165,169 @@ type IDistributedEnforcer interface {
 	UpdatePoliciesSelf(shouldPersist func() bool, sec string, ptype string, oldRules, newRules [][]string) (affected bool, err error)
 	UpdateFilteredPoliciesSelf(shouldPersist func() bool, sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) (bool, error)
 }
+
+var _ IPolicySnapshotEnforcer = &DistributedEnforcer{}
+
+// IPolicySnapshotEnforcer is implemented by the dispatcher enforcers that can take a snapshot of the policy
+// and restore it. It is kept out of IDistributedEnforcer so that the existing implementations still satisfy it.
+type IPolicySnapshotEnforcer interface {
+	IDistributedEnforcer
+	SelfLoadPolicyFromRules(rules map[string][][]string) error
+	GetPolicySnapshot() PolicySnapshot
+}
+
+// The interfaces below are implemented by the enforcers of this package next to IEnforcer. They are kept out of
+// IEnforcer so that the existing implementations of IEnforcer still satisfy it, callers type-assert an IEnforcer
+// to the ones they need.
+
+var _ IWatcherSyncEnforcer = &Enforcer{}
+var _ IWatcherSyncEnforcer = &SyncedEnforcer{}
+var _ IWatcherSyncEnforcer = &CachedEnforcer{}
+
+// IWatcherSyncEnforcer is the API interface of the synchronization of the enforcers through the watcher.
+type IWatcherSyncEnforcer interface {
+	SetWatcherCallbackRetry(attempts int, backoff time.Duration)
+	OnSyncFailure(fn func(err error))
+	IsPolicyStale() bool
+	GetSyncStatus() SyncStatus
+	SetWatcherDiffThreshold(maxRules int)
+	EnableNotifyWithoutAutoSave(enable bool)
+}
+
+var _ IStandbyEnforcer = &Enforcer{}
+var _ IStandbyEnforcer = &SyncedEnforcer{}
+var _ IStandbyEnforcer = &CachedEnforcer{}
+
+// IStandbyEnforcer is the API interface of loading the policy next to the active one and swapping them.
+type IStandbyEnforcer interface {
+	LoadPolicyIntoStandby() error
+	SwapStandby() error
+}
+
+var _ IPersistenceEnforcer = &Enforcer{}
+var _ IPersistenceEnforcer = &SyncedEnforcer{}
+var _ IPersistenceEnforcer = &CachedEnforcer{}
+
+// IPersistenceEnforcer is the API interface of how the changes of the policy are saved to the adapter.
+type IPersistenceEnforcer interface {
+	SetAutoSaveForPtype(sec string, ptype string, enabled bool)
+	SetSaveOrdering(ordering SaveOrdering)
+	SetDryRun(dryRun bool)
+	SetWriteCoalesceWindow(d time.Duration, onError func(error)) error
+	FlushWrites() error
+}
+
+var _ IPolicyLoadEnforcer = &Enforcer{}
+var _ IPolicyLoadEnforcer = &SyncedEnforcer{}
+var _ IPolicyLoadEnforcer = &CachedEnforcer{}
+
+// IPolicyLoadEnforcer is the API interface of the validation of the rules added to or loaded into the policy.
+type IPolicyLoadEnforcer interface {
+	SetLoadErrorHandler(fn func(line int, raw string, err error) (skip bool))
+	SetLoadProgressCallback(fn func(loaded int))
+	SetPolicyValidator(fn func(ptype string, rule []string) error)
+	SetPolicyValidationOnLoad(validation LoadValidation)
+	EnableEvalRuleValidation(enable bool)
+}
+
+var _ IEvaluationEnforcer = &Enforcer{}
+var _ IEvaluationEnforcer = &SyncedEnforcer{}
+var _ IEvaluationEnforcer = &CachedEnforcer{}
+
+// IEvaluationEnforcer is the API interface of how the requests are evaluated against the policy.
+type IEvaluationEnforcer interface {
+	SetRecoverFromPanic(recoverFromPanic bool)
+	SetStrictMatcherTypes(strict bool)
+	SetEvaluationErrorPolicy(policy EvaluationErrorPolicy)
+	SetEvaluationErrorHandler(fn func(ptype string, index int, rule []string, err error))
+	SetDecisionOverride(fn func(rvals []interface{}) (decision bool, overridden bool))
+	SetGlobalParameter(name string, value interface{})
+	AddFunctionAuto(name string, fn interface{}) error
+	AddContextFunction(name string, function model.ContextFunction)
+}
+
+var _ IQuotaEnforcer = &Enforcer{}
+var _ IQuotaEnforcer = &SyncedEnforcer{}
+var _ IQuotaEnforcer = &CachedEnforcer{}
+
+// IQuotaEnforcer is the API interface of the quotas of the enforcers.
+type IQuotaEnforcer interface {
+	SetQuotaStore(store QuotaStore)
+}
+
+var _ IRuleUsageEnforcer = &Enforcer{}
+var _ IRuleUsageEnforcer = &SyncedEnforcer{}
+var _ IRuleUsageEnforcer = &CachedEnforcer{}
+
+// IRuleUsageEnforcer is the API interface of the tracking of the rules used by the decisions.
+type IRuleUsageEnforcer interface {
+	EnableRuleUsageTracking(enable bool)
+	GetRuleUsage() map[string]uint64
+	ResetRuleUsage()
+	GetPolicyWithUsage() []RuleUsage
+	GetNamedPolicyWithUsage(ptype string) []RuleUsage
+}
+
+var _ IPolicyIndexEnforcer = &Enforcer{}
+var _ IPolicyIndexEnforcer = &SyncedEnforcer{}
+var _ IPolicyIndexEnforcer = &CachedEnforcer{}
+
+// IPolicyIndexEnforcer is the API interface of how the policy is kept in memory and which version of it is kept.
+type IPolicyIndexEnforcer interface {
+	EnableStringInterning(enable bool)
+	EnablePermissionIndex(enable bool)
+	BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error
+	RebuildRoleLinks() error
+	GetPolicyGeneration() uint64
+	GetPolicyHash() string
+}
+
+var _ IContextEnforcer = &Enforcer{}
+var _ IContextEnforcer = &SyncedEnforcer{}
+var _ IContextEnforcer = &CachedEnforcer{}
+
+// IContextEnforcer is the API interface of the enforcement with a context.
+type IContextEnforcer interface {
+	EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error)
+	EnforceStream(ctx context.Context, reqs <-chan []interface{}) <-chan EnforceResult
+}
+
+var _ IExplainEnforcer = &Enforcer{}
+var _ IExplainEnforcer = &SyncedEnforcer{}
+var _ IExplainEnforcer = &CachedEnforcer{}
+
+// IExplainEnforcer is the API interface of the enforcement that explains or partially evaluates the decisions.
+type IExplainEnforcer interface {
+	EnforceExStructured(rvals ...interface{}) (bool, *MatchedRule, error)
+	EnforceWithPartialEval(known map[string]interface{}) (residual string, err error)
+	GetFilteredPolicyByEvalSubject(attrs interface{}) ([][]string, error)
+}
+
+var _ IRBACExtEnforcer = &Enforcer{}
+var _ IRBACExtEnforcer = &SyncedEnforcer{}
+var _ IRBACExtEnforcer = &CachedEnforcer{}
+
+// IRBACExtEnforcer is the API interface of the RBAC API added next to the one of IEnforcer.
+type IRBACExtEnforcer interface {
+	/* RBAC API */
+	DeletePermissionsForUsers(users []string) (bool, error)
+	ExpandActionWildcards(perms [][]string, allActions []string) [][]string
+	GetPermittedActions(sub string, obj string, domain ...string) ([]string, error)
+	AddDefaultRole(role string, domain ...string)
+	DeleteDefaultRole(role string, domain ...string)
+	GetImplicitRolesForUserExcluding(name string, exclude []string, domain ...string) ([]string, error)
+	GetImplicitPermissionsForUserWithSource(user string, domain ...string) ([]PermissionWithSource, error)
+	GetPoliciesForSubject(sub string, domain ...string) (*SubjectPolicies, error)
+	DeleteUsers(users []string) (bool, error)
+
+	/* RBAC API with domains*/
+	GetImplicitUsersForRoleInDomain(role string, domain string) ([]string, error)
+	GetImplicitRolesForUserInDomain(user string, domain string) ([]string, error)
+	ScopedToDomain(domain string) *DomainView
+
+	/* Management API */
+	GetAllRolesDetailed(domain ...string) []RoleWithSource
+	HasRole(role string, domain ...string) bool
+	HasNamedRole(ptype string, role string, domain ...string) bool
+	AddGroupingPoliciesValidated(rules [][]string, opts GroupingImportOptions) (GroupingImportReport, error)
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/log"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// EnforcerPool holds an enforcer per tenant. The enforcers have their own policy and role managers
+// but share the model definition, the functions and the compiled matchers, whose role functions call
+// the ones of the tenant of the enforcement.
+type EnforcerPool struct {
+	model      model.Model
+	fm         model.FunctionMap
+	matcherMap *atomic.Value
+	newAdapter func(tenant string) persist.Adapter
+
+	mu        sync.Mutex
+	enforcers map[string]*Enforcer
+}
+
+// NewEnforcerPool creates a pool of tenant enforcers for the model, newAdapter returns the adapter of the policy
+// of a tenant, it may be nil for enforcers whose policy is only managed in memory.
+func NewEnforcerPool(m model.Model, newAdapter func(tenant string) persist.Adapter) *EnforcerPool {
+	p := &EnforcerPool{
+		model:      m.Copy(),
+		fm:         model.LoadFunctionMap(),
+		newAdapter: newAdapter,
+		enforcers:  map[string]*Enforcer{},
+	}
+	p.model.ClearPolicy()
+	p.model.SetLogger(&log.DefaultLogger{})
+	p.matcherMap = &atomic.Value{}
+	p.matcherMap.Store(&sync.Map{})
+	return p
+}
+
+// For returns the enforcer of the tenant. It is created on first use with the adapter of the tenant
+// and an empty policy, call its LoadPolicy() to load the policy of the tenant.
+func (p *EnforcerPool) For(tenant string) *Enforcer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.enforcers[tenant]; ok {
+		return e
+	}
+
+	e := &Enforcer{logger: &log.DefaultLogger{}}
+	if p.newAdapter != nil {
+		e.adapter = p.newAdapter(tenant)
+	}
+	e.model = p.model.Copy()
+	e.model.SetLogger(e.logger)
+	e.fm = p.fm
+	e.initialize()
+	// bind the role managers to the model for the enforcers whose policy is not loaded,
+	// an invalid role definition fails the same way on LoadPolicy().
+	_ = e.model.BuildRoleLinks(e.rmMap)
+	e.sharedMatcherMap = p.matcherMap
+	p.enforcers[tenant] = e
+	return e
+}
+
+// Remove removes the enforcer of the tenant from the pool, For then creates a new one.
+func (p *EnforcerPool) Remove(tenant string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.enforcers, tenant)
+}
+
+// AddFunction adds a customized function to the enforcers of every tenant, replacing the function
+// already added under the name. Functions added to an enforcer of the pool are added to every tenant too.
+func (p *EnforcerPool) AddFunction(name string, function govaluate.ExpressionFunction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fm.AddFunction(name, function)
+	p.matcherMap.Store(&sync.Map{})
+	for _, e := range p.enforcers {
+		e.invalidateMatcherMap()
+	}
+}
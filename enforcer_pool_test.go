@@ -0,0 +1,108 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+)
+
+func TestEnforcerPool(t *testing.T) {
+	m, _ := model.NewModelFromFile("examples/basic_model.conf")
+	policies := map[string]string{
+		"tenant1": "p, alice, data1, read",
+		"tenant2": "p, bob, data2, write",
+	}
+	pool := NewEnforcerPool(m, func(tenant string) persist.Adapter {
+		return stringadapter.NewAdapter(policies[tenant])
+	})
+
+	e1, e2 := pool.For("tenant1"), pool.For("tenant2")
+	if pool.For("tenant1") != e1 {
+		t.Error("For should return the same enforcer for a tenant")
+	}
+	for _, e := range []*Enforcer{e1, e2} {
+		if err := e.LoadPolicy(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The tenants have their own policy.
+	testEnforce(t, e1, "alice", "data1", "read", true)
+	testEnforce(t, e1, "bob", "data2", "write", false)
+	testEnforce(t, e2, "alice", "data1", "read", false)
+	testEnforce(t, e2, "bob", "data2", "write", true)
+	_, _ = e2.AddPolicy("alice", "data1", "read")
+	testEnforce(t, e2, "alice", "data1", "read", true)
+	testGetPolicy(t, e1, [][]string{{"alice", "data1", "read"}})
+
+	// They share the compiled matcher.
+	testSharedMatchers(t, pool, 1)
+
+	// Functions added to the pool are added to every tenant.
+	pool.AddFunction("isAdmin", func(args ...interface{}) (interface{}, error) { return true, nil })
+	if !e1.HasFunction("isAdmin") || !e2.HasFunction("isAdmin") {
+		t.Error("the function added to the pool should be added to every tenant")
+	}
+
+	pool.Remove("tenant1")
+	if pool.For("tenant1") == e1 {
+		t.Error("For should create a new enforcer for a removed tenant")
+	}
+}
+
+func TestEnforcerPoolWithRoles(t *testing.T) {
+	m, _ := model.NewModelFromFile("examples/rbac_model.conf")
+	pool := NewEnforcerPool(m, nil)
+
+	e1, e2 := pool.For("tenant1"), pool.For("tenant2")
+	_, _ = e1.AddPolicy("admin", "data1", "read")
+	_, _ = e1.AddRoleForUser("alice", "admin")
+	_, _ = e2.AddPolicy("admin", "data1", "read")
+
+	// The tenants have their own role managers, but share the compiled matcher.
+	testEnforce(t, e1, "alice", "data1", "read", true)
+	testEnforce(t, e2, "alice", "data1", "read", false)
+	testGetRoles(t, e2, []string{}, "alice")
+	testSharedMatchers(t, pool, 1)
+
+	// The settings of a tenant do not leak into the matchers of the others.
+	e1.SetStrictMatcherTypes(true)
+	if _, err := e1.Enforce("alice", 1, "read"); err == nil {
+		t.Error("tenant1 compares r.obj with p.obj using strict types")
+	}
+	if res, err := e2.Enforce("admin", 1, "read"); res || err != nil {
+		t.Errorf("tenant2: %t, %v, supposed to be false, <nil>", res, err)
+	}
+	testSharedMatchers(t, pool, 2)
+	testEnforce(t, e1, "alice", "data1", "read", true)
+	testEnforce(t, e2, "admin", "data1", "read", true)
+}
+
+func testSharedMatchers(t *testing.T, pool *EnforcerPool, res int) {
+	t.Helper()
+	count := 0
+	pool.matcherMap.Load().(*sync.Map).Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != res {
+		t.Errorf("%d shared compiled matchers, supposed to be %d", count, res)
+	}
+}
@@ -15,12 +15,14 @@
 package casbin
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/Knetic/govaluate"
 
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
 	"github.com/casbin/casbin/v2/rbac"
 	defaultrolemanager "github.com/casbin/casbin/v2/rbac/default-role-manager"
@@ -75,8 +77,8 @@ func (e *SyncedEnforcer) StartAutoLoadPolicy(d time.Duration) {
 		for {
 			select {
 			case <-ticker.C:
-				// error intentionally ignored
-				_ = e.LoadPolicy()
+				// a failure is recorded in the sync status, see IsPolicyStale
+				e.syncPolicy(e.LoadPolicy)
 				// Uncomment this line to see when the policy is loaded.
 				// log.Print("Load policy for time: ", n)
 				n++
@@ -101,6 +103,27 @@ func (e *SyncedEnforcer) SetWatcher(watcher persist.Watcher) error {
 	return e.Enforcer.SetWatcher(watcher)
 }
 
+// GetNamedRoleManager gets the role manager for the named grouping policy.
+func (e *SyncedEnforcer) GetNamedRoleManager(ptype string) rbac.RoleManager {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetNamedRoleManager(ptype)
+}
+
+// SetNamedRoleManager sets the role manager for the named grouping policy and rebuilds its role links.
+func (e *SyncedEnforcer) SetNamedRoleManager(ptype string, rm rbac.RoleManager) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetNamedRoleManager(ptype, rm)
+}
+
+// TrySetNamedRoleManager is SetNamedRoleManager returning an error if the role manager cannot be set.
+func (e *SyncedEnforcer) TrySetNamedRoleManager(ptype string, rm rbac.RoleManager) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.TrySetNamedRoleManager(ptype, rm)
+}
+
 // LoadModel reloads the model from the model CONF file.
 func (e *SyncedEnforcer) LoadModel() error {
 	e.m.Lock()
@@ -132,7 +155,7 @@ func (e *SyncedEnforcer) LoadPolicyFast() error {
 	newRmMap := map[string]rbac.RoleManager{}
 	var err error
 
-	if err = e.adapter.LoadPolicy(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
+	if err = e.loadPolicyWithProgress(newModel); err != nil && err.Error() != "invalid file path, file path cannot be empty" {
 		return err
 	}
 
@@ -159,9 +182,24 @@ func (e *SyncedEnforcer) LoadPolicyFast() error {
 	defer e.m.Unlock()
 	e.model = newModel
 	e.rmMap = newRmMap
+	e.bumpPolicyGeneration()
 	return nil
 }
 
+// LoadPolicyIntoStandby loads the policy from file/database next to the one in use, which keeps being enforced.
+func (e *SyncedEnforcer) LoadPolicyIntoStandby() error {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.LoadPolicyIntoStandby()
+}
+
+// SwapStandby replaces the policy in use with the one loaded by LoadPolicyIntoStandby.
+func (e *SyncedEnforcer) SwapStandby() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.SwapStandby()
+}
+
 // LoadFilteredPolicy reloads a filtered policy from file/database.
 func (e *SyncedEnforcer) LoadFilteredPolicy(filter interface{}) error {
 	e.m.Lock()
@@ -183,6 +221,13 @@ func (e *SyncedEnforcer) SavePolicy() error {
 	return e.Enforcer.SavePolicy()
 }
 
+// SaveFilteredPolicy saves the rules of the current policy that match the filter back to file/database.
+func (e *SyncedEnforcer) SaveFilteredPolicy(filter interface{}) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.SaveFilteredPolicy(filter)
+}
+
 // BuildRoleLinks manually rebuild the role inheritance relations.
 func (e *SyncedEnforcer) BuildRoleLinks() error {
 	e.m.Lock()
@@ -190,6 +235,34 @@ func (e *SyncedEnforcer) BuildRoleLinks() error {
 	return e.Enforcer.BuildRoleLinks()
 }
 
+// GetFilteredPolicyByEvalSubject returns the rules of "p" whose fields given to eval() are all true for the subject attrs.
+func (e *SyncedEnforcer) GetFilteredPolicyByEvalSubject(attrs interface{}) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetFilteredPolicyByEvalSubject(attrs)
+}
+
+// GetPolicyHash returns the hex-encoded SHA-256 of the rules of the policy, which does not depend on their order.
+func (e *SyncedEnforcer) GetPolicyHash() string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPolicyHash()
+}
+
+// BuildIncrementalRoleLinks provides incremental build the role inheritance relations.
+func (e *SyncedEnforcer) BuildIncrementalRoleLinks(op model.PolicyOp, ptype string, rules [][]string) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.BuildIncrementalRoleLinks(op, ptype, rules)
+}
+
+// RebuildRoleLinks rebuilds the role links of all the grouping ptypes from scratch.
+func (e *SyncedEnforcer) RebuildRoleLinks() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RebuildRoleLinks()
+}
+
 // Enforce decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (sub, obj, act).
 func (e *SyncedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 	e.m.RLock()
@@ -197,6 +270,20 @@ func (e *SyncedEnforcer) Enforce(rvals ...interface{}) (bool, error) {
 	return e.Enforcer.Enforce(rvals...)
 }
 
+// EnforceCtx decides whether a "subject" can access a "object" with the operation "action",
+// the context functions are given ctx.
+func (e *SyncedEnforcer) EnforceCtx(ctx context.Context, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceCtx(ctx, rvals...)
+}
+
+// EnforceStream decides the requests received from reqs with a pool of workers and sends the results as they are decided,
+// every request is decided under the read lock on its own, so that the policy can be modified in between.
+func (e *SyncedEnforcer) EnforceStream(ctx context.Context, reqs <-chan []interface{}) <-chan EnforceResult {
+	return enforceStream(ctx, reqs, e.EnforceCtx)
+}
+
 // EnforceWithMatcher use a custom matcher to decides whether a "subject" can access a "object" with the operation "action", input parameters are usually: (matcher, sub, obj, act), use model matcher by default when matcher is "".
 func (e *SyncedEnforcer) EnforceWithMatcher(matcher string, rvals ...interface{}) (bool, error) {
 	e.m.RLock()
@@ -204,6 +291,22 @@ func (e *SyncedEnforcer) EnforceWithMatcher(matcher string, rvals ...interface{}
 	return e.Enforcer.EnforceWithMatcher(matcher, rvals...)
 }
 
+// EnforceInScope decides whether a "subject" can access a "object" with the operation "action",
+// taking only the policy rules for which scope returns true into account.
+func (e *SyncedEnforcer) EnforceInScope(scope func(rule []string) bool, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceInScope(scope, rvals...)
+}
+
+// EnforceWithPtype decides whether a "subject" can access a "object" with the operation "action"
+// against the policy definition ptype and its correspondingly named matcher and effect.
+func (e *SyncedEnforcer) EnforceWithPtype(ptype string, rvals ...interface{}) (bool, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithPtype(ptype, rvals...)
+}
+
 // EnforceEx explain enforcement by informing matched rules
 func (e *SyncedEnforcer) EnforceEx(rvals ...interface{}) (bool, []string, error) {
 	e.m.RLock()
@@ -218,6 +321,27 @@ func (e *SyncedEnforcer) EnforceExWithMatcher(matcher string, rvals ...interface
 	return e.Enforcer.EnforceExWithMatcher(matcher, rvals...)
 }
 
+// EnforceExStructured explains enforcement by informing the matched rule along with its ptype and field names.
+func (e *SyncedEnforcer) EnforceExStructured(rvals ...interface{}) (bool, *MatchedRule, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceExStructured(rvals...)
+}
+
+// EnforceWithPartialEval evaluates the matcher with the known request values and returns the condition left on the unknown ones.
+func (e *SyncedEnforcer) EnforceWithPartialEval(known map[string]interface{}) (residual string, err error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceWithPartialEval(known)
+}
+
+// GetPolicySnapshot returns a copy of all the current policy rules keyed by ptype.
+func (e *SyncedEnforcer) GetPolicySnapshot() PolicySnapshot {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPolicySnapshot()
+}
+
 // BatchEnforce enforce in batches
 func (e *SyncedEnforcer) BatchEnforce(requests [][]interface{}) ([]bool, error) {
 	e.m.RLock()
@@ -232,6 +356,59 @@ func (e *SyncedEnforcer) BatchEnforceWithMatcher(matcher string, requests [][]in
 	return e.Enforcer.BatchEnforceWithMatcher(matcher, requests)
 }
 
+// GetMatchingPolicies returns all the policy rules whose matcher evaluates to true for the request.
+func (e *SyncedEnforcer) GetMatchingPolicies(rvals ...interface{}) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetMatchingPolicies(rvals...)
+}
+
+// EnforceDiagnose decides like Enforce and explains the decision clause by clause, see Enforcer.EnforceDiagnose.
+func (e *SyncedEnforcer) EnforceDiagnose(rvals ...interface{}) (bool, *Diagnosis, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.EnforceDiagnose(rvals...)
+}
+
+// SetWriteCoalesceWindow delays the adapter writes of single rule mutations for the window, see Enforcer.SetWriteCoalesceWindow.
+func (e *SyncedEnforcer) SetWriteCoalesceWindow(d time.Duration, onError func(error)) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	err := e.Enforcer.SetWriteCoalesceWindow(d, onError)
+	if e.writeCoalescer != nil {
+		e.writeCoalescer.locker = &e.m
+	}
+	return err
+}
+
+// FlushWrites sends the writes queued by SetWriteCoalesceWindow to the adapter now.
+func (e *SyncedEnforcer) FlushWrites() error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.FlushWrites()
+}
+
+// EnableStringInterning controls whether the identical field values of the policy rules share their storage.
+func (e *SyncedEnforcer) EnableStringInterning(enable bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.EnableStringInterning(enable)
+}
+
+// EnablePermissionIndex controls whether an index from the subjects of the rules to their rules is kept up to date.
+func (e *SyncedEnforcer) EnablePermissionIndex(enable bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.EnablePermissionIndex(enable)
+}
+
+// SetAutoSaveForPtype controls whether to save the rules of a ptype automatically to the adapter, see Enforcer.SetAutoSaveForPtype.
+func (e *SyncedEnforcer) SetAutoSaveForPtype(sec string, ptype string, enabled bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.SetAutoSaveForPtype(sec, ptype, enabled)
+}
+
 // GetAllSubjects gets the list of subjects that show up in the current policy.
 func (e *SyncedEnforcer) GetAllSubjects() []string {
 	e.m.RLock()
@@ -288,6 +465,27 @@ func (e *SyncedEnforcer) GetAllNamedRoles(ptype string) []string {
 	return e.Enforcer.GetAllNamedRoles(ptype)
 }
 
+// GetAllRolesDetailed gets the roles of g along with their source, including the pattern roles and the subjects of the p rules.
+func (e *SyncedEnforcer) GetAllRolesDetailed(domain ...string) []RoleWithSource {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllRolesDetailed(domain...)
+}
+
+// HasRole determines whether a user has the role of g, directly or through a pattern role.
+func (e *SyncedEnforcer) HasRole(role string, domain ...string) bool {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.HasRole(role, domain...)
+}
+
+// HasNamedRole determines whether a user has the role of the named role definition, directly or through a pattern role.
+func (e *SyncedEnforcer) HasNamedRole(ptype string, role string, domain ...string) bool {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.HasNamedRole(ptype, role, domain...)
+}
+
 // GetPolicy gets all the authorization rules in the policy.
 func (e *SyncedEnforcer) GetPolicy() [][]string {
 	e.m.RLock()
@@ -344,6 +542,20 @@ func (e *SyncedEnforcer) GetFilteredNamedGroupingPolicy(ptype string, fieldIndex
 	return e.Enforcer.GetFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
 }
 
+// GetFilteredGroupingPolicyMatched gets the role inheritance rules that would link for the given field values.
+func (e *SyncedEnforcer) GetFilteredGroupingPolicyMatched(fieldIndex int, fieldValues ...string) [][]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetFilteredGroupingPolicyMatched(fieldIndex, fieldValues...)
+}
+
+// GetFilteredNamedGroupingPolicyMatched gets the role inheritance rules that would link for the given field values.
+func (e *SyncedEnforcer) GetFilteredNamedGroupingPolicyMatched(ptype string, fieldIndex int, fieldValues ...string) [][]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetFilteredNamedGroupingPolicyMatched(ptype, fieldIndex, fieldValues...)
+}
+
 // HasPolicy determines whether an authorization rule exists.
 func (e *SyncedEnforcer) HasPolicy(params ...interface{}) bool {
 	e.m.RLock()
@@ -394,6 +606,34 @@ func (e *SyncedEnforcer) AddNamedPolicies(ptype string, rules [][]string) (bool,
 	return e.Enforcer.AddNamedPolicies(ptype, rules)
 }
 
+// GetPolicyMetadata returns the metadata fields of an authorization rule.
+func (e *SyncedEnforcer) GetPolicyMetadata(rule []string) map[string]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPolicyMetadata(rule)
+}
+
+// GetNamedPolicyMetadata returns the metadata fields of an authorization rule of the named policy.
+func (e *SyncedEnforcer) GetNamedPolicyMetadata(ptype string, rule []string) map[string]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetNamedPolicyMetadata(ptype, rule)
+}
+
+// AddPoliciesWithResult adds authorization rules to the current policy, skipping the ones that already exist.
+func (e *SyncedEnforcer) AddPoliciesWithResult(rules [][]string) (AddPoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddPoliciesWithResult(rules)
+}
+
+// AddNamedPoliciesWithResult adds authorization rules to the current named policy, skipping the ones that already exist.
+func (e *SyncedEnforcer) AddNamedPoliciesWithResult(ptype string, rules [][]string) (AddPoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddNamedPoliciesWithResult(ptype, rules)
+}
+
 // RemovePolicy removes an authorization rule from the current policy.
 func (e *SyncedEnforcer) RemovePolicy(params ...interface{}) (bool, error) {
 	e.m.Lock()
@@ -467,6 +707,34 @@ func (e *SyncedEnforcer) RemoveNamedPolicies(ptype string, rules [][]string) (bo
 	return e.Enforcer.RemoveNamedPolicies(ptype, rules)
 }
 
+// RemovePoliciesEx removes the authorization rules that are in the current policy and ignores the others.
+func (e *SyncedEnforcer) RemovePoliciesEx(rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemovePoliciesEx(rules)
+}
+
+// RemoveNamedPoliciesEx removes the authorization rules that are in the current named policy and ignores the others.
+func (e *SyncedEnforcer) RemoveNamedPoliciesEx(ptype string, rules [][]string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveNamedPoliciesEx(ptype, rules)
+}
+
+// RemovePoliciesWithResult removes authorization rules from the current policy, reporting the ones that do not exist.
+func (e *SyncedEnforcer) RemovePoliciesWithResult(rules [][]string) (RemovePoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemovePoliciesWithResult(rules)
+}
+
+// RemoveNamedPoliciesWithResult removes authorization rules from the current named policy, reporting the ones that do not exist.
+func (e *SyncedEnforcer) RemoveNamedPoliciesWithResult(ptype string, rules [][]string) (RemovePoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveNamedPoliciesWithResult(ptype, rules)
+}
+
 // RemoveFilteredNamedPolicy removes an authorization rule from the current named policy, field filters can be specified.
 func (e *SyncedEnforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int, fieldValues ...string) (bool, error) {
 	e.m.Lock()
@@ -524,6 +792,27 @@ func (e *SyncedEnforcer) AddNamedGroupingPolicies(ptype string, rules [][]string
 	return e.Enforcer.AddNamedGroupingPolicies(ptype, rules)
 }
 
+// AddGroupingPoliciesWithResult adds role inheritance rules to the current policy, skipping the ones that already exist.
+func (e *SyncedEnforcer) AddGroupingPoliciesWithResult(rules [][]string) (AddPoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddGroupingPoliciesWithResult(rules)
+}
+
+// AddGroupingPoliciesValidated adds role inheritance rules for importing a role hierarchy, see Enforcer.AddGroupingPoliciesValidated.
+func (e *SyncedEnforcer) AddGroupingPoliciesValidated(rules [][]string, opts GroupingImportOptions) (GroupingImportReport, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddGroupingPoliciesValidated(rules, opts)
+}
+
+// AddNamedGroupingPoliciesWithResult adds named role inheritance rules to the current policy, skipping the ones that already exist.
+func (e *SyncedEnforcer) AddNamedGroupingPoliciesWithResult(ptype string, rules [][]string) (AddPoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddNamedGroupingPoliciesWithResult(ptype, rules)
+}
+
 // RemoveGroupingPolicy removes a role inheritance rule from the current policy.
 func (e *SyncedEnforcer) RemoveGroupingPolicy(params ...interface{}) (bool, error) {
 	e.m.Lock()
@@ -559,6 +848,20 @@ func (e *SyncedEnforcer) RemoveNamedGroupingPolicies(ptype string, rules [][]str
 	return e.Enforcer.RemoveNamedGroupingPolicies(ptype, rules)
 }
 
+// RemoveGroupingPoliciesWithResult removes role inheritance rules from the current policy, reporting the ones that do not exist.
+func (e *SyncedEnforcer) RemoveGroupingPoliciesWithResult(rules [][]string) (RemovePoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveGroupingPoliciesWithResult(rules)
+}
+
+// RemoveNamedGroupingPoliciesWithResult removes role inheritance rules from the current named policy, reporting the ones that do not exist.
+func (e *SyncedEnforcer) RemoveNamedGroupingPoliciesWithResult(ptype string, rules [][]string) (RemovePoliciesResult, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.RemoveNamedGroupingPoliciesWithResult(ptype, rules)
+}
+
 func (e *SyncedEnforcer) UpdateGroupingPolicy(oldRule []string, newRule []string) (bool, error) {
 	e.m.Lock()
 	defer e.m.Unlock()
@@ -590,9 +893,59 @@ func (e *SyncedEnforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIn
 	return e.Enforcer.RemoveFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
 }
 
-// AddFunction adds a customized function.
+// AddFunction adds a customized function, it waits for the enforcements in progress to finish.
 func (e *SyncedEnforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.m.Lock()
 	defer e.m.Unlock()
 	e.Enforcer.AddFunction(name, function)
 }
+
+// AddContextFunction adds a customized function that is given the context of the enforcement,
+// it waits for the enforcements in progress to finish.
+func (e *SyncedEnforcer) AddContextFunction(name string, function model.ContextFunction) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.AddContextFunction(name, function)
+}
+
+// GetFunctionNames returns the sorted names of the functions the matchers can call.
+func (e *SyncedEnforcer) GetFunctionNames() []string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetFunctionNames()
+}
+
+// HasFunction returns whether the matchers can call the function.
+func (e *SyncedEnforcer) HasFunction(name string) bool {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.HasFunction(name)
+}
+
+// VerifyFunctions returns an error listing the functions the model requires that the matchers cannot call.
+func (e *SyncedEnforcer) VerifyFunctions() error {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.VerifyFunctions()
+}
+
+// AddFunctionAuto adds a customized function written as a plain Go func.
+func (e *SyncedEnforcer) AddFunctionAuto(name string, fn interface{}) error {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.AddFunctionAuto(name, fn)
+}
+
+// GetPolicyWithUsage returns the "p" rules with their usage, see Enforcer.GetNamedPolicyWithUsage.
+func (e *SyncedEnforcer) GetPolicyWithUsage() []RuleUsage {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPolicyWithUsage()
+}
+
+// GetNamedPolicyWithUsage returns the rules of the ptype with the number of times they matched and when they last did.
+func (e *SyncedEnforcer) GetNamedPolicyWithUsage(ptype string) []RuleUsage {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetNamedPolicyWithUsage(ptype)
+}
@@ -15,8 +15,13 @@
 package casbin
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
 )
 
 func testEnforceSync(t *testing.T, e *SyncedEnforcer, sub string, obj interface{}, act string, res bool) {
@@ -66,3 +71,120 @@ func TestStopAutoLoadPolicy(t *testing.T) {
 		t.Error("auto load is still running")
 	}
 }
+
+func TestSyncedAddFunction(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act || isAdmin(r.sub)
+`)
+	e, _ := NewSyncedEnforcer(m)
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	isAdmin := func(admin string) func(args ...interface{}) (interface{}, error) {
+		return func(args ...interface{}) (interface{}, error) {
+			return args[0].(string) == admin, nil
+		}
+	}
+	e.AddFunction("isAdmin", isAdmin(""))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if res, err := e.Enforce("alice", "data1", "read"); err != nil || !res {
+					t.Errorf("alice, data1, read: %t, %v, supposed to be true, <nil>", res, err)
+					return
+				}
+				_, _ = e.Enforce("bob", "data2", "write")
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		e.AddFunction("isAdmin", isAdmin(fmt.Sprintf("user%d", i)))
+	}
+	close(stop)
+	wg.Wait()
+
+	// The matcher is recompiled with the function added last.
+	testEnforceSync(t, e, "bob", "data2", "write", false)
+	testEnforceSync(t, e, "user99", "data2", "write", true)
+	e.AddFunction("isAdmin", isAdmin("bob"))
+	testEnforceSync(t, e, "bob", "data2", "write", true)
+	testEnforceSync(t, e, "user99", "data2", "write", false)
+}
+
+func TestSyncedSwapStandby(t *testing.T) {
+	generations := []string{
+		"p, role1, data1, read\ng, alice, role1",
+		"p, role2, data2, read\ng, alice, role2",
+	}
+	a := stringadapter.NewAdapter(generations[0])
+	e, _ := NewSyncedEnforcer("examples/rbac_model.conf", a)
+
+	if err := e.SwapStandby(); err == nil {
+		t.Error("SwapStandby without a standby policy should fail")
+	}
+
+	a.Line = generations[1]
+	if err := e.LoadPolicyIntoStandby(); err != nil {
+		t.Fatal(err)
+	}
+	// The standby policy is not enforced until it is swapped in.
+	testEnforceSync(t, e, "alice", "data1", "read", true)
+	testEnforceSync(t, e, "alice", "data2", "read", false)
+	if err := e.SwapStandby(); err != nil {
+		t.Fatal(err)
+	}
+	testEnforceSync(t, e, "alice", "data1", "read", false)
+	testEnforceSync(t, e, "alice", "data2", "read", true)
+
+	// Alice can read exactly one of data1 and data2 in every generation.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			requests := [][]interface{}{{"alice", "data1", "read"}, {"alice", "data2", "read"}}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				res, err := e.BatchEnforce(requests)
+				if err != nil || res[0] == res[1] {
+					t.Errorf("BatchEnforce: %v, %v, supposed to allow exactly one of data1 and data2", res, err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		a.Line = generations[i%2]
+		if err := e.LoadPolicyIntoStandby(); err != nil {
+			t.Error(err)
+		}
+		if err := e.SwapStandby(); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -15,11 +15,28 @@
 package casbin
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/effector"
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/log"
 	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
 	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	jsonadapter "github.com/casbin/casbin/v2/persist/json-adapter"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+	"github.com/casbin/casbin/v2/rbac"
+	defaultrolemanager "github.com/casbin/casbin/v2/rbac/default-role-manager"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -226,6 +243,115 @@ func TestMatcherUsingInOperatorBracket(t *testing.T) {
 	testEnforce(t, e, "anyone", "data3", "read", true)
 }
 
+func TestMatcherUsingNotIn(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.obj == p.obj && r.act == p.act && notIn(r.sub, "bob", "eve", "eve")
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("*", "data1", "read")
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "eve", "data1", "read", false)
+	testEnforce(t, e, "alice", "data1", "write", false)
+}
+
+func TestMatcherUsingTokenAliases(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub as subject, obj as resource, act
+
+[policy_definition]
+p = sub as subject, obj as resource, act as action
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.subject == p.sub && keyMatch(r.obj, p.resource) && r.act == p.action
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "/data/*", "read")
+
+	testEnforce(t, e, "alice", "/data/1", "read", true)
+	testEnforce(t, e, "alice", "/data/1", "write", false)
+	testEnforce(t, e, "bob", "/data/1", "read", false)
+	testGetPolicy(t, e, [][]string{{"alice", "/data/*", "read"}})
+}
+
+func TestGlobalParameters(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && (g_env != "prod" || g_maintenance == false)
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "data1", "write")
+
+	// an undefined global parameter fails like any unknown parameter.
+	if _, err := e.Enforce("alice", "data1", "write"); err == nil {
+		t.Error("Enforce should fail for an undefined global parameter")
+	}
+
+	e.SetGlobalParameter("env", "prod")
+	e.SetGlobalParameter("maintenance", false)
+	testEnforce(t, e, "alice", "data1", "write", true)
+	e.SetGlobalParameter("maintenance", true)
+	testEnforce(t, e, "alice", "data1", "write", false)
+	e.SetGlobalParameter("env", "dev")
+	testEnforce(t, e, "alice", "data1", "write", true)
+	testEnforce(t, e, "bob", "data1", "write", false)
+
+	// the values are swapped while enforcing, every enforcement sees either value.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			e.SetGlobalParameter("env", []string{"prod", "dev"}[i%2])
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			if _, err := e.Enforce("alice", "data1", "write"); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	wg.Wait()
+
+	ce, _ := NewCachedEnforcer(m)
+	_, _ = ce.AddPolicy("alice", "data1", "write")
+	ce.SetGlobalParameter("env", "prod")
+	ce.SetGlobalParameter("maintenance", false)
+	if res, _ := ce.Enforce("alice", "data1", "write"); !res {
+		t.Error("cached Enforce should allow alice before the maintenance")
+	}
+	ce.SetGlobalParameter("maintenance", true)
+	if res, _ := ce.Enforce("alice", "data1", "write"); res {
+		t.Error("cached Enforce should deny alice during the maintenance")
+	}
+}
+
 func TestReloadPolicy(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -239,6 +365,141 @@ func TestSavePolicy(t *testing.T) {
 	_ = e.SavePolicy()
 }
 
+const saveOrderingModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub, obj, act
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`
+
+// testSavePolicyGolden loads the policy lines, saves them with the file and the string adapters and compares
+// the saved policies with the golden file.
+func testSavePolicyGolden(t *testing.T, ordering SaveOrdering, lines string, golden string) {
+	t.Helper()
+	m, _ := model.NewModelFromString(saveOrderingModel)
+	e, err := NewEnforcer(m, stringadapter.NewAdapter(lines))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.SetSaveOrdering(ordering)
+
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	e.SetAdapter(fileadapter.NewAdapter(path))
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(saved)) != strings.TrimSpace(string(expected)) {
+		t.Errorf("file adapter saved:\n%s\nsupposed to be %s:\n%s", saved, golden, expected)
+	}
+
+	a := stringadapter.NewAdapter("")
+	e.SetAdapter(a)
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(a.Line) != strings.TrimSpace(string(expected)) {
+		t.Errorf("string adapter saved:\n%s\nsupposed to be %s:\n%s", a.Line, golden, expected)
+	}
+}
+
+func TestSaveOrdering(t *testing.T) {
+	// The ptypes are saved in order whatever order their rules were loaded in.
+	insertionGolden := "examples/save_ordering_insertion_golden.csv"
+	testSavePolicyGolden(t, SaveInsertionOrder, "p, alice, data1, read\ng, bob, admin\np2, carol, data2, write\n"+
+		"p, admin, data2, read\ng2, data1, group1\ng, carol, admin", insertionGolden)
+	testSavePolicyGolden(t, SaveInsertionOrder, "g2, data1, group1\ng, bob, admin\np2, carol, data2, write\n"+
+		"g, carol, admin\np, alice, data1, read\np, admin, data2, read", insertionGolden)
+
+	// The rules of a ptype are sorted with SaveSorted.
+	sortedGolden := "examples/save_ordering_sorted_golden.csv"
+	testSavePolicyGolden(t, SaveSorted, "p, alice, data1, read\ng, bob, admin\np2, carol, data2, write\n"+
+		"p, admin, data2, read\ng2, data1, group1\ng, carol, admin", sortedGolden)
+	testSavePolicyGolden(t, SaveSorted, "g, carol, admin\np, admin, data2, read\ng2, data1, group1\n"+
+		"p2, carol, data2, write\np, alice, data1, read\ng, bob, admin", sortedGolden)
+
+	// Sorting the saved copy leaves the order of the policy in memory alone.
+	m, _ := model.NewModelFromString(saveOrderingModel)
+	e, _ := NewEnforcer(m, stringadapter.NewAdapter("p, bob, data1, read\np, alice, data1, read"))
+	e.SetSaveOrdering(SaveSorted)
+	e.SetAdapter(stringadapter.NewAdapter(""))
+	_ = e.SavePolicy()
+	testGetPolicy(t, e, [][]string{{"bob", "data1", "read"}, {"alice", "data1", "read"}})
+}
+
+// progressAdapter reports the progress of loading its lines every two rules and once done.
+type progressAdapter struct {
+	*stringadapter.Adapter
+}
+
+func (a *progressAdapter) LoadPolicyWithProgress(m model.Model, progress func(loaded int)) error {
+	lines := strings.Split(a.Line, "\n")
+	for i, line := range lines {
+		if err := persist.LoadPolicyLine(strings.TrimSpace(line), m); err != nil {
+			return err
+		}
+		if (i+1)%2 == 0 || i == len(lines)-1 {
+			progress(i + 1)
+		}
+	}
+	return nil
+}
+
+func TestLoadProgressCallback(t *testing.T) {
+	a := &progressAdapter{stringadapter.NewAdapter("p, alice, data1, read\np, bob, data2, write\n" +
+		"p, data2_admin, data2, read\np, data2_admin, data2, write\ng, alice, data2_admin")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	var counts []int
+	e.SetLoadProgressCallback(func(loaded int) {
+		counts = append(counts, loaded)
+	})
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, []int{2, 4, 5}) {
+		t.Errorf("progress: %v, supposed to be [2 4 5]", counts)
+	}
+	testEnforce(t, e, "alice", "data2", "write", true)
+
+	// The standby policy reports its progress too.
+	counts = nil
+	if err := e.LoadPolicyIntoStandby(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(counts, []int{2, 4, 5}) {
+		t.Errorf("standby progress: %v, supposed to be [2 4 5]", counts)
+	}
+
+	// Nothing is reported once the callback is removed.
+	counts = nil
+	e.SetLoadProgressCallback(nil)
+	_ = e.LoadPolicy()
+	if len(counts) != 0 {
+		t.Errorf("progress without callback: %v", counts)
+	}
+}
+
 func TestClearPolicy(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -332,6 +593,85 @@ func TestEnableAutoSave(t *testing.T) {
 	testEnforce(t, e, "bob", "data2", "write", true)
 }
 
+func TestSetAutoSaveForPtype(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+	e.SetAutoSaveForPtype("g", "g", false)
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.AddGroupingPolicy("eve", "data2_admin")
+	_, _ = e.AddGroupingPolicies([][]string{{"frank", "data2_admin"}, {"grace", "data2_admin"}})
+	_, _ = e.RemoveGroupingPolicies([][]string{{"frank", "data2_admin"}})
+	_, _ = e.RemoveFilteredGroupingPolicy(0, "grace")
+	_, _ = e.RemovePolicies([][]string{{"eve", "data3", "read"}})
+	testAdapterCalls(t, e, a, []string{"AddPolicy p", "RemovePolicies p 1"})
+	testEnforce(t, e, "eve", "data2", "write", true)
+	if w.updates != 6 {
+		t.Errorf("watcher updates: %d, supposed to be 6", w.updates)
+	}
+
+	// The changes that are not saved are not sent to the watcher either.
+	e.EnableNotifyWithoutAutoSave(false)
+	_, _ = e.RemoveGroupingPolicy("eve", "data2_admin")
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	testAdapterCalls(t, e, a, []string{"AddPolicy p"})
+	if w.updates != 7 {
+		t.Errorf("watcher updates: %d, supposed to be 7", w.updates)
+	}
+
+	// The global setting applies to the other ptypes.
+	e.EnableAutoSave(false)
+	e.SetAutoSaveForPtype("g", "g", true)
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	_, _ = e.AddGroupingPolicy("eve", "data2_admin")
+	testAdapterCalls(t, e, a, []string{"AddPolicy g"})
+}
+
+func TestDryRun(t *testing.T) {
+	path := copyPolicyFile(t, "examples/rbac_policy.csv")
+	before, _ := ioutil.ReadFile(path)
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter(path)}
+	logger := &modelLogger{}
+	logger.EnableLog(true)
+	e, _ := NewEnforcer("examples/rbac_model.conf", a, logger)
+	e.SetDryRun(true)
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.AddGroupingPolicies([][]string{{"eve", "data2_admin"}, {"frank", "data2_admin"}})
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	_, _ = e.RemoveFilteredGroupingPolicy(0, "frank")
+	_, _ = e.UpdatePolicy([]string{"bob", "data2", "write"}, []string{"bob", "data2", "read"})
+	_, _ = e.UpdateFilteredPolicies([][]string{{"eve", "data4", "read"}}, 0, "eve")
+	if err := e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+
+	testAdapterCalls(t, e, a, nil)
+	if after, _ := ioutil.ReadFile(path); string(after) != string(before) {
+		t.Errorf("policy file: %s, supposed to be unchanged", after)
+	}
+	testGetPolicy(t, e, [][]string{{"bob", "data2", "read"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}, {"eve", "data4", "read"}})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}, {"eve", "data2_admin"}})
+	testEnforce(t, e, "eve", "data2", "write", true)
+
+	var logged []string
+	for _, row := range logger.rows {
+		if len(row) == 3 && strings.HasPrefix(row[2], "dry run, not saved: ") {
+			logged = append(logged, strings.Fields(strings.TrimPrefix(row[2], "dry run, not saved: "))[0])
+		}
+	}
+	res := []string{"AddPolicy", "AddPolicies", "RemovePolicy", "RemoveFilteredPolicy", "UpdatePolicy", "UpdateFilteredPolicies", "SavePolicy"}
+	if !util.ArrayEquals(logged, res) {
+		t.Errorf("logged calls: %v, supposed to be %v", logged, res)
+	}
+
+	e.SetDryRun(false)
+	_, _ = e.AddPolicy("grace", "data3", "read")
+	testAdapterCalls(t, e, a, []string{"AddPolicy p"})
+}
+
 func TestInitWithAdapter(t *testing.T) {
 	adapter := fileadapter.NewAdapter("examples/basic_policy.csv")
 	e, _ := NewEnforcer("examples/basic_model.conf", adapter)
@@ -346,6 +686,114 @@ func TestInitWithAdapter(t *testing.T) {
 	testEnforce(t, e, "bob", "data2", "write", true)
 }
 
+func TestRecoverFromPanic(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && buggyMatch(r.obj, p.obj) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	e.AddFunction("buggyMatch", func(args ...interface{}) (interface{}, error) {
+		var index []int
+		return args[0] == args[1] || index[1] == 0, nil
+	})
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	_, err := e.Enforce("alice", "data2", "read")
+	var panicErr *Err.ErrFunctionPanic
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Enforce should return an ErrFunctionPanic, got %v", err)
+	}
+	if panicErr.Name != "buggyMatch" {
+		t.Errorf("ErrFunctionPanic should name buggyMatch, got %s", panicErr.Name)
+	}
+
+	e.SetRecoverFromPanic(false)
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Enforce should panic when not recovering from panics")
+		}
+	}()
+	_, _ = e.Enforce("alice", "data2", "read")
+}
+
+func TestEvaluationErrorPolicy(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_model.conf")
+	// the first rule has an invalid regular expression.
+	_, _ = e.AddPolicies([][]string{{"alice", "/alice_data/*", "(GET"}, {"alice", "/alice_data/*", "GET"}})
+
+	if _, err := e.Enforce("alice", "/alice_data/resource1", "GET"); err == nil {
+		t.Error("Enforce should fail for the poisoned rule by default")
+	}
+
+	type report struct {
+		ptype string
+		index int
+		rule  []string
+	}
+	var reports []report
+	e.SetEvaluationErrorPolicy(EvaluationDenyAndReport)
+	e.SetEvaluationErrorHandler(func(ptype string, index int, rule []string, err error) {
+		if err == nil {
+			t.Error("the evaluation error handler should be given the error")
+		}
+		reports = append(reports, report{ptype, index, rule})
+	})
+	testEnforce(t, e, "alice", "/alice_data/resource1", "GET", true)
+	testEnforce(t, e, "alice", "/alice_data/resource1", "POST", false)
+	testGetMatchingPolicies(t, e, []interface{}{"alice", "/alice_data/resource1", "GET"}, [][]string{{"alice", "/alice_data/*", "GET"}})
+	if len(reports) != 3 || reports[0].ptype != "p" || reports[0].index != 0 || !util.ArrayEquals(reports[0].rule, []string{"alice", "/alice_data/*", "(GET"}) {
+		t.Errorf("reports: %v, supposed to be the rule 0 of p three times", reports)
+	}
+
+	// a malformed rule is reported too.
+	reports = nil
+	e.GetModel().AddPolicy("p", "p", []string{"alice"})
+	testEnforce(t, e, "alice", "/alice_data/resource1", "POST", false)
+	if len(reports) != 2 || reports[1].index != 2 {
+		t.Errorf("reports: %v, supposed to include the rule 2 of p", reports)
+	}
+
+	// the errors that do not depend on the rule still fail the enforcement.
+	if _, err := e.Enforce("alice", "/alice_data/resource1"); err == nil {
+		t.Error("Enforce should fail for a request with the wrong number of values")
+	}
+	if _, err := e.EnforceWithMatcher("r.sub == p.sub && unknownMatch(r.obj, p.obj)", "alice", "/alice_data/resource1", "GET"); err == nil {
+		t.Error("Enforce should fail for a matcher calling an unknown function")
+	}
+
+	// a poisoned rule denying the request denies it.
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, eft
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = r.sub == p.sub && regexMatch(r.obj, p.obj)
+`)
+	e, _ = NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{{"alice", "data.*", "allow"}, {"alice", "(data", "deny"}})
+	e.SetEvaluationErrorPolicy(EvaluationDenyAndReport)
+	testEnforce(t, e, "alice", "data1", "read", false)
+	_, _ = e.RemovePolicy("alice", "(data", "deny")
+	testEnforce(t, e, "alice", "data1", "read", true)
+}
+
 func TestRoleLinks(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf")
 	e.EnableAutoBuildRoleLinks(false)
@@ -479,6 +927,84 @@ func TestEnforceEx(t *testing.T) {
 	testEnforceEx(t, e, "alice", obj, "write", []string{})
 }
 
+func testEnforceExStructured(t *testing.T, e *Enforcer, rvals []interface{}, res *MatchedRule) {
+	t.Helper()
+	_, myRes, err := e.EnforceExStructured(rvals...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("%v: %+v, supposed to be %+v", rvals, myRes, res)
+	}
+}
+
+func TestEnforceExStructured(t *testing.T) {
+	e, _ := NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+	enforceContext := NewEnforceContext("2")
+	enforceContext.EType = "e"
+
+	testEnforceExStructured(t, e, []interface{}{"alice", "data2", "read"},
+		&MatchedRule{PType: "p", Tokens: []string{"sub", "obj", "act"}, Values: []string{"data2_admin", "data2", "read"}, Effect: effector.Allow, Index: 0})
+	testEnforceExStructured(t, e, []interface{}{enforceContext, struct{ Age int }{Age: 30}, "/data1", "read"},
+		&MatchedRule{PType: "p2", Tokens: []string{"sub_rule", "obj", "act", "eft"}, Values: []string{"r2.sub.Age > 18 && r2.sub.Age < 60", "/data1", "read", "allow"}, Effect: effector.Allow, Index: 0})
+	testEnforceExStructured(t, e, []interface{}{enforceContext, struct{ Age int }{Age: 70}, "/data1", "read"}, nil)
+	testEnforceExStructured(t, e, []interface{}{"bob", "data2", "read"}, nil)
+
+	// The denying rule decides the enforcement of a deny-override model.
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	testEnforceExStructured(t, e, []interface{}{"alice", "data2", "write"},
+		&MatchedRule{PType: "p", Tokens: []string{"sub", "obj", "act", "eft"}, Values: []string{"alice", "data2", "write", "deny"}, Effect: effector.Deny, Index: 4})
+}
+
+func TestEnforceShortCircuit(t *testing.T) {
+	newEnforcer := func(effect string) (*Enforcer, *int) {
+		m := model.NewModel()
+		m.AddDef("r", "r", "sub, obj, act")
+		m.AddDef("p", "p", "sub, obj, act, eft")
+		m.AddDef("e", "e", effect)
+		m.AddDef("m", "m", "counted(p.sub) && r.sub == p.sub && r.obj == p.obj && r.act == p.act")
+
+		e, _ := NewEnforcer(m)
+		calls := 0
+		e.AddFunction("counted", func(args ...interface{}) (interface{}, error) {
+			calls++
+			return true, nil
+		})
+		_, _ = e.AddPolicies([][]string{
+			{"alice", "data1", "read", "deny"},
+			{"alice", "data1", "read", "allow"},
+			{"bob", "data1", "read", "deny"},
+			{"bob", "data1", "read", "allow"},
+			{"alice", "data2", "read", "allow"},
+		})
+		return e, &calls
+	}
+
+	// allow-override only evaluates allow rules and stops at the first matched one.
+	e, calls := newEnforcer("some(where (p.eft == allow))")
+	testEnforceEx(t, e, "alice", "data1", "read", []string{"alice", "data1", "read", "allow"})
+	if *calls != 1 {
+		t.Errorf("Matcher calls: %d, supposed to be 1", *calls)
+	}
+	*calls = 0
+	testEnforceEx(t, e, "carol", "data1", "read", []string{})
+	if *calls != 3 {
+		t.Errorf("Matcher calls: %d, supposed to be 3", *calls)
+	}
+	testEnforce(t, e, "bob", "data1", "read", true)
+
+	// deny-override only evaluates deny rules and stops at the first matched one.
+	e, calls = newEnforcer("!some(where (p.eft == deny))")
+	testEnforceEx(t, e, "bob", "data1", "read", []string{"bob", "data1", "read", "deny"})
+	if *calls != 2 {
+		t.Errorf("Matcher calls: %d, supposed to be 2", *calls)
+	}
+	testEnforceEx(t, e, "alice", "data2", "read", []string{})
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "alice", "data1", "read", false)
+}
+
 func TestEnforceExLog(t *testing.T) {
 	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv", true)
 
@@ -531,6 +1057,40 @@ func TestSubjectPriorityWithDomain(t *testing.T) {
 	})
 }
 
+func TestSubjectPriorityWithRoleChanges(t *testing.T) {
+	e, _ := NewEnforcer("examples/subject_priority_model.conf")
+
+	_, _ = e.AddPolicy("employee", "data1", "read", "allow")
+	_, _ = e.AddPolicy("intern", "data1", "read", "deny")
+	_, _ = e.AddPolicy("staff", "data2", "read", "deny")
+	_, _ = e.AddPolicy("manager", "data2", "read", "allow")
+
+	_, _ = e.AddGroupingPolicy("alice", "intern")
+	_, _ = e.AddGroupingPolicy("intern", "employee")
+	_, _ = e.AddGroupingPolicy("bob", "manager")
+	_, _ = e.AddGroupingPolicy("manager", "staff")
+
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "read"},
+		{"intern", "data1", "read"},
+		{"employee", "data1", "read"},
+		{"bob", "data2", "read"},
+		{"manager", "data2", "read"},
+		{"staff", "data2", "read"},
+	}, []bool{
+		false, false, true, true, true, false,
+	})
+
+	// alice now inherits employee directly, the deny on intern no longer applies to her.
+	_, _ = e.RemoveGroupingPolicy("alice", "intern")
+	_, _ = e.AddGroupingPolicy("alice", "employee")
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	// an explicit rule on the user is deeper than any of its roles.
+	_, _ = e.AddPolicy("bob", "data2", "read", "deny")
+	testEnforce(t, e, "bob", "data2", "read", false)
+}
+
 func TestSubjectPriorityInFilter(t *testing.T) {
 	e, _ := NewEnforcer()
 
@@ -563,42 +1123,247 @@ func TestMultiplePolicyDefinitions(t *testing.T) {
 	})
 }
 
-func TestPriorityExplicit(t *testing.T) {
-	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "write"},
-		{"alice", "data1", "read"},
-		{"bob", "data2", "read"},
-		{"bob", "data2", "write"},
-		{"data1_deny_group", "data1", "read"},
-		{"data1_deny_group", "data1", "write"},
-		{"data2_allow_group", "data2", "read"},
-		{"data2_allow_group", "data2", "write"},
-	}, []bool{
-		true, true, false, true, false, false, true, true,
-	})
-
-	_, err := e.AddPolicy("1", "bob", "data2", "write", "deny")
-	if err != nil {
-		t.Fatalf("Add Policy: %v", err)
+func testEnforceWithPtype(t *testing.T, e *Enforcer, ptype string, sub interface{}, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.EnforceWithPtype(ptype, sub, obj, act); err != nil {
+		t.Errorf("EnforceWithPtype: %v", err)
+	} else if myRes != res {
+		t.Errorf("%s, %v, %s, %s: %t, supposed to be %t", ptype, sub, obj, act, myRes, res)
 	}
-
-	testBatchEnforce(t, e, [][]interface{}{
-		{"alice", "data1", "write"},
-		{"alice", "data1", "read"},
-		{"bob", "data2", "read"},
-		{"bob", "data2", "write"},
-		{"data1_deny_group", "data1", "read"},
-		{"data1_deny_group", "data1", "write"},
-		{"data2_allow_group", "data2", "read"},
-		{"data2_allow_group", "data2", "write"},
-	}, []bool{
-		true, true, false, false, false, false, true, true,
-	})
 }
 
-func TestFailedToLoadPolicy(t *testing.T) {
-	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
+func TestEnforceWithPtype(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub, obj, act, eft
+
+[policy_effect]
+e = some(where (p.eft == allow))
+e2 = some(where (p.eft == allow)) && !some(where (p.eft == deny))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+m2 = r.sub == p2.sub && keyMatch(r.obj, p2.obj) && r.act == p2.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "/data1", "read")
+	_, _ = e.AddNamedPolicy("p2", "alice", "/data*", "read", "allow")
+	_, _ = e.AddNamedPolicy("p2", "alice", "/data1", "read", "deny")
+	_, _ = e.AddNamedPolicy("p2", "bob", "/data*", "write", "allow")
+
+	testEnforceWithPtype(t, e, "p", "alice", "/data1", "read", true)
+	testEnforceWithPtype(t, e, "p", "alice", "/data2", "read", false)
+	testEnforceWithPtype(t, e, "p", "bob", "/data2", "write", false)
+	testEnforceWithPtype(t, e, "p2", "alice", "/data1", "read", false)
+	testEnforceWithPtype(t, e, "p2", "alice", "/data2", "read", true)
+	testEnforceWithPtype(t, e, "p2", "bob", "/data2", "write", true)
+
+	// The default ptype enforces like Enforce().
+	testEnforce(t, e, "alice", "/data1", "read", true)
+	testEnforce(t, e, "bob", "/data2", "write", false)
+
+	if _, err := e.EnforceWithPtype("p3", "alice", "/data1", "read"); err == nil {
+		t.Error("EnforceWithPtype should fail for a policy definition that does not exist")
+	}
+
+	// The request definition and the effect fall back to "r" and "e".
+	e, _ = NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+	testEnforceWithPtype(t, e, "p", "alice", "data2", "read", true)
+	testEnforceWithPtype(t, e, "p2", struct{ Age int }{Age: 70}, "/data1", "read", false)
+	testEnforceWithPtype(t, e, "p2", struct{ Age int }{Age: 30}, "/data1", "read", true)
+}
+
+func TestRequestConditionedEffect(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act, risk
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow)) && !some(where (p.eft == deny)) && (r.risk != 'high' || count(where (p.eft == allow)) >= 2)
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{
+		{"alice", "data1", "write", "allow"},
+		{"approver", "data1", "write", "allow"},
+		{"bob", "data1", "write", "allow"},
+		{"charlie", "data1", "write", "allow"},
+		{"charlie", "data1", "write", "deny"},
+	})
+	_, _ = e.AddGroupingPolicy("alice", "approver")
+
+	// A low-risk request needs a single allow, a high-risk one two of them.
+	for _, risk := range []string{"low", "high"} {
+		res, explain, err := e.EnforceEx("alice", "data1", "write", risk)
+		if err != nil || !res || !util.ArrayEquals(explain, []string{"alice", "data1", "write", "allow"}) {
+			t.Errorf("alice, %s risk: %t, %v, %v, supposed to be true", risk, res, explain, err)
+		}
+	}
+	testEnforceRequestRisk(t, e, "bob", "low", true)
+	testEnforceRequestRisk(t, e, "bob", "high", false)
+	testEnforceRequestRisk(t, e, "charlie", "low", false)
+	testEnforceRequestRisk(t, e, "charlie", "high", false)
+	testEnforceRequestRisk(t, e, "dave", "low", false)
+
+	// An effect that is neither built-in nor a condition on the matched rules is rejected.
+	m.AddDef("e", "e", "r.risk == 'low'")
+	if _, err := e.Enforce("bob", "data1", "write", "low"); err == nil || err.Error() != "unsupported effect" {
+		t.Errorf("Enforce error: %v, supposed to be unsupported effect", err)
+	}
+}
+
+func testEnforceRequestRisk(t *testing.T, e *Enforcer, sub string, risk string, res bool) {
+	t.Helper()
+	if myRes, err := e.Enforce(sub, "data1", "write", risk); err != nil || myRes != res {
+		t.Errorf("%s, %s risk: %t, %v, supposed to be %t", sub, risk, myRes, err, res)
+	}
+}
+
+const twoMatchersModel = `
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+m2 = r.sub == p.sub && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+func TestEnforceContextMatchers(t *testing.T) {
+	m, _ := model.NewModelFromString(twoMatchersModel)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "/data/*", "read")
+
+	keyMatchContext := NewEnforceContext("")
+	keyMatchContext.MType = "m2"
+
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "/data/1", "read"},
+		{keyMatchContext, "alice", "/data/1", "read"},
+		{&keyMatchContext, "alice", "/data/1", "read"},
+		{DefaultEnforceContext, "alice", "/data/1", "read"},
+		{DefaultEnforceContext, "alice", "/data/*", "read"},
+	}, []bool{false, true, true, false, true})
+
+	res, explain, err := e.EnforceEx(keyMatchContext, "alice", "/data/1", "read")
+	if err != nil || !res || !util.ArrayEquals(explain, []string{"alice", "/data/*", "read"}) {
+		t.Errorf("EnforceEx with m2: %t, %v, %v, supposed to be true, [alice /data/* read]", res, explain, err)
+	}
+	if res, explain, _ := e.EnforceEx("alice", "/data/1", "read"); res || len(explain) != 0 {
+		t.Errorf("EnforceEx with m: %t, %v, supposed to be false, []", res, explain)
+	}
+
+	testEnforceContextNotFound(t, e, NewEnforceContext("2"), "r", "r2")
+	missingMatcherContext := NewEnforceContext("")
+	missingMatcherContext.MType = "m3"
+	testEnforceContextNotFound(t, e, missingMatcherContext, "m", "m3")
+	missingEffectContext := NewEnforceContext("")
+	missingEffectContext.EType = "e2"
+	testEnforceContextNotFound(t, e, missingEffectContext, "e", "e2")
+
+	// The matcher of the context is not needed with a custom matcher.
+	if res, err := e.EnforceWithMatcher("r.sub == p.sub", missingMatcherContext, "alice", "/data/1", "read"); err != nil || !res {
+		t.Errorf("EnforceWithMatcher: %t, %v, supposed to be true, <nil>", res, err)
+	}
+}
+
+func testEnforceContextNotFound(t *testing.T, e *Enforcer, enforceContext EnforceContext, sec string, key string) {
+	t.Helper()
+	_, err := e.Enforce(enforceContext, "alice", "/data/1", "read")
+	var notFound *Err.ErrAssertionNotFound
+	if !errors.As(err, &notFound) || notFound.Sec != sec || notFound.Key != key {
+		t.Errorf("Enforce error: %v, supposed to be ErrAssertionNotFound for %s", err, key)
+	}
+}
+
+func TestEnforceConcurrentContexts(t *testing.T) {
+	e, _ := NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+	enforceContext := NewEnforceContext("2")
+	enforceContext.EType = "e"
+
+	requests := [][]interface{}{
+		{"alice", "data2", "read"},
+		{"alice", "data2", "write"},
+		{enforceContext, struct{ Age int }{Age: 70}, "/data1", "read"},
+		{enforceContext, struct{ Age int }{Age: 30}, "/data1", "read"},
+	}
+	results := []bool{true, false, false, true}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(offset int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				k := (offset + j) % len(requests)
+				res, err := e.Enforce(requests[k]...)
+				if err != nil {
+					t.Errorf("Enforce Error: %s", err)
+					return
+				}
+				if res != results[k] {
+					t.Errorf("%v: %t, supposed to be %t", requests[k], res, results[k])
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestPriorityExplicit(t *testing.T) {
+	e, _ := NewEnforcer("examples/priority_model_explicit.conf", "examples/priority_policy_explicit.csv")
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "write"},
+		{"alice", "data1", "read"},
+		{"bob", "data2", "read"},
+		{"bob", "data2", "write"},
+		{"data1_deny_group", "data1", "read"},
+		{"data1_deny_group", "data1", "write"},
+		{"data2_allow_group", "data2", "read"},
+		{"data2_allow_group", "data2", "write"},
+	}, []bool{
+		true, true, false, true, false, false, true, true,
+	})
+
+	_, err := e.AddPolicy("1", "bob", "data2", "write", "deny")
+	if err != nil {
+		t.Fatalf("Add Policy: %v", err)
+	}
+
+	testBatchEnforce(t, e, [][]interface{}{
+		{"alice", "data1", "write"},
+		{"alice", "data1", "read"},
+		{"bob", "data2", "read"},
+		{"bob", "data2", "write"},
+		{"data1_deny_group", "data1", "read"},
+		{"data1_deny_group", "data1", "write"},
+		{"data2_allow_group", "data2", "read"},
+		{"data2_allow_group", "data2", "write"},
+	}, []bool{
+		true, true, false, false, false, false, true, true,
+	})
+}
+
+func TestFailedToLoadPolicy(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
 	e.AddNamedMatchingFunc("g2", "matchingFunc", util.KeyMatch2)
 	testEnforce(t, e, "alice", "/book/1", "GET", true)
 	testEnforce(t, e, "bob", "/pen/3", "GET", true)
@@ -624,3 +1389,676 @@ func TestEvalPriority(t *testing.T) {
 	testEnforce(t, e, "admin", "none", "write", false)
 	testEnforce(t, e, "user", "users", "write", false)
 }
+
+func TestNewEnforcerFromCombinedFile(t *testing.T) {
+	e, err := NewEnforcerFromCombinedFile("examples/basic_model_and_policy.conf")
+	if err != nil {
+		t.Fatalf("NewEnforcerFromCombinedFile: %v", err)
+	}
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	if _, err = NewEnforcerFromCombinedFile("examples/basic_model.conf"); err == nil {
+		t.Errorf("NewEnforcerFromCombinedFile should fail without a [policy] block")
+	}
+}
+
+func TestCombinedFileChanges(t *testing.T) {
+	e, err := NewEnforcerFromCombinedFile("examples/basic_model_and_policy.conf")
+	if err != nil {
+		t.Fatalf("NewEnforcerFromCombinedFile: %v", err)
+	}
+
+	// the auto-saved changes are kept by the in-memory adapter.
+	if _, err = e.AddPolicy("carol", "data3", "read"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+	if _, err = e.RemovePolicy("bob", "data2", "write"); err != nil {
+		t.Fatalf("RemovePolicy: %v", err)
+	}
+	if _, err = e.DeleteRoleForUser("alice", "data2_admin"); err != nil {
+		t.Fatalf("DeleteRoleForUser: %v", err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	testEnforce(t, e, "carol", "data3", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", false)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	// so are the changes saved as a whole.
+	e.EnableAutoSave(false)
+	if _, err = e.AddPolicy("dave", "data4", "read"); err != nil {
+		t.Fatalf("AddPolicy: %v", err)
+	}
+	if err = e.SavePolicy(); err != nil {
+		t.Fatalf("SavePolicy: %v", err)
+	}
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatalf("LoadPolicy: %v", err)
+	}
+	testEnforce(t, e, "dave", "data4", "read", true)
+	testEnforce(t, e, "carol", "data3", "read", true)
+
+	// and the file is left as it was.
+	e, err = NewEnforcerFromCombinedFile("examples/basic_model_and_policy.conf")
+	if err != nil {
+		t.Fatalf("NewEnforcerFromCombinedFile: %v", err)
+	}
+	testEnforce(t, e, "carol", "data3", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+}
+
+func TestJSONAdapter(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", jsonadapter.NewAdapter("examples/rbac_policy.json"))
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+
+	// The fields that CSV cannot hold without quoting survive the round trip.
+	path := filepath.Join(t.TempDir(), "policy.json")
+	e.SetAdapter(jsonadapter.NewAdapter(path))
+	_, _ = e.AddPolicy("carol", "data3, data4", "read")
+	_, _ = e.AddPolicy("dave", "line1\nline2", "\"write\"")
+	if err := e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", jsonadapter.NewAdapter(path))
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"carol", "data3, data4", "read"},
+		{"dave", "line1\nline2", "\"write\""}})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}})
+	testEnforce(t, e, "carol", "data3, data4", "read", true)
+	testEnforce(t, e, "carol", "data3", "read", false)
+
+	if err := ioutil.WriteFile(path, []byte(`[{"ptype": "x", "rule": ["alice"]}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.LoadPolicy(); err == nil {
+		t.Error("LoadPolicy should fail for a rule with an invalid ptype")
+	}
+}
+
+func TestEnforceCtx(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && remoteCheck(r.sub)
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+
+	calls := 0
+	e.AddContextFunction("remoteCheck", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		calls++
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Millisecond):
+			return args[0].(string) != "bob", nil
+		}
+	})
+	if !e.HasFunction("remoteCheck") {
+		t.Error("HasFunction(remoteCheck) should be true")
+	}
+
+	ok, err := e.EnforceCtx(context.Background(), "alice", "data1", "read")
+	if !ok || err != nil {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be true, <nil>", ok, err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", false)
+
+	// The function sees the deadline of the enforcement and its error is returned.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	e.AddContextFunction("remoteCheck", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		calls++
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if ok, err = e.EnforceCtx(ctx, "alice", "data1", "read"); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be false, %v", ok, err, context.DeadlineExceeded)
+	}
+
+	// A context already done stops the enforcement before any function is called.
+	calls = 0
+	if ok, err = e.EnforceCtx(ctx, "alice", "data1", "read"); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be false, %v", ok, err, context.DeadlineExceeded)
+	}
+	if calls != 0 {
+		t.Errorf("remoteCheck was called %d times, supposed to be 0", calls)
+	}
+
+	// AddFunction replaces the context function of the same name.
+	e.AddFunction("remoteCheck", func(args ...interface{}) (interface{}, error) { return true, nil })
+	if ok, err = e.EnforceCtx(context.Background(), "bob", "data2", "write"); !ok || err != nil {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be true, <nil>", ok, err)
+	}
+}
+
+func testGetMatchingPolicies(t *testing.T, e *Enforcer, rvals []interface{}, res [][]string) {
+	t.Helper()
+	myRes, err := e.GetMatchingPolicies(rvals...)
+	if err != nil {
+		t.Errorf("GetMatchingPolicies: %v", err)
+	}
+
+	if !util.Array2DEquals(res, myRes) {
+		t.Errorf("Matching policies for %v: %v, supposed to be %v", rvals, myRes, res)
+	}
+}
+
+func TestGetMatchingPolicies(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+
+	testGetMatchingPolicies(t, e, []interface{}{"alice", "data2", "write"}, [][]string{
+		{"data2_admin", "data2", "write", "allow"},
+		{"alice", "data2", "write", "deny"},
+	})
+	testGetMatchingPolicies(t, e, []interface{}{"alice", "data1", "read"}, [][]string{
+		{"alice", "data1", "read", "allow"},
+	})
+	testGetMatchingPolicies(t, e, []interface{}{"bob", "data1", "read"}, [][]string{})
+
+	_, err := e.GetMatchingPolicies("alice", "data1")
+	if err == nil {
+		t.Errorf("GetMatchingPolicies should fail for an invalid request size")
+	}
+
+	e, _ = NewEnforcer("examples/multiple_policy_definitions_model.conf", "examples/multiple_policy_definitions_policy.csv")
+	enforceContext := NewEnforceContext("2")
+	testGetMatchingPolicies(t, e, []interface{}{enforceContext, struct{ Age int }{Age: 30}, "/data1", "read"}, [][]string{
+		{"r2.sub.Age > 18 && r2.sub.Age < 60", "/data1", "read", "allow"},
+	})
+}
+
+func testEnforceInScope(t *testing.T, e *Enforcer, scope func(rule []string) bool, sub string, dom string, obj string, act string, res bool) {
+	t.Helper()
+	if myRes, err := e.EnforceInScope(scope, sub, dom, obj, act); err != nil {
+		t.Errorf("EnforceInScope Error: %s", err)
+	} else if myRes != res {
+		t.Errorf("%s, %s, %s, %s: %t, supposed to be %t", sub, dom, obj, act, myRes, res)
+	}
+}
+
+func TestEnforceInScope(t *testing.T) {
+	inDomain := func(domain string) func(rule []string) bool {
+		return func(rule []string) bool {
+			return rule[1] == domain
+		}
+	}
+
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+
+	testEnforceInScope(t, e, inDomain("domain1"), "alice", "domain1", "data1", "read", true)
+	testEnforceInScope(t, e, inDomain("domain1"), "alice", "domain1", "data1", "write", true)
+	testEnforceInScope(t, e, inDomain("domain1"), "bob", "domain2", "data2", "read", false)
+	testEnforceInScope(t, e, inDomain("domain2"), "bob", "domain2", "data2", "read", true)
+	testEnforceInScope(t, e, inDomain("domain2"), "alice", "domain1", "data1", "read", false)
+	testEnforceInScope(t, e, nil, "bob", "domain2", "data2", "read", true)
+
+	// The "*" domain rule grants alice data3 in every domain, unless it is left out of the scope.
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && keyMatch(r.dom, p.dom) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ = NewEnforcer(m, fileadapter.NewAdapter("examples/rbac_with_domain_pattern_policy.csv"))
+	e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+
+	testDomainEnforce(t, e, "alice", "domain1", "data3", "read", true)
+	testEnforceInScope(t, e, inDomain("domain1"), "alice", "domain1", "data3", "read", false)
+	testEnforceInScope(t, e, inDomain("domain1"), "alice", "domain1", "data1", "read", true)
+	testEnforceInScope(t, e, inDomain("*"), "alice", "domain1", "data3", "read", true)
+}
+
+func TestSetNamedRoleManager(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
+	testEnforce(t, e, "alice", "/book/1", "GET", false)
+	testEnforce(t, e, "bob", "/pen/1", "GET", false)
+
+	// The new role manager gets the existing g2 rules and is used by g2() right away.
+	rm := defaultrolemanager.NewRoleManager(10)
+	rm.AddMatchingFunc("KeyMatch2", util.KeyMatch2)
+	e.SetNamedRoleManager("g2", rm)
+	if e.GetNamedRoleManager("g2") != rm {
+		t.Error("GetNamedRoleManager(g2) should return the role manager set")
+	}
+	testEnforce(t, e, "alice", "/book/1", "GET", true)
+	testEnforce(t, e, "bob", "/pen/1", "GET", true)
+	testEnforce(t, e, "bob", "/book/1", "GET", false)
+
+	// Later grouping rules go to the new role manager.
+	_, _ = e.AddNamedGroupingPolicy("g2", "/magazine/:id", "book_group")
+	testEnforce(t, e, "alice", "/magazine/1", "GET", true)
+
+	// The other grouping policies keep their role manager.
+	if e.GetRoleManager() == rm {
+		t.Error("the role manager of g should not change")
+	}
+	testEnforce(t, e, "/book/user/1", "/pen4/1", "GET", false)
+
+	if err := e.TrySetNamedRoleManager("g3", rm); err == nil {
+		t.Error("TrySetNamedRoleManager should fail for a grouping policy definition that does not exist")
+	}
+	if err := e.TrySetNamedRoleManager("g", nil); err == nil {
+		t.Error("TrySetNamedRoleManager should fail for a nil role manager")
+	}
+	// SetNamedRoleManager ignores them.
+	e.SetNamedRoleManager("g", nil)
+	if e.GetRoleManager() == nil {
+		t.Error("SetNamedRoleManager should ignore a nil role manager")
+	}
+
+	// The role links are rebuilt on reloading the policy.
+	_ = e.LoadPolicy()
+	if e.GetNamedRoleManager("g2") != rm {
+		t.Error("GetNamedRoleManager(g2) should return the role manager set after LoadPolicy")
+	}
+	testEnforce(t, e, "alice", "/book/1", "GET", true)
+	testEnforce(t, e, "alice", "/magazine/1", "GET", false)
+}
+
+func TestStrictMode(t *testing.T) {
+	m, _ := model.NewModelFromFile("examples/basic_model.conf")
+	a := stringadapter.NewAdapter("p, alice, data1, read\np, , data2, write")
+
+	// Out of strict mode, the empty subject matches the corrupted rule.
+	e, _ := NewEnforcer(m, a)
+	testEnforce(t, e, "", "data2", "write", true)
+
+	e.SetStrictMode(true)
+	for i, rvals := range [][]interface{}{{"", "data2", "write"}, {"alice", nil, "read"}} {
+		_, err := e.Enforce(rvals...)
+		var emptyValue *Err.ErrEmptyRequestValue
+		if !errors.As(err, &emptyValue) || emptyValue.Index != i || emptyValue.Token != []string{"r_sub", "r_obj"}[i] {
+			t.Errorf("Enforce%v error: %v, supposed to be ErrEmptyRequestValue at index %d", rvals, err, i)
+		}
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	// Loading the corrupted policy fails and keeps the loaded one.
+	err := e.LoadPolicy()
+	var emptyField *Err.ErrEmptyPolicyField
+	if !errors.As(err, &emptyField) || emptyField.PType != "p" || emptyField.Index != 1 || emptyField.Field != 0 {
+		t.Errorf("LoadPolicy error: %v, supposed to be ErrEmptyPolicyField for field 0 of rule 1 of p", err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"", "data2", "write"}})
+
+	e.SetStrictMode(false)
+	if err := e.LoadPolicy(); err != nil {
+		t.Errorf("LoadPolicy out of strict mode: %v", err)
+	}
+}
+
+// modelLogger records the model rows it is given to log.
+type modelLogger struct {
+	log.DefaultLogger
+	rows [][]string
+}
+
+func (l *modelLogger) LogModel(model [][]string) {
+	l.rows = append(l.rows, model...)
+}
+
+func TestRequiredFunctions(t *testing.T) {
+	logger := &modelLogger{}
+	logger.EnableLog(true)
+	_, err := NewEnforcer("examples/required_functions_model.conf", "examples/basic_policy.csv", logger)
+	var missing *Err.ErrMissingFunctions
+	if !errors.As(err, &missing) || !util.ArrayEquals(missing.Names, []string{"customMatch"}) {
+		t.Errorf("NewEnforcer: %v, supposed to be missing customMatch", err)
+	}
+
+	// customMatch is required and called by the matcher, keyMatch2 is a builtin.
+	var warnings []string
+	for _, row := range logger.rows {
+		if len(row) == 3 && strings.HasSuffix(row[2], "function: customMatch") {
+			warnings = append(warnings, row[0])
+		}
+	}
+	if !util.ArrayEquals(warnings, []string{"f", "m"}) {
+		t.Errorf("warnings for customMatch in sections %v, supposed to be [f m]", warnings)
+	}
+
+	functions := map[string]govaluate.ExpressionFunction{
+		"customMatch": func(args ...interface{}) (interface{}, error) {
+			return args[0].(string) == args[1].(string), nil
+		},
+	}
+	e, err := NewEnforcer("examples/required_functions_model.conf", "examples/basic_policy.csv", functions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.VerifyFunctions(); err != nil {
+		t.Errorf("VerifyFunctions: %v, supposed to be <nil>", err)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	// SetModel keeps the functions given to NewEnforcer.
+	m, _ := model.NewModelFromFile("examples/required_functions_model.conf")
+	e.SetModel(m)
+	if err := e.VerifyFunctions(); err != nil {
+		t.Errorf("VerifyFunctions after SetModel: %v, supposed to be <nil>", err)
+	}
+
+	// SetModel cannot fail, the enforcements do.
+	e, _ = NewEnforcer()
+	e.SetModel(m)
+	if err := e.VerifyFunctions(); !errors.As(err, &missing) {
+		t.Errorf("VerifyFunctions after SetModel: %v, supposed to be missing customMatch", err)
+	}
+	if _, err := e.Enforce("alice", "data1", "read"); !errors.As(err, &missing) {
+		t.Errorf("Enforce: %v, supposed to be missing customMatch", err)
+	}
+
+	if !strings.Contains(m.ToText(), "[functions]\nrequired = customMatch, keyMatch2\n") {
+		t.Errorf("ToText should keep the functions section: %s", m.ToText())
+	}
+}
+
+func TestMatcherCompiledOnce(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	compiled := func() interface{} {
+		expression, _ := e.matcherMap.Load().(*sync.Map).Load(e.model["m"]["m"].Value)
+		return expression
+	}
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	expression := compiled()
+	if expression == nil {
+		t.Fatal("the matcher should be compiled by Enforce")
+	}
+	testEnforce(t, e, "bob", "data2", "write", true)
+	_, _ = e.BatchEnforce([][]interface{}{{"alice", "data1", "read"}, {"bob", "data1", "read"}})
+	if compiled() != expression {
+		t.Error("the compiled matcher should be reused by Enforce and BatchEnforce")
+	}
+
+	// Adding a function discards the compiled matcher.
+	e.AddFunction("alwaysTrue", func(args ...interface{}) (interface{}, error) { return true, nil })
+	if compiled() != nil {
+		t.Error("the compiled matcher should be discarded by AddFunction")
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if compiled() == nil || compiled() == expression {
+		t.Error("the matcher should be compiled again after AddFunction")
+	}
+
+	// A changed matcher is compiled on its own.
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj
+`)
+	e.SetModel(m)
+	_ = e.LoadPolicy()
+	testEnforce(t, e, "alice", "data1", "write", true)
+	if compiled() == nil || compiled() == expression {
+		t.Error("the changed matcher should be compiled")
+	}
+}
+
+func TestConcurrencyCheck(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = barrier() && r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+
+	// enforceDuring enforces on another goroutine and changes the policy while the matcher is evaluated.
+	enforceDuring := func(change func()) error {
+		entered, proceed := make(chan struct{}), make(chan struct{})
+		var once sync.Once
+		e.AddFunction("barrier", func(args ...interface{}) (interface{}, error) {
+			once.Do(func() {
+				close(entered)
+				<-proceed
+			})
+			return true, nil
+		})
+		result := make(chan error)
+		go func() {
+			_, err := e.Enforce("alice", "data1", "read")
+			result <- err
+		}()
+		<-entered
+		change()
+		close(proceed)
+		return <-result
+	}
+
+	if err := enforceDuring(func() { _, _ = e.AddPolicy("carol", "data1", "read") }); err != nil {
+		t.Errorf("Enforce with the check disabled: %v, supposed to be <nil>", err)
+	}
+
+	e.EnableConcurrencyCheck(true)
+	testEnforce(t, e, "alice", "data1", "read", true)
+	var concurrent *Err.ErrConcurrentModification
+	err := enforceDuring(func() { _, _ = e.AddPolicy("dave", "data1", "read") })
+	if !errors.As(err, &concurrent) {
+		t.Fatalf("Enforce: %v, supposed to be ErrConcurrentModification", err)
+	}
+	if !strings.Contains(concurrent.ModifyStack, "AddPolicy") || !strings.Contains(concurrent.EnforceStack, "Enforce") {
+		t.Errorf("the stacks should show the changing and the enforcing calls:\n%s", err)
+	}
+	if err := enforceDuring(func() { e.ClearPolicy() }); !errors.As(err, &concurrent) {
+		t.Errorf("Enforce: %v, supposed to be ErrConcurrentModification", err)
+	}
+
+	// The changes made before enforcing are fine.
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	testEnforce(t, e, "alice", "data1", "read", true)
+}
+
+// enforceLogger counts the decisions, the errors and the overridden decisions it is given to log.
+type enforceLogger struct {
+	log.DefaultLogger
+	decisions, errors, overrides int
+}
+
+func (l *enforceLogger) LogEnforce(matcher string, request []interface{}, result bool, explains [][]string) {
+	if len(explains) == 1 && len(explains[0]) == 1 && strings.HasPrefix(explains[0][0], "error: ") {
+		l.errors++
+	} else if len(explains) == 1 && len(explains[0]) == 1 && explains[0][0] == "override" {
+		l.overrides++
+	} else {
+		l.decisions++
+	}
+}
+
+func TestLogSampleRate(t *testing.T) {
+	logger := &enforceLogger{}
+	logger.EnableLog(true)
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv", logger)
+
+	e.SetLogSampleRate(10)
+	for i := 0; i < 1000; i++ {
+		_, _ = e.Enforce("alice", "data1", "read")
+	}
+	for i := 0; i < 5; i++ {
+		_, _ = e.Enforce("alice", "data1")
+	}
+	if logger.decisions != 100 {
+		t.Errorf("logged decisions: %d, supposed to be 100", logger.decisions)
+	}
+	if logger.errors != 5 {
+		t.Errorf("logged errors: %d, supposed to be 5", logger.errors)
+	}
+
+	e.SetLogSampleRate(1)
+	for i := 0; i < 10; i++ {
+		_, _ = e.Enforce("alice", "data1", "read")
+	}
+	if logger.decisions != 110 {
+		t.Errorf("logged decisions: %d, supposed to be 110", logger.decisions)
+	}
+}
+
+// slowRoleManager is a role manager backed by a slow service, its queries take a second unless their context is done.
+type slowRoleManager struct {
+	*defaultrolemanager.RoleManager
+}
+
+func (rm *slowRoleManager) HasLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error) {
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	case <-time.After(time.Second):
+		return rm.HasLink(name1, name2, domain...)
+	}
+}
+
+func TestEnforceCtxWithContextRoleManager(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	if err := e.TrySetNamedRoleManager("g", &slowRoleManager{defaultrolemanager.NewRoleManager(10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if ok, err := e.EnforceCtx(ctx, "alice", "data2", "read"); ok || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("EnforceCtx: %t, %v, supposed to be false, %v", ok, err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("EnforceCtx took %v after the deadline", elapsed)
+	}
+
+	// A plain role manager adapted to the context fails the same way.
+	rm := rbac.NewContextRoleManager(&testCustomRoleManager{})
+	if _, err := rm.HasLinkCtx(ctx, "alice", "data2_admin"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("HasLinkCtx: %v, supposed to be %v", err, context.DeadlineExceeded)
+	}
+	if _, ok := rbac.NewContextRoleManager(defaultrolemanager.NewRoleManager(10)).(*defaultrolemanager.RoleManager); !ok {
+		t.Error("NewContextRoleManager should return a context role manager as is")
+	}
+}
+
+type tenantKey struct{}
+
+func TestEnforceCtxCompilesOnce(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act && tenantIs(r.sub)
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/rbac_policy.csv"))
+	e.AddContextFunction("tenantIs", func(ctx context.Context, args ...interface{}) (interface{}, error) {
+		return ctx.Value(tenantKey{}) != "blocked", nil
+	})
+
+	matcherMap := e.matcherMap.Load().(*sync.Map)
+	var compiled interface{}
+	for i, tenant := range []string{"a", "blocked", "b", "blocked"} {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		// the context functions see the context of every call, the matcher is compiled once for all of them.
+		if ok, _ := e.EnforceCtx(ctx, "alice", "data2", "read"); ok != (tenant != "blocked") {
+			t.Errorf("EnforceCtx for %s: %t, supposed to be %t", tenant, ok, tenant != "blocked")
+		}
+		expression, _ := matcherMap.Load(e.model["m"]["m"].Value)
+		if i > 0 && expression != compiled {
+			t.Error("The matcher should be compiled once for the calls of every context")
+		}
+		compiled = expression
+	}
+	if compiled == nil {
+		t.Error("The compiled matcher should be stored")
+	}
+}
+
+func TestTabDelimitedModel(t *testing.T) {
+	m := model.NewModel()
+	m.SetTokenDelimiter("\t")
+	err := m.LoadModelFromText("[request_definition]\nr = sub\tobj\tact\n\n" +
+		"[policy_definition]\np = sub\tobj\tact\n\n" +
+		"[role_definition]\ng = _\t_\n\n" +
+		"[policy_effect]\ne = some(where (p.eft == allow))\n\n" +
+		"[matchers]\nm = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the values keep their spaces and the commas of the quoted fields.
+	e, err := NewEnforcer(m, stringadapter.NewAdapter(`p, data admin, "data, 1", read
+p, bob, data 2, write
+g, alice smith, data admin`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice smith", "data, 1", "read", true)
+	testEnforce(t, e, "alice smith", "data", "read", false)
+	testEnforce(t, e, "alice", "data, 1", "read", false)
+	testEnforce(t, e, "bob", "data 2", "write", true)
+
+	// the exported model uses the default delimiter.
+	exported, err := CasbinJsGetPermissionForUser(e, "alice smith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received map[string]interface{}
+	if err = json.Unmarshal([]byte(exported), &received); err != nil {
+		t.Fatal(err)
+	}
+	if text := received["m"].(string); !strings.Contains(text, "p = sub, obj, act\n") || !strings.Contains(text, "g = _, _\n") {
+		t.Errorf("exported model: %s, supposed to use the default delimiter", text)
+	}
+}
@@ -15,9 +15,13 @@
 package casbin
 
 import (
+	"errors"
+	"reflect"
 	"testing"
 
+	Err "github.com/casbin/casbin/v2/errors"
 	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/util"
 )
 
 func TestPathError(t *testing.T) {
@@ -283,3 +287,52 @@ func TestMockAdapterErrors(t *testing.T) {
 		t.Log(err10.Error())
 	}
 }
+
+func TestLoadErrorHandler(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	e.SetAdapter(fileadapter.NewAdapter("examples/basic_policy_malformed.csv"))
+
+	if err := e.LoadPolicy(); err == nil {
+		t.Error("LoadPolicy should fail on the first malformed rule without a load error handler")
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	// aborting on the first malformed rule keeps the policy in use.
+	var lines []int
+	e.SetLoadErrorHandler(func(line int, raw string, err error) bool {
+		lines = append(lines, line)
+		return false
+	})
+	if err := e.LoadPolicy(); err == nil {
+		t.Error("LoadPolicy should fail when the load error handler aborts")
+	}
+	if !reflect.DeepEqual(lines, []int{2}) {
+		t.Errorf("lines given to the load error handler: %v, supposed to be [2]", lines)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+
+	// skipping the malformed rules loads the other ones.
+	var raws []string
+	e.SetLoadErrorHandler(func(line int, raw string, err error) bool {
+		raws = append(raws, raw)
+		return true
+	})
+	err := e.LoadPolicy()
+	var skipped *Err.MultiError
+	if !errors.As(err, &skipped) {
+		t.Fatalf("LoadPolicy: %v, supposed to be an *errors.MultiError", err)
+	}
+	expected := map[string]int{"ptype is not defined": 3, "wrong number of fields": 2, "malformed line": 1}
+	if !reflect.DeepEqual(skipped.Counts, expected) {
+		t.Errorf("skipped rules: %v, supposed to be %v", skipped.Counts, expected)
+	}
+	if len(skipped.Errors) != 3 {
+		t.Errorf("errors: %v, supposed to hold the first error of every kind", skipped.Errors)
+	}
+	if !util.ArrayEquals(raws, []string{"p, bob, data2", "x, carol, data3, read", `p, "eve, data3, read`,
+		"g, alice, admin", "p, cathy, data1, read, extra", "g2, bob, admin"}) {
+		t.Errorf("raw rules given to the load error handler: %v", raws)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	testEnforce(t, e, "bob", "data2", "write", true)
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ErrAssertionNotFound is returned when an enforce context names a definition the model does not have,
+// e.g. Sec "m" and Key "m2" for a model without a second matcher.
+type ErrAssertionNotFound struct {
+	Sec string
+	Key string
+}
+
+func (e *ErrAssertionNotFound) Error() string {
+	return fmt.Sprintf("enforce context: %s is not defined in section %s of the model", e.Key, e.Sec)
+}
+
+// ErrEmptyRequestValue is returned in strict mode when a request value is nil or an empty string.
+type ErrEmptyRequestValue struct {
+	Token string
+	Index int
+}
+
+func (e *ErrEmptyRequestValue) Error() string {
+	return fmt.Sprintf("empty request value for %s at index %d", e.Token, e.Index)
+}
+
+// ErrEmptyPolicyField is returned in strict mode when a loaded policy rule has an empty field,
+// Index is the position of the rule among the rules of its ptype.
+type ErrEmptyPolicyField struct {
+	PType string
+	Index int
+	Field int
+	Rule  []string
+}
+
+func (e *ErrEmptyPolicyField) Error() string {
+	return fmt.Sprintf("empty field %d in rule %d of %s: %v", e.Field, e.Index, e.PType, e.Rule)
+}
+
+// ErrMissingFunctions is returned when the model requires functions in its [functions] section
+// that the matchers cannot call, e.g. custom functions not added with AddFunction.
+type ErrMissingFunctions struct {
+	Names []string
+}
+
+func (e *ErrMissingFunctions) Error() string {
+	return fmt.Sprintf("missing required functions: %s", strings.Join(e.Names, ", "))
+}
+
+// ErrConcurrentModification is returned by an enforcement during which the policy was changed by another goroutine
+// without synchronization, when the concurrency check of the enforcer is enabled. The stacks are snippets of the
+// stacks of the enforcing goroutine and of the goroutine that made the last change.
+type ErrConcurrentModification struct {
+	EnforceStack string
+	ModifyStack  string
+}
+
+func (e *ErrConcurrentModification) Error() string {
+	return fmt.Sprintf("the policy was modified concurrently with enforcing, use a SyncedEnforcer or synchronize the calls\n"+
+		"enforcing goroutine:\n%s\nmodifying goroutine:\n%s", e.EnforceStack, e.ModifyStack)
+}
+
+// ErrFunctionPanic is returned by an enforcement during which a function called by the matcher panicked,
+// see Enforcer.SetRecoverFromPanic. Value is the value the function panicked with.
+type ErrFunctionPanic struct {
+	Name  string
+	Value interface{}
+	Stack string
+}
+
+func (e *ErrFunctionPanic) Error() string {
+	return fmt.Sprintf("function %s panicked: %v", e.Name, e.Value)
+}
+
+// ErrIncompatibleTypes is returned when a matcher compares values of incompatible types with strict matcher types,
+// e.g. a number with a string, see Enforcer.SetStrictMatcherTypes. Left and Right name the operands.
+type ErrIncompatibleTypes struct {
+	Operator   string
+	Left       string
+	Right      string
+	LeftValue  interface{}
+	RightValue interface{}
+}
+
+func (e *ErrIncompatibleTypes) Error() string {
+	return fmt.Sprintf("cannot compare %s (%T %v) with %s (%T %v) using %s", e.Left, e.LeftValue, e.LeftValue,
+		e.Right, e.RightValue, e.RightValue, e.Operator)
+}
@@ -14,7 +14,10 @@
 
 package errors
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // Global errors for rbac defined here
 var (
@@ -24,3 +27,24 @@ var (
 	ERR_USE_DOMAIN_PARAMETER      = errors.New("error: useDomain should be 1 parameter")
 	INVALID_FIELDVAULES_PARAMETER = errors.New("fieldValues requires at least one parameter")
 )
+
+// ErrRoleCycles is returned when grouping rules would make a role inherit from itself.
+type ErrRoleCycles struct {
+	PType  string
+	Cycles [][]string
+}
+
+func (e *ErrRoleCycles) Error() string {
+	return fmt.Sprintf("the rules of %s create role cycles: %v", e.PType, e.Cycles)
+}
+
+// ErrOrphanRoles is returned when grouping rules link to roles that are neither the subject of a "p" rule
+// nor have a role themselves.
+type ErrOrphanRoles struct {
+	PType string
+	Roles []string
+}
+
+func (e *ErrOrphanRoles) Error() string {
+	return fmt.Sprintf("the rules of %s link to orphan roles: %v", e.PType, e.Roles)
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package errors
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrTokenNotFound is returned when the policy definition of a ptype has no token the function needs,
+// e.g. the dom token for GetAllObjectsByDomain on a model without domains.
+type ErrTokenNotFound struct {
+	PType string
+	Token string
+}
+
+func (e *ErrTokenNotFound) Error() string {
+	return fmt.Sprintf("the policy definition of %s has no %s token", e.PType, e.Token)
+}
+
+// ErrUnknownToken is returned by Model.Validate when a matcher uses a name that is neither a token
+// of the request and policy definitions nor an alias of one, e.g. a misspelled p.subjet.
+type ErrUnknownToken struct {
+	Matcher string
+	Token   string
+}
+
+func (e *ErrUnknownToken) Error() string {
+	return fmt.Sprintf("matcher %s uses unknown token %s", e.Matcher, e.Token)
+}
+
+// ErrInvalidRule is returned when a rule to add or update does not fit the definition of its ptype.
+// Err is the error of the policy validator when it rejected the rule.
+type ErrInvalidRule struct {
+	PType    string
+	Expected int
+	Rule     []string
+	Reason   string
+	Err      error
+}
+
+func (e *ErrInvalidRule) Error() string {
+	return fmt.Sprintf("invalid rule for %s: %s, expected %d fields, rule: %v", e.PType, e.Reason, e.Expected, e.Rule)
+}
+
+func (e *ErrInvalidRule) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidRules is returned by batch operations, it holds every invalid rule of the batch.
+type ErrInvalidRules []*ErrInvalidRule
+
+func (e ErrInvalidRules) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ErrMigrateRule is a rule that could not be migrated to the new model, Index is its position among the rules of its ptype.
+type ErrMigrateRule struct {
+	PType string
+	Index int
+	Rule  []string
+	Err   error
+}
+
+func (e *ErrMigrateRule) Error() string {
+	return fmt.Sprintf("cannot migrate rule %d of %s: %v, rule: %v", e.Index, e.PType, e.Err, e.Rule)
+}
+
+func (e *ErrMigrateRule) Unwrap() error {
+	return e.Err
+}
+
+// ErrMigrateRules is returned by a policy migration, it holds every rule that could not be migrated.
+type ErrMigrateRules []*ErrMigrateRule
+
+func (e ErrMigrateRules) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// MultiError is returned by LoadPolicy when the load error handler skipped malformed rules, the policy is loaded
+// without them. Counts holds the number of skipped rules per kind of error, Errors the first error of every kind.
+type MultiError struct {
+	Counts map[string]int
+	Errors []error
+}
+
+// Add records a skipped rule failing with err of the kind.
+func (e *MultiError) Add(kind string, err error) {
+	if e.Counts == nil {
+		e.Counts = map[string]int{}
+	}
+	if e.Counts[kind] == 0 {
+		e.Errors = append(e.Errors, err)
+	}
+	e.Counts[kind]++
+}
+
+func (e *MultiError) Error() string {
+	kinds := make([]string, 0, len(e.Counts))
+	total := 0
+	for kind, count := range e.Counts {
+		kinds = append(kinds, fmt.Sprintf("%s: %d", kind, count))
+		total += count
+	}
+	sort.Strings(kinds)
+	return fmt.Sprintf("skipped %d malformed rules (%s)", total, strings.Join(kinds, ", "))
+}
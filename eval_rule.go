@@ -0,0 +1,121 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// EnableEvalRuleValidation controls whether the fields of the rules of "p" that the matchers give to eval(),
+// like sub_rule in eval(p.sub_rule), are parsed when the rules are added or loaded, so that an invalid
+// expression is rejected with an *errors.ErrInvalidRule instead of failing every enforcement. It is disabled by default.
+func (e *Enforcer) EnableEvalRuleValidation(enable bool) {
+	e.validateEvalRules = enable
+}
+
+// evalFields returns the indexes of the fields of the ptype given to eval() by a matcher of the model m.
+func evalFields(m model.Model, ptype string) []int {
+	ast, ok := m["p"][ptype]
+	if !ok {
+		return nil
+	}
+	var fields []int
+	seen := map[int]bool{}
+	for _, matcher := range m["m"] {
+		for _, arg := range util.GetEvalValue(matcher.Value) {
+			for i, token := range ast.Tokens {
+				if token == arg && !seen[i] {
+					seen[i] = true
+					fields = append(fields, i)
+				}
+			}
+		}
+	}
+	sort.Ints(fields)
+	return fields
+}
+
+// parseEvalFields parses the fields of the rule given to eval() by the matchers of the model m.
+func (e *Enforcer) parseEvalFields(m model.Model, ptype string, rule []string) ([]*govaluate.EvaluableExpression, error) {
+	fields := evalFields(m, ptype)
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	functions := e.getFunctions(context.Background())
+	expressions := make([]*govaluate.EvaluableExpression, 0, len(fields))
+	for _, i := range fields {
+		if i >= len(rule) {
+			continue
+		}
+		expression, err := govaluate.NewEvaluableExpressionWithFunctions(util.EscapeAssertion(rule[i]), functions)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expression %q in field %d: %s", rule[i], i, err)
+		}
+		expressions = append(expressions, expression)
+	}
+	return expressions, nil
+}
+
+// GetFilteredPolicyByEvalSubject returns the rules of "p" whose fields given to eval() by the matchers,
+// like sub_rule in eval(p.sub_rule), are all true for a request whose subject is attrs, e.g. the rule
+// "r.sub.Age > 18, /data1, read" for struct{ Age int }{Age: 30}. It is meant for tools showing what a subject
+// may access. It returns nil if no field of "p" is given to eval().
+func (e *Enforcer) GetFilteredPolicyByEvalSubject(attrs interface{}) ([][]string, error) {
+	if len(evalFields(e.model, "p")) == 0 {
+		return nil, nil
+	}
+	rTokens := e.model["r"]["r"].Tokens
+	rvals := make([]interface{}, len(rTokens))
+	subIndex := 0
+	for i, token := range rTokens {
+		if token == "r_sub" {
+			subIndex = i
+		}
+	}
+	rvals[subIndex] = attrs
+
+	buffer := e.getEnforceBuffer(rTokens, e.model["p"]["p"].Tokens, rvals)
+	defer putEnforceBuffer(buffer)
+
+	res := make([][]string, 0)
+	for _, rule := range e.model["p"]["p"].Policy {
+		expressions, err := e.parseEvalFields(e.model, "p", rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %v: %s", rule, err)
+		}
+		buffer.parameters.pVals = rule
+		matched := true
+		for _, expression := range expressions {
+			value, err := expression.Eval(&buffer.parameters)
+			if err != nil {
+				return nil, fmt.Errorf("rule %v: %s", rule, err)
+			}
+			if value != true {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			res = append(res, deepCopyPolicy(rule))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"testing"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+	"github.com/casbin/casbin/v2/util"
+)
+
+func TestEvalRuleValidation(t *testing.T) {
+	e, _ := NewEnforcer("examples/abac_rule_model.conf", "examples/abac_rule_policy.csv")
+
+	// without the validation, an invalid expression is only found when enforcing.
+	if _, err := e.AddPolicy("r.sub.Age >", "/data3", "read"); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = e.RemovePolicy("r.sub.Age >", "/data3", "read")
+
+	e.EnableEvalRuleValidation(true)
+	if ok, err := e.AddPolicy("r.sub.Age > 18 && r.sub.Age < 30", "/data3", "read"); !ok || err != nil {
+		t.Errorf("AddPolicy of a valid expression: %t, %v", ok, err)
+	}
+	ok, err := e.AddPolicy("r.sub.Age >", "/data3", "write")
+	var invalid *Err.ErrInvalidRule
+	if ok || !errors.As(err, &invalid) {
+		t.Fatalf("AddPolicy of an invalid expression should fail with an ErrInvalidRule, got %t, %v", ok, err)
+	}
+	if !util.ArrayEquals(invalid.Rule, []string{"r.sub.Age >", "/data3", "write"}) {
+		t.Errorf("The error should carry the invalid rule, got %v", invalid.Rule)
+	}
+	if e.HasPolicy("r.sub.Age >", "/data3", "write") {
+		t.Error("The invalid rule should not be added")
+	}
+	// the other fields are not expressions.
+	if ok, err := e.AddPolicy("r.sub.Age > 60", "/data(", "read"); !ok || err != nil {
+		t.Errorf("AddPolicy with a field not given to eval(): %t, %v", ok, err)
+	}
+
+	e.SetAdapter(stringadapter.NewAdapter("p, r.sub.Age > 18, /data1, read\np, r.sub.Age <, /data2, write"))
+	if err := e.LoadPolicy(); !errors.As(err, &invalid) {
+		t.Errorf("LoadPolicy of an invalid expression should fail with an ErrInvalidRule, got %v", err)
+	}
+}
+
+func TestGetFilteredPolicyByEvalSubject(t *testing.T) {
+	e, _ := NewEnforcer("examples/abac_rule_model.conf", "examples/abac_rule_policy.csv")
+
+	testCases := []struct {
+		age      int
+		expected [][]string
+	}{
+		{30, [][]string{{"r.sub.Age > 18", "/data1", "read"}, {"r.sub.Age < 60", "/data2", "write"}}},
+		{70, [][]string{{"r.sub.Age > 18", "/data1", "read"}}},
+		{10, [][]string{{"r.sub.Age < 60", "/data2", "write"}}},
+	}
+	for _, tc := range testCases {
+		rules, err := e.GetFilteredPolicyByEvalSubject(struct{ Age int }{Age: tc.age})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !util.Array2DEquals(tc.expected, rules) {
+			t.Errorf("Rules for age %d: %v, supposed to be %v", tc.age, rules, tc.expected)
+		}
+	}
+
+	// an expression that cannot be evaluated for the subject is reported.
+	if _, err := e.GetFilteredPolicyByEvalSubject(struct{ Name string }{Name: "alice"}); err == nil {
+		t.Error("GetFilteredPolicyByEvalSubject should fail for a subject without the attributes used by the rules")
+	}
+
+	e, _ = NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+	if rules, err := e.GetFilteredPolicyByEvalSubject("alice"); rules != nil || err != nil {
+		t.Errorf("GetFilteredPolicyByEvalSubject without eval(): %v, %v, supposed to be nil", rules, err)
+	}
+}
@@ -207,3 +207,47 @@ func TestFilteredAdapterInvalidFilepath(t *testing.T) {
 		t.Errorf("expected error in LoadFilteredPolicy, but got nil")
 	}
 }
+
+func TestSaveFilteredPolicy(t *testing.T) {
+	path := copyPolicyFile(t, "examples/rbac_with_domains_policy2.csv")
+	e, _ := NewEnforcer()
+	_ = e.InitWithAdapter("examples/rbac_with_domains_model.conf", fileadapter.NewFilteredAdapter(path))
+	filter := &fileadapter.Filter{
+		P: []string{"", "domain1"},
+		G: []string{"", "", "domain1"},
+	}
+	if err := e.LoadFilteredPolicy(filter); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _ = e.RemovePolicy("admin", "domain1", "data1", "write")
+	_, _ = e.AddPolicy("admin", "domain1", "data3", "read")
+	_, _ = e.AddGroupingPolicy("carol", "admin", "domain1")
+	// The rules outside of the filter are not saved.
+	_, _ = e.AddPolicy("admin", "domain2", "data3", "read")
+	if err := e.SaveFilteredPolicy(filter); err != nil {
+		t.Fatal(err)
+	}
+
+	// The rules of the other domains are kept.
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", path)
+	testGetPolicy(t, e, [][]string{
+		{"admin", "domain1", "data1", "read"},
+		{"admin", "domain1", "data3", "read"},
+		{"admin", "domain2", "data2", "read"},
+		{"admin", "domain2", "data2", "write"},
+		{"user", "domain3", "data2", "read"},
+	})
+	testGetGroupingPolicy(t, e, [][]string{
+		{"alice", "admin", "domain1"},
+		{"carol", "admin", "domain1"},
+		{"alice", "admin", "domain2"},
+		{"bob", "admin", "domain2"},
+		{"bob", "user", "domain3"},
+	})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy2.csv")
+	if err := e.SaveFilteredPolicy(filter); err == nil {
+		t.Error("SaveFilteredPolicy should fail for an adapter not supporting it")
+	}
+}
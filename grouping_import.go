@@ -0,0 +1,189 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sort"
+	"strings"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// GroupingImportOptions controls AddGroupingPoliciesValidated.
+type GroupingImportOptions struct {
+	// PType is the ptype of the rules, "g" if it is empty.
+	PType string
+	// RejectOrphans rejects the import if it has orphans, by default they are only reported.
+	RejectOrphans bool
+}
+
+// GroupingImportReport reports the problems AddGroupingPoliciesValidated found in the rules it was given.
+type GroupingImportReport struct {
+	// Added is the number of rules that were added.
+	Added int
+	// Duplicates are the rules that were dropped because they were repeated or already in the policy.
+	Duplicates [][]string
+	// Cycles are the role cycles of the resulting hierarchy, each one as the names along the cycle,
+	// starting and ending with the same name, e.g. ["a", "b", "a"].
+	Cycles [][]string
+	// Orphans are the roles the rules link to that are neither the subject of a "p" rule nor have a role
+	// themselves, sorted lexicographically.
+	Orphans []string
+}
+
+// AddGroupingPoliciesValidated adds role inheritance rules to the current policy for importing a role hierarchy,
+// e.g. an org chart. The rules repeated or already in the policy are dropped, and nothing is added if the rules
+// would create a role cycle, or if they link to orphan roles and opts.RejectOrphans is set. The other rules are
+// added with a single batch call to the adapter and a single update of the role links.
+// The report is returned whether the rules were added or not.
+func (e *Enforcer) AddGroupingPoliciesValidated(rules [][]string, opts GroupingImportOptions) (GroupingImportReport, error) {
+	ptype := opts.PType
+	if ptype == "" {
+		ptype = "g"
+	}
+	report := GroupingImportReport{}
+	if _, ok := e.model["g"][ptype]; !ok {
+		return report, &Err.ErrInvalidRule{PType: ptype, Reason: "ptype is not defined"}
+	}
+
+	var added [][]string
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		key := strings.Join(rule, model.DefaultSep)
+		if seen[key] || e.model.HasPolicy("g", ptype, rule) {
+			report.Duplicates = append(report.Duplicates, rule)
+			continue
+		}
+		seen[key] = true
+		added = append(added, rule)
+	}
+
+	existing := e.model.GetPolicy("g", ptype)
+	report.Cycles = findRoleCycles(append(append([][]string(nil), existing...), added...))
+	report.Orphans = e.findOrphanRoles(existing, added)
+
+	if len(report.Cycles) > 0 {
+		return report, &Err.ErrRoleCycles{PType: ptype, Cycles: report.Cycles}
+	}
+	if opts.RejectOrphans && len(report.Orphans) > 0 {
+		return report, &Err.ErrOrphanRoles{PType: ptype, Roles: report.Orphans}
+	}
+	if len(added) == 0 {
+		return report, nil
+	}
+
+	ok, err := e.addPolicies("g", ptype, added)
+	if ok {
+		report.Added = len(added)
+	}
+	return report, err
+}
+
+// findOrphanRoles returns the roles the added rules link to that are neither the subject of a "p" rule
+// nor the user of a grouping rule.
+func (e *Enforcer) findOrphanRoles(existing [][]string, added [][]string) []string {
+	subjects := map[string]bool{}
+	for _, ast := range e.model["p"] {
+		for _, rule := range ast.Policy {
+			subjects[rule[0]] = true
+		}
+	}
+	for _, rules := range [][][]string{existing, added} {
+		for _, rule := range rules {
+			subjects[rule[0]] = true
+		}
+	}
+
+	orphans := []string{}
+	for _, rule := range added {
+		if len(rule) > 1 && !subjects[rule[1]] {
+			subjects[rule[1]] = true
+			orphans = append(orphans, rule[1])
+		}
+	}
+	sort.Strings(orphans)
+	return orphans
+}
+
+// findRoleCycles returns the cycles of the role hierarchy of the grouping rules. The rules link a user to a role
+// in the domain of their other fields, so that the same names in different domains are different roles.
+// The cycles are found in a deterministic order, each one once.
+func findRoleCycles(rules [][]string) [][]string {
+	type node struct {
+		name   string
+		domain string
+	}
+	edges := map[node][]node{}
+	for _, rule := range rules {
+		if len(rule) < 2 {
+			continue
+		}
+		domain := strings.Join(rule[2:], model.DefaultSep)
+		user := node{rule[0], domain}
+		edges[user] = append(edges[user], node{rule[1], domain})
+	}
+	less := func(a, b node) bool {
+		if a.domain != b.domain {
+			return a.domain < b.domain
+		}
+		return a.name < b.name
+	}
+	nodes := make([]node, 0, len(edges))
+	for n, next := range edges {
+		nodes = append(nodes, n)
+		sort.Slice(next, func(i, j int) bool { return less(next[i], next[j]) })
+	}
+	sort.Slice(nodes, func(i, j int) bool { return less(nodes[i], nodes[j]) })
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[node]int{}
+	var path []node
+	cycles := [][]string{}
+	var visit func(n node)
+	visit = func(n node) {
+		state[n] = visiting
+		path = append(path, n)
+		for _, next := range edges[n] {
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				var cycle []string
+				for i := len(path) - 1; i >= 0; i-- {
+					if path[i] == next {
+						for _, m := range path[i:] {
+							cycle = append(cycle, m.name)
+						}
+						break
+					}
+				}
+				cycles = append(cycles, append(cycle, next.name))
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+	}
+	for _, n := range nodes {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return cycles
+}
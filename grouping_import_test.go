@@ -0,0 +1,113 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	Err "github.com/casbin/casbin/v2/errors"
+)
+
+// loadImportRules reads the grouping rules of a policy file, without their ptype.
+func loadImportRules(t *testing.T, path string) [][]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+	lines, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := make([][]string, len(lines))
+	for i, line := range lines {
+		rules[i] = line[1:]
+	}
+	return rules
+}
+
+func testImportReport(t *testing.T, report GroupingImportReport, added int, duplicates [][]string, cycles [][]string, orphans []string) {
+	t.Helper()
+	if report.Added != added {
+		t.Errorf("added %d rules, supposed to be %d", report.Added, added)
+	}
+	if !reflect.DeepEqual(report.Duplicates, duplicates) {
+		t.Errorf("duplicates: %v, supposed to be %v", report.Duplicates, duplicates)
+	}
+	if !reflect.DeepEqual(report.Cycles, cycles) {
+		t.Errorf("cycles: %v, supposed to be %v", report.Cycles, cycles)
+	}
+	if !reflect.DeepEqual(report.Orphans, orphans) {
+		t.Errorf("orphans: %v, supposed to be %v", report.Orphans, orphans)
+	}
+}
+
+func TestAddGroupingPoliciesValidated(t *testing.T) {
+	rules := loadImportRules(t, "examples/rbac_import_policy.csv")
+	duplicates := [][]string{{"alice", "data2_admin"}, {"carol", "team_lead"}}
+	initial := [][]string{{"alice", "data2_admin"}}
+
+	// The cycle between manager and director rejects the whole import.
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	report, err := e.AddGroupingPoliciesValidated(rules, GroupingImportOptions{})
+	var cyclesErr *Err.ErrRoleCycles
+	if !errors.As(err, &cyclesErr) {
+		t.Fatalf("error: %v, supposed to be *errors.ErrRoleCycles", err)
+	}
+	testImportReport(t, report, 0, duplicates, [][]string{{"director", "manager", "director"}}, []string{"contractor"})
+	testGetGroupingPolicy(t, e, initial)
+
+	// Without the cycle, the orphan roles reject the import if asked to.
+	rules = rules[:len(rules)-1]
+	report, err = e.AddGroupingPoliciesValidated(rules, GroupingImportOptions{RejectOrphans: true})
+	var orphansErr *Err.ErrOrphanRoles
+	if !errors.As(err, &orphansErr) {
+		t.Fatalf("error: %v, supposed to be *errors.ErrOrphanRoles", err)
+	}
+	testImportReport(t, report, 0, duplicates, [][]string{}, []string{"contractor", "director"})
+	testGetGroupingPolicy(t, e, initial)
+
+	// Otherwise they are only reported.
+	report, err = e.AddGroupingPoliciesValidated(rules, GroupingImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testImportReport(t, report, 4, duplicates, [][]string{}, []string{"contractor", "director"})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}, {"carol", "team_lead"}, {"team_lead", "data2_admin"}, {"dave", "contractor"}, {"manager", "director"}})
+	testGetImplicitRoles(t, e, "carol", []string{"team_lead", "data2_admin"})
+	testEnforce(t, e, "carol", "data2", "write", true)
+
+	// A cycle with the rules already in the policy is found too.
+	report, err = e.AddGroupingPoliciesValidated([][]string{{"data2_admin", "carol"}}, GroupingImportOptions{})
+	if !errors.As(err, &cyclesErr) {
+		t.Fatalf("error: %v, supposed to be *errors.ErrRoleCycles", err)
+	}
+	testImportReport(t, report, 0, nil, [][]string{{"data2_admin", "carol", "team_lead", "data2_admin"}}, []string{})
+
+	// The same names in different domains are different roles.
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	report, err = e.AddGroupingPoliciesValidated([][]string{{"admin", "alice", "domain2"}}, GroupingImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testImportReport(t, report, 1, nil, [][]string{}, []string{})
+}
@@ -16,6 +16,7 @@ package casbin
 
 import (
 	"fmt"
+	"strings"
 
 	Err "github.com/casbin/casbin/v2/errors"
 	"github.com/casbin/casbin/v2/model"
@@ -26,16 +27,119 @@ const (
 	notImplemented = "not implemented"
 )
 
-func (e *Enforcer) shouldPersist() bool {
-	return e.adapter != nil && e.autoSave
+// shouldPersist reports whether changes to the ptype are saved to the adapter, see SetAutoSaveForPtype.
+func (e *Enforcer) shouldPersist(sec string, ptype string) bool {
+	return e.adapter != nil && e.autoSaveFor(sec, ptype) && !e.dryRun
 }
 
-func (e *Enforcer) shouldNotify() bool {
-	return e.watcher != nil && e.autoNotifyWatcher
+// shouldNotify reports whether changes to the ptype are sent to the watcher, see EnableNotifyWithoutAutoSave.
+func (e *Enforcer) shouldNotify(sec string, ptype string) bool {
+	return e.watcher != nil && e.autoNotifyWatcher && (e.notifyWithoutAutoSave || e.autoSaveFor(sec, ptype))
+}
+
+// notifyRules reports whether a change of n rules is sent to the watcher with the rules, see SetWatcherDiffThreshold.
+func (e *Enforcer) notifyRules(n int) bool {
+	return e.watcherDiffThreshold <= 0 || n <= e.watcherDiffThreshold
+}
+
+// autoSaveFor returns the autoSave setting of the ptype, the global one unless it is set by SetAutoSaveForPtype.
+func (e *Enforcer) autoSaveFor(sec string, ptype string) bool {
+	if autoSave, ok := e.autoSaveForPtype[sec+"."+ptype]; ok {
+		return autoSave
+	}
+	return e.autoSave
+}
+
+// logDryRun logs the adapter call that a change to the ptype skips in dry-run mode, see SetDryRun.
+// sec and ptype are empty for the calls saving a whole policy, which are logged regardless of autoSave.
+func (e *Enforcer) logDryRun(sec string, ptype string, call string, args ...interface{}) {
+	if !e.dryRun || e.adapter == nil || e.logger == nil || !e.logger.IsEnabled() {
+		return
+	}
+	if ptype != "" && !e.autoSaveFor(sec, ptype) {
+		return
+	}
+	e.logger.LogModel([][]string{{sec, ptype, "dry run, not saved: " + call + " " + fmt.Sprint(args...)}})
+}
+
+// validateRule checks that the rule fits the definition of its ptype: it must have one field per token,
+// optionally followed by its metadata fields, or more if extra fields are allowed, and no field may be empty unless empty fields are allowed.
+// Its fields given to eval() must be valid expressions if EnableEvalRuleValidation is enabled,
+// and it must pass the policy validator, if any.
+func (e *Enforcer) validateRule(sec string, ptype string, rule []string) *Err.ErrInvalidRule {
+	return e.validateRuleInModel(e.model, sec, ptype, rule)
+}
+
+// validateRuleInModel checks the rule against the definition of its ptype in the model m.
+func (e *Enforcer) validateRuleInModel(m model.Model, sec string, ptype string, rule []string) *Err.ErrInvalidRule {
+	ast, ok := m[sec][ptype]
+	if !ok {
+		return &Err.ErrInvalidRule{PType: ptype, Rule: rule, Reason: "ptype is not defined"}
+	}
+
+	expected := len(ast.Tokens)
+	if len(rule) < expected || (len(rule) > expected+len(ast.MetaTokens) && !e.allowExtraFields) {
+		return &Err.ErrInvalidRule{PType: ptype, Expected: expected, Rule: rule, Reason: fmt.Sprintf("got %d fields", len(rule))}
+	}
+	if !e.allowEmptyFields {
+		for i, field := range rule {
+			// the metadata fields may be left empty.
+			if field == "" && (i < expected || i >= expected+len(ast.MetaTokens)) {
+				return &Err.ErrInvalidRule{PType: ptype, Expected: expected, Rule: rule, Reason: fmt.Sprintf("field %d is empty", i)}
+			}
+		}
+	}
+	if e.validateEvalRules && sec == "p" {
+		if _, err := e.parseEvalFields(m, ptype, rule); err != nil {
+			return &Err.ErrInvalidRule{PType: ptype, Expected: expected, Rule: rule, Reason: err.Error(), Err: err}
+		}
+	}
+	if e.policyValidator != nil {
+		if err := e.policyValidator(ptype, rule); err != nil {
+			return &Err.ErrInvalidRule{PType: ptype, Expected: expected, Rule: rule, Reason: err.Error(), Err: err}
+		}
+	}
+	return nil
+}
+
+// storedRules returns the rules as the policy stores them, with the metadata fields they may be given without,
+// so that the adapter and the watcher are given the rules the model removes. The other rules are returned as is.
+func (e *Enforcer) storedRules(sec string, ptype string, rules [][]string) [][]string {
+	if ast, ok := e.model[sec][ptype]; !ok || len(ast.MetaTokens) == 0 {
+		return rules
+	}
+
+	stored := make([][]string, len(rules))
+	for i, rule := range rules {
+		if stored[i] = e.model.GetStoredPolicy(sec, ptype, rule); stored[i] == nil {
+			stored[i] = rule
+		}
+	}
+	return stored
+}
+
+// validateRules checks every rule with validateRule and reports all the invalid ones.
+func (e *Enforcer) validateRules(sec string, ptype string, rules [][]string) error {
+	var invalid Err.ErrInvalidRules
+	for _, rule := range rules {
+		if err := e.validateRule(sec, ptype, rule); err != nil {
+			invalid = append(invalid, err)
+		}
+	}
+	if len(invalid) != 0 {
+		return invalid
+	}
+	return nil
 }
 
 // addPolicy adds a rule to the current policy.
 func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []string) (bool, error) {
+	defer e.beginChange()()
+
+	if err := e.validateRule(sec, ptype, rule); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.AddPolicies(sec, ptype, [][]string{rule})
 	}
@@ -44,15 +148,27 @@ func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []strin
 		return false, nil
 	}
 
-	if e.shouldPersist() {
+	coalesce := e.shouldPersist(sec, ptype) && e.coalescing()
+	if e.shouldPersist(sec, ptype) && !coalesce {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.AddPolicy(sec, ptype, rule); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "AddPolicy", rule)
 
 	e.model.AddPolicy(sec, ptype, rule)
+	e.bumpPolicyGeneration()
+	// the write is queued once the rule is in the model
+	if coalesce {
+		if err := e.writeCoalescer.write(e.adapter, true, sec, ptype, rule); err != nil {
+			return true, err
+		}
+	}
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, [][]string{rule})
@@ -61,11 +177,21 @@ func (e *Enforcer) addPolicyWithoutNotify(sec string, ptype string, rule []strin
 		}
 	}
 
+	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return true, err
+	}
+
 	return true, nil
 }
 
 // addPolicies adds rules to the current policy.
 func (e *Enforcer) addPoliciesWithoutNotify(sec string, ptype string, rules [][]string) (bool, error) {
+	defer e.beginChange()()
+
+	if err := e.validateRules(sec, ptype, rules); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.AddPolicies(sec, ptype, rules)
 	}
@@ -74,15 +200,20 @@ func (e *Enforcer) addPoliciesWithoutNotify(sec string, ptype string, rules [][]
 		return false, nil
 	}
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.(persist.BatchAdapter).AddPolicies(sec, ptype, rules); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "AddPolicies", rules)
 
 	e.model.AddPolicies(sec, ptype, rules)
+	e.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyAdd, ptype, rules)
@@ -91,54 +222,90 @@ func (e *Enforcer) addPoliciesWithoutNotify(sec string, ptype string, rules [][]
 		}
 	}
 
+	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return true, err
+	}
+
 	return true, nil
 }
 
 // removePolicy removes a rule from the current policy.
 func (e *Enforcer) removePolicyWithoutNotify(sec string, ptype string, rule []string) (bool, error) {
+	defer e.beginChange()()
+
+	rule = e.storedRules(sec, ptype, [][]string{rule})[0]
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.RemovePolicies(sec, ptype, [][]string{rule})
 	}
 
-	if e.shouldPersist() {
+	coalesce := e.shouldPersist(sec, ptype) && e.coalescing()
+	if e.shouldPersist(sec, ptype) && !coalesce {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.RemovePolicy(sec, ptype, rule); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "RemovePolicy", rule)
 
 	ruleRemoved := e.model.RemovePolicy(sec, ptype, rule)
 	if !ruleRemoved {
 		return ruleRemoved, nil
 	}
+	e.bumpPolicyGeneration()
+	// the write is only queued for a rule the model held, an absent rule must not cancel a later add
+	if coalesce {
+		if err := e.writeCoalescer.write(e.adapter, false, sec, ptype, rule); err != nil {
+			return ruleRemoved, err
+		}
+	}
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{rule})
 		if err != nil {
 			return ruleRemoved, err
 		}
+		if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+			return ruleRemoved, err
+		}
 	}
 
 	return ruleRemoved, nil
 }
 
 func (e *Enforcer) updatePolicyWithoutNotify(sec string, ptype string, oldRule []string, newRule []string) (bool, error) {
+	defer e.beginChange()()
+
+	oldRule = e.storedRules(sec, ptype, [][]string{oldRule})[0]
+
+	if err := e.validateRule(sec, ptype, newRule); err != nil {
+		return false, err
+	}
+
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
 		return true, e.dispatcher.UpdatePolicy(sec, ptype, oldRule, newRule)
 	}
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.(persist.UpdatableAdapter).UpdatePolicy(sec, ptype, oldRule, newRule); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "UpdatePolicy", oldRule, newRule)
 	ruleUpdated := e.model.UpdatePolicy(sec, ptype, oldRule, newRule)
 	if !ruleUpdated {
 		return ruleUpdated, nil
 	}
+	e.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, [][]string{oldRule}) // remove the old rule
@@ -151,10 +318,22 @@ func (e *Enforcer) updatePolicyWithoutNotify(sec string, ptype string, oldRule [
 		}
 	}
 
+	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return ruleUpdated, err
+	}
+
 	return ruleUpdated, nil
 }
 
 func (e *Enforcer) updatePoliciesWithoutNotify(sec string, ptype string, oldRules [][]string, newRules [][]string) (bool, error) {
+	defer e.beginChange()()
+
+	oldRules = e.storedRules(sec, ptype, oldRules)
+
+	if err := e.validateRules(sec, ptype, newRules); err != nil {
+		return false, err
+	}
+
 	if len(newRules) != len(oldRules) {
 		return false, fmt.Errorf("the length of oldRules should be equal to the length of newRules, but got the length of oldRules is %d, the length of newRules is %d", len(oldRules), len(newRules))
 	}
@@ -163,18 +342,23 @@ func (e *Enforcer) updatePoliciesWithoutNotify(sec string, ptype string, oldRule
 		return true, e.dispatcher.UpdatePolicies(sec, ptype, oldRules, newRules)
 	}
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.(persist.UpdatableAdapter).UpdatePolicies(sec, ptype, oldRules, newRules); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "UpdatePolicies", oldRules, newRules)
 
 	ruleUpdated := e.model.UpdatePolicies(sec, ptype, oldRules, newRules)
 	if !ruleUpdated {
 		return ruleUpdated, nil
 	}
+	e.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, oldRules) // remove the old rules
@@ -187,11 +371,19 @@ func (e *Enforcer) updatePoliciesWithoutNotify(sec string, ptype string, oldRule
 		}
 	}
 
+	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return ruleUpdated, err
+	}
+
 	return ruleUpdated, nil
 }
 
 // removePolicies removes rules from the current policy.
 func (e *Enforcer) removePoliciesWithoutNotify(sec string, ptype string, rules [][]string) (bool, error) {
+	defer e.beginChange()()
+
+	rules = e.storedRules(sec, ptype, rules)
+
 	if !e.model.HasPolicies(sec, ptype, rules) {
 		return false, nil
 	}
@@ -200,30 +392,40 @@ func (e *Enforcer) removePoliciesWithoutNotify(sec string, ptype string, rules [
 		return true, e.dispatcher.RemovePolicies(sec, ptype, rules)
 	}
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.(persist.BatchAdapter).RemovePolicies(sec, ptype, rules); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "RemovePolicies", rules)
 
 	rulesRemoved := e.model.RemovePolicies(sec, ptype, rules)
 	if !rulesRemoved {
 		return rulesRemoved, nil
 	}
+	e.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, rules)
 		if err != nil {
 			return rulesRemoved, err
 		}
+		if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+			return rulesRemoved, err
+		}
 	}
 	return rulesRemoved, nil
 }
 
 // removeFilteredPolicy removes rules based on field filters from the current policy.
 func (e *Enforcer) removeFilteredPolicyWithoutNotify(sec string, ptype string, fieldIndex int, fieldValues []string) (bool, error) {
+	defer e.beginChange()()
+
 	if len(fieldValues) == 0 {
 		return false, Err.INVALID_FIELDVAULES_PARAMETER
 	}
@@ -232,36 +434,53 @@ func (e *Enforcer) removeFilteredPolicyWithoutNotify(sec string, ptype string, f
 		return true, e.dispatcher.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
 	}
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return false, err
+		}
 		if err := e.adapter.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...); err != nil {
 			if err.Error() != notImplemented {
 				return false, err
 			}
 		}
 	}
+	e.logDryRun(sec, ptype, "RemoveFilteredPolicy", fieldIndex, fieldValues)
 
 	ruleRemoved, effects := e.model.RemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
 	if !ruleRemoved {
 		return ruleRemoved, nil
 	}
+	e.bumpPolicyGeneration()
 
 	if sec == "g" {
 		err := e.BuildIncrementalRoleLinks(model.PolicyRemove, ptype, effects)
 		if err != nil {
 			return ruleRemoved, err
 		}
+		if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+			return ruleRemoved, err
+		}
 	}
 
 	return ruleRemoved, nil
 }
 
 func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	defer e.beginChange()()
+
+	if err := e.validateRules(sec, ptype, newRules); err != nil {
+		return nil, err
+	}
+
 	var (
 		oldRules [][]string
 		err      error
 	)
 
-	if e.shouldPersist() {
+	if e.shouldPersist(sec, ptype) {
+		if err := e.FlushWrites(); err != nil {
+			return nil, err
+		}
 		if oldRules, err = e.adapter.(persist.UpdatableAdapter).UpdateFilteredPolicies(sec, ptype, newRules, fieldIndex, fieldValues...); err != nil {
 			if err.Error() != notImplemented {
 				return nil, err
@@ -273,6 +492,10 @@ func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string,
 				oldRules[i] = oldRule[1:]
 			}
 		}
+	} else if e.dryRun {
+		// the adapter is not asked for the rules it replaces, they are the ones in memory.
+		oldRules = e.model.GetFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
+		e.logDryRun(sec, ptype, "UpdateFilteredPolicies", newRules, fieldIndex, fieldValues)
 	}
 
 	if e.dispatcher != nil && e.autoNotifyDispatcher {
@@ -281,6 +504,9 @@ func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string,
 
 	ruleChanged := e.model.RemovePolicies(sec, ptype, oldRules)
 	e.model.AddPolicies(sec, ptype, newRules)
+	if ruleChanged || len(newRules) != 0 {
+		e.bumpPolicyGeneration()
+	}
 	ruleChanged = ruleChanged && len(newRules) != 0
 	if !ruleChanged {
 		return make([][]string, 0), nil
@@ -297,6 +523,10 @@ func (e *Enforcer) updateFilteredPoliciesWithoutNotify(sec string, ptype string,
 		}
 	}
 
+	if err := e.model.SortPoliciesBySubjectHierarchy(); err != nil {
+		return oldRules, err
+	}
+
 	return oldRules, nil
 }
 
@@ -307,7 +537,7 @@ func (e *Enforcer) addPolicy(sec string, ptype string, rule []string) (bool, err
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
 		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
 			err = watcher.UpdateForAddPolicy(sec, ptype, rule...)
@@ -327,9 +557,9 @@ func (e *Enforcer) addPolicies(sec string, ptype string, rules [][]string) (bool
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
-		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok && e.notifyRules(len(rules)) {
 			err = watcher.UpdateForAddPolicies(sec, ptype, rules...)
 		} else {
 			err = e.watcher.Update()
@@ -342,12 +572,13 @@ func (e *Enforcer) addPolicies(sec string, ptype string, rules [][]string) (bool
 
 // removePolicy removes a rule from the current policy.
 func (e *Enforcer) removePolicy(sec string, ptype string, rule []string) (bool, error) {
+	rule = e.storedRules(sec, ptype, [][]string{rule})[0]
 	ok, err := e.removePolicyWithoutNotify(sec, ptype, rule)
 	if !ok || err != nil {
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
 		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
 			err = watcher.UpdateForRemovePolicy(sec, ptype, rule...)
@@ -362,12 +593,13 @@ func (e *Enforcer) removePolicy(sec string, ptype string, rule []string) (bool,
 }
 
 func (e *Enforcer) updatePolicy(sec string, ptype string, oldRule []string, newRule []string) (bool, error) {
+	oldRule = e.storedRules(sec, ptype, [][]string{oldRule})[0]
 	ok, err := e.updatePolicyWithoutNotify(sec, ptype, oldRule, newRule)
 	if !ok || err != nil {
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
 		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok {
 			err = watcher.UpdateForUpdatePolicy(sec, ptype, oldRule, newRule)
@@ -381,14 +613,15 @@ func (e *Enforcer) updatePolicy(sec string, ptype string, oldRule []string, newR
 }
 
 func (e *Enforcer) updatePolicies(sec string, ptype string, oldRules [][]string, newRules [][]string) (bool, error) {
+	oldRules = e.storedRules(sec, ptype, oldRules)
 	ok, err := e.updatePoliciesWithoutNotify(sec, ptype, oldRules, newRules)
 	if !ok || err != nil {
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
-		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok {
+		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok && e.notifyRules(len(oldRules)+len(newRules)) {
 			err = watcher.UpdateForUpdatePolicies(sec, ptype, oldRules, newRules)
 		} else {
 			err = e.watcher.Update()
@@ -401,14 +634,15 @@ func (e *Enforcer) updatePolicies(sec string, ptype string, oldRules [][]string,
 
 // removePolicies removes rules from the current policy.
 func (e *Enforcer) removePolicies(sec string, ptype string, rules [][]string) (bool, error) {
+	rules = e.storedRules(sec, ptype, rules)
 	ok, err := e.removePoliciesWithoutNotify(sec, ptype, rules)
 	if !ok || err != nil {
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
-		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
+		if watcher, ok := e.watcher.(persist.WatcherEx); ok && e.notifyRules(len(rules)) {
 			err = watcher.UpdateForRemovePolicies(sec, ptype, rules...)
 		} else {
 			err = e.watcher.Update()
@@ -419,6 +653,96 @@ func (e *Enforcer) removePolicies(sec string, ptype string, rules [][]string) (b
 	return true, nil
 }
 
+// addPoliciesWithResult adds the rules that are not in the current policy yet and reports the others as skipped,
+// only the new rules are persisted and sent to the watcher.
+func (e *Enforcer) addPoliciesWithResult(sec string, ptype string, rules [][]string) (AddPoliciesResult, error) {
+	result := AddPoliciesResult{Skipped: [][]string{}}
+	if err := e.validateRules(sec, ptype, rules); err != nil {
+		return result, err
+	}
+
+	var added [][]string
+	seen := map[string]struct{}{}
+	for _, rule := range rules {
+		key := strings.Join(rule, model.DefaultSep)
+		if _, ok := seen[key]; ok || e.model.HasPolicy(sec, ptype, rule) {
+			result.Skipped = append(result.Skipped, rule)
+			continue
+		}
+		seen[key] = struct{}{}
+		added = append(added, rule)
+	}
+
+	if len(added) == 0 {
+		return result, nil
+	}
+	ok, err := e.addPolicies(sec, ptype, added)
+	if ok {
+		result.Added = len(added)
+	}
+	return result, err
+}
+
+// removePoliciesWithResult removes the rules that are in the current policy and reports the others as missing,
+// only the present rules are removed from the storage and sent to the watcher.
+func (e *Enforcer) removePoliciesWithResult(sec string, ptype string, rules [][]string) (RemovePoliciesResult, error) {
+	result := RemovePoliciesResult{Missing: [][]string{}}
+
+	var removed [][]string
+	seen := map[string]struct{}{}
+	for _, rule := range rules {
+		key := strings.Join(rule, model.DefaultSep)
+		if _, ok := seen[key]; ok || !e.model.HasPolicy(sec, ptype, rule) {
+			result.Missing = append(result.Missing, rule)
+			continue
+		}
+		seen[key] = struct{}{}
+		removed = append(removed, rule)
+	}
+
+	if len(removed) == 0 {
+		return result, nil
+	}
+	ok, err := e.removePolicies(sec, ptype, removed)
+	if ok {
+		result.Removed = len(removed)
+	}
+	return result, err
+}
+
+// removeGroupingPoliciesAndPolicies removes the "g" rules and then the "p" rules from the current policy
+// with one batch call each, and notifies the watcher once for everything that was removed.
+// If removing the "p" rules fails, the "g" rules stay removed from both the model and the storage.
+func (e *Enforcer) removeGroupingPoliciesAndPolicies(gRules [][]string, pRules [][]string) (bool, error) {
+	gRules, pRules = e.storedRules("g", "g", gRules), e.storedRules("p", "p", pRules)
+	var gRemoved, pRemoved bool
+	var err error
+	if len(gRules) > 0 {
+		gRemoved, err = e.removePoliciesWithoutNotify("g", "g", gRules)
+	}
+	if err == nil && len(pRules) > 0 {
+		pRemoved, err = e.removePoliciesWithoutNotify("p", "p", pRules)
+	}
+
+	if gRemoved && e.shouldNotify("g", "g") || pRemoved && e.shouldNotify("p", "p") {
+		var notifyErr error
+		watcher, ok := e.watcher.(persist.WatcherEx)
+		switch {
+		case ok && !pRemoved && e.notifyRules(len(gRules)):
+			notifyErr = watcher.UpdateForRemovePolicies("g", "g", gRules...)
+		case ok && !gRemoved && e.notifyRules(len(pRules)):
+			notifyErr = watcher.UpdateForRemovePolicies("p", "p", pRules...)
+		default:
+			notifyErr = e.watcher.Update()
+		}
+		if err == nil {
+			err = notifyErr
+		}
+	}
+
+	return gRemoved || pRemoved, err
+}
+
 // removeFilteredPolicy removes rules based on field filters from the current policy.
 func (e *Enforcer) removeFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues []string) (bool, error) {
 	ok, err := e.removeFilteredPolicyWithoutNotify(sec, ptype, fieldIndex, fieldValues)
@@ -426,7 +750,7 @@ func (e *Enforcer) removeFilteredPolicy(sec string, ptype string, fieldIndex int
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
 		if watcher, ok := e.watcher.(persist.WatcherEx); ok {
 			err = watcher.UpdateForRemoveFilteredPolicy(sec, ptype, fieldIndex, fieldValues...)
@@ -446,9 +770,9 @@ func (e *Enforcer) updateFilteredPolicies(sec string, ptype string, newRules [][
 		return ok, err
 	}
 
-	if e.shouldNotify() {
+	if e.shouldNotify(sec, ptype) {
 		var err error
-		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok {
+		if watcher, ok := e.watcher.(persist.UpdatableWatcher); ok && e.notifyRules(len(oldRules)+len(newRules)) {
 			err = watcher.UpdateForUpdatePolicies(sec, ptype, oldRules, newRules)
 		} else {
 			err = e.watcher.Update()
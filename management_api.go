@@ -15,55 +15,155 @@
 package casbin
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/constant"
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/util"
 )
 
 // GetAllSubjects gets the list of subjects that show up in the current policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllSubjects() []string {
-	return e.model.GetValuesForFieldInPolicyAllTypes("p", 0)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicyAllTypes("p", 0))
 }
 
 // GetAllNamedSubjects gets the list of subjects that show up in the current named policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllNamedSubjects(ptype string) []string {
-	return e.model.GetValuesForFieldInPolicy("p", ptype, 0)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicy("p", ptype, 0))
 }
 
 // GetAllObjects gets the list of objects that show up in the current policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllObjects() []string {
-	return e.model.GetValuesForFieldInPolicyAllTypes("p", 1)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicyAllTypes("p", 1))
 }
 
 // GetAllNamedObjects gets the list of objects that show up in the current named policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllNamedObjects(ptype string) []string {
-	return e.model.GetValuesForFieldInPolicy("p", ptype, 1)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicy("p", ptype, 1))
 }
 
 // GetAllActions gets the list of actions that show up in the current policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllActions() []string {
-	return e.model.GetValuesForFieldInPolicyAllTypes("p", 2)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicyAllTypes("p", 2))
 }
 
 // GetAllNamedActions gets the list of actions that show up in the current named policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllNamedActions(ptype string) []string {
-	return e.model.GetValuesForFieldInPolicy("p", ptype, 2)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicy("p", ptype, 2))
 }
 
 // GetAllRoles gets the list of roles that show up in the current policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllRoles() []string {
-	return e.model.GetValuesForFieldInPolicyAllTypes("g", 1)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicyAllTypes("g", 1))
 }
 
 // GetAllNamedRoles gets the list of roles that show up in the current named policy.
+// The list keeps the order of first appearance, or is sorted if SetDeterministicOutput(true) was called.
 func (e *Enforcer) GetAllNamedRoles(ptype string) []string {
-	return e.model.GetValuesForFieldInPolicy("g", ptype, 1)
+	return e.sortIfDeterministic(e.model.GetValuesForFieldInPolicy("g", ptype, 1))
 }
 
-// GetPolicy gets all the authorization rules in the policy.
+const (
+	// RoleSourceGrouping is the source of the roles of the g rules, see RoleWithSource.
+	RoleSourceGrouping = "grouping"
+	// RoleSourcePattern is the source of the roles the users have through a pattern role of the g rules matching
+	// them, with the matching function of g, e.g. "book_reader" for g, bob, book_*.
+	RoleSourcePattern = "pattern"
+	// RoleSourcePolicy is the source of the subjects of the p rules that no g rule mentions.
+	RoleSourcePolicy = "policy"
+)
+
+// RoleWithSource is a role along with where it comes from: RoleSourceGrouping, RoleSourcePattern or RoleSourcePolicy.
+type RoleWithSource struct {
+	Name   string
+	Source string
+}
+
+// GetAllRolesDetailed gets the roles of g like GetAllNamedRoles("g"), followed by the roles the users only have
+// through a pattern role, and by the subjects of the p rules no g rule mentions, which may be roles granted
+// permissions before being given to users as well as users without roles. The roles of every source keep
+// the order of first appearance. If a domain is given, only the rules of the domain are considered.
+func (e *Enforcer) GetAllRolesDetailed(domain ...string) []RoleWithSource {
+	inDomain := func(rule []string, index int) bool {
+		return len(domain) == 0 || index < 0 || index >= len(rule) || rule[index] == domain[0]
+	}
+
+	var res []RoleWithSource
+	seen := map[string]bool{}
+	add := func(name string, source string) {
+		if !seen[name] {
+			seen[name] = true
+			res = append(res, RoleWithSource{Name: name, Source: source})
+		}
+	}
+
+	var users, candidates []string
+	for _, rule := range e.GetNamedGroupingPolicy("g") {
+		if len(rule) > 1 && inDomain(rule, 2) {
+			add(rule[1], RoleSourceGrouping)
+			users = append(users, rule[0])
+		}
+	}
+
+	subIndex, err := e.GetFieldIndex("p", constant.SubjectIndex)
+	if err != nil {
+		subIndex = 0
+	}
+	domainIndex, err := e.GetFieldIndex("p", constant.DomainIndex)
+	if err != nil {
+		domainIndex = -1
+	}
+	for _, rule := range e.GetNamedPolicy("p") {
+		if subIndex < len(rule) && inDomain(rule, domainIndex) {
+			candidates = append(candidates, rule[subIndex])
+		}
+	}
+
+	// the subjects the role manager knows users of are roles through a pattern.
+	for _, name := range candidates {
+		if !seen[name] && e.HasNamedRole("g", name, domain...) {
+			add(name, RoleSourcePattern)
+		}
+	}
+	for _, name := range users {
+		seen[name] = true
+	}
+	for _, name := range candidates {
+		add(name, RoleSourcePolicy)
+	}
+	return res
+}
+
+// HasRole determines whether a user has the role of g, directly or through a pattern role. It is false
+// for a role that is only the subject of p rules.
+func (e *Enforcer) HasRole(role string, domain ...string) bool {
+	return e.HasNamedRole("g", role, domain...)
+}
+
+// HasNamedRole determines whether a user has the role of the named role definition, according to its role manager,
+// so the users having the role through a pattern role of the rules with a matching function count.
+func (e *Enforcer) HasNamedRole(ptype string, role string, domain ...string) bool {
+	ast, ok := e.model["g"][ptype]
+	if !ok || ast.RM == nil {
+		return false
+	}
+	users, err := ast.RM.GetUsers(role, domain...)
+	return err == nil && len(users) != 0
+}
+
+// GetPolicy gets all the authorization rules in the policy, in the order they are stored in the model.
 func (e *Enforcer) GetPolicy() [][]string {
 	return e.GetNamedPolicy("p")
 }
@@ -103,18 +203,70 @@ func (e *Enforcer) GetFilteredNamedGroupingPolicy(ptype string, fieldIndex int,
 	return e.model.GetFilteredPolicy("g", ptype, fieldIndex, fieldValues...)
 }
 
+// GetFilteredGroupingPolicyMatched gets the role inheritance rules that would link for the given field values.
+// The stored rules may be patterns, see GetFilteredNamedGroupingPolicyMatched.
+func (e *Enforcer) GetFilteredGroupingPolicyMatched(fieldIndex int, fieldValues ...string) [][]string {
+	return e.GetFilteredNamedGroupingPolicyMatched("g", fieldIndex, fieldValues...)
+}
+
+// nameMatcher is implemented by role managers whose Match compares domains, like the default one.
+type nameMatcher interface {
+	MatchName(str string, pattern string) bool
+}
+
+// GetFilteredNamedGroupingPolicyMatched gets the role inheritance rules that would link for the given field values.
+// Unlike GetFilteredNamedGroupingPolicy, the user and role fields are compared with the role manager's matching
+// function and the domain field with its domain matching function, so a rule like "g, alice, /admin/*, domain"
+// is returned for the role "/admin/users". An empty field value matches any rule.
+func (e *Enforcer) GetFilteredNamedGroupingPolicyMatched(ptype string, fieldIndex int, fieldValues ...string) [][]string {
+	rm, ok := e.rmMap[ptype]
+	if !ok {
+		return e.GetFilteredNamedGroupingPolicy(ptype, fieldIndex, fieldValues...)
+	}
+
+	nameMatch := rm.Match
+	domainMatch := func(str string, pattern string) bool { return str == pattern }
+	if dm, ok := rm.(nameMatcher); ok {
+		// Match of a domain-aware role manager compares domains, names go through MatchName.
+		nameMatch = dm.MatchName
+		domainMatch = rm.Match
+	}
+
+	res := [][]string{}
+	for _, rule := range e.model["g"][ptype].Policy {
+		matched := true
+		for i, fieldValue := range fieldValues {
+			index := fieldIndex + i
+			if fieldValue == "" || rule[index] == fieldValue {
+				continue
+			}
+			switch {
+			case index < 2:
+				matched = nameMatch(fieldValue, rule[index])
+			case index == 2:
+				matched = domainMatch(fieldValue, rule[index])
+			default:
+				matched = false
+			}
+			if !matched {
+				break
+			}
+		}
+
+		if matched {
+			res = append(res, rule)
+		}
+	}
+
+	return res
+}
+
 // GetFilteredNamedPolicyWithMatcher gets rules based on matcher from the policy.
 func (e *Enforcer) GetFilteredNamedPolicyWithMatcher(ptype string, matcher string) ([][]string, error) {
 	var res [][]string
 	var err error
 
-	functions := e.fm.GetFunctions()
-	if _, ok := e.model["g"]; ok {
-		for key, ast := range e.model["g"] {
-			rm := ast.RM
-			functions[key] = util.GenerateGFunction(rm)
-		}
-	}
+	functions := e.getFunctions(context.Background())
 
 	var expString string
 	if matcher == "" {
@@ -141,7 +293,7 @@ func (e *Enforcer) GetFilteredNamedPolicyWithMatcher(ptype string, matcher strin
 
 	if policyLen := len(e.model["p"][ptype].Policy); policyLen != 0 && strings.Contains(expString, ptype+"_") {
 		for _, pvals := range e.model["p"][ptype].Policy {
-			if len(e.model["p"][ptype].Tokens) != len(pvals) {
+			if !e.model["p"][ptype].IsValidPolicySize(pvals) {
 				return res, fmt.Errorf(
 					"invalid policy size: expected %d, got %d, pvals: %v",
 					len(e.model["p"][ptype].Tokens),
@@ -230,6 +382,34 @@ func (e *Enforcer) AddNamedPolicies(ptype string, rules [][]string) (bool, error
 	return e.addPolicies("p", ptype, rules)
 }
 
+// AddPoliciesResult reports what a batch addition changed.
+type AddPoliciesResult struct {
+	// Added is the number of rules that were added.
+	Added int
+	// Skipped are the rules that were not added because they were already in the policy.
+	Skipped [][]string
+}
+
+// RemovePoliciesResult reports what a batch removal changed.
+type RemovePoliciesResult struct {
+	// Removed is the number of rules that were removed.
+	Removed int
+	// Missing are the rules that were not removed because they were not in the policy.
+	Missing [][]string
+}
+
+// AddPoliciesWithResult adds authorization rules to the current policy like AddPolicies,
+// but the rules that already exist are skipped instead of failing the whole batch.
+func (e *Enforcer) AddPoliciesWithResult(rules [][]string) (AddPoliciesResult, error) {
+	return e.AddNamedPoliciesWithResult("p", rules)
+}
+
+// AddNamedPoliciesWithResult adds authorization rules to the current named policy,
+// the rules that already exist are skipped and reported in the result.
+func (e *Enforcer) AddNamedPoliciesWithResult(ptype string, rules [][]string) (AddPoliciesResult, error) {
+	return e.addPoliciesWithResult("p", ptype, rules)
+}
+
 // RemovePolicy removes an authorization rule from the current policy.
 func (e *Enforcer) RemovePolicy(params ...interface{}) (bool, error) {
 	return e.RemoveNamedPolicy("p", params...)
@@ -266,6 +446,30 @@ func (e *Enforcer) RemovePolicies(rules [][]string) (bool, error) {
 	return e.RemoveNamedPolicies("p", rules)
 }
 
+// RemovePoliciesWithResult removes authorization rules from the current policy like RemovePolicies,
+// but the rules that do not exist are reported as missing instead of failing the whole batch.
+func (e *Enforcer) RemovePoliciesWithResult(rules [][]string) (RemovePoliciesResult, error) {
+	return e.RemoveNamedPoliciesWithResult("p", rules)
+}
+
+// RemoveNamedPoliciesWithResult removes authorization rules from the current named policy,
+// the rules that do not exist are reported as missing in the result.
+func (e *Enforcer) RemoveNamedPoliciesWithResult(ptype string, rules [][]string) (RemovePoliciesResult, error) {
+	return e.removePoliciesWithResult("p", ptype, rules)
+}
+
+// RemovePoliciesEx removes the authorization rules that are in the current policy and ignores the others,
+// only the rules actually removed are removed from the storage. It returns true if any rule was removed.
+func (e *Enforcer) RemovePoliciesEx(rules [][]string) (bool, error) {
+	return e.RemoveNamedPoliciesEx("p", rules)
+}
+
+// RemoveNamedPoliciesEx removes the authorization rules that are in the current named policy and ignores the others.
+func (e *Enforcer) RemoveNamedPoliciesEx(ptype string, rules [][]string) (bool, error) {
+	result, err := e.removePoliciesWithResult("p", ptype, rules)
+	return result.Removed > 0, err
+}
+
 // RemoveFilteredPolicy removes an authorization rule from the current policy, field filters can be specified.
 func (e *Enforcer) RemoveFilteredPolicy(fieldIndex int, fieldValues ...string) (bool, error) {
 	return e.RemoveFilteredNamedPolicy("p", fieldIndex, fieldValues...)
@@ -294,6 +498,21 @@ func (e *Enforcer) RemoveFilteredNamedPolicy(ptype string, fieldIndex int, field
 	return e.removeFilteredPolicy("p", ptype, fieldIndex, fieldValues)
 }
 
+// GetPolicyMetadata returns the metadata fields of an authorization rule, keyed by the metadata tokens of the
+// policy definition, e.g. {"desc": "...", "owner": "..."} for "p = sub, obj, act | meta: desc, owner".
+// The rule may be given with or without its metadata. It returns nil if the rule does not exist.
+func (e *Enforcer) GetPolicyMetadata(rule []string) map[string]string {
+	return e.GetNamedPolicyMetadata("p", rule)
+}
+
+// GetNamedPolicyMetadata returns the metadata fields of an authorization rule of the named policy.
+func (e *Enforcer) GetNamedPolicyMetadata(ptype string, rule []string) map[string]string {
+	if _, ok := e.model["p"][ptype]; !ok {
+		return nil
+	}
+	return e.model.GetPolicyMetadata("p", ptype, rule)
+}
+
 // HasGroupingPolicy determines whether a role inheritance rule exists.
 func (e *Enforcer) HasGroupingPolicy(params ...interface{}) bool {
 	return e.HasNamedGroupingPolicy("g", params...)
@@ -354,6 +573,18 @@ func (e *Enforcer) AddNamedGroupingPolicies(ptype string, rules [][]string) (boo
 	return e.addPolicies("g", ptype, rules)
 }
 
+// AddGroupingPoliciesWithResult adds role inheritance rules to the current policy like AddGroupingPolicies,
+// but the rules that already exist are skipped instead of failing the whole batch.
+func (e *Enforcer) AddGroupingPoliciesWithResult(rules [][]string) (AddPoliciesResult, error) {
+	return e.AddNamedGroupingPoliciesWithResult("g", rules)
+}
+
+// AddNamedGroupingPoliciesWithResult adds named role inheritance rules to the current policy,
+// the rules that already exist are skipped and reported in the result.
+func (e *Enforcer) AddNamedGroupingPoliciesWithResult(ptype string, rules [][]string) (AddPoliciesResult, error) {
+	return e.addPoliciesWithResult("g", ptype, rules)
+}
+
 // RemoveGroupingPolicy removes a role inheritance rule from the current policy.
 func (e *Enforcer) RemoveGroupingPolicy(params ...interface{}) (bool, error) {
 	return e.RemoveNamedGroupingPolicy("g", params...)
@@ -364,6 +595,18 @@ func (e *Enforcer) RemoveGroupingPolicies(rules [][]string) (bool, error) {
 	return e.RemoveNamedGroupingPolicies("g", rules)
 }
 
+// RemoveGroupingPoliciesWithResult removes role inheritance rules from the current policy like RemoveGroupingPolicies,
+// but the rules that do not exist are reported as missing instead of failing the whole batch.
+func (e *Enforcer) RemoveGroupingPoliciesWithResult(rules [][]string) (RemovePoliciesResult, error) {
+	return e.RemoveNamedGroupingPoliciesWithResult("g", rules)
+}
+
+// RemoveNamedGroupingPoliciesWithResult removes role inheritance rules from the current named policy,
+// the rules that do not exist are reported as missing in the result.
+func (e *Enforcer) RemoveNamedGroupingPoliciesWithResult(ptype string, rules [][]string) (RemovePoliciesResult, error) {
+	return e.removePoliciesWithResult("g", ptype, rules)
+}
+
 // RemoveFilteredGroupingPolicy removes a role inheritance rule from the current policy, field filters can be specified.
 func (e *Enforcer) RemoveFilteredGroupingPolicy(fieldIndex int, fieldValues ...string) (bool, error) {
 	return e.RemoveFilteredNamedGroupingPolicy("g", fieldIndex, fieldValues...)
@@ -414,9 +657,64 @@ func (e *Enforcer) RemoveFilteredNamedGroupingPolicy(ptype string, fieldIndex in
 	return e.removeFilteredPolicy("g", ptype, fieldIndex, fieldValues)
 }
 
-// AddFunction adds a customized function.
+// AddFunction adds a customized function, replacing the function already added under the name.
+// The built-in functions like keyMatch cannot be replaced, they are kept.
+// Functions should ideally be added before serving traffic, but adding them while enforcing is safe:
+// the compiled matchers are discarded and recompiled with the new function on the next enforce.
 func (e *Enforcer) AddFunction(name string, function govaluate.ExpressionFunction) {
 	e.fm.AddFunction(name, function)
+	e.invalidateFunctions()
+}
+
+// AddFunctionAuto adds a customized function written as a plain Go func, e.g. func(string, string) bool,
+// see util.WrapFunction for the supported signatures. Unlike AddFunction, a matcher calling the function
+// with the wrong number or types of arguments gets a descriptive error instead of a panic.
+func (e *Enforcer) AddFunctionAuto(name string, fn interface{}) error {
+	function, err := util.WrapFunction(name, fn)
+	if err != nil {
+		return err
+	}
+	e.AddFunction(name, function)
+	return nil
+}
+
+// AddContextFunction adds a customized function that is given the context of the enforcement, see EnforceCtx,
+// replacing the function already added under the name, except a built-in function. A matcher calling a context function is compiled for
+// every enforcement, the enforcements without a context give it context.Background().
+func (e *Enforcer) AddContextFunction(name string, function model.ContextFunction) {
+	e.fm.AddContextFunction(name, function)
+	e.invalidateFunctions()
+}
+
+// GetFunctionNames returns the sorted names of the functions the matchers can call: the built-in ones,
+// the role functions of the role definitions like g and g2, and the ones added by AddFunction and AddContextFunction.
+func (e *Enforcer) GetFunctionNames() []string {
+	functions := e.getFunctions(context.Background())
+	names := make([]string, 0, len(functions))
+	for name := range functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasFunction returns whether the matchers can call the function, see GetFunctionNames.
+func (e *Enforcer) HasFunction(name string) bool {
+	if _, ok := e.model["g"][name]; ok {
+		return true
+	}
+	if _, ok := e.fm.GetContextFunctions()[name]; ok {
+		return true
+	}
+	_, ok := e.fm.GetFunctions()[name]
+	return ok
+}
+
+// VerifyFunctions returns an *errors.ErrMissingFunctions listing the functions the model requires in its
+// [functions] section that the matchers cannot call. Call it once the custom functions are added,
+// enforcing fails with the same error until they are.
+func (e *Enforcer) VerifyFunctions() error {
+	return checkRequiredFunctions(e.model.GetRequiredFunctions(), e.getFunctions(context.Background()))
 }
 
 func (e *Enforcer) SelfAddPolicy(sec string, ptype string, rule []string) (bool, error) {
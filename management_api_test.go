@@ -15,8 +15,17 @@
 package casbin
 
 import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	jsonadapter "github.com/casbin/casbin/v2/persist/json-adapter"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -39,6 +48,64 @@ func TestGetList(t *testing.T) {
 	testStringList(t, "Roles", e.GetAllRoles, []string{"data2_admin"})
 }
 
+func testHasNamedRole(t *testing.T, e *Enforcer, ptype string, role string, res bool, domain ...string) {
+	t.Helper()
+	if myRes := e.HasNamedRole(ptype, role, domain...); myRes != res {
+		t.Errorf("HasNamedRole(%s, %s, %v): %t, supposed to be %t", ptype, role, domain, myRes, res)
+	}
+}
+
+func TestGetAllRolesDetailed(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	e.AddNamedMatchingFunc("g", "KeyMatch", util.KeyMatch)
+	_, _ = e.AddPolicies([][]string{
+		{"admin", "data1", "write"},
+		{"book_reader", "book", "read"},
+		{"auditor", "logs", "read"},
+		{"alice", "data2", "read"},
+	})
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "admin"}, {"bob", "book_*"}, {"admin", "staff"}})
+
+	// book_reader is a role of bob through book_*, auditor is only the subject of a p rule, alice is a user.
+	expected := []RoleWithSource{
+		{"admin", RoleSourceGrouping},
+		{"book_*", RoleSourceGrouping},
+		{"staff", RoleSourceGrouping},
+		{"book_reader", RoleSourcePattern},
+		{"auditor", RoleSourcePolicy},
+	}
+	if roles := e.GetAllRolesDetailed(); !reflect.DeepEqual(roles, expected) {
+		t.Errorf("GetAllRolesDetailed: %v, supposed to be %v", roles, expected)
+	}
+	testStringList(t, "Roles", e.GetAllRoles, []string{"admin", "book_*", "staff"})
+
+	testHasNamedRole(t, e, "g", "admin", true)
+	testHasNamedRole(t, e, "g", "staff", true)
+	testHasNamedRole(t, e, "g", "book_reader", true)
+	testHasNamedRole(t, e, "g", "auditor", false)
+	testHasNamedRole(t, e, "g", "alice", false)
+	testHasNamedRole(t, e, "g", "book_writer", true)
+	testHasNamedRole(t, e, "g2", "admin", false)
+	if !e.HasRole("admin") || e.HasRole("auditor") {
+		t.Error("HasRole: admin should exist and auditor should not")
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf")
+	_, _ = e.AddPolicies([][]string{{"admin", "domain1", "data1", "read"}, {"reviewer", "domain2", "data2", "read"}})
+	_, _ = e.AddGroupingPolicy("alice", "admin", "domain1")
+
+	expected = []RoleWithSource{{"admin", RoleSourceGrouping}}
+	if roles := e.GetAllRolesDetailed("domain1"); !reflect.DeepEqual(roles, expected) {
+		t.Errorf("GetAllRolesDetailed(domain1): %v, supposed to be %v", roles, expected)
+	}
+	expected = []RoleWithSource{{"reviewer", RoleSourcePolicy}}
+	if roles := e.GetAllRolesDetailed("domain2"); !reflect.DeepEqual(roles, expected) {
+		t.Errorf("GetAllRolesDetailed(domain2): %v, supposed to be %v", roles, expected)
+	}
+	testHasNamedRole(t, e, "g", "admin", true, "domain1")
+	testHasNamedRole(t, e, "g", "admin", false, "domain2")
+}
+
 func testGetPolicy(t *testing.T, e *Enforcer, res [][]string) {
 	t.Helper()
 	myRes := e.GetPolicy()
@@ -93,6 +160,16 @@ func testGetFilteredGroupingPolicy(t *testing.T, e *Enforcer, fieldIndex int, re
 	}
 }
 
+func testGetFilteredGroupingPolicyMatched(t *testing.T, e *Enforcer, fieldIndex int, res [][]string, fieldValues ...string) {
+	t.Helper()
+	myRes := e.GetFilteredGroupingPolicyMatched(fieldIndex, fieldValues...)
+	t.Log("Matched grouping policy for ", util.ParamsToString(fieldValues...), ": ", myRes)
+
+	if !util.Array2DEquals(res, myRes) {
+		t.Error("Matched grouping policy for ", util.ParamsToString(fieldValues...), ": ", myRes, ", supposed to be ", res)
+	}
+}
+
 func testHasPolicy(t *testing.T, e *Enforcer, policy []string, res bool) {
 	t.Helper()
 	myRes := e.HasPolicy(policy)
@@ -160,6 +237,32 @@ func TestGetPolicyAPI(t *testing.T) {
 	testHasGroupingPolicy(t, e, []string{"bob", "data2_admin"}, false)
 }
 
+func TestGetFilteredGroupingPolicyMatched(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_all_pattern_model.conf", "examples/rbac_with_all_pattern_policy.csv")
+
+	// Without matching functions only exact values match.
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{}, "/book/1", "book_group", "domain1")
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{{"/book/:id", "book_group", "*"}}, "/book/:id", "book_group", "*")
+
+	e.AddNamedMatchingFunc("g", "keyMatch2", util.KeyMatch2)
+	e.AddNamedDomainMatchingFunc("g", "keyMatch2", util.KeyMatch2)
+
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{{"/book/:id", "book_group", "*"}}, "/book/1", "book_group", "domain1")
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{{"/book/:id", "book_group", "*"}}, "/book/1")
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{}, "/pen/1")
+	testGetFilteredGroupingPolicyMatched(t, e, 1, [][]string{}, "pen_group")
+	// The exact variant is left unchanged.
+	testGetFilteredGroupingPolicy(t, e, 0, [][]string{}, "/book/1", "book_group", "domain1")
+
+	e, _ = NewEnforcer("examples/rbac_with_domain_pattern_model.conf", "examples/rbac_with_domain_pattern_policy.csv")
+	e.AddNamedDomainMatchingFunc("g", "keyMatch2", util.KeyMatch2)
+
+	testGetFilteredGroupingPolicyMatched(t, e, 0, [][]string{{"alice", "admin", "*"}}, "alice", "admin", "domain1")
+	testGetFilteredGroupingPolicyMatched(t, e, 1, [][]string{{"alice", "admin", "*"}, {"bob", "admin", "domain2"}}, "admin", "domain2")
+	testGetFilteredGroupingPolicyMatched(t, e, 2, [][]string{{"alice", "admin", "*"}}, "domain3")
+	testGetFilteredGroupingPolicy(t, e, 2, [][]string{}, "domain3")
+}
+
 func TestModifyPolicyAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
 
@@ -301,3 +404,470 @@ func TestModifyGroupingPolicyAPI(t *testing.T) {
 	testGetRoles(t, e, []string{"admin_groups"}, "eve")
 
 }
+
+func testInvalidRule(t *testing.T, title string, err error, ptype string, expected int, rules ...[]string) {
+	t.Helper()
+	var invalid Err.ErrInvalidRules
+	switch err := err.(type) {
+	case *Err.ErrInvalidRule:
+		invalid = Err.ErrInvalidRules{err}
+	case Err.ErrInvalidRules:
+		invalid = err
+	default:
+		t.Errorf("%s: %v, supposed to be an invalid rule error", title, err)
+		return
+	}
+
+	if len(invalid) != len(rules) {
+		t.Errorf("%s: %v, supposed to report %d rules", title, err, len(rules))
+		return
+	}
+	for i, ruleErr := range invalid {
+		if ruleErr.PType != ptype || ruleErr.Expected != expected || !util.ArrayEquals(ruleErr.Rule, rules[i]) {
+			t.Errorf("%s: %v, supposed to be about %s rule %v with %d fields", title, ruleErr, ptype, rules[i], expected)
+		}
+	}
+}
+
+func TestInvalidRules(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	_, err := e.AddPolicy("alice", "data1")
+	testInvalidRule(t, "AddPolicy", err, "p", 3, []string{"alice", "data1"})
+	_, err = e.AddPolicy("alice", "data1", "read", "extra")
+	testInvalidRule(t, "AddPolicy", err, "p", 3, []string{"alice", "data1", "read", "extra"})
+	_, err = e.AddNamedPolicy("p", "alice", "", "read")
+	testInvalidRule(t, "AddNamedPolicy", err, "p", 3, []string{"alice", "", "read"})
+	_, err = e.AddPolicies([][]string{{"eve", "data3", "read"}, {"eve", "data3"}, {"eve", "data4", "read"}, {"", "data3", "write"}})
+	testInvalidRule(t, "AddPolicies", err, "p", 3, []string{"eve", "data3"}, []string{"", "data3", "write"})
+	_, err = e.AddGroupingPolicy("eve")
+	testInvalidRule(t, "AddGroupingPolicy", err, "g", 2, []string{"eve"})
+	_, err = e.AddNamedGroupingPolicy("g", "eve", "data2_admin", "domain1")
+	testInvalidRule(t, "AddNamedGroupingPolicy", err, "g", 2, []string{"eve", "data2_admin", "domain1"})
+	_, err = e.AddGroupingPolicies([][]string{{"eve", ""}, {"frank", "data2_admin"}})
+	testInvalidRule(t, "AddGroupingPolicies", err, "g", 2, []string{"eve", ""})
+	_, err = e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1"})
+	testInvalidRule(t, "UpdatePolicy", err, "p", 3, []string{"alice", "data1"})
+	_, err = e.UpdatePolicies([][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}, [][]string{{"alice", ""}, {"bob", "data2", ""}})
+	testInvalidRule(t, "UpdatePolicies", err, "p", 3, []string{"alice", ""}, []string{"bob", "data2", ""})
+	_, err = e.UpdateGroupingPolicy([]string{"alice", "data2_admin"}, []string{"alice", "data2_admin", "domain1"})
+	testInvalidRule(t, "UpdateGroupingPolicy", err, "g", 2, []string{"alice", "data2_admin", "domain1"})
+	_, err = e.UpdateFilteredPolicies([][]string{{"alice"}}, 0, "alice")
+	testInvalidRule(t, "UpdateFilteredPolicies", err, "p", 3, []string{"alice"})
+
+	// Nothing was changed by the rejected operations.
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}})
+
+	e.AllowExtraFields(true)
+	e.AllowEmptyFields(true)
+	if _, err = e.AddPolicy("alice", "data1", "read", "extra"); err != nil {
+		t.Error(err)
+	}
+	if _, err = e.AddGroupingPolicy("bob", "data2_admin", "custom_data"); err != nil {
+		t.Error(err)
+	}
+	if _, err = e.AddPolicy("alice", "", "read"); err != nil {
+		t.Error(err)
+	}
+	// Missing fields are never accepted.
+	_, err = e.AddPolicy("alice", "data1")
+	testInvalidRule(t, "AddPolicy", err, "p", 3, []string{"alice", "data1"})
+	testEnforce(t, e, "bob", "data2", "read", true)
+}
+
+var errUnknownAction = errors.New("unknown action")
+
+// validateAction accepts the "p" rules whose action is read or write.
+func validateAction(ptype string, rule []string) error {
+	if ptype == "p" && rule[2] != "read" && rule[2] != "write" {
+		return errUnknownAction
+	}
+	return nil
+}
+
+func TestPolicyValidator(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.SetPolicyValidator(validateAction)
+
+	_, err := e.AddPolicy("alice", "data1", "delete")
+	testInvalidRule(t, "AddPolicy", err, "p", 3, []string{"alice", "data1", "delete"})
+	if !errors.Is(err, errUnknownAction) {
+		t.Errorf("AddPolicy: %v, supposed to wrap the error of the validator", err)
+	}
+	_, err = e.AddPolicies([][]string{{"eve", "data3", "read"}, {"eve", "data3", "delete"}})
+	testInvalidRule(t, "AddPolicies", err, "p", 3, []string{"eve", "data3", "delete"})
+	_, err = e.UpdatePolicy([]string{"alice", "data1", "read"}, []string{"alice", "data1", "delete"})
+	testInvalidRule(t, "UpdatePolicy", err, "p", 3, []string{"alice", "data1", "delete"})
+
+	if ok, err := e.AddPolicy("alice", "data3", "write"); !ok || err != nil {
+		t.Errorf("AddPolicy: %t, %v, supposed to add the valid rule", ok, err)
+	}
+	if ok, err := e.AddGroupingPolicy("eve", "data2_admin"); !ok || err != nil {
+		t.Errorf("AddGroupingPolicy: %t, %v, supposed to add the valid rule", ok, err)
+	}
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read"},
+		{"bob", "data2", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+		{"alice", "data3", "write"}})
+}
+
+func TestPolicyValidationOnLoad(t *testing.T) {
+	logger := &modelLogger{}
+	logger.EnableLog(true)
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", logger)
+	e.SetPolicyValidator(func(ptype string, rule []string) error {
+		if ptype == "p" && rule[2] == "write" {
+			return errUnknownAction
+		}
+		return nil
+	})
+
+	// the loaded rules are not validated by default.
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	logger.rows = nil
+
+	e.SetPolicyValidationOnLoad(LoadValidationWarn)
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	if len(logger.rows) != 2 {
+		t.Errorf("logged rows: %v, supposed to warn about the 2 write rules", logger.rows)
+	}
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	e.SetPolicyValidationOnLoad(LoadValidationReject)
+	_, _ = e.RemovePolicy("bob", "data2", "write")
+	err := e.LoadPolicy()
+	testInvalidRule(t, "LoadPolicy", err, "p", 3, []string{"bob", "data2", "write"})
+	testEnforce(t, e, "bob", "data2", "write", false)
+}
+
+func testAddPoliciesResult(t *testing.T, title string, result AddPoliciesResult, err error, added int, skipped [][]string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", title, err)
+	}
+	if result.Added != added || !util.Array2DEquals(result.Skipped, skipped) {
+		t.Errorf("%s: %d added, %v skipped, supposed to be %d added, %v skipped", title, result.Added, result.Skipped, added, skipped)
+	}
+}
+
+func testRemovePoliciesResult(t *testing.T, title string, result RemovePoliciesResult, err error, removed int, missing [][]string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: %v", title, err)
+	}
+	if result.Removed != removed || !util.Array2DEquals(result.Missing, missing) {
+		t.Errorf("%s: %d removed, %v missing, supposed to be %d removed, %v missing", title, result.Removed, result.Missing, removed, missing)
+	}
+}
+
+func TestPoliciesWithResult(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+
+	// Fully new.
+	result, err := e.AddPoliciesWithResult([][]string{{"eve", "data3", "read"}, {"eve", "data3", "write"}})
+	testAddPoliciesResult(t, "AddPoliciesWithResult", result, err, 2, [][]string{})
+	testAdapterCalls(t, e, a, []string{"AddPolicies p 2"})
+	testEnforce(t, e, "eve", "data3", "write", true)
+
+	// Fully existing: nothing is persisted and the watcher is not notified.
+	result, err = e.AddPoliciesWithResult([][]string{{"alice", "data1", "read"}, {"eve", "data3", "read"}})
+	testAddPoliciesResult(t, "AddPoliciesWithResult", result, err, 0, [][]string{{"alice", "data1", "read"}, {"eve", "data3", "read"}})
+	testAdapterCalls(t, e, a, nil)
+
+	// Mixed: only the new rules are persisted, a rule repeated in the batch is added once.
+	result, err = e.AddPoliciesWithResult([][]string{{"alice", "data1", "read"}, {"frank", "data4", "read"}, {"frank", "data4", "read"}})
+	testAddPoliciesResult(t, "AddPoliciesWithResult", result, err, 1, [][]string{{"alice", "data1", "read"}, {"frank", "data4", "read"}})
+	testAdapterCalls(t, e, a, []string{"AddPolicies p 1"})
+	testEnforce(t, e, "frank", "data4", "read", true)
+	if w.updates != 2 {
+		t.Errorf("watcher updates: %d, supposed to be 2", w.updates)
+	}
+
+	// The legacy method still rejects the whole batch.
+	if ok, _ := e.AddPolicies([][]string{{"alice", "data1", "read"}, {"gina", "data5", "read"}}); ok {
+		t.Error("AddPolicies should return false when a rule already exists")
+	}
+
+	removeResult, err := e.RemovePoliciesWithResult([][]string{{"eve", "data3", "read"}, {"nobody", "data1", "read"}})
+	testRemovePoliciesResult(t, "RemovePoliciesWithResult", removeResult, err, 1, [][]string{{"nobody", "data1", "read"}})
+	testAdapterCalls(t, e, a, []string{"RemovePolicies p 1"})
+	testEnforce(t, e, "eve", "data3", "read", false)
+	testEnforce(t, e, "eve", "data3", "write", true)
+
+	removeResult, err = e.RemovePoliciesWithResult([][]string{{"eve", "data3", "read"}})
+	testRemovePoliciesResult(t, "RemovePoliciesWithResult", removeResult, err, 0, [][]string{{"eve", "data3", "read"}})
+	testAdapterCalls(t, e, a, nil)
+
+	removeResult, err = e.RemovePoliciesWithResult([][]string{{"eve", "data3", "write"}, {"frank", "data4", "read"}})
+	testRemovePoliciesResult(t, "RemovePoliciesWithResult", removeResult, err, 2, [][]string{})
+	testAdapterCalls(t, e, a, []string{"RemovePolicies p 2"})
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if _, err = e.AddPoliciesWithResult([][]string{{"eve", "data3"}}); err == nil {
+		t.Error("AddPoliciesWithResult should fail for an invalid rule")
+	}
+}
+
+func TestRemovePoliciesEx(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	// The absent rules are not sent to the adapter.
+	ok, err := e.RemovePoliciesEx([][]string{{"alice", "data1", "read"}, {"nobody", "data1", "read"}, {"bob", "data2", "write"}})
+	if !ok || err != nil {
+		t.Errorf("RemovePoliciesEx: %t, %v, supposed to be true, <nil>", ok, err)
+	}
+	testAdapterCalls(t, e, a, []string{"RemovePolicies p 2"})
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	// Removing again is a no-op.
+	ok, err = e.RemovePoliciesEx([][]string{{"alice", "data1", "read"}, {"nobody", "data1", "read"}})
+	if ok || err != nil {
+		t.Errorf("RemovePoliciesEx: %t, %v, supposed to be false, <nil>", ok, err)
+	}
+	testAdapterCalls(t, e, a, nil)
+}
+
+func TestGroupingPoliciesWithResult(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	result, err := e.AddGroupingPoliciesWithResult([][]string{{"alice", "data2_admin"}, {"bob", "data2_admin"}})
+	testAddPoliciesResult(t, "AddGroupingPoliciesWithResult", result, err, 1, [][]string{{"alice", "data2_admin"}})
+	testAdapterCalls(t, e, a, []string{"AddPolicies g 1"})
+	testEnforce(t, e, "bob", "data2", "read", true)
+
+	result, err = e.AddGroupingPoliciesWithResult([][]string{{"bob", "data2_admin"}})
+	testAddPoliciesResult(t, "AddGroupingPoliciesWithResult", result, err, 0, [][]string{{"bob", "data2_admin"}})
+	testAdapterCalls(t, e, a, nil)
+
+	removeResult, err := e.RemoveGroupingPoliciesWithResult([][]string{{"alice", "data2_admin"}, {"cathy", "data2_admin"}})
+	testRemovePoliciesResult(t, "RemoveGroupingPoliciesWithResult", removeResult, err, 1, [][]string{{"cathy", "data2_admin"}})
+	testAdapterCalls(t, e, a, []string{"RemovePolicies g 1"})
+	testEnforce(t, e, "alice", "data2", "read", false)
+	testEnforce(t, e, "bob", "data2", "read", true)
+
+	removeResult, err = e.RemoveGroupingPoliciesWithResult([][]string{{"alice", "data2_admin"}})
+	testRemovePoliciesResult(t, "RemoveGroupingPoliciesWithResult", removeResult, err, 0, [][]string{{"alice", "data2_admin"}})
+	testAdapterCalls(t, e, a, nil)
+	testGetRoles(t, e, []string{"data2_admin"}, "bob")
+}
+
+func testGetPolicyMetadata(t *testing.T, e *Enforcer, rule []string, res map[string]string) {
+	t.Helper()
+	myRes := e.GetPolicyMetadata(rule)
+	if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("GetPolicyMetadata(%v): %v, supposed to be %v", rule, myRes, res)
+	}
+}
+
+func TestPolicyMetadata(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_with_metadata_model.conf", "examples/basic_with_metadata_policy.csv")
+
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "cathy", "data3", "read", true)
+	testEnforce(t, e, "alice", "data2", "read", false)
+
+	testGetPolicy(t, e, [][]string{
+		{"alice", "data1", "read", "alice reads the reports", "TICKET-1"},
+		{"bob", "data2", "write", "bob, the writer", "TICKET-2"},
+		{"cathy", "data3", "read"}})
+	_, explain, _ := e.EnforceEx("bob", "data2", "write")
+	if !util.ArrayEquals(explain, []string{"bob", "data2", "write", "bob, the writer", "TICKET-2"}) {
+		t.Errorf("EnforceEx explain: %v, supposed to include the metadata", explain)
+	}
+
+	testGetPolicyMetadata(t, e, []string{"alice", "data1", "read"}, map[string]string{"desc": "alice reads the reports", "owner": "TICKET-1"})
+	testGetPolicyMetadata(t, e, []string{"bob", "data2", "write", "other", "TICKET-9"}, map[string]string{"desc": "bob, the writer", "owner": "TICKET-2"})
+	testGetPolicyMetadata(t, e, []string{"cathy", "data3", "read"}, map[string]string{"desc": "", "owner": ""})
+	testGetPolicyMetadata(t, e, []string{"alice", "data2", "read"}, nil)
+
+	// Rules differing only in their metadata are duplicates.
+	if !e.HasPolicy("alice", "data1", "read") || !e.HasPolicy("alice", "data1", "read", "other", "TICKET-9") {
+		t.Error("HasPolicy should ignore the metadata")
+	}
+	if ok, err := e.AddPolicy("alice", "data1", "read", "other", "TICKET-9"); ok || err != nil {
+		t.Errorf("AddPolicy: %t, %v, supposed to be false, <nil>", ok, err)
+	}
+	if ok, err := e.AddPolicy("dave", "data4", "read", "", "TICKET-4"); !ok || err != nil {
+		t.Errorf("AddPolicy: %t, %v, supposed to be true, <nil>", ok, err)
+	}
+	testEnforce(t, e, "dave", "data4", "read", true)
+	if ok, _ := e.RemovePolicy("dave", "data4", "read"); !ok {
+		t.Error("RemovePolicy should remove the rule given without its metadata")
+	}
+	testEnforce(t, e, "dave", "data4", "read", false)
+	if _, err := e.AddPolicy("dave", "data4", "read", "", "TICKET-4", "extra"); err == nil {
+		t.Error("AddPolicy should fail for a rule with more fields than tokens and metadata tokens")
+	}
+
+	// The matchers cannot use the metadata.
+	if _, err := e.EnforceWithMatcher("r.sub == p.sub && p.owner == \"TICKET-1\"", "alice", "data1", "read"); err == nil {
+		t.Error("the matcher should not be able to use a metadata token")
+	}
+
+	// The metadata is saved with the rules.
+	a := jsonadapter.NewAdapter(filepath.Join(t.TempDir(), "policy.json"))
+	if err := a.SavePolicy(e.GetModel()); err != nil {
+		t.Fatal(err)
+	}
+	e2, _ := NewEnforcer("examples/basic_with_metadata_model.conf", a)
+	testGetPolicyMetadata(t, e2, []string{"bob", "data2", "write"}, map[string]string{"desc": "bob, the writer", "owner": "TICKET-2"})
+
+	e, _ = NewEnforcer("examples/basic_with_metadata_model.conf")
+	e.SetCompareMetadata(true)
+	if ok, _ := e.AddPolicy("alice", "data1", "read", "a", "TICKET-1"); !ok {
+		t.Error("AddPolicy should add the rule")
+	}
+	if ok, _ := e.AddPolicy("alice", "data1", "read", "b", "TICKET-1"); !ok {
+		t.Error("AddPolicy should add the rule differing in its metadata when the metadata is compared")
+	}
+	if e.HasPolicy("alice", "data1", "read") {
+		t.Error("HasPolicy should compare the metadata")
+	}
+}
+
+// removedRulesAdapter records the rules removed from it.
+type removedRulesAdapter struct {
+	*fileadapter.Adapter
+	removed [][]string
+}
+
+func (a *removedRulesAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return nil
+}
+
+func (a *removedRulesAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	a.removed = append(a.removed, rule)
+	return nil
+}
+
+func (a *removedRulesAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.removed = append(a.removed, rules...)
+	return nil
+}
+
+// removedRulesWatcher records the rules it is told were removed.
+type removedRulesWatcher struct {
+	SampleWatcherEx
+	removed [][]string
+}
+
+func (w *removedRulesWatcher) UpdateForRemovePolicy(sec, ptype string, params ...string) error {
+	w.removed = append(w.removed, params)
+	return nil
+}
+
+func (w *removedRulesWatcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	w.removed = append(w.removed, rules...)
+	return nil
+}
+
+func TestPolicyMetadataRemoval(t *testing.T) {
+	a := &removedRulesAdapter{Adapter: fileadapter.NewAdapter("examples/basic_with_metadata_policy.csv")}
+	e, _ := NewEnforcer("examples/basic_with_metadata_model.conf", a)
+	w := &removedRulesWatcher{}
+	_ = e.SetWatcher(w)
+
+	// The adapter and the watcher are given the rules as stored, with their metadata.
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	_, _ = e.RemovePolicies([][]string{{"bob", "data2", "write", "other", "TICKET-9"}, {"cathy", "data3", "read"}})
+	removed := [][]string{
+		{"alice", "data1", "read", "alice reads the reports", "TICKET-1"},
+		{"bob", "data2", "write", "bob, the writer", "TICKET-2"},
+		{"cathy", "data3", "read"},
+	}
+	if !reflect.DeepEqual(a.removed, removed) {
+		t.Errorf("Adapter removed: %v, supposed to be %v", a.removed, removed)
+	}
+	if !reflect.DeepEqual(w.removed, removed) {
+		t.Errorf("Watcher removed: %v, supposed to be %v", w.removed, removed)
+	}
+	testGetPolicy(t, e, [][]string{})
+}
+
+func TestAddFunctionAuto(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && objMatch(r.obj, p.obj) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice", "/data", "read")
+
+	if err := e.AddFunctionAuto("objMatch", func(obj string, prefix string) bool { return obj == prefix }); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "/data", "read", true)
+	testEnforce(t, e, "alice", "/data/1", "read", false)
+
+	// Adding the function again after enforcing replaces the compiled matcher.
+	if err := e.AddFunctionAuto("objMatch", strings.HasPrefix); err != nil {
+		t.Fatal(err)
+	}
+	testEnforce(t, e, "alice", "/data/1", "read", true)
+
+	// A type mismatch at enforce time is an error naming the function and the argument.
+	if _, err := e.Enforce("alice", 1, "read"); err == nil || !strings.Contains(err.Error(), "objMatch: argument 0 must be string, but got float64") {
+		t.Errorf("Enforce error: %v, supposed to name objMatch and argument 0", err)
+	}
+
+	if err := e.AddFunctionAuto("objMatch", func(obj string) {}); err == nil {
+		t.Error("AddFunctionAuto should fail for a function without result")
+	}
+	testEnforce(t, e, "alice", "/data/1", "read", true)
+}
+
+func TestGetFunctionNames(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domain_pattern_model.conf", "examples/rbac_with_domain_pattern_policy.csv")
+
+	names := e.GetFunctionNames()
+	for _, name := range []string{"keyMatch", "keyMatch2", "keyMatch5", "regexMatch", "ipMatch", "globMatch", "g"} {
+		if len(util.SetSubtract([]string{name}, names)) != 0 || !e.HasFunction(name) {
+			t.Errorf("function %s is missing in %v", name, names)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("function names are not sorted: %v", names)
+	}
+	if e.HasFunction("custom") {
+		t.Error("function custom should not exist")
+	}
+
+	e.AddFunction("custom", util.KeyMatchFunc)
+	if len(util.SetSubtract([]string{"custom"}, e.GetFunctionNames())) != 0 || !e.HasFunction("custom") {
+		t.Error("function custom is missing after AddFunction")
+	}
+
+	_, err := e.EnforceWithMatcher("keyMatch6(r.obj, p.obj)", "alice", "domain1", "data1", "read")
+	if err == nil || err.Error() != "Undefined function keyMatch6, did you mean keyMatch?" {
+		t.Errorf("EnforceWithMatcher error: %v, supposed to suggest keyMatch", err)
+	}
+	_, err = e.EnforceWithMatcher("regexMach(r.obj, p.obj)", "alice", "domain1", "data1", "read")
+	if err == nil || !strings.HasSuffix(err.Error(), "did you mean regexMatch?") {
+		t.Errorf("EnforceWithMatcher error: %v, supposed to suggest regexMatch", err)
+	}
+}
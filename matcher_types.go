@@ -0,0 +1,196 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	Err "github.com/casbin/casbin/v2/errors"
+)
+
+// SetStrictMatcherTypes controls whether the matchers reject the comparisons between a number and a string
+// or a boolean, which govaluate otherwise evaluates silently, e.g. r.age == "18" is false for the number 18.
+// The comparisons of two literals are rejected when the matcher is compiled, the others when they are evaluated
+// with an *errors.ErrIncompatibleTypes, so the comparisons that && or || skip are not checked. Only the operands
+// that are a single value, a token or a literal, are checked, not the results of functions or arithmetic.
+// It is disabled by default.
+func (e *Enforcer) SetStrictMatcherTypes(strict bool) {
+	e.strictMatcherTypes = strict
+	e.invalidateMatcherMap()
+}
+
+// strictComparators are the comparators whose operands are checked.
+var strictComparators = map[string]bool{"==": true, "!=": true, ">": true, ">=": true, "<": true, "<=": true}
+
+// withStrictTypes returns the expression with its comparisons between single values replaced by calls of functions
+// checking the types of the operands, so that a comparison is only checked when it is evaluated and not when && or ||
+// skip it, e.g. r.sub.Age > 18 in r.kind == "user" && r.sub.Age > 18. An error is returned for a comparison of two
+// literals of incompatible types.
+func withStrictTypes(expression *govaluate.EvaluableExpression) (*govaluate.EvaluableExpression, error) {
+	tokens := expression.Tokens()
+	strict := make([]govaluate.ExpressionToken, 0, len(tokens))
+	for i := 0; i < len(tokens); i++ {
+		if i+2 >= len(tokens) || !isStrictComparison(tokens, i+1) {
+			strict = append(strict, tokens[i])
+			continue
+		}
+
+		left, comparator, right := tokens[i], tokens[i+1], tokens[i+2]
+		operator := comparator.Value.(string)
+		if isLiteral(left) && isLiteral(right) {
+			if !compatibleTypes(left.Value, right.Value) {
+				return nil, &Err.ErrIncompatibleTypes{Operator: operator, Left: operandName(left), Right: operandName(right),
+					LeftValue: left.Value, RightValue: right.Value}
+			}
+			strict = append(strict, left, comparator, right)
+		} else {
+			strict = append(strict,
+				govaluate.ExpressionToken{Kind: govaluate.FUNCTION, Value: strictComparison(operator, left, right)},
+				govaluate.ExpressionToken{Kind: govaluate.CLAUSE, Value: '('},
+				left,
+				govaluate.ExpressionToken{Kind: govaluate.SEPARATOR, Value: ","},
+				right,
+				govaluate.ExpressionToken{Kind: govaluate.CLAUSE_CLOSE, Value: ')'})
+		}
+		i += 2
+	}
+	return govaluate.NewEvaluableExpressionFromTokens(strict)
+}
+
+// isStrictComparison reports whether the token at i is a comparison between single values whose types are checked.
+func isStrictComparison(tokens []govaluate.ExpressionToken, i int) bool {
+	token := tokens[i]
+	if token.Kind != govaluate.COMPARATOR || !strictComparators[token.Value.(string)] || i == 0 || i == len(tokens)-1 {
+		return false
+	}
+	return isSingleValue(tokens[i-1]) && isSingleValue(tokens[i+1]) && boundsOperand(tokens, i-2) && boundsOperand(tokens, i+2)
+}
+
+// strictComparison returns the function comparing its two arguments like the comparator does in govaluate,
+// once it checked that their types are compatible.
+func strictComparison(operator string, left, right govaluate.ExpressionToken) govaluate.ExpressionFunction {
+	return func(args ...interface{}) (interface{}, error) {
+		a, b := args[0], args[1]
+		if !compatibleTypes(a, b) {
+			return nil, &Err.ErrIncompatibleTypes{Operator: operator, Left: operandName(left), Right: operandName(right),
+				LeftValue: a, RightValue: b}
+		}
+
+		switch operator {
+		case "==":
+			return reflect.DeepEqual(a, b), nil
+		case "!=":
+			return !reflect.DeepEqual(a, b), nil
+		}
+		if x, ok := a.(string); ok {
+			if y, ok := b.(string); ok {
+				return compareOrdered(operator, strings.Compare(x, y)), nil
+			}
+		}
+		x, ok1 := a.(float64)
+		y, ok2 := b.(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("Value '%v' cannot be used with the comparator '%s', it is not a number", a, operator)
+		}
+		switch {
+		case x < y:
+			return compareOrdered(operator, -1), nil
+		case x > y:
+			return compareOrdered(operator, 1), nil
+		}
+		return compareOrdered(operator, 0), nil
+	}
+}
+
+// compareOrdered applies the ordering comparator to the result of a comparison, -1, 0 or 1.
+func compareOrdered(operator string, cmp int) bool {
+	switch operator {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	}
+	return cmp <= 0
+}
+
+// isSingleValue reports whether the token is a value on its own.
+func isSingleValue(token govaluate.ExpressionToken) bool {
+	switch token.Kind {
+	case govaluate.VARIABLE, govaluate.ACCESSOR:
+		return true
+	}
+	return isLiteral(token)
+}
+
+func isLiteral(token govaluate.ExpressionToken) bool {
+	switch token.Kind {
+	case govaluate.NUMERIC, govaluate.STRING, govaluate.BOOLEAN:
+		return true
+	}
+	return false
+}
+
+// boundsOperand reports whether the token at i, next to an operand of a comparison, ends the operand,
+// e.g. && or a parenthesis, but not + or a function call.
+func boundsOperand(tokens []govaluate.ExpressionToken, i int) bool {
+	if i < 0 || i >= len(tokens) {
+		return true
+	}
+	switch tokens[i].Kind {
+	case govaluate.LOGICALOP, govaluate.CLAUSE, govaluate.CLAUSE_CLOSE, govaluate.SEPARATOR, govaluate.TERNARY:
+		return true
+	}
+	return false
+}
+
+// operandName names the operand in errors, e.g. r.age or "18".
+func operandName(token govaluate.ExpressionToken) string {
+	switch token.Kind {
+	case govaluate.VARIABLE:
+		return unescapeToken(token.Value.(string))
+	case govaluate.STRING:
+		return fmt.Sprintf("%q", token.Value)
+	}
+	return fmt.Sprint(token.Value)
+}
+
+// compatibleTypes reports whether the values are both numbers, both strings or both booleans.
+// The values of other types, e.g. structs, are not checked.
+func compatibleTypes(a, b interface{}) bool {
+	kindA, kindB := valueKind(a), valueKind(b)
+	return kindA == "" || kindB == "" || kindA == kindB
+}
+
+func valueKind(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	switch reflect.TypeOf(value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "bool"
+	}
+	return ""
+}
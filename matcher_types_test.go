@@ -0,0 +1,131 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+)
+
+func TestStrictMatcherTypes(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, age
+
+[policy_definition]
+p = sub
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.age == "18"
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice")
+
+	// By default the number is silently not equal to the string.
+	if res, err := e.Enforce("alice", 18); res || err != nil {
+		t.Errorf("alice, 18: %t, %v, supposed to be false, nil", res, err)
+	}
+
+	e.SetStrictMatcherTypes(true)
+	_, err := e.Enforce("alice", 18)
+	var typesErr *Err.ErrIncompatibleTypes
+	if !errors.As(err, &typesErr) {
+		t.Fatalf("alice, 18: %v, supposed to be *errors.ErrIncompatibleTypes", err)
+	}
+	if typesErr.Left != "r.age" || typesErr.Right != `"18"` || typesErr.Operator != "==" {
+		t.Errorf("error %v, supposed to compare r.age with \"18\" using ==", typesErr)
+	}
+	if !strings.Contains(err.Error(), `cannot compare r.age (float64 18) with "18" (string 18) using ==`) {
+		t.Errorf("error message: %s", err)
+	}
+	if res, err := e.Enforce("alice", "18"); !res || err != nil {
+		t.Errorf("alice, \"18\": %t, %v, supposed to be true, nil", res, err)
+	}
+
+	// The comparison of two tokens is checked too.
+	if _, err := e.EnforceWithMatcher("r.sub == p.sub && r.age >= r.sub", "alice", 18); !errors.As(err, &typesErr) {
+		t.Errorf("r.age >= r.sub: %v, supposed to be *errors.ErrIncompatibleTypes", err)
+	}
+	if res, err := e.EnforceWithMatcher("r.sub == p.sub && r.age >= 18", "alice", 20); !res || err != nil {
+		t.Errorf("r.age >= 18 for 20: %t, %v, supposed to be true, nil", res, err)
+	}
+
+	// Two literals are compared when the matcher is compiled, before any rule.
+	e.ClearPolicy()
+	if _, err := e.EnforceWithMatcher(`r.sub == "alice" && 18 != "18"`, "alice", 18); !errors.As(err, &typesErr) {
+		t.Errorf(`18 != "18": %v, supposed to be *errors.ErrIncompatibleTypes`, err)
+	}
+
+	// The operands that are not single values are not checked.
+	if res, err := e.EnforceWithMatcher(`r.sub == "alice" && r.age + 0 == "18"`, "alice", 18); res || err != nil {
+		t.Errorf(`r.age + 0 == "18": %t, %v, supposed to be false, nil`, res, err)
+	}
+
+	e.SetStrictMatcherTypes(false)
+	if res, err := e.EnforceWithMatcher(`r.sub == "alice" && 18 != "18"`, "alice", 18); !res || err != nil {
+		t.Errorf(`18 != "18": %t, %v, supposed to be true, nil`, res, err)
+	}
+}
+
+func TestStrictMatcherTypesShortCircuit(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, age
+
+[policy_definition]
+p = sub
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.age >= 18
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("alice")
+	e.SetStrictMatcherTypes(true)
+
+	// The comparison guarded by r.sub == p.sub is not evaluated, so it is not checked, for bob.
+	if res, err := e.Enforce("bob", "unknown"); res || err != nil {
+		t.Errorf("bob, unknown: %t, %v, supposed to be false, nil", res, err)
+	}
+	if res, err := e.Enforce("alice", 20); !res || err != nil {
+		t.Errorf("alice, 20: %t, %v, supposed to be true, nil", res, err)
+	}
+	if res, err := e.Enforce("alice", 17); res || err != nil {
+		t.Errorf("alice, 17: %t, %v, supposed to be false, nil", res, err)
+	}
+	if _, err := e.Enforce("alice", "unknown"); err == nil {
+		t.Error("alice, unknown: supposed to fail")
+	}
+
+	// The checked matcher is compiled once.
+	count := 0
+	e.matcherMap.Load().(*sync.Map).Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Errorf("%d compiled matchers, supposed to be 1", count)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+)
+
+// PolicyTransform converts a rule of ptype from the old model to the new one, a nil rule drops it.
+type PolicyTransform func(ptype string, oldRule []string) ([]string, error)
+
+// InsertField returns a PolicyTransform inserting value at index k of the rules of the given ptypes,
+// or of all the ptypes if none is given. The other rules are kept as they are.
+func InsertField(k int, value string, ptypes ...string) PolicyTransform {
+	return func(ptype string, oldRule []string) ([]string, error) {
+		if len(ptypes) != 0 && !containsString(ptypes, ptype) {
+			return oldRule, nil
+		}
+		if k < 0 || k > len(oldRule) {
+			return nil, fmt.Errorf("cannot insert field at index %d of a rule with %d fields", k, len(oldRule))
+		}
+
+		rule := make([]string, 0, len(oldRule)+1)
+		rule = append(rule, oldRule[:k]...)
+		rule = append(rule, value)
+		return append(rule, oldRule[k:]...), nil
+	}
+}
+
+// MigratePolicy loads the policy stored in the adapter under oldModel, converts every rule with transform
+// and saves the converted policy through the adapter under newModel.
+// The converted rules are checked against the definitions of newModel first, and nothing is written if any
+// rule cannot be migrated: the returned Err.ErrMigrateRules then reports every such rule with its index.
+// The enforcer's own model and policy are left untouched, call SetModel and LoadPolicy to use the migrated policy.
+func (e *Enforcer) MigratePolicy(oldModel model.Model, newModel model.Model, transform PolicyTransform) error {
+	if e.adapter == nil {
+		return errors.New("cannot migrate the policy without an adapter")
+	}
+
+	oldPolicy := oldModel.Copy()
+	oldPolicy.ClearPolicy()
+	if err := e.adapter.LoadPolicy(oldPolicy); err != nil {
+		return err
+	}
+
+	newPolicy := newModel.Copy()
+	newPolicy.ClearPolicy()
+	var invalid Err.ErrMigrateRules
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range sortedPTypes(oldPolicy[sec]) {
+			for i, oldRule := range oldPolicy[sec][ptype].Policy {
+				rule, err := transform(ptype, oldRule)
+				if err == nil && rule == nil {
+					continue
+				}
+				if err == nil {
+					if invalidRule := e.validateRuleInModel(newPolicy, sec, ptype, rule); invalidRule != nil {
+						err = invalidRule
+					}
+				}
+				if err != nil {
+					invalid = append(invalid, &Err.ErrMigrateRule{PType: ptype, Index: i, Rule: oldRule, Err: err})
+					continue
+				}
+				newPolicy.AddPolicy(sec, ptype, rule)
+			}
+		}
+	}
+	if len(invalid) != 0 {
+		return invalid
+	}
+
+	if e.dryRun {
+		e.logDryRun("", "", "SavePolicy")
+		return nil
+	}
+	return e.adapter.SavePolicy(newPolicy)
+}
+
+func sortedPTypes(assertions model.AssertionMap) []string {
+	ptypes := make([]string, 0, len(assertions))
+	for ptype := range assertions {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
+func containsString(s []string, v string) bool {
+	for _, item := range s {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+func copyPolicyFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := filepath.Join(t.TempDir(), filepath.Base(path))
+	if err := ioutil.WriteFile(copied, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return copied
+}
+
+func TestMigratePolicy(t *testing.T) {
+	path := copyPolicyFile(t, "examples/basic_policy.csv")
+	e, _ := NewEnforcer("examples/basic_model.conf", fileadapter.NewAdapter(path))
+	newModel, _ := model.NewModelFromFile("examples/rbac_with_domains_model.conf")
+
+	if err := e.MigratePolicy(e.GetModel(), newModel, InsertField(1, "domain1", "p")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The enforcer keeps its model until it is told to switch.
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	migrated, _ := NewEnforcer("examples/rbac_with_domains_model.conf", path)
+	testGetPolicy(t, migrated, [][]string{{"alice", "domain1", "data1", "read"}, {"bob", "domain1", "data2", "write"}})
+	testDomainEnforce(t, migrated, "alice", "domain1", "data1", "read", true)
+	testDomainEnforce(t, migrated, "bob", "domain1", "data2", "write", true)
+	testDomainEnforce(t, migrated, "alice", "domain2", "data1", "read", false)
+}
+
+func TestMigratePolicyInvalidRules(t *testing.T) {
+	path := copyPolicyFile(t, "examples/rbac_policy.csv")
+	e, _ := NewEnforcer("examples/rbac_model.conf", fileadapter.NewAdapter(path))
+	newModel, _ := model.NewModelFromFile("examples/rbac_with_domains_model.conf")
+
+	// The g rules miss the domain, and the transform fails for bob's rule.
+	errBob := errors.New("bob must not migrate")
+	err := e.MigratePolicy(e.GetModel(), newModel, func(ptype string, oldRule []string) ([]string, error) {
+		if oldRule[0] == "bob" {
+			return nil, errBob
+		}
+		if ptype == "g" {
+			return oldRule, nil
+		}
+		return InsertField(1, "domain1")(ptype, oldRule)
+	})
+
+	invalid, ok := err.(Err.ErrMigrateRules)
+	if !ok || len(invalid) != 2 {
+		t.Fatalf("MigratePolicy error: %v, supposed to report 2 rules", err)
+	}
+	if invalid[0].PType != "p" || invalid[0].Index != 1 || !errors.Is(invalid[0], errBob) {
+		t.Errorf("first invalid rule: %v, supposed to be rule 1 of p", invalid[0])
+	}
+	var invalidRule *Err.ErrInvalidRule
+	if invalid[1].PType != "g" || invalid[1].Index != 0 || !errors.As(invalid[1], &invalidRule) || invalidRule.Expected != 3 {
+		t.Errorf("second invalid rule: %v, supposed to be rule 0 of g with 3 expected fields", invalid[1])
+	}
+
+	// Nothing has been written.
+	_ = e.LoadPolicy()
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}, {"data2_admin", "data2", "read"}, {"data2_admin", "data2", "write"}})
+
+	if _, err := InsertField(4, "domain1")("p", []string{"alice", "data1", "read"}); err == nil {
+		t.Error("InsertField should fail for an index past the end of the rule")
+	}
+	noAdapter, _ := NewEnforcer("examples/basic_model.conf")
+	if err := noAdapter.MigratePolicy(e.GetModel(), newModel, InsertField(1, "domain1")); err == nil {
+		t.Error("MigratePolicy should fail without an adapter")
+	}
+}
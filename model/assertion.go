@@ -32,8 +32,35 @@ type Assertion struct {
 	PolicyMap     map[string]int
 	RM            rbac.RoleManager
 	FieldIndexMap map[string]int
+	// MetaTokens are the metadata tokens of a policy definition, e.g. p_desc and p_owner for
+	// "p = sub, obj, act | meta: desc, owner". The metadata fields follow the fields of Tokens in the rules,
+	// they are stored and returned with the rules but the matchers cannot use them.
+	MetaTokens []string
+	// Aliases maps the aliases of the tokens to the tokens, e.g. p_subject to p_sub for "p = sub as subject".
+	// The matchers are rewritten to use the tokens when the model is loaded.
+	Aliases map[string]string
+	// CompareMetadata makes rules that differ only in their metadata distinct rules,
+	// by default such rules are duplicates.
+	CompareMetadata bool
 
-	logger log.Logger
+	// interner interns the field values of the rules, see Model.EnableStringInterning.
+	interner *stringInterner
+	// subjects indexes the rules by their subject, see Model.EnablePermissionIndex.
+	subjects *subjectIndex
+	logger   log.Logger
+}
+
+// policyKey returns the key of the rule in PolicyMap, which leaves out the metadata fields unless they are compared.
+func (ast *Assertion) policyKey(rule []string) string {
+	if len(ast.MetaTokens) != 0 && !ast.CompareMetadata && len(rule) > len(ast.Tokens) {
+		rule = rule[:len(ast.Tokens)]
+	}
+	return strings.Join(rule, DefaultSep)
+}
+
+// IsValidPolicySize reports whether the rule has a field for every token, and at most one for every metadata token.
+func (ast *Assertion) IsValidPolicySize(rule []string) bool {
+	return len(rule) >= len(ast.Tokens) && len(rule) <= len(ast.Tokens)+len(ast.MetaTokens)
 }
 
 func (ast *Assertion) buildIncrementalRoleLinks(rm rbac.RoleManager, op PolicyOp, rules [][]string) error {
@@ -43,12 +70,20 @@ func (ast *Assertion) buildIncrementalRoleLinks(rm rbac.RoleManager, op PolicyOp
 		return errors.New("the number of \"_\" in role definition should be at least 2")
 	}
 
+	// the links of the removed rules longer than the role definition, which other rules may share.
+	var truncated map[string]bool
 	for _, rule := range rules {
 		if len(rule) < count {
 			return errors.New("grouping policy elements do not meet role definition")
 		}
 		if len(rule) > count {
 			rule = rule[:count]
+			if op == PolicyRemove {
+				if truncated == nil {
+					truncated = map[string]bool{}
+				}
+				truncated[strings.Join(rule, DefaultSep)] = true
+			}
 		}
 		switch op {
 		case PolicyAdd:
@@ -64,6 +99,17 @@ func (ast *Assertion) buildIncrementalRoleLinks(rm rbac.RoleManager, op PolicyOp
 		}
 	}
 
+	// a link stays as long as one of the rules sharing it does, like with a full rebuild.
+	if truncated != nil {
+		for _, rule := range ast.Policy {
+			if len(rule) > count && truncated[strings.Join(rule[:count], DefaultSep)] {
+				if err := rm.AddLink(rule[0], rule[1], rule[2:count]...); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -95,6 +141,7 @@ func (ast *Assertion) setLogger(logger log.Logger) {
 
 func (ast *Assertion) copy() *Assertion {
 	tokens := append([]string(nil), ast.Tokens...)
+	metaTokens := append([]string(nil), ast.MetaTokens...)
 	policy := make([][]string, len(ast.Policy))
 
 	for i, p := range ast.Policy {
@@ -104,6 +151,13 @@ func (ast *Assertion) copy() *Assertion {
 	for k, v := range ast.PolicyMap {
 		policyMap[k] = v
 	}
+	var aliases map[string]string
+	if ast.Aliases != nil {
+		aliases = make(map[string]string, len(ast.Aliases))
+		for k, v := range ast.Aliases {
+			aliases[k] = v
+		}
+	}
 
 	newAst := &Assertion{
 		Key:           ast.Key,
@@ -112,6 +166,14 @@ func (ast *Assertion) copy() *Assertion {
 		Tokens:        tokens,
 		Policy:        policy,
 		FieldIndexMap: ast.FieldIndexMap,
+
+		MetaTokens:      metaTokens,
+		Aliases:         aliases,
+		CompareMetadata: ast.CompareMetadata,
+		interner:        ast.interner,
+	}
+	if ast.subjects != nil {
+		newAst.subjects = newSubjectIndex(newAst)
 	}
 
 	return newAst
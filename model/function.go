@@ -15,6 +15,7 @@
 package model
 
 import (
+	"context"
 	"sync"
 
 	"github.com/Knetic/govaluate"
@@ -23,32 +24,68 @@ import (
 
 // FunctionMap represents the collection of Function.
 type FunctionMap struct {
-	fns *sync.Map
+	fns    *sync.Map
+	ctxFns *sync.Map
 }
 
 // [string]govaluate.ExpressionFunction
 
-// AddFunction adds an expression function.
+// ContextFunction is a function the matchers can call that also receives the context of the enforcement,
+// so that it can honor its deadline and cancellation, e.g. when it queries an external service.
+type ContextFunction func(ctx context.Context, args ...interface{}) (interface{}, error)
+
+// builtinFunctions are the functions of every function map, which cannot be replaced.
+var builtinFunctions = map[string]govaluate.ExpressionFunction{
+	"keyMatch":            util.KeyMatchFunc,
+	"keyGet":              util.KeyGetFunc,
+	"keyMatch2":           util.KeyMatch2Func,
+	"keyMatchNormalized":  util.KeyMatchNormalizedFunc,
+	"keyMatch2Normalized": util.KeyMatch2NormalizedFunc,
+	"keyGet2":             util.KeyGet2Func,
+	"keyMatch3":           util.KeyMatch3Func,
+	"keyGet3":             util.KeyGet3Func,
+	"keyMatch4":           util.KeyMatch4Func,
+	"keyMatch4Strict":     util.KeyMatch4StrictFunc,
+	"keyMatch5":           util.KeyMatch5Func,
+	"regexMatch":          util.RegexMatchFunc,
+	"ipMatch":             util.IPMatchFunc,
+	"globMatch":           util.GlobMatchFunc,
+	"notIn":               util.NotInFunc,
+	"timeAfter":           util.TimeAfterFunc,
+	"timeBefore":          util.TimeBeforeFunc,
+	"timeBetween":         util.TimeBetweenFunc,
+}
+
+// AddFunction adds an expression function, replacing the function already added under the name,
+// unless it is a built-in function, which is kept.
 func (fm *FunctionMap) AddFunction(name string, function govaluate.ExpressionFunction) {
-	fm.fns.LoadOrStore(name, function)
+	if _, ok := builtinFunctions[name]; ok {
+		fm.fns.LoadOrStore(name, function)
+		return
+	}
+	fm.ctxFns.Delete(name)
+	fm.fns.Store(name, function)
+}
+
+// AddContextFunction adds a context function, replacing the function already added under the name,
+// unless it is a built-in function, which is kept.
+func (fm *FunctionMap) AddContextFunction(name string, function ContextFunction) {
+	if _, ok := builtinFunctions[name]; ok {
+		return
+	}
+	fm.fns.Delete(name)
+	fm.ctxFns.Store(name, function)
 }
 
 // LoadFunctionMap loads an initial function map.
 func LoadFunctionMap() FunctionMap {
 	fm := &FunctionMap{}
 	fm.fns = &sync.Map{}
+	fm.ctxFns = &sync.Map{}
 
-	fm.AddFunction("keyMatch", util.KeyMatchFunc)
-	fm.AddFunction("keyGet", util.KeyGetFunc)
-	fm.AddFunction("keyMatch2", util.KeyMatch2Func)
-	fm.AddFunction("keyGet2", util.KeyGet2Func)
-	fm.AddFunction("keyMatch3", util.KeyMatch3Func)
-	fm.AddFunction("keyGet3", util.KeyGet3Func)
-	fm.AddFunction("keyMatch4", util.KeyMatch4Func)
-	fm.AddFunction("keyMatch5", util.KeyMatch5Func)
-	fm.AddFunction("regexMatch", util.RegexMatchFunc)
-	fm.AddFunction("ipMatch", util.IPMatchFunc)
-	fm.AddFunction("globMatch", util.GlobMatchFunc)
+	for name, function := range builtinFunctions {
+		fm.fns.Store(name, function)
+	}
 
 	return *fm
 }
@@ -64,3 +101,15 @@ func (fm *FunctionMap) GetFunctions() map[string]govaluate.ExpressionFunction {
 
 	return ret
 }
+
+// GetContextFunctions returns a map with all the context functions.
+func (fm *FunctionMap) GetContextFunctions() map[string]ContextFunction {
+	ret := make(map[string]ContextFunction)
+
+	fm.ctxFns.Range(func(k interface{}, v interface{}) bool {
+		ret[k.(string)] = v.(ContextFunction)
+		return true
+	})
+
+	return ret
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "sync"
+
+// stringInterner canonicalizes the field values of the policy rules, so that the identical values of
+// different rules share their storage, see Model.EnableStringInterning.
+type stringInterner struct {
+	mu      sync.Mutex
+	strings map[string]string
+}
+
+func newStringInterner() *stringInterner {
+	return &stringInterner{strings: map[string]string{}}
+}
+
+// internRule returns a copy of the rule made of the canonical values of its fields.
+func (in *stringInterner) internRule(rule []string) []string {
+	interned := make([]string, len(rule))
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for i, field := range rule {
+		canonical, ok := in.strings[field]
+		if !ok {
+			// the field may be a part of a bigger string, e.g. the line of the policy file it was read from,
+			// which must not be kept alive by the table.
+			canonical = string([]byte(field))
+			in.strings[canonical] = canonical
+		}
+		interned[i] = canonical
+	}
+	return interned
+}
+
+// EnableStringInterning controls whether the field values of the policy rules are interned: the rules added
+// to the model then share the storage of their identical values, which saves memory when a large policy
+// repeats few distinct subjects or actions. It should be called before the policy is loaded, the rules already
+// in the model are interned too. The values of the removed rules stay in the table until the policy is cleared,
+// e.g. by LoadPolicy, which gives the model a new table.
+func (model Model) EnableStringInterning(enable bool) {
+	var interner *stringInterner
+	if enable {
+		interner = newStringInterner()
+	}
+
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range model[sec] {
+			ast.interner = interner
+			if interner == nil {
+				continue
+			}
+			for i, rule := range ast.Policy {
+				ast.Policy[i] = interner.internRule(rule)
+			}
+		}
+	}
+}
+
+// resetInterner gives the assertions interning their rules a new table, see ClearPolicy.
+func (model Model) resetInterner() {
+	var interner *stringInterner
+	for _, sec := range []string{"p", "g"} {
+		for _, ast := range model[sec] {
+			if ast.interner == nil {
+				continue
+			}
+			if interner == nil {
+				interner = newStringInterner()
+			}
+			ast.interner = interner
+		}
+	}
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/casbin/casbin/v2/config"
 	"github.com/casbin/casbin/v2/constant"
+	Err "github.com/casbin/casbin/v2/errors"
 	"github.com/casbin/casbin/v2/log"
 	"github.com/casbin/casbin/v2/util"
 )
@@ -44,6 +45,7 @@ var sectionNameMap = map[string]string{
 	"g": "role_definition",
 	"e": "policy_effect",
 	"m": "matchers",
+	"f": "functions",
 }
 
 // Minimal required sections for a model to be valid
@@ -54,6 +56,15 @@ func loadAssertion(model Model, cfg config.ConfigInterface, sec string, key stri
 	return model.AddDef(sec, key, value)
 }
 
+// metaTokensRegex matches a policy definition declaring metadata tokens, e.g. "sub, obj, act | meta: desc, owner".
+var metaTokensRegex = regexp.MustCompile(`^(.*)\|\s*meta\s*:(.*)$`)
+
+// tokenAliasRegex matches a token declared with an alias, e.g. "sub as subject".
+var tokenAliasRegex = regexp.MustCompile(`^(\w+)\s+as\s+(\w+)$`)
+
+// matcherTokenRegex matches the escaped request and policy tokens used by a matcher, e.g. "r_sub" or "p2_obj".
+var matcherTokenRegex = regexp.MustCompile(`\b((r|p)[0-9]*)_\w+`)
+
 // AddDef adds an assertion to the model.
 func (model Model) AddDef(sec string, key string, value string) bool {
 	if value == "" {
@@ -68,12 +79,26 @@ func (model Model) AddDef(sec string, key string, value string) bool {
 	ast.setLogger(model.GetLogger())
 
 	if sec == "r" || sec == "p" {
-		ast.Tokens = strings.Split(ast.Value, ",")
-		for i := range ast.Tokens {
-			ast.Tokens[i] = key + "_" + strings.TrimSpace(ast.Tokens[i])
+		tokens := ast.Value
+		if match := metaTokensRegex.FindStringSubmatch(ast.Value); sec == "p" && match != nil {
+			tokens = match[1]
+			for _, token := range model.splitTokens(match[2]) {
+				ast.MetaTokens = append(ast.MetaTokens, key+"_"+token)
+			}
+		}
+		ast.Tokens = model.splitTokens(tokens)
+		for i, token := range ast.Tokens {
+			if match := tokenAliasRegex.FindStringSubmatch(token); match != nil {
+				token = match[1]
+				if ast.Aliases == nil {
+					ast.Aliases = make(map[string]string)
+				}
+				ast.Aliases[key+"_"+match[2]] = key + "_" + token
+			}
+			ast.Tokens[i] = key + "_" + token
 		}
 	} else if sec == "g" {
-		ast.Tokens = strings.Split(ast.Value, ",")
+		ast.Tokens = model.splitTokens(ast.Value)
 	} else {
 		ast.Value = util.RemoveComments(util.EscapeAssertion(ast.Value))
 	}
@@ -88,9 +113,47 @@ func (model Model) AddDef(sec string, key string, value string) bool {
 	}
 
 	model[sec][key] = &ast
+	if sec == "r" || sec == "p" || sec == "m" {
+		model.resolveAliases()
+	}
 	return true
 }
 
+// resolveAliases rewrites the token aliases used by the matchers to the tokens they stand for,
+// e.g. p_subject to p_sub for "p = sub as subject", so that the matchers can use either name.
+func (model Model) resolveAliases() {
+	for _, sec := range []string{"r", "p"} {
+		for _, ast := range model[sec] {
+			for alias, token := range ast.Aliases {
+				re := regexp.MustCompile(`\b` + alias + `\b`)
+				for _, matcher := range model["m"] {
+					matcher.Value = re.ReplaceAllLiteralString(matcher.Value, token)
+				}
+			}
+		}
+	}
+}
+
+// Validate checks that the matchers only use the tokens of the request and policy definitions or their aliases.
+// It returns an *errors.ErrUnknownToken for the first unknown name.
+func (model Model) Validate() error {
+	keys := make([]string, 0, len(model["m"]))
+	for key := range model["m"] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, match := range matcherTokenRegex.FindAllStringSubmatch(model["m"][key].Value, -1) {
+			ast, ok := model[match[2]][match[1]]
+			if !ok || !util.In(match[0], ast.Tokens...) {
+				return &Err.ErrUnknownToken{Matcher: key, Token: strings.Replace(match[0], "_", ".", 1)}
+			}
+		}
+	}
+	return nil
+}
+
 func getKeySuffix(i int) string {
 	if i == 1 {
 		return ""
@@ -179,8 +242,12 @@ func (model Model) LoadModelFromText(text string) error {
 
 func (model Model) loadModelFromConfig(cfg config.ConfigInterface) error {
 	for s := range sectionNameMap {
+		if s == "f" {
+			continue
+		}
 		loadSection(model, cfg, s)
 	}
+	loadAssertion(model, cfg, "f", "required")
 	ms := make([]string, 0)
 	for _, rs := range requiredSections {
 		if !model.hasSection(rs) {
@@ -193,6 +260,24 @@ func (model Model) loadModelFromConfig(cfg config.ConfigInterface) error {
 	return nil
 }
 
+// GetRequiredFunctions returns the functions the model declares in its optional section:
+//
+//	[functions]
+//	required = customMatch, ipMatch2
+func (model Model) GetRequiredFunctions() []string {
+	ast, ok := model["f"]["required"]
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, name := range SplitTokens(ast.Value, DefaultTokenDelimiter) {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func (model Model) hasSection(sec string) bool {
 	section := model[sec]
 	return section != nil
@@ -206,7 +291,7 @@ func (model Model) PrintModel() {
 
 	var modelInfo [][]string
 	for k, v := range model {
-		if k == "logger" {
+		if k == "logger" || k == optionsKey {
 			continue
 		}
 
@@ -218,10 +303,21 @@ func (model Model) PrintModel() {
 	model.GetLogger().LogModel(modelInfo)
 }
 
+// SortPoliciesBySubjectHierarchy sorts the "p" rules so that rules whose subject is deeper in the
+// role hierarchy come first. Subjects that do not show up in the hierarchy get the lowest priority.
+// It is a no-op unless the policy effect is subjectPriority(p_eft) || deny.
 func (model Model) SortPoliciesBySubjectHierarchy() error {
 	if model["e"]["e"].Value != constant.SubjectPriorityEffect {
 		return nil
 	}
+	var groupingPolicy [][]string
+	if ast, ok := model["g"]["g"]; ok {
+		groupingPolicy = ast.Policy
+	}
+	subjectHierarchyMap, err := getSubjectHierarchyMap(groupingPolicy)
+	if err != nil {
+		return err
+	}
 	subIndex := 0
 	for ptype, assertion := range model["p"] {
 		domainIndex, err := model.GetFieldIndex(ptype, constant.DomainIndex)
@@ -229,10 +325,6 @@ func (model Model) SortPoliciesBySubjectHierarchy() error {
 			domainIndex = -1
 		}
 		policies := assertion.Policy
-		subjectHierarchyMap, err := getSubjectHierarchyMap(model["g"]["g"].Policy)
-		if err != nil {
-			return err
-		}
 		sort.SliceStable(policies, func(i, j int) bool {
 			domain1, domain2 := defaultDomain, defaultDomain
 			if domainIndex != -1 {
@@ -240,12 +332,18 @@ func (model Model) SortPoliciesBySubjectHierarchy() error {
 				domain2 = policies[j][domainIndex]
 			}
 			name1, name2 := getNameWithDomain(domain1, policies[i][subIndex]), getNameWithDomain(domain2, policies[j][subIndex])
-			p1 := subjectHierarchyMap[name1]
-			p2 := subjectHierarchyMap[name2]
+			p1, ok := subjectHierarchyMap[name1]
+			if !ok {
+				p1 = -1
+			}
+			p2, ok := subjectHierarchyMap[name2]
+			if !ok {
+				p2 = -1
+			}
 			return p1 > p2
 		})
 		for i, policy := range assertion.Policy {
-			assertion.PolicyMap[strings.Join(policy, ",")] = i
+			assertion.PolicyMap[assertion.policyKey(policy)] = i
 		}
 	}
 	return nil
@@ -325,12 +423,37 @@ func (model Model) SortPoliciesByPriority() error {
 			return p1 < p2
 		})
 		for i, policy := range assertion.Policy {
-			assertion.PolicyMap[strings.Join(policy, ",")] = i
+			assertion.PolicyMap[assertion.policyKey(policy)] = i
 		}
 	}
 	return nil
 }
 
+// SortPolicies sorts the rules of every "p" and "g" ptype lexicographically, field by field.
+func (model Model) SortPolicies() {
+	for _, sec := range []string{"p", "g"} {
+		for _, assertion := range model[sec] {
+			policies := assertion.Policy
+			sort.SliceStable(policies, func(i, j int) bool {
+				return lessRule(policies[i], policies[j])
+			})
+			for i, policy := range policies {
+				assertion.PolicyMap[assertion.policyKey(policy)] = i
+			}
+		}
+	}
+}
+
+// lessRule compares the rules field by field, a rule is less than the longer rules it is a prefix of.
+func lessRule(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
 func (model Model) ToText() string {
 	tokenPatterns := make(map[string]string)
 
@@ -347,6 +470,9 @@ func (model Model) ToText() string {
 	writeString := func(sec string) {
 		for ptype := range model[sec] {
 			value := model[sec][ptype].Value
+			if sec == "r" || sec == "p" {
+				value = model.canonicalDefinition(value)
+			}
 			for tokenPattern, newToken := range tokenPatterns {
 				value = strings.Replace(value, tokenPattern, newToken, -1)
 			}
@@ -360,13 +486,17 @@ func (model Model) ToText() string {
 	if _, ok := model["g"]; ok {
 		s.WriteString("[role_definition]\n")
 		for ptype := range model["g"] {
-			s.WriteString(fmt.Sprintf("%s = %s\n", ptype, model["g"][ptype].Value))
+			s.WriteString(fmt.Sprintf("%s = %s\n", ptype, model.canonicalDefinition(model["g"][ptype].Value)))
 		}
 	}
 	s.WriteString("[policy_effect]\n")
 	writeString("e")
 	s.WriteString("[matchers]\n")
 	writeString("m")
+	if ast, ok := model["f"]["required"]; ok {
+		s.WriteString("[functions]\n")
+		s.WriteString(fmt.Sprintf("required = %s\n", ast.Value))
+	}
 	return s.String()
 }
 
@@ -390,17 +520,27 @@ func (model Model) GetFieldIndex(ptype string, field string) (int, error) {
 	if index, ok := assertion.FieldIndexMap[field]; ok {
 		return index, nil
 	}
-	pattern := fmt.Sprintf("%s_"+field, ptype)
-	index := -1
-	for i, token := range assertion.Tokens {
-		if token == pattern {
-			index = i
-			break
-		}
-	}
+	index := assertion.fieldIndex(field)
 	if index == -1 {
 		return index, fmt.Errorf(field + " index is not set, please use enforcer.SetFieldIndex() to set index")
 	}
 	assertion.FieldIndexMap[field] = index
 	return index, nil
 }
+
+// fieldIndex returns the index of the field in the rules, -1 if the field is not defined.
+func (ast *Assertion) fieldIndex(field string) int {
+	if index, ok := ast.FieldIndexMap[field]; ok {
+		return index
+	}
+	pattern := fmt.Sprintf("%s_"+field, ast.Key)
+	if token, ok := ast.Aliases[pattern]; ok {
+		pattern = token
+	}
+	for i, token := range ast.Tokens {
+		if token == pattern {
+			return i
+		}
+	}
+	return -1
+}
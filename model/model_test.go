@@ -17,11 +17,14 @@ package model
 import (
 	"io/ioutil"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/casbin/casbin/v2/config"
 	"github.com/casbin/casbin/v2/constant"
+	"github.com/casbin/casbin/v2/util"
 )
 
 var (
@@ -125,6 +128,186 @@ func TestModel_AddDef(t *testing.T) {
 	}
 }
 
+func TestModel_AddDefWithMetadata(t *testing.T) {
+	m := NewModel()
+	m.AddDef("p", "p", "sub, obj, act | meta: desc, owner")
+	if !util.ArrayEquals(m["p"]["p"].Tokens, []string{"p_sub", "p_obj", "p_act"}) {
+		t.Errorf("tokens: %v, supposed to be %v", m["p"]["p"].Tokens, []string{"p_sub", "p_obj", "p_act"})
+	}
+	if !util.ArrayEquals(m["p"]["p"].MetaTokens, []string{"p_desc", "p_owner"}) {
+		t.Errorf("metadata tokens: %v, supposed to be %v", m["p"]["p"].MetaTokens, []string{"p_desc", "p_owner"})
+	}
+
+	m.AddDef("r", "r", "sub, obj, act | meta: desc")
+	if m["r"]["r"].MetaTokens != nil {
+		t.Error("a request definition should not have metadata tokens")
+	}
+	copied := m.Copy()
+	if !util.ArrayEquals(copied["p"]["p"].MetaTokens, []string{"p_desc", "p_owner"}) {
+		t.Errorf("copied metadata tokens: %v, supposed to be %v", copied["p"]["p"].MetaTokens, []string{"p_desc", "p_owner"})
+	}
+}
+
+func TestModel_AddDefWithAliases(t *testing.T) {
+	m, err := NewModelFromString(`
+[request_definition]
+r = sub as subject, obj, act
+
+[policy_definition]
+p = sub as subject, obj as resource, act as action
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.subject == p.sub && r.obj == p.resource && r.act == p.action
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(m["p"]["p"].Tokens, []string{"p_sub", "p_obj", "p_act"}) {
+		t.Errorf("tokens: %v, supposed to be %v", m["p"]["p"].Tokens, []string{"p_sub", "p_obj", "p_act"})
+	}
+	if expected := "r_sub == p_sub && r_obj == p_obj && r_act == p_act"; m["m"]["m"].Value != expected {
+		t.Errorf("matcher: %s, supposed to be %s", m["m"]["m"].Value, expected)
+	}
+	if err = m.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	if index, err := m.GetFieldIndex("p", "resource"); err != nil || index != 1 {
+		t.Errorf("GetFieldIndex: %d, %v, supposed to be 1", index, err)
+	}
+
+	// the matcher is resolved whatever the order the definitions are added in.
+	m = NewModel()
+	m.AddDef("m", "m", "r.sub == p.subject")
+	m.AddDef("p", "p", "sub as subject, obj")
+	if expected := "r_sub == p_sub"; m["m"]["m"].Value != expected {
+		t.Errorf("matcher: %s, supposed to be %s", m["m"]["m"].Value, expected)
+	}
+	if copied := m.Copy(); copied["p"]["p"].Aliases["p_subject"] != "p_sub" {
+		t.Errorf("copied aliases: %v", copied["p"]["p"].Aliases)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	m := NewModel()
+	m.AddDef("r", "r", "sub, obj, act")
+	m.AddDef("p", "p", "sub as subject, obj, act")
+	m.AddDef("m", "m", "r.sub == p.subject && r.obj == p.obj && r.act == p.act")
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	for _, matcher := range []string{
+		"r.sub == p.subjet && r.obj == p.obj",
+		"r.sub == p.sub && r2.obj == p.obj",
+		"r.sub.Name == p.sub && r.dom == p.obj",
+	} {
+		m.AddDef("m", "m", matcher)
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate should fail for %s", matcher)
+		}
+	}
+}
+
+// fresh returns a copy of s with its own storage, like the values read from an adapter.
+func fresh(s string) string {
+	return string([]byte(s))
+}
+
+// sameStorage reports whether the strings share their bytes.
+func sameStorage(s1 string, s2 string) bool {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s1)).Data == (*reflect.StringHeader)(unsafe.Pointer(&s2)).Data
+}
+
+func TestEnableStringInterning(t *testing.T) {
+	m := NewModel()
+	m.AddDef("p", "p", "sub, obj, act")
+	m.AddPolicy("p", "p", []string{"alice", "data1", fresh("read")})
+	m.EnableStringInterning(true)
+
+	rule := []string{"bob", "data1", fresh("read")}
+	m.AddPolicy("p", "p", rule)
+	m.UpdatePolicy("p", "p", []string{"alice", "data1", "read"}, []string{"alice", "data2", fresh("read")})
+
+	policy := m.GetPolicy("p", "p")
+	if !util.Array2DEquals(policy, [][]string{{"alice", "data2", "read"}, {"bob", "data1", "read"}}) {
+		t.Errorf("policy: %v, supposed to be [[alice data2 read] [bob data1 read]]", policy)
+	}
+	if !sameStorage(policy[0][2], policy[1][2]) {
+		t.Error("the identical values of the rules should share their storage")
+	}
+	if !m.HasPolicy("p", "p", []string{"bob", "data1", "read"}) {
+		t.Error("an interned rule should be found by its values")
+	}
+	if &m["p"]["p"].Policy[1][0] == &rule[0] {
+		t.Error("the added rule should not be stored as is")
+	}
+
+	// A copy keeps interning.
+	copied := m.Copy()
+	copied.AddPolicy("p", "p", []string{"carol", "data2", fresh("read")})
+	if !sameStorage(copied["p"]["p"].Policy[2][1], policy[0][1]) {
+		t.Error("the copy should share the table of the model")
+	}
+
+	// A cleared copy, e.g. the one LoadPolicy loads, has its own table.
+	copied.ClearPolicy()
+	if copied["p"]["p"].interner == m["p"]["p"].interner || copied["p"]["p"].interner == nil {
+		t.Error("the cleared copy should have its own table")
+	}
+	copied.AddPolicy("p", "p", []string{"dave", "data2", fresh("read")})
+	if sameStorage(copied["p"]["p"].Policy[0][1], policy[0][1]) || len(copied["p"]["p"].interner.strings) != 3 {
+		t.Error("the table of the cleared copy should only hold its values")
+	}
+
+	m.EnableStringInterning(false)
+	m.AddPolicy("p", "p", []string{"carol", "data1", fresh("read")})
+	if sameStorage(m["p"]["p"].Policy[2][2], policy[0][2]) {
+		t.Error("the values should not be interned once interning is disabled")
+	}
+}
+
+func TestEnablePermissionIndex(t *testing.T) {
+	m := NewModel()
+	m.AddDef("p", "p", "obj, sub, act")
+	m.AddPolicy("p", "p", []string{"data1", "alice", "read"})
+	m.AddPolicy("p", "p", []string{"data2", "bob", "read"})
+	m.EnablePermissionIndex(true)
+	m.AddPolicy("p", "p", []string{"data3", "alice", "read"})
+	m.UpdatePolicy("p", "p", []string{"data2", "bob", "read"}, []string{"data2", "alice", "write"})
+	m.RemovePolicy("p", "p", []string{"data1", "alice", "read"})
+
+	alice := func(subject string) bool { return subject == "alice" }
+	testPolicyOfSubjects := func(m Model, res [][]string) {
+		t.Helper()
+		if myRes := m.GetPolicyOfSubjects("p", alice); !util.Array2DEquals(res, myRes) {
+			t.Errorf("policy of alice: %v, supposed to be %v", myRes, res)
+		}
+	}
+	testPolicyOfSubjects(m, [][]string{{"data2", "alice", "write"}, {"data3", "alice", "read"}})
+	if len(m["p"]["p"].subjects.rules) != 1 {
+		t.Errorf("indexed subjects: %v, supposed to be only alice", m["p"]["p"].subjects.rules)
+	}
+
+	// A copy has its own index.
+	copied := m.Copy()
+	copied.RemoveFilteredPolicy("p", "p", 0, "data2")
+	testPolicyOfSubjects(copied, [][]string{{"data3", "alice", "read"}})
+	testPolicyOfSubjects(m, [][]string{{"data2", "alice", "write"}, {"data3", "alice", "read"}})
+
+	// The rules are visited once the subject is another field than the one indexed.
+	m["p"]["p"].FieldIndexMap[constant.SubjectIndex] = 0
+	testPolicyOfSubjects(m, nil)
+
+	copied.ClearPolicy()
+	testPolicyOfSubjects(copied, nil)
+	if copied["p"]["p"].subjects == nil || len(copied["p"]["p"].subjects.rules) != 0 {
+		t.Error("the cleared copy should have an empty index")
+	}
+}
+
 func TestModelToTest(t *testing.T) {
 	testModelToText(t, "r.sub == p.sub && r.obj == p.obj && r_func(r.act, p.act) && testr_func(r.act, p.act)", "r_sub == p_sub && r_obj == p_obj && r_func(r_act, p_act) && testr_func(r_act, p_act)")
 	testModelToText(t, "r.sub == p.sub && r.obj == p.obj && p_func(r.act, p.act) && testp_func(r.act, p.act)", "r_sub == p_sub && r_obj == p_obj && p_func(r_act, p_act) && testp_func(r_act, p_act)")
@@ -159,3 +342,59 @@ func testModelToText(t *testing.T, mData, mExpected string) {
 		}
 	}
 }
+
+func TestTokenDelimiter(t *testing.T) {
+	text := "[request_definition]\nr = sub\tobj\tact\n\n" +
+		"[policy_definition]\np = sub\t obj \tact | meta: desc\towner\n\n" +
+		"[role_definition]\ng = _\t_\n\n" +
+		"[policy_effect]\ne = some(where (p.eft == allow))\n\n" +
+		"[matchers]\nm = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act\n"
+	m := NewModel()
+	m.SetTokenDelimiter("\t")
+	if err := m.LoadModelFromText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(m["r"]["r"].Tokens, []string{"r_sub", "r_obj", "r_act"}) {
+		t.Errorf("r tokens: %v, supposed to be [r_sub r_obj r_act]", m["r"]["r"].Tokens)
+	}
+	if !util.ArrayEquals(m["p"]["p"].Tokens, []string{"p_sub", "p_obj", "p_act"}) || !util.ArrayEquals(m["p"]["p"].MetaTokens, []string{"p_desc", "p_owner"}) {
+		t.Errorf("p tokens: %v and %v, supposed to be [p_sub p_obj p_act] and [p_desc p_owner]", m["p"]["p"].Tokens, m["p"]["p"].MetaTokens)
+	}
+	if !util.ArrayEquals(m["g"]["g"].Tokens, []string{"_", "_"}) {
+		t.Errorf("g tokens: %v, supposed to be [_ _]", m["g"]["g"].Tokens)
+	}
+	if err := m.Validate(); err != nil {
+		t.Errorf("Validate error: %v", err)
+	}
+
+	// the text of the model uses the default delimiter.
+	m2, err := NewModelFromString(m.ToText())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sec := range []string{"r", "p", "g"} {
+		if !util.ArrayEquals(m2[sec][sec].Tokens, m[sec][sec].Tokens) {
+			t.Errorf("%s tokens of the model text: %v, supposed to be %v", sec, m2[sec][sec].Tokens, m[sec][sec].Tokens)
+		}
+	}
+	if m2.GetTokenDelimiter() != DefaultTokenDelimiter || m.Copy().GetTokenDelimiter() != "\t" {
+		t.Errorf("token delimiters: %q and %q, supposed to be %q and %q", m2.GetTokenDelimiter(), m.Copy().GetTokenDelimiter(), DefaultTokenDelimiter, "\t")
+	}
+}
+
+func TestSplitTokens(t *testing.T) {
+	for _, c := range []struct {
+		value, delimiter string
+		tokens           []string
+	}{
+		{"sub, obj, act", ",", []string{"sub", "obj", "act"}},
+		{" sub ,obj,\tact ", ",", []string{"sub", "obj", "act"}},
+		{"sub\tobj\t act", "\t", []string{"sub", "obj", "act"}},
+		{"sub; obj", ";", []string{"sub", "obj"}},
+		{"sub, obj", "\t", []string{"sub, obj"}},
+	} {
+		if tokens := SplitTokens(c.value, c.delimiter); !util.ArrayEquals(tokens, c.tokens) {
+			t.Errorf("SplitTokens(%q, %q): %q, supposed to be %q", c.value, c.delimiter, tokens, c.tokens)
+		}
+	}
+}
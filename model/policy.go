@@ -16,6 +16,7 @@ package model
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -57,6 +58,15 @@ func (model Model) BuildRoleLinks(rmMap map[string]rbac.RoleManager) error {
 	return nil
 }
 
+// BuildNamedRoleLinks initializes the roles of the named grouping policy in the role manager.
+func (model Model) BuildNamedRoleLinks(ptype string, rm rbac.RoleManager) error {
+	ast, ok := model["g"][ptype]
+	if !ok {
+		return fmt.Errorf("grouping policy definition %s does not exist", ptype)
+	}
+	return ast.buildRoleLinks(rm)
+}
+
 // PrintPolicy prints the policy to log.
 func (model Model) PrintPolicy() {
 	if !model.GetLogger().IsEnabled() {
@@ -93,12 +103,17 @@ func (model Model) ClearPolicy() {
 	for _, ast := range model["p"] {
 		ast.Policy = nil
 		ast.PolicyMap = map[string]int{}
+		ast.reindexRules()
 	}
 
 	for _, ast := range model["g"] {
 		ast.Policy = nil
 		ast.PolicyMap = map[string]int{}
 	}
+
+	// the values of the cleared rules are dropped with the interning table, which the copies of the model
+	// no longer share.
+	model.resetInterner()
 }
 
 // GetPolicy gets all rules in a policy.
@@ -132,7 +147,7 @@ func (model Model) HasPolicyEx(sec string, ptype string, rule []string) (bool, e
 	assertion := model[sec][ptype]
 	switch sec {
 	case "p":
-		if len(rule) != len(assertion.Tokens) {
+		if !assertion.IsValidPolicySize(rule) {
 			return false, fmt.Errorf(
 				"invalid policy rule size: expected %d, got %d, rule: %v",
 				len(model["p"][ptype].Tokens),
@@ -153,10 +168,58 @@ func (model Model) HasPolicyEx(sec string, ptype string, rule []string) (bool, e
 
 // HasPolicy determines whether a model has the specified policy rule.
 func (model Model) HasPolicy(sec string, ptype string, rule []string) bool {
-	_, ok := model[sec][ptype].PolicyMap[strings.Join(rule, DefaultSep)]
+	_, ok := model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(rule)]
 	return ok
 }
 
+// GetStoredPolicy returns the rule of the policy equal to the rule as it is stored, e.g. with the metadata fields
+// the rule was given without, and nil if the policy has no such rule.
+func (model Model) GetStoredPolicy(sec string, ptype string, rule []string) []string {
+	ast := model[sec][ptype]
+	index, ok := ast.PolicyMap[ast.policyKey(rule)]
+	if !ok {
+		return nil
+	}
+	return ast.Policy[index]
+}
+
+// GetPolicyMetadata returns the metadata of the stored rule equal to the rule, keyed by metadata token without
+// its prefix, e.g. "owner" for p_owner. The metadata fields that the rule was stored without are empty.
+// It returns nil if the policy has no such rule.
+func (model Model) GetPolicyMetadata(sec string, ptype string, rule []string) map[string]string {
+	ast := model[sec][ptype]
+	stored := model.GetStoredPolicy(sec, ptype, rule)
+	if stored == nil {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(ast.MetaTokens))
+	for i, token := range ast.MetaTokens {
+		value := ""
+		if j := len(ast.Tokens) + i; j < len(stored) {
+			value = stored[j]
+		}
+		metadata[strings.TrimPrefix(token, ptype+"_")] = value
+	}
+	return metadata
+}
+
+// SetCompareMetadata sets whether the rules of the policy definitions that differ only in their metadata
+// are distinct rules. It should be called before the policy is loaded: turning the comparison off keeps
+// the rules already loaded that then become duplicates.
+func (model Model) SetCompareMetadata(compare bool) {
+	for _, ast := range model["p"] {
+		ast.CompareMetadata = compare
+		ast.PolicyMap = make(map[string]int, len(ast.Policy))
+		for i, rule := range ast.Policy {
+			if _, ok := ast.PolicyMap[ast.policyKey(rule)]; !ok {
+				ast.PolicyMap[ast.policyKey(rule)] = i
+			}
+		}
+		ast.reindexRules()
+	}
+}
+
 // HasPolicies determines whether a model has any of the specified policies. If one is found we return true.
 func (model Model) HasPolicies(sec string, ptype string, rules [][]string) bool {
 	for i := 0; i < len(rules); i++ {
@@ -171,8 +234,11 @@ func (model Model) HasPolicies(sec string, ptype string, rules [][]string) bool
 // AddPolicy adds a policy rule to the model.
 func (model Model) AddPolicy(sec string, ptype string, rule []string) {
 	assertion := model[sec][ptype]
+	if assertion.interner != nil {
+		rule = assertion.interner.internRule(rule)
+	}
 	assertion.Policy = append(assertion.Policy, rule)
-	assertion.PolicyMap[strings.Join(rule, DefaultSep)] = len(model[sec][ptype].Policy) - 1
+	assertion.PolicyMap[assertion.policyKey(rule)] = len(model[sec][ptype].Policy) - 1
 
 	hasPriority := false
 	if _, ok := assertion.FieldIndexMap[constant.PriorityIndex]; ok {
@@ -188,15 +254,16 @@ func (model Model) AddPolicy(sec string, ptype string, rule []string) {
 				}
 				if idx > idxInsert {
 					assertion.Policy[i] = assertion.Policy[i-1]
-					assertion.PolicyMap[strings.Join(assertion.Policy[i-1], DefaultSep)]++
+					assertion.PolicyMap[assertion.policyKey(assertion.Policy[i-1])]++
 				} else {
 					break
 				}
 			}
 			assertion.Policy[i] = rule
-			assertion.PolicyMap[strings.Join(rule, DefaultSep)] = i
+			assertion.PolicyMap[assertion.policyKey(rule)] = i
 		}
 	}
+	assertion.indexRule(rule)
 }
 
 // AddPolicies adds policy rules to the model.
@@ -208,7 +275,7 @@ func (model Model) AddPolicies(sec string, ptype string, rules [][]string) {
 func (model Model) AddPoliciesWithAffected(sec string, ptype string, rules [][]string) [][]string {
 	var affected [][]string
 	for _, rule := range rules {
-		hashKey := strings.Join(rule, DefaultSep)
+		hashKey := model[sec][ptype].policyKey(rule)
 		_, ok := model[sec][ptype].PolicyMap[hashKey]
 		if ok {
 			continue
@@ -222,31 +289,37 @@ func (model Model) AddPoliciesWithAffected(sec string, ptype string, rules [][]s
 // RemovePolicy removes a policy rule from the model.
 // Deprecated: Using AddPoliciesWithAffected instead.
 func (model Model) RemovePolicy(sec string, ptype string, rule []string) bool {
-	index, ok := model[sec][ptype].PolicyMap[strings.Join(rule, DefaultSep)]
+	index, ok := model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(rule)]
 	if !ok {
 		return false
 	}
 
 	model[sec][ptype].Policy = append(model[sec][ptype].Policy[:index], model[sec][ptype].Policy[index+1:]...)
-	delete(model[sec][ptype].PolicyMap, strings.Join(rule, DefaultSep))
+	delete(model[sec][ptype].PolicyMap, model[sec][ptype].policyKey(rule))
 	for i := index; i < len(model[sec][ptype].Policy); i++ {
-		model[sec][ptype].PolicyMap[strings.Join(model[sec][ptype].Policy[i], DefaultSep)] = i
+		model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(model[sec][ptype].Policy[i])] = i
 	}
+	model[sec][ptype].unindexRule(rule)
 
 	return true
 }
 
 // UpdatePolicy updates a policy rule from the model.
 func (model Model) UpdatePolicy(sec string, ptype string, oldRule []string, newRule []string) bool {
-	oldPolicy := strings.Join(oldRule, DefaultSep)
+	oldPolicy := model[sec][ptype].policyKey(oldRule)
 	index, ok := model[sec][ptype].PolicyMap[oldPolicy]
 	if !ok {
 		return false
 	}
 
+	if model[sec][ptype].interner != nil {
+		newRule = model[sec][ptype].interner.internRule(newRule)
+	}
 	model[sec][ptype].Policy[index] = newRule
 	delete(model[sec][ptype].PolicyMap, oldPolicy)
-	model[sec][ptype].PolicyMap[strings.Join(newRule, DefaultSep)] = index
+	model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(newRule)] = index
+	model[sec][ptype].unindexRule(oldRule)
+	model[sec][ptype].indexRule(newRule)
 
 	return true
 }
@@ -261,17 +334,19 @@ func (model Model) UpdatePolicies(sec string, ptype string, oldRules, newRules [
 		if rollbackFlag {
 			for index, oldNewIndex := range modifiedRuleIndex {
 				model[sec][ptype].Policy[index] = oldRules[oldNewIndex[0]]
-				oldPolicy := strings.Join(oldRules[oldNewIndex[0]], DefaultSep)
-				newPolicy := strings.Join(newRules[oldNewIndex[1]], DefaultSep)
+				oldPolicy := model[sec][ptype].policyKey(oldRules[oldNewIndex[0]])
+				newPolicy := model[sec][ptype].policyKey(newRules[oldNewIndex[1]])
 				delete(model[sec][ptype].PolicyMap, newPolicy)
 				model[sec][ptype].PolicyMap[oldPolicy] = index
+				model[sec][ptype].unindexRule(newRules[oldNewIndex[1]])
+				model[sec][ptype].indexRule(oldRules[oldNewIndex[0]])
 			}
 		}
 	}()
 
 	newIndex := 0
 	for oldIndex, oldRule := range oldRules {
-		oldPolicy := strings.Join(oldRule, DefaultSep)
+		oldPolicy := model[sec][ptype].policyKey(oldRule)
 		index, ok := model[sec][ptype].PolicyMap[oldPolicy]
 		if !ok {
 			rollbackFlag = true
@@ -279,8 +354,13 @@ func (model Model) UpdatePolicies(sec string, ptype string, oldRules, newRules [
 		}
 
 		model[sec][ptype].Policy[index] = newRules[newIndex]
+		if model[sec][ptype].interner != nil {
+			model[sec][ptype].Policy[index] = model[sec][ptype].interner.internRule(newRules[newIndex])
+		}
 		delete(model[sec][ptype].PolicyMap, oldPolicy)
-		model[sec][ptype].PolicyMap[strings.Join(newRules[newIndex], DefaultSep)] = index
+		model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(newRules[newIndex])] = index
+		model[sec][ptype].unindexRule(oldRule)
+		model[sec][ptype].indexRule(newRules[newIndex])
 		modifiedRuleIndex[index] = []int{oldIndex, newIndex}
 		newIndex++
 	}
@@ -298,17 +378,18 @@ func (model Model) RemovePolicies(sec string, ptype string, rules [][]string) bo
 func (model Model) RemovePoliciesWithAffected(sec string, ptype string, rules [][]string) [][]string {
 	var affected [][]string
 	for _, rule := range rules {
-		index, ok := model[sec][ptype].PolicyMap[strings.Join(rule, DefaultSep)]
+		index, ok := model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(rule)]
 		if !ok {
 			continue
 		}
 
 		affected = append(affected, rule)
 		model[sec][ptype].Policy = append(model[sec][ptype].Policy[:index], model[sec][ptype].Policy[index+1:]...)
-		delete(model[sec][ptype].PolicyMap, strings.Join(rule, DefaultSep))
+		delete(model[sec][ptype].PolicyMap, model[sec][ptype].policyKey(rule))
 		for i := index; i < len(model[sec][ptype].Policy); i++ {
-			model[sec][ptype].PolicyMap[strings.Join(model[sec][ptype].Policy[i], DefaultSep)] = i
+			model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(model[sec][ptype].Policy[i])] = i
 		}
+		model[sec][ptype].unindexRule(rule)
 	}
 	return affected
 }
@@ -333,12 +414,13 @@ func (model Model) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int
 			effects = append(effects, rule)
 		} else {
 			tmp = append(tmp, rule)
-			model[sec][ptype].PolicyMap[strings.Join(rule, DefaultSep)] = len(tmp) - 1
+			model[sec][ptype].PolicyMap[model[sec][ptype].policyKey(rule)] = len(tmp) - 1
 		}
 	}
 
 	if len(tmp) != len(model[sec][ptype].Policy) {
 		model[sec][ptype].Policy = tmp
+		model[sec][ptype].reindexRules()
 		res = true
 	}
 
@@ -359,10 +441,17 @@ func (model Model) GetValuesForFieldInPolicy(sec string, ptype string, fieldInde
 }
 
 // GetValuesForFieldInPolicyAllTypes gets all values for a field for all rules in a policy of all ptypes, duplicated values are removed.
+// The ptypes are visited in lexicographical order, so the values keep their order of first appearance.
 func (model Model) GetValuesForFieldInPolicyAllTypes(sec string, fieldIndex int) []string {
 	values := []string{}
 
+	ptypes := make([]string, 0, len(model[sec]))
 	for ptype := range model[sec] {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+
+	for _, ptype := range ptypes {
 		values = append(values, model.GetValuesForFieldInPolicy(sec, ptype, fieldIndex)...)
 	}
 
@@ -0,0 +1,153 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"sort"
+
+	"github.com/casbin/casbin/v2/constant"
+)
+
+// subjectIndex maps the subjects of the rules of a policy definition to the keys of their rules in PolicyMap,
+// see Model.EnablePermissionIndex.
+type subjectIndex struct {
+	// field is the index of the subject in the rules when the index was built.
+	field int
+	rules map[string]map[string]struct{}
+}
+
+func newSubjectIndex(ast *Assertion) *subjectIndex {
+	index := &subjectIndex{field: ast.subjectIndex(), rules: map[string]map[string]struct{}{}}
+	for _, rule := range ast.Policy {
+		index.add(ast, rule)
+	}
+	return index
+}
+
+func (index *subjectIndex) add(ast *Assertion, rule []string) {
+	if index.field >= len(rule) {
+		return
+	}
+	keys, ok := index.rules[rule[index.field]]
+	if !ok {
+		keys = map[string]struct{}{}
+		index.rules[rule[index.field]] = keys
+	}
+	keys[ast.policyKey(rule)] = struct{}{}
+}
+
+func (index *subjectIndex) remove(ast *Assertion, rule []string) {
+	if index.field >= len(rule) {
+		return
+	}
+	keys := index.rules[rule[index.field]]
+	delete(keys, ast.policyKey(rule))
+	if len(keys) == 0 {
+		delete(index.rules, rule[index.field])
+	}
+}
+
+// subjectIndex returns the index of the subject in the rules, the first field if the subject is not defined.
+func (ast *Assertion) subjectIndex() int {
+	if index := ast.fieldIndex(constant.SubjectIndex); index != -1 {
+		return index
+	}
+	return 0
+}
+
+// indexRule adds the rule to the subject index, if the assertion has one.
+func (ast *Assertion) indexRule(rule []string) {
+	if ast.subjects != nil {
+		ast.subjects.add(ast, rule)
+	}
+}
+
+// unindexRule removes the rule from the subject index, if the assertion has one.
+func (ast *Assertion) unindexRule(rule []string) {
+	if ast.subjects != nil {
+		ast.subjects.remove(ast, rule)
+	}
+}
+
+// reindexRules rebuilds the subject index from the rules, if the assertion has one.
+func (ast *Assertion) reindexRules() {
+	if ast.subjects != nil {
+		ast.subjects = newSubjectIndex(ast)
+	}
+}
+
+// EnablePermissionIndex controls whether the model keeps an index from the subjects of the rules of the
+// policy definitions to their rules, which GetPolicyOfSubjects then uses instead of going through all the rules.
+// The index is built from the rules already in the model and is kept up to date by the changes of the policy
+// made through the model. It is copied with the model but not kept by a new model, e.g. of LoadModel.
+func (model Model) EnablePermissionIndex(enable bool) {
+	for _, ast := range model["p"] {
+		ast.subjects = nil
+		if enable {
+			ast.subjects = newSubjectIndex(ast)
+		}
+	}
+}
+
+// GetPolicyOfSubjects returns the rules of the policy definition whose subject is accepted by match, in the order
+// of the policy, match is called once per distinct subject. The rules are looked up in the index kept by
+// EnablePermissionIndex, or else found by going through all the rules.
+func (model Model) GetPolicyOfSubjects(ptype string, match func(subject string) bool) [][]string {
+	ast, ok := model["p"][ptype]
+	if !ok {
+		return nil
+	}
+
+	field := ast.subjectIndex()
+	if ast.subjects == nil || ast.subjects.field != field {
+		return ast.scanPolicyOfSubjects(field, match)
+	}
+
+	var indexes []int
+	for subject, keys := range ast.subjects.rules {
+		if !match(subject) {
+			continue
+		}
+		for key := range keys {
+			indexes = append(indexes, ast.PolicyMap[key])
+		}
+	}
+	sort.Ints(indexes)
+
+	res := make([][]string, len(indexes))
+	for i, index := range indexes {
+		res[i] = ast.Policy[index]
+	}
+	return res
+}
+
+func (ast *Assertion) scanPolicyOfSubjects(field int, match func(subject string) bool) [][]string {
+	var res [][]string
+	matched := map[string]bool{}
+	for _, rule := range ast.Policy {
+		if field >= len(rule) {
+			continue
+		}
+		ok, seen := matched[rule[field]]
+		if !seen {
+			ok = match(rule[field])
+			matched[rule[field]] = ok
+		}
+		if ok {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
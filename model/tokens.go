@@ -0,0 +1,70 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import "strings"
+
+// DefaultTokenDelimiter is the delimiter of the tokens of the request, policy and role definitions,
+// e.g. "sub, obj, act".
+const DefaultTokenDelimiter = ","
+
+// optionsKey is the key of the options of the model, which is not a section of the model text.
+const optionsKey = "options"
+
+// tokenDelimiterOption is the option holding the token delimiter set by SetTokenDelimiter.
+const tokenDelimiterOption = "token_delimiter"
+
+// SplitTokens splits the value of a definition into its tokens at every delimiter, the spaces and tabs
+// around every token are trimmed, e.g. "sub,  obj ,act" gives "sub", "obj" and "act".
+func SplitTokens(value string, delimiter string) []string {
+	tokens := strings.Split(value, delimiter)
+	for i, token := range tokens {
+		tokens[i] = strings.TrimSpace(token)
+	}
+	return tokens
+}
+
+// SetTokenDelimiter sets the delimiter of the tokens of the request, policy and role definitions added
+// afterwards, e.g. "\t" for definitions like "p = sub	obj	act", the default is DefaultTokenDelimiter.
+// It is set on a model created by NewModel before the model text is loaded.
+func (model Model) SetTokenDelimiter(delimiter string) {
+	if delimiter == "" || delimiter == DefaultTokenDelimiter {
+		delete(model, optionsKey)
+		return
+	}
+	model[optionsKey] = AssertionMap{tokenDelimiterOption: &Assertion{Key: tokenDelimiterOption, Value: delimiter}}
+}
+
+// GetTokenDelimiter returns the delimiter of the tokens of the definitions, see SetTokenDelimiter.
+func (model Model) GetTokenDelimiter() string {
+	if ast, ok := model[optionsKey][tokenDelimiterOption]; ok {
+		return ast.Value
+	}
+	return DefaultTokenDelimiter
+}
+
+// splitTokens splits the value of a definition of the model into its tokens, see SplitTokens.
+func (model Model) splitTokens(value string) []string {
+	return SplitTokens(value, model.GetTokenDelimiter())
+}
+
+// canonicalDefinition returns the value of a definition with the tokens separated by ", " if the model uses
+// another delimiter, so that the text of the model can be read with the default one, e.g. by Casbin.js.
+func (model Model) canonicalDefinition(value string) string {
+	if model.GetTokenDelimiter() == DefaultTokenDelimiter {
+		return value
+	}
+	return strings.Join(model.splitTokens(value), DefaultTokenDelimiter+" ")
+}
@@ -16,8 +16,11 @@ package casbin
 
 import (
 	"fmt"
+	"runtime"
 	"testing"
 
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -55,6 +58,16 @@ func BenchmarkRBACModel(b *testing.B) {
 	}
 }
 
+func BenchmarkRBACModelWithRuleUsage(b *testing.B) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", false)
+	e.EnableRuleUsageTracking(true)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("alice", "data2", "read")
+	}
+}
+
 func BenchmarkRBACModelSizes(b *testing.B) {
 	cases := []struct {
 		name      string
@@ -211,6 +224,67 @@ func BenchmarkRBACModelLarge(b *testing.B) {
 	}
 }
 
+func BenchmarkRBACModelMediumAllocs(b *testing.B) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", false)
+
+	// 1000 roles, 100 resources.
+	pPolicies := make([][]string, 0)
+	for i := 0; i < 1000; i++ {
+		pPolicies = append(pPolicies, []string{fmt.Sprintf("group%d", i), fmt.Sprintf("data%d", i/10), "read"})
+	}
+
+	_, err := e.AddPolicies(pPolicies)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = e.Enforce("group999", "data99", "read")
+		}
+	})
+}
+
+func BenchmarkDenyOverrideModelLarge(b *testing.B) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[policy_effect]
+e = !some(where (p.eft == deny))
+
+[matchers]
+m = r.sub == p.sub && keyMatch(r.obj, p.obj) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m, false)
+
+	// 10000 allow rules, 100 deny rules.
+	pPolicies := make([][]string, 0)
+	for i := 0; i < 10000; i++ {
+		eft := "allow"
+		if i%100 == 0 {
+			eft = "deny"
+		}
+		pPolicies = append(pPolicies, []string{fmt.Sprintf("user%d", i), fmt.Sprintf("/data%d/*", i/10), "read", eft})
+	}
+
+	_, err := e.AddPolicies(pPolicies)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = e.Enforce("user5001", "/data500/1", "read")
+	}
+}
+
 func BenchmarkRBACModelWithResourceRoles(b *testing.B) {
 	e, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf", "examples/rbac_with_resource_roles_policy.csv", false)
 
@@ -289,3 +363,51 @@ func BenchmarkRBACModelWithDomainPatternLarge(b *testing.B) {
 		_, _ = e.Enforce("staffUser1001", "/orgs/1/sites/site001", "App001.Module001.Action1001")
 	}
 }
+
+// BenchmarkMatcherCompilation compares enforcing with the compiled matcher reused to compiling it for every call.
+func BenchmarkMatcherCompilation(b *testing.B) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv", false)
+
+	b.Run("reused", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = e.Enforce("alice", "data2", "read")
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			e.invalidateMatcherMap()
+			_, _ = e.Enforce("alice", "data2", "read")
+		}
+	})
+}
+
+// BenchmarkStringInterning compares the heap used by a policy of 200000 rules over 5000 subjects, 20000 objects
+// and 200 actions loaded with and without string interning.
+func BenchmarkStringInterning(b *testing.B) {
+	heapAlloc := func() uint64 {
+		var stats runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	for _, interning := range []bool{false, true} {
+		interning := interning
+		b.Run(fmt.Sprintf("interning=%t", interning), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				m, _ := model.NewModelFromFile("examples/basic_model.conf")
+				m.EnableStringInterning(interning)
+				before := heapAlloc()
+				for j := 0; j < 200000; j++ {
+					// like the rules read by a database adapter, every field is a string of its own.
+					rule := []string{"p", fmt.Sprintf("user%d", j%5000), fmt.Sprintf("data%d", j/10), fmt.Sprintf("action%d", j%200)}
+					_ = persist.LoadPolicyArray(rule, m)
+				}
+				b.ReportMetric(float64(heapAlloc()-before)/(1<<20), "heap-MB")
+				runtime.KeepAlive(m)
+			}
+		})
+	}
+}
@@ -263,6 +263,8 @@ func TestRBACModelWithCustomData(t *testing.T) {
 	// You can add custom data to a grouping policy, Casbin will ignore it. It is only meaningful to the caller.
 	// This feature can be used to store information like whether "bob" is an end user (so no subject will inherit "bob")
 	// For Casbin, it is equivalent to: e.AddGroupingPolicy("bob", "data2_admin")
+	// Rules with extra fields are rejected unless AllowExtraFields(true) is set.
+	e.AllowExtraFields(true)
 	_, _ = e.AddGroupingPolicy("bob", "data2_admin", "custom_data")
 
 	testEnforce(t, e, "alice", "data1", "read", true)
@@ -449,6 +451,25 @@ func TestKeyMatch2Model(t *testing.T) {
 	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
 }
 
+func TestKeyMatch2NormalizedModel(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch2_normalized_model.conf", "examples/keymatch2_normalized_policy.csv")
+
+	testEnforce(t, e, "alice", "/api/orders", "GET", true)
+	testEnforce(t, e, "alice", "/api/users", "GET", false)
+	testEnforce(t, e, "alice", "/api/users/1/profile", "GET", false)
+
+	// The deny rules cannot be bypassed by duplicate slashes, "." segments or a trailing slash.
+	testEnforce(t, e, "alice", "/api//users", "GET", false)
+	testEnforce(t, e, "alice", "/api/users/", "GET", false)
+	testEnforce(t, e, "alice", "/api/./users", "GET", false)
+	testEnforce(t, e, "alice", "//api/users//", "GET", false)
+	testEnforce(t, e, "alice", "/api/users//1/./profile/", "GET", false)
+
+	// A path with a ".." segment is rejected.
+	testEnforce(t, e, "alice", "/api/orders/../users", "GET", false)
+	testEnforce(t, e, "alice", "/api/../api/orders", "GET", false)
+}
+
 func CustomFunction(key1 string, key2 string) bool {
 	if key1 == "/alice_data2/myid/using/res_id" && key2 == "/alice_data/:resource" {
 		return true
@@ -475,6 +496,25 @@ func TestKeyMatchCustomModel(t *testing.T) {
 	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
 }
 
+func TestKeyMatchCustomModelReplaced(t *testing.T) {
+	e, _ := NewEnforcer("examples/keymatch_custom_model.conf", "examples/keymatch2_policy.csv")
+	alwaysTrue := func(args ...interface{}) (interface{}, error) {
+		return true, nil
+	}
+
+	// a custom function can be replaced.
+	e.AddFunction("keyMatchCustom", alwaysTrue)
+	e.AddFunction("keyMatchCustom", CustomFunctionWrapper)
+	testEnforce(t, e, "alice", "/alice_data2/myid", "GET", false)
+	testEnforce(t, e, "alice", "/alice_data2/myid/using/res_id", "GET", true)
+
+	// a built-in function cannot.
+	e, _ = NewEnforcer("examples/keymatch2_model.conf", "examples/keymatch2_policy.csv")
+	e.AddFunction("keyMatch2", alwaysTrue)
+	testEnforce(t, e, "alice", "/alice_data/resource", "GET", true)
+	testEnforce(t, e, "alice", "/bob_data/resource", "GET", false)
+}
+
 func TestIPMatchModel(t *testing.T) {
 	e, _ := NewEnforcer("examples/ipmatch_model.conf", "examples/ipmatch_policy.csv")
 
@@ -0,0 +1,110 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+// writeTeamFiles writes the policy files of two teams into a temporary directory and returns it.
+func writeTeamFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"team-b.csv": "p, bob, data2, write\ng, bob, data2_admin\n",
+		"team-a.csv": "# team a\np, alice, data1, read\np, data2_admin, data2, read\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testFileContent(t *testing.T, path string, content string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("%s: %q, supposed to be %q", filepath.Base(path), data, content)
+	}
+}
+
+func TestMultiFileAdapter(t *testing.T) {
+	dir := writeTeamFiles(t)
+	a, err := fileadapter.NewFileAdapterFromGlob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	// the files are loaded in sorted order.
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"data2_admin", "data2", "read"}, {"bob", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"bob", "data2_admin"}})
+	testEnforce(t, e, "bob", "data2", "read", true)
+
+	// the rules are saved to the files they come from, the new ones to the default file, team-a.csv.
+	e.EnableAutoSave(false)
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.RemovePolicy("data2_admin", "data2", "read")
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testFileContent(t, filepath.Join(dir, "team-a.csv"), "p, alice, data1, read\np, eve, data3, read\n")
+	testFileContent(t, filepath.Join(dir, "team-b.csv"), "p, bob, data2, write\ng, bob, data2_admin\n")
+
+	// with auto-save, a removed rule is deleted from its file and an added one appended to the default file.
+	e.EnableAutoSave(true)
+	_, _ = e.RemovePolicy("bob", "data2", "write")
+	a.SetDefaultFile(filepath.Join(dir, "team-b.csv"))
+	_, _ = e.AddPolicy("frank", "data4", "write")
+	testFileContent(t, filepath.Join(dir, "team-a.csv"), "p, alice, data1, read\np, eve, data3, read\n")
+	testFileContent(t, filepath.Join(dir, "team-b.csv"), "g, bob, data2_admin\np, frank, data4, write\n")
+
+	if err = e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testGetPolicy(t, e, [][]string{{"alice", "data1", "read"}, {"eve", "data3", "read"}, {"frank", "data4", "write"}})
+	if err = e.SavePolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testFileContent(t, filepath.Join(dir, "team-b.csv"), "p, frank, data4, write\ng, bob, data2_admin\n")
+
+	if _, err = fileadapter.NewFileAdapterFromGlob(filepath.Join(dir, "*.json")); err == nil {
+		t.Error("NewFileAdapterFromGlob should fail when no file matches")
+	}
+}
+
+func TestMultiFileAdapterFiltered(t *testing.T) {
+	dir := writeTeamFiles(t)
+	a := fileadapter.NewMultiFileAdapter(filepath.Join(dir, "team-a.csv"), filepath.Join(dir, "team-b.csv"))
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	if err := e.LoadFilteredPolicy(&fileadapter.Filter{P: []string{"", "data2"}}); err != nil {
+		t.Fatal(err)
+	}
+	testGetPolicy(t, e, [][]string{{"data2_admin", "data2", "read"}, {"bob", "data2", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"bob", "data2_admin"}})
+	if err := e.SavePolicy(); err == nil {
+		t.Error("SavePolicy should fail for a filtered policy")
+	}
+}
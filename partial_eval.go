@@ -0,0 +1,171 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+	"github.com/casbin/casbin/v2/constant"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// EnforceWithPartialEval evaluates the matcher with the request values that are known, keyed by token like "r.sub",
+// and returns the condition left on the unknown ones, e.g. `r.obj == "data1" || r.obj == "data2"` for a query
+// pushdown. Every policy rule gives the top-level && clauses of the matcher still using an unknown value,
+// with the known values and the fields of the rule put in, the other clauses are evaluated.
+// The residual is "true" if a rule matches whatever the unknown values are and "false" if none can match.
+// Only the some(where (p.eft == allow)) policy effect is supported.
+func (e *Enforcer) EnforceWithPartialEval(known map[string]interface{}) (residual string, err error) {
+	if e.model["e"]["e"].Value != constant.AllowOverrideEffect {
+		return "", fmt.Errorf("partial evaluation only supports the policy effect %s", unescapeToken(constant.AllowOverrideEffect))
+	}
+	rTokens, pTokens := e.model["r"]["r"].Tokens, e.model["p"]["p"].Tokens
+	expString := e.model["m"]["m"].Value
+
+	rvals := make([]interface{}, len(rTokens))
+	knownTokens := map[string]bool{}
+	for name, value := range known {
+		token := util.EscapeAssertion(name)
+		index := -1
+		for i, t := range rTokens {
+			if t == token {
+				index = i
+			}
+		}
+		if index == -1 {
+			return "", fmt.Errorf("unknown request token %s", name)
+		}
+		rvals[index] = value
+		knownTokens[token] = true
+	}
+
+	buffer := e.getEnforceBuffer(rTokens, pTokens, rvals)
+	defer putEnforceBuffer(buffer)
+	parameters := &buffer.parameters
+
+	functions := e.getFunctions(context.Background())
+	if util.HasEval(expString) {
+		functions["eval"] = generateEvalFunction(functions, parameters)
+	}
+
+	clauses := util.SplitConjunction(expString)
+	expressions := make([]*govaluate.EvaluableExpression, len(clauses))
+	unknown := make([]bool, len(clauses))
+	for i, clause := range clauses {
+		for _, token := range rTokens {
+			if !knownTokens[token] && tokenRegexp(token).MatchString(clause) {
+				unknown[i] = true
+			}
+		}
+		if unknown[i] {
+			continue
+		}
+		if expressions[i], err = govaluate.NewEvaluableExpressionWithFunctions(clause, functions); err != nil {
+			return "", fmt.Errorf("invalid clause %s of matcher m: %s", clause, err)
+		}
+	}
+
+	// residualOf returns the clauses left for the rule, and false if a clause is false whatever the unknown values are.
+	residualOf := func(rule []string) ([]string, bool, error) {
+		parameters.pVals = rule
+		var left []string
+		for i, clause := range clauses {
+			if unknown[i] {
+				left = append(left, substituteTokens(clause, rTokens, rvals, knownTokens, pTokens, rule))
+				continue
+			}
+			value, err := expressions[i].Eval(parameters)
+			if err != nil {
+				return nil, false, err
+			}
+			if value == false || value == float64(0) {
+				return nil, false, nil
+			}
+		}
+		return left, true, nil
+	}
+
+	rules := e.model["p"]["p"].Policy
+	if !strings.Contains(expString, "p_") {
+		rules = [][]string{make([]string, len(pTokens))}
+	}
+
+	var residuals []string
+	seen := map[string]bool{}
+	for _, rule := range rules {
+		left, ok, err := residualOf(rule)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			continue
+		}
+		if len(left) == 0 {
+			return "true", nil
+		}
+		for i, clause := range left {
+			if strings.Contains(clause, "||") {
+				left[i] = "(" + clause + ")"
+			}
+		}
+		if condition := strings.Join(left, " && "); !seen[condition] {
+			seen[condition] = true
+			residuals = append(residuals, condition)
+		}
+	}
+
+	switch len(residuals) {
+	case 0:
+		return "false", nil
+	case 1:
+		return residuals[0], nil
+	}
+	for i, condition := range residuals {
+		if strings.Contains(condition, "&&") {
+			residuals[i] = "(" + condition + ")"
+		}
+	}
+	return strings.Join(residuals, " || "), nil
+}
+
+// substituteTokens puts the known request values and the fields of the rule in the clause,
+// and turns the unknown request tokens back into names like "r.obj".
+func substituteTokens(clause string, rTokens []string, rvals []interface{}, knownTokens map[string]bool, pTokens []string, rule []string) string {
+	for i, token := range rTokens {
+		if knownTokens[token] {
+			clause = tokenRegexp(token).ReplaceAllLiteralString(clause, literal(rvals[i]))
+		} else {
+			clause = tokenRegexp(token).ReplaceAllLiteralString(clause, unescapeToken(token))
+		}
+	}
+	for i, token := range pTokens {
+		if i < len(rule) {
+			clause = tokenRegexp(token).ReplaceAllLiteralString(clause, literal(rule[i]))
+		}
+	}
+	return clause
+}
+
+// literal writes the value as a literal of the matcher language, strings are quoted.
+func literal(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
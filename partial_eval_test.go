@@ -0,0 +1,85 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+func testPartialEval(t *testing.T, e *Enforcer, known map[string]interface{}, res string) {
+	t.Helper()
+	residual, err := e.EnforceWithPartialEval(known)
+	if err != nil {
+		t.Fatalf("EnforceWithPartialEval: %v", err)
+	}
+	if residual != res {
+		t.Errorf("%v: residual %s, supposed to be %s", known, residual, res)
+	}
+}
+
+func TestEnforceWithPartialEval(t *testing.T) {
+	e, _ := NewEnforcer("examples/basic_model.conf", "examples/basic_policy.csv")
+
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice", "r.act": "read"}, `r.obj == "data1"`)
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice"}, `r.obj == "data1" && r.act == "read"`)
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "bob", "r.act": "read"}, "false")
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice", "r.obj": "data1", "r.act": "read"}, "true")
+
+	_, _ = e.AddPolicy("alice", "data3", "read")
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice", "r.act": "read"}, `r.obj == "data1" || r.obj == "data3"`)
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice"},
+		`(r.obj == "data1" && r.act == "read") || (r.obj == "data3" && r.act == "read")`)
+
+	if _, err := e.EnforceWithPartialEval(map[string]interface{}{"r.dom": "domain1"}); err == nil {
+		t.Error("EnforceWithPartialEval should fail for a token the request definition does not have")
+	}
+}
+
+func TestEnforceWithPartialEvalRBAC(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	// the roles of the known subject are resolved, only the object is left.
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "alice", "r.act": "read"}, `r.obj == "data1" || r.obj == "data2"`)
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "bob", "r.act": "read"}, "false")
+
+	e, _ = NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+	if _, err := e.EnforceWithPartialEval(map[string]interface{}{"r.sub": "alice"}); err == nil {
+		t.Error("EnforceWithPartialEval should fail for a deny policy effect")
+	}
+}
+
+func TestEnforceWithPartialEvalDisjunction(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act || r.sub == "root"
+`)
+	e, _ := NewEnforcer(m, fileadapter.NewAdapter("examples/basic_policy.csv"))
+
+	// the matcher is "(r.sub == p.sub && r.obj == p.obj && r.act == p.act) || r.sub == "root"", not a conjunction.
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "root", "r.obj": "data1", "r.act": "write"}, "true")
+	testPartialEval(t, e, map[string]interface{}{"r.sub": "bob", "r.obj": "data1", "r.act": "write"}, "false")
+}
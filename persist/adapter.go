@@ -16,8 +16,11 @@ package persist
 
 import (
 	"encoding/csv"
+	"fmt"
+	"sort"
 	"strings"
 
+	Err "github.com/casbin/casbin/v2/errors"
 	"github.com/casbin/casbin/v2/model"
 )
 
@@ -41,9 +44,19 @@ func LoadPolicyLine(line string, m model.Model) error {
 }
 
 // LoadPolicyArray loads a policy rule to model.
+// It returns an *errors.ErrInvalidRule if the ptype of the rule is not defined or the rule has the wrong number of fields.
 func LoadPolicyArray(rule []string, m model.Model) error {
+	if len(rule) == 0 || rule[0] == "" {
+		return &Err.ErrInvalidRule{Rule: rule, Reason: "ptype is not defined"}
+	}
 	key := rule[0]
 	sec := key[:1]
+	if _, ok := m[sec][key]; !ok || (sec != "p" && sec != "g") {
+		return &Err.ErrInvalidRule{PType: key, Rule: rule[1:], Reason: "ptype is not defined"}
+	}
+	if expected := len(m[sec][key].Tokens); len(rule[1:]) < expected || (sec == "p" && !m[sec][key].IsValidPolicySize(rule[1:])) {
+		return &Err.ErrInvalidRule{PType: key, Expected: expected, Rule: rule[1:], Reason: fmt.Sprintf("got %d fields", len(rule)-1)}
+	}
 	ok, err := m.HasPolicyEx(sec, key, rule[1:])
 	if err != nil {
 		return err
@@ -55,11 +68,25 @@ func LoadPolicyArray(rule []string, m model.Model) error {
 	return nil
 }
 
+// SortedPtypes returns the ptypes of the section of the model in lexicographical order, e.g. p, p2 or g, g2,
+// the order the adapters save them in.
+func SortedPtypes(m model.Model, sec string) []string {
+	ptypes := make([]string, 0, len(m[sec]))
+	for ptype := range m[sec] {
+		ptypes = append(ptypes, ptype)
+	}
+	sort.Strings(ptypes)
+	return ptypes
+}
+
 // Adapter is the interface for Casbin adapters.
 type Adapter interface {
 	// LoadPolicy loads all policy rules from the storage.
 	LoadPolicy(model model.Model) error
 	// SavePolicy saves all policy rules to the storage.
+	// The rules should be saved in a deterministic order, so that saving the same policy twice gives the same
+	// storage content: the "p" rules before the "g" rules, the ptypes of a section in the order of SortedPtypes
+	// and the rules of a ptype in the order of the model, see SortedPtypes.
 	SavePolicy(model model.Model) error
 
 	// AddPolicy adds a policy rule to the storage.
@@ -27,3 +27,12 @@ type FilteredAdapter interface {
 	// IsFiltered returns true if the loaded policy has been filtered.
 	IsFiltered() bool
 }
+
+// FilteredSaveAdapter is the interface for the filtered adapters that can save a filtered policy.
+type FilteredSaveAdapter interface {
+	FilteredAdapter
+
+	// SaveFilteredPolicy replaces the policy rules that match the filter in the storage with the rules of
+	// the model that match the filter, the rules of the model that do not match it are ignored.
+	SaveFilteredPolicy(model model.Model, filter interface{}) error
+}
@@ -0,0 +1,359 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package adaptertest provides a test suite checking that an implementation of persist.Adapter behaves like the
+// enforcer expects, which third-party adapters can run in their own tests.
+package adaptertest
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// notImplemented is the error message of the Auto-Save methods an adapter does not support, the enforcer
+// ignores these errors and so does the suite by skipping the checks of such methods.
+const notImplemented = "not implemented"
+
+// autoSaveDefinition is the definition of the model of the Auto-Save checks, p2 has the same first fields as p
+// to check that the methods only change the rules of the ptype they are given.
+const autoSaveDefinition = "p = sub, obj, act\np2 = sub, obj, act, eft"
+
+// autoSavePolicy is the policy the storage holds before every Auto-Save check.
+const autoSavePolicy = `
+p, alice, data1, read
+p, alice, data1, write
+p, alice, data2, read
+p, bob, data1, read
+p, bob, data2, write
+p2, alice, data1, read, deny
+g, alice, admin
+g, bob, admin
+g, carol, alice
+`
+
+// roundTripCases are the models and policies SavePolicy and LoadPolicy are checked with, like the examples.
+var roundTripCases = []struct {
+	name             string
+	policyDefinition string
+	roleDefinition   string
+	policy           string
+}{
+	{"basic", "p = sub, obj, act", "", `
+p, alice, data1, read
+p, bob, data2, write
+`},
+	{"rbac", "p = sub, obj, act", "g = _, _", `
+p, alice, data1, read
+p, bob, data2, write
+p, data2_admin, data2, read
+p, data2_admin, data2, write
+g, alice, data2_admin
+`},
+	{"rbac_with_domains", "p = sub, dom, obj, act", "g = _, _, _", `
+p, admin, domain1, data1, read
+p, admin, domain1, data1, write
+p, admin, domain2, data2, read
+g, alice, admin, domain1
+g, bob, admin, domain2
+`},
+	{"rbac_with_resource_roles", "p = sub, obj, act", "g = _, _\ng2 = _, _", `
+p, alice, data1, read
+p, data_group_admin, data_group, write
+g, alice, data_group_admin
+g2, data1, data_group
+g2, data2, data_group
+`},
+	{"priority", "p = priority, sub, obj, act, eft", "g = _, _", `
+p, 10, data1_deny_group, data1, read, deny
+p, 1, alice, data1, read, allow
+p, 2, bob, data2, write, allow
+g, bob, data2_allow_group
+`},
+	{"abac_rule", "p = sub_rule, obj, act", "", `
+p, r.sub.Age > 18 && r.sub.Age < 60, /data1, read
+p, r.sub.Name == 'alice', /data2, write
+`},
+	{"multiple_ptypes", autoSaveDefinition, "g = _, _", autoSavePolicy},
+}
+
+// TestAdapter checks the adapter returned by factory, which is called for every check to get an adapter on an
+// empty storage: LoadPolicy, SavePolicy, the Auto-Save methods and, if the adapter implements them,
+// persist.BatchAdapter, persist.FilteredAdapter and persist.UpdatableAdapter. The rules may be stored in any order.
+func TestAdapter(t *testing.T, factory func() persist.Adapter) {
+	t.Run("LoadEmpty", func(t *testing.T) {
+		a := factory()
+		testPolicy(t, a, newModel(t, autoSaveDefinition, "g = _, _", ""))
+	})
+
+	t.Run("SaveEmpty", func(t *testing.T) {
+		a := factory()
+		seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+		// saving an empty policy removes every rule of the storage.
+		empty := newModel(t, autoSaveDefinition, "g = _, _", "")
+		if err := a.SavePolicy(empty); err != nil {
+			t.Fatalf("SavePolicy of an empty policy error: %v", err)
+		}
+		testPolicy(t, a, empty)
+	})
+
+	t.Run("SaveRoundTrip", func(t *testing.T) {
+		for _, c := range roundTripCases {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				a := factory()
+				expected := seed(t, a, c.policyDefinition, c.roleDefinition, c.policy)
+				testPolicy(t, a, expected)
+
+				// saving again replaces the rules instead of adding them.
+				expected.RemovePolicy("p", "p", append([]string{}, expected.GetPolicy("p", "p")[0]...))
+				if err := a.SavePolicy(expected); err != nil {
+					t.Fatalf("second SavePolicy error: %v", err)
+				}
+				testPolicy(t, a, expected)
+			})
+		}
+	})
+
+	t.Run("AddRemovePolicy", func(t *testing.T) {
+		a := factory()
+		expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+
+		for _, r := range []struct {
+			sec, ptype string
+			rule       []string
+		}{
+			{"p", "p", []string{"carol", "data3", "read"}},
+			{"p", "p2", []string{"bob", "data1", "read", "allow"}},
+			{"g", "g", []string{"dave", "admin"}},
+		} {
+			skipIfNotImplemented(t, a.AddPolicy(r.sec, r.ptype, r.rule), "AddPolicy")
+			expected.AddPolicy(r.sec, r.ptype, r.rule)
+		}
+		testPolicy(t, a, expected)
+
+		for _, r := range []struct {
+			sec, ptype string
+			rule       []string
+		}{
+			{"p", "p", []string{"alice", "data1", "read"}},
+			{"p", "p", []string{"carol", "data3", "read"}},
+			{"g", "g", []string{"carol", "alice"}},
+		} {
+			skipIfNotImplemented(t, a.RemovePolicy(r.sec, r.ptype, r.rule), "RemovePolicy")
+			expected.RemovePolicy(r.sec, r.ptype, r.rule)
+		}
+		testPolicy(t, a, expected)
+	})
+
+	t.Run("AddDuplicatePolicy", func(t *testing.T) {
+		a := factory()
+		expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+		// the storage may keep both copies, but they are loaded once.
+		skipIfNotImplemented(t, a.AddPolicy("p", "p", []string{"alice", "data1", "read"}), "AddPolicy")
+		testPolicy(t, a, expected)
+	})
+
+	t.Run("RemoveFilteredPolicy", func(t *testing.T) {
+		for _, c := range []struct {
+			name        string
+			sec, ptype  string
+			fieldIndex  int
+			fieldValues []string
+		}{
+			{"FirstField", "p", "p", 0, []string{"alice"}},
+			{"FieldIndexOffset", "p", "p", 1, []string{"data1"}},
+			{"LastField", "p", "p", 2, []string{"read"}},
+			{"SeveralFields", "p", "p", 1, []string{"data2", "write"}},
+			{"LeadingWildcard", "p", "p", 0, []string{"", "data1"}},
+			{"GapInFieldValues", "p", "p", 0, []string{"alice", "", "read"}},
+			{"AllWildcards", "p", "p", 0, []string{"", ""}},
+			{"NoMatch", "p", "p", 0, []string{"nobody"}},
+			{"OtherPtype", "p", "p2", 0, []string{"alice"}},
+			{"Grouping", "g", "g", 1, []string{"admin"}},
+		} {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				a := factory()
+				expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+				skipIfNotImplemented(t, a.RemoveFilteredPolicy(c.sec, c.ptype, c.fieldIndex, c.fieldValues...), "RemoveFilteredPolicy")
+				expected.RemoveFilteredPolicy(c.sec, c.ptype, c.fieldIndex, c.fieldValues...)
+				testPolicy(t, a, expected)
+			})
+		}
+	})
+
+	t.Run("BatchAdapter", func(t *testing.T) {
+		a := factory()
+		batch, ok := a.(persist.BatchAdapter)
+		if !ok {
+			t.Skip("the adapter does not implement persist.BatchAdapter")
+		}
+		expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+
+		added := [][]string{{"carol", "data3", "read"}, {"carol", "data3", "write"}}
+		skipIfNotImplemented(t, batch.AddPolicies("p", "p", added), "AddPolicies")
+		expected.AddPolicies("p", "p", added)
+		testPolicy(t, a, expected)
+
+		removed := [][]string{{"alice", "data1", "read"}, {"carol", "data3", "write"}}
+		skipIfNotImplemented(t, batch.RemovePolicies("p", "p", removed), "RemovePolicies")
+		expected.RemovePolicies("p", "p", removed)
+		testPolicy(t, a, expected)
+
+		removed = [][]string{{"alice", "admin"}, {"bob", "admin"}}
+		skipIfNotImplemented(t, batch.RemovePolicies("g", "g", removed), "RemovePolicies")
+		expected.RemovePolicies("g", "g", removed)
+		testPolicy(t, a, expected)
+	})
+
+	t.Run("FilteredAdapter", func(t *testing.T) {
+		a := factory()
+		filtered, ok := a.(persist.FilteredAdapter)
+		if !ok {
+			t.Skip("the adapter does not implement persist.FilteredAdapter")
+		}
+		expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+
+		// the filters are specific to the adapter, a nil filter loads the whole policy.
+		m := newModel(t, autoSaveDefinition, "g = _, _", "")
+		if err := filtered.LoadFilteredPolicy(m, nil); err != nil {
+			t.Fatalf("LoadFilteredPolicy with a nil filter error: %v", err)
+		}
+		if filtered.IsFiltered() {
+			t.Error("IsFiltered after loading with a nil filter: true, supposed to be false")
+		}
+		testModelPolicy(t, m, expected)
+
+		// the policy loaded without filter can be saved.
+		if err := a.SavePolicy(expected); err != nil {
+			t.Fatalf("SavePolicy after loading with a nil filter error: %v", err)
+		}
+		testPolicy(t, a, expected)
+	})
+
+	t.Run("UpdatableAdapter", func(t *testing.T) {
+		a := factory()
+		updatable, ok := a.(persist.UpdatableAdapter)
+		if !ok {
+			t.Skip("the adapter does not implement persist.UpdatableAdapter")
+		}
+		expected := seed(t, a, autoSaveDefinition, "g = _, _", autoSavePolicy)
+
+		oldRule, newRule := []string{"alice", "data1", "read"}, []string{"alice", "data3", "read"}
+		skipIfNotImplemented(t, updatable.UpdatePolicy("p", "p", oldRule, newRule), "UpdatePolicy")
+		expected.UpdatePolicy("p", "p", oldRule, newRule)
+		testPolicy(t, a, expected)
+
+		oldRules := [][]string{{"alice", "admin"}, {"carol", "alice"}}
+		newRules := [][]string{{"alice", "superuser"}, {"carol", "bob"}}
+		skipIfNotImplemented(t, updatable.UpdatePolicies("g", "g", oldRules, newRules), "UpdatePolicies")
+		expected.UpdatePolicies("g", "g", oldRules, newRules)
+		testPolicy(t, a, expected)
+
+		newRules = [][]string{{"dave", "data4", "read"}}
+		oldRules, err := updatable.UpdateFilteredPolicies("p", "p", newRules, 0, "bob")
+		skipIfNotImplemented(t, err, "UpdateFilteredPolicies")
+		_, removed := expected.RemoveFilteredPolicy("p", "p", 0, "bob")
+		expected.AddPolicies("p", "p", newRules)
+		if !util.Array2DEquals(sortedRules(oldRules), sortedRules(removed)) {
+			t.Errorf("UpdateFilteredPolicies returned %v, supposed to be %v", oldRules, removed)
+		}
+		testPolicy(t, a, expected)
+	})
+}
+
+// newModel returns a model with the policy and role definitions, and the rules of the policy text.
+// The request definition and the matcher do not matter to an adapter.
+func newModel(t *testing.T, policyDefinition string, roleDefinition string, policy string) model.Model {
+	t.Helper()
+	text := "[request_definition]\nr = sub, obj, act\n\n[policy_definition]\n" + policyDefinition + "\n\n"
+	if roleDefinition != "" {
+		text += "[role_definition]\n" + roleDefinition + "\n\n"
+	}
+	text += "[policy_effect]\ne = some(where (p.eft == allow))\n\n[matchers]\nm = r.obj == p.obj\n"
+	m, err := model.NewModelFromString(text)
+	if err != nil {
+		t.Fatalf("invalid model: %v", err)
+	}
+	for _, line := range strings.Split(policy, "\n") {
+		if err = persist.LoadPolicyLine(strings.TrimSpace(line), m); err != nil {
+			t.Fatalf("invalid rule %s: %v", line, err)
+		}
+	}
+	return m
+}
+
+// seed loads the empty storage of the adapter like an enforcer would, saves the policy to it and returns
+// the model of the policy.
+func seed(t *testing.T, a persist.Adapter, policyDefinition string, roleDefinition string, policy string) model.Model {
+	t.Helper()
+	if err := a.LoadPolicy(newModel(t, policyDefinition, roleDefinition, "")); err != nil {
+		t.Fatalf("LoadPolicy of the empty storage error: %v", err)
+	}
+	m := newModel(t, policyDefinition, roleDefinition, policy)
+	if err := a.SavePolicy(m); err != nil {
+		t.Fatalf("SavePolicy error: %v", err)
+	}
+	return m
+}
+
+// testPolicy checks that loading the storage of the adapter gives the policy of the expected model.
+func testPolicy(t *testing.T, a persist.Adapter, expected model.Model) {
+	t.Helper()
+	m := expected.Copy()
+	m.ClearPolicy()
+	if err := a.LoadPolicy(m); err != nil {
+		t.Fatalf("LoadPolicy error: %v", err)
+	}
+	testModelPolicy(t, m, expected)
+}
+
+// testModelPolicy checks that the model has the policy of the expected model, in any order.
+func testModelPolicy(t *testing.T, m model.Model, expected model.Model) {
+	t.Helper()
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range persist.SortedPtypes(expected, sec) {
+			myRules, rules := sortedRules(m.GetPolicy(sec, ptype)), sortedRules(expected.GetPolicy(sec, ptype))
+			if !util.Array2DEquals(myRules, rules) {
+				t.Errorf("%s rules: %v, supposed to be %v", ptype, myRules, rules)
+			}
+		}
+	}
+}
+
+// skipIfNotImplemented skips the check if err is the error of a method the adapter does not support,
+// and fails it on any other error.
+func skipIfNotImplemented(t *testing.T, err error, method string) {
+	t.Helper()
+	if err != nil && err.Error() == notImplemented {
+		t.Skipf("%s is not implemented by the adapter", method)
+	}
+	if err != nil {
+		t.Fatalf("%s error: %v", method, err)
+	}
+}
+
+// sortedRules returns a sorted copy of the rules.
+func sortedRules(rules [][]string) [][]string {
+	sorted := append([][]string{}, rules...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return util.ArrayToString(sorted[i]) < util.ArrayToString(sorted[j])
+	})
+	return sorted
+}
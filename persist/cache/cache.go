@@ -14,13 +14,17 @@
 
 package cache
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var ErrNoSuchKey = errors.New("there's no such key existing in cache")
 
 type Cache interface {
 	// Set puts key and value into cache.
-	// First parameter for extra should be uint denoting expected survival time.
+	// First parameter for extra is the expected survival time, a time.Duration given by CachedEnforcer,
+	// the caches of this package also accept uint seconds, see SurvivalTime.
 	// If survival time equals 0 or less, the key will always be survival.
 	Set(key string, value bool, extra ...interface{}) error
 
@@ -37,3 +41,38 @@ type Cache interface {
 	// Clear deletes all the items stored in cache.
 	Clear() error
 }
+
+// SurvivalTime returns the survival time given to Set as the first parameter for extra,
+// either uint seconds or a time.Duration, 0 if there is none.
+func SurvivalTime(extra []interface{}) time.Duration {
+	if len(extra) == 0 {
+		return 0
+	}
+	switch survivalTime := extra[0].(type) {
+	case uint:
+		return time.Duration(survivalTime) * time.Second
+	case time.Duration:
+		return survivalTime
+	}
+	return 0
+}
+
+// CacheWithTTL is a Cache that can also report how long a cached value has left.
+type CacheWithTTL interface {
+	Cache
+
+	// GetWithTTL returns result for key and its remaining survival time,
+	// which is 0 for a key that will always be survival.
+	// If there's no such key existing in cache, or it has expired,
+	// ErrNoSuchKey will be returned.
+	GetWithTTL(key string) (bool, time.Duration, error)
+}
+
+// ValueCache is a Cache whose values can be of any type, e.g. the decisions of CachedEnforcer.EnforceExStructured
+// along with their matched rules. Its methods behave like the ones of Cache.
+type ValueCache interface {
+	Set(key string, value interface{}, extra ...interface{}) error
+	Get(key string) (interface{}, error)
+	Delete(key string) error
+	Clear() error
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cachetest provides a test suite checking that an implementation of cache.Cache behaves like the
+// built-in ones, which is what CachedEnforcer expects.
+package cachetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/persist/cache"
+)
+
+// ClockSetter is implemented by the caches whose clock can be replaced, like cache.TTLCache.
+// The suite then checks the survival times with a fake clock instead of sleeping.
+type ClockSetter interface {
+	SetClock(now func() time.Time)
+}
+
+// TestCache checks the cache returned by factory, which is called for every check to get an empty cache:
+// missing keys, Set and Get, survival times, Delete and Clear.
+func TestCache(t *testing.T, factory func() cache.Cache) {
+	t.Run("GetMissing", func(t *testing.T) {
+		c := factory()
+		if res, err := c.Get("missing"); err != cache.ErrNoSuchKey || res {
+			t.Errorf("Get(missing): %t, %v, supposed to be false, %v", res, err, cache.ErrNoSuchKey)
+		}
+	})
+
+	t.Run("SetGet", func(t *testing.T) {
+		c := factory()
+		mustSet(t, c, "allowed", true)
+		mustSet(t, c, "denied", false)
+		testGet(t, c, "allowed", true)
+		testGet(t, c, "denied", false)
+
+		// Set replaces the value.
+		mustSet(t, c, "allowed", false)
+		testGet(t, c, "allowed", false)
+	})
+
+	t.Run("TTL", func(t *testing.T) {
+		c := factory()
+		clock, ok := c.(ClockSetter)
+		now := time.Unix(1000, 0)
+		var mu sync.Mutex
+		advance := func(d time.Duration) {
+			if !ok {
+				time.Sleep(d)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			now = now.Add(d)
+		}
+		if ok {
+			clock.SetClock(func() time.Time {
+				mu.Lock()
+				defer mu.Unlock()
+				return now
+			})
+		}
+
+		mustSet(t, c, "short", true, 20*time.Millisecond)
+		mustSet(t, c, "long", true, time.Hour)
+		mustSet(t, c, "forever", true)
+		mustSet(t, c, "zero", true, time.Duration(0))
+		mustSet(t, c, "negative", true, -time.Second)
+		testGet(t, c, "short", true)
+
+		advance(50 * time.Millisecond)
+		if res, err := c.Get("short"); err != cache.ErrNoSuchKey || res {
+			t.Errorf("Get(short) after its survival time: %t, %v, supposed to be false, %v", res, err, cache.ErrNoSuchKey)
+		}
+		// a survival time of 0 or less keeps the key.
+		for _, key := range []string{"long", "forever", "zero", "negative"} {
+			testGet(t, c, key, true)
+		}
+
+		// Set restarts the survival time.
+		mustSet(t, c, "short", false, 20*time.Millisecond)
+		testGet(t, c, "short", false)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		c := factory()
+		if err := c.Delete("missing"); err != cache.ErrNoSuchKey {
+			t.Errorf("Delete(missing) error: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+		}
+		mustSet(t, c, "key", true)
+		mustSet(t, c, "other", true)
+		if err := c.Delete("key"); err != nil {
+			t.Errorf("Delete(key) error: %v", err)
+		}
+		if _, err := c.Get("key"); err != cache.ErrNoSuchKey {
+			t.Errorf("Get(key) after Delete error: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+		}
+		if err := c.Delete("key"); err != cache.ErrNoSuchKey {
+			t.Errorf("second Delete(key) error: %v, supposed to be %v", err, cache.ErrNoSuchKey)
+		}
+		testGet(t, c, "other", true)
+	})
+
+	t.Run("Clear", func(t *testing.T) {
+		c := factory()
+		for i := 0; i < 10; i++ {
+			mustSet(t, c, fmt.Sprint(i), true)
+		}
+		if err := c.Clear(); err != nil {
+			t.Fatalf("Clear error: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			if _, err := c.Get(fmt.Sprint(i)); err != cache.ErrNoSuchKey {
+				t.Errorf("Get(%d) after Clear error: %v, supposed to be %v", i, err, cache.ErrNoSuchKey)
+			}
+		}
+		// the cache can be used after Clear.
+		mustSet(t, c, "0", true)
+		testGet(t, c, "0", true)
+	})
+}
+
+// TestConcurrentCache checks like TestCache a cache meant to be used by several goroutines without locking,
+// and that its methods can be called concurrently, which is best run with the race detector.
+func TestConcurrentCache(t *testing.T, factory func() cache.Cache) {
+	TestCache(t, factory)
+
+	t.Run("Concurrent", func(t *testing.T) {
+		c := factory()
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				own := fmt.Sprintf("key%d", i)
+				for j := 0; j < 200; j++ {
+					if err := c.Set(own, j%2 == 0); err != nil {
+						t.Errorf("Set(%s) error: %v", own, err)
+						return
+					}
+					// the key may have been cleared by another goroutine meanwhile.
+					if res, err := c.Get(own); err != nil && err != cache.ErrNoSuchKey || err == nil && res != (j%2 == 0) {
+						t.Errorf("Get(%s): %t, %v, supposed to be %t", own, res, err, j%2 == 0)
+						return
+					}
+					_ = c.Set("shared", true, time.Minute)
+					_, _ = c.Get("shared")
+					_ = c.Delete("shared")
+					if j%50 == 0 {
+						_ = c.Clear()
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func mustSet(t *testing.T, c cache.Cache, key string, value bool, extra ...interface{}) {
+	t.Helper()
+	if err := c.Set(key, value, extra...); err != nil {
+		t.Fatalf("Set(%s) error: %v", key, err)
+	}
+}
+
+func testGet(t *testing.T, c cache.Cache, key string, res bool) {
+	t.Helper()
+	myRes, err := c.Get(key)
+	if err != nil || myRes != res {
+		t.Errorf("Get(%s): %t, %v, supposed to be %t", key, myRes, err, res)
+	}
+}
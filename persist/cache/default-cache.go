@@ -14,6 +14,125 @@
 
 package cache
 
+import "time"
+
+type cacheItem struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// minSweepSize is the number of items from which Set starts dropping the expired ones.
+const minSweepSize = 64
+
+// DefaultValueCache is an in-memory ValueCache whose entries expire after the survival time given to Set.
+// Expired entries are no longer returned, they are dropped by the next Set of the same key, by Delete, by Clear,
+// or by a Set once the cache has doubled in size since they were last dropped. Its zero value is an empty cache.
+type DefaultValueCache struct {
+	items map[string]cacheItem
+	now   func() time.Time
+	// sweepSize is the number of items from which Set drops the expired ones.
+	sweepSize int
+}
+
+// NewDefaultValueCache creates an empty DefaultValueCache.
+func NewDefaultValueCache() *DefaultValueCache {
+	return &DefaultValueCache{
+		items:     make(map[string]cacheItem),
+		now:       time.Now,
+		sweepSize: minSweepSize,
+	}
+}
+
+func (c *DefaultValueCache) Set(key string, value interface{}, extra ...interface{}) error {
+	item := cacheItem{value: value}
+	if ttl := SurvivalTime(extra); ttl > 0 {
+		item.expiresAt = c.clock().Add(ttl)
+	}
+	if c.items == nil {
+		c.items = make(map[string]cacheItem)
+	}
+	c.items[key] = item
+
+	if len(c.items) >= c.sweepSize {
+		c.dropExpired()
+		c.sweepSize = 2 * len(c.items)
+		if c.sweepSize < minSweepSize {
+			c.sweepSize = minSweepSize
+		}
+	}
+	return nil
+}
+
+// clock returns the current time, of the clock set by SetClock if any.
+func (c *DefaultValueCache) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// dropExpired deletes the expired items.
+func (c *DefaultValueCache) dropExpired() {
+	now := c.clock()
+	for key, item := range c.items {
+		if !item.expiresAt.IsZero() && !item.expiresAt.After(now) {
+			delete(c.items, key)
+		}
+	}
+}
+
+func (c *DefaultValueCache) Get(key string) (interface{}, error) {
+	res, _, err := c.GetWithTTL(key)
+	return res, err
+}
+
+func (c *DefaultValueCache) GetWithTTL(key string) (interface{}, time.Duration, error) {
+	item, ok := c.items[key]
+	if !ok {
+		return nil, 0, ErrNoSuchKey
+	}
+	if item.expiresAt.IsZero() {
+		return item.value, 0, nil
+	}
+
+	ttl := item.expiresAt.Sub(c.clock())
+	if ttl <= 0 {
+		return nil, 0, ErrNoSuchKey
+	}
+	return item.value, ttl, nil
+}
+
+// Delete removes the key, it returns ErrNoSuchKey for a key that has expired.
+func (c *DefaultValueCache) Delete(key string) error {
+	item, ok := c.items[key]
+	if !ok {
+		return ErrNoSuchKey
+	}
+	delete(c.items, key)
+	if !item.expiresAt.IsZero() && !item.expiresAt.After(c.clock()) {
+		return ErrNoSuchKey
+	}
+	return nil
+}
+
+func (c *DefaultValueCache) Clear() error {
+	c.items = make(map[string]cacheItem)
+	c.sweepSize = minSweepSize
+	return nil
+}
+
+// Len returns the number of items stored in cache, including the expired ones not dropped yet.
+func (c *DefaultValueCache) Len() int {
+	return len(c.items)
+}
+
+// SetClock sets the function giving the current time the survival times are measured with, time.Now by default.
+func (c *DefaultValueCache) SetClock(now func() time.Time) {
+	c.now = now
+}
+
+// DefaultCache is an in-memory Cache of the decisions, the survival times given to Set are ignored:
+// the decisions are kept until they are deleted or cleared. TTLCache is the one honoring the survival times.
 type DefaultCache map[string]bool
 
 func (c *DefaultCache) Set(key string, value bool, extra ...interface{}) error {
@@ -42,3 +161,32 @@ func (c *DefaultCache) Clear() error {
 	*c = make(DefaultCache)
 	return nil
 }
+
+// TTLCache is an in-memory Cache of the decisions whose entries expire after the survival time given to Set,
+// see SurvivalTime. Expired entries are no longer returned, they are dropped like the ones of DefaultValueCache.
+// It is the cache CachedEnforcer uses by default, its zero value is an empty cache.
+type TTLCache struct {
+	DefaultValueCache
+}
+
+// NewTTLCache creates an empty TTLCache.
+func NewTTLCache() *TTLCache {
+	return &TTLCache{DefaultValueCache: *NewDefaultValueCache()}
+}
+
+func (c *TTLCache) Set(key string, value bool, extra ...interface{}) error {
+	return c.DefaultValueCache.Set(key, value, extra...)
+}
+
+func (c *TTLCache) Get(key string) (bool, error) {
+	res, _, err := c.GetWithTTL(key)
+	return res, err
+}
+
+func (c *TTLCache) GetWithTTL(key string) (bool, time.Duration, error) {
+	res, ttl, err := c.DefaultValueCache.GetWithTTL(key)
+	if err != nil {
+		return false, 0, err
+	}
+	return res.(bool), ttl, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func testGetWithTTL(t *testing.T, c *TTLCache, key string, res bool, ttl time.Duration, resErr error) {
+	t.Helper()
+	myRes, myTTL, err := c.GetWithTTL(key)
+	if err != resErr {
+		t.Fatalf("GetWithTTL(%s) error: %v, supposed to be %v", key, err, resErr)
+	}
+	if myRes != res || myTTL != ttl {
+		t.Errorf("GetWithTTL(%s): %t, %s, supposed to be %t, %s", key, myRes, myTTL, res, ttl)
+	}
+}
+
+func TestDefaultCache(t *testing.T) {
+	c := DefaultCache(make(map[string]bool))
+
+	// The survival time is ignored.
+	_ = c.Set("allowed", true, time.Nanosecond)
+	_ = c.Set("denied", false)
+	time.Sleep(time.Millisecond)
+	if res, err := c.Get("allowed"); err != nil || !res {
+		t.Errorf("Get(allowed): %t, %v, supposed to be true", res, err)
+	}
+	if err := c.Delete("denied"); err != nil {
+		t.Errorf("Delete(denied) error: %v", err)
+	}
+	if _, err := c.Get("denied"); err != ErrNoSuchKey {
+		t.Errorf("Get(denied) error: %v, supposed to be %v", err, ErrNoSuchKey)
+	}
+	_ = c.Clear()
+	if len(c) != 0 {
+		t.Errorf("Len: %d, supposed to be 0", len(c))
+	}
+}
+
+func TestTTLCache(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	c := NewTTLCache()
+	c.now = clock.now
+
+	_ = c.Set("forever", true)
+	_ = c.Set("zero", true, time.Duration(0))
+	_ = c.Set("minute", true, time.Minute)
+	_ = c.Set("second", false, time.Second)
+	// A uint survival time is in seconds.
+	_ = c.Set("uint", true, uint(2))
+	// A survival time of another type is ignored.
+	_ = c.Set("int", true, 1)
+
+	testGetWithTTL(t, c, "forever", true, 0, nil)
+	testGetWithTTL(t, c, "zero", true, 0, nil)
+	testGetWithTTL(t, c, "minute", true, time.Minute, nil)
+	testGetWithTTL(t, c, "second", false, time.Second, nil)
+	testGetWithTTL(t, c, "uint", true, 2*time.Second, nil)
+	testGetWithTTL(t, c, "int", true, 0, nil)
+	testGetWithTTL(t, c, "missing", false, 0, ErrNoSuchKey)
+
+	clock.t = clock.t.Add(400 * time.Millisecond)
+	testGetWithTTL(t, c, "minute", true, time.Minute-400*time.Millisecond, nil)
+	testGetWithTTL(t, c, "second", false, 600*time.Millisecond, nil)
+
+	// An entry expires exactly at the end of its survival time.
+	clock.t = clock.t.Add(600 * time.Millisecond)
+	testGetWithTTL(t, c, "second", false, 0, ErrNoSuchKey)
+	if _, err := c.Get("second"); err != ErrNoSuchKey {
+		t.Errorf("Get(second) error: %v, supposed to be %v", err, ErrNoSuchKey)
+	}
+	testGetWithTTL(t, c, "minute", true, 59*time.Second, nil)
+	testGetWithTTL(t, c, "uint", true, time.Second, nil)
+	testGetWithTTL(t, c, "forever", true, 0, nil)
+
+	// Setting the key again restarts its survival time.
+	_ = c.Set("second", true, time.Second)
+	testGetWithTTL(t, c, "second", true, time.Second, nil)
+
+	if c.Len() != 6 {
+		t.Errorf("Len: %d, supposed to be 6", c.Len())
+	}
+	_ = c.Clear()
+	testGetWithTTL(t, c, "forever", false, 0, ErrNoSuchKey)
+}
+
+func TestTTLCacheExpiry(t *testing.T) {
+	c := NewTTLCache()
+	_ = c.Set("short", true, time.Millisecond)
+	_ = c.Set("forever", true)
+
+	time.Sleep(5 * time.Millisecond)
+	if _, err := c.Get("short"); err != ErrNoSuchKey {
+		t.Errorf("Get(short) error: %v, supposed to be %v", err, ErrNoSuchKey)
+	}
+	if res, err := c.Get("forever"); err != nil || !res {
+		t.Errorf("Get(forever): %t, %v, supposed to be true", res, err)
+	}
+	if err := c.Delete("short"); err != ErrNoSuchKey {
+		t.Errorf("Delete(short) error: %v, supposed to be %v", err, ErrNoSuchKey)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len: %d, supposed to be 1", c.Len())
+	}
+}
+
+func TestTTLCacheDropExpired(t *testing.T) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	c := NewTTLCache()
+	c.now = clock.now
+
+	_ = c.Set("forever", true)
+	for i := 0; i < 1000; i++ {
+		_ = c.Set(fmt.Sprintf("key%d", i), true, time.Second)
+		clock.t = clock.t.Add(10 * time.Millisecond)
+	}
+	// the expired keys are dropped as the cache grows, the ones set during the last second and "forever" are kept.
+	if c.Len() > 2*(100+1) {
+		t.Errorf("Len: %d, the expired items should have been dropped", c.Len())
+	}
+	testGetWithTTL(t, c, "forever", true, 0, nil)
+	testGetWithTTL(t, c, "key999", true, 990*time.Millisecond, nil)
+}
+
+func TestDefaultValueCache(t *testing.T) {
+	type decision struct {
+		result bool
+		rule   string
+	}
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	c := NewDefaultValueCache()
+	c.now = clock.now
+
+	_ = c.Set("alice", decision{result: true, rule: "p, alice, data1, read"})
+	_ = c.Set("bob", decision{}, time.Second)
+	if res, err := c.Get("alice"); err != nil || res != (decision{result: true, rule: "p, alice, data1, read"}) {
+		t.Errorf("Get(alice): %v, %v, supposed to be the decision of alice", res, err)
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if res, err := c.Get("bob"); err != ErrNoSuchKey || res != nil {
+		t.Errorf("Get(bob): %v, %v, supposed to be %v", res, err, ErrNoSuchKey)
+	}
+	if err := c.Delete("alice"); err != nil {
+		t.Error(err)
+	}
+	if err := c.Delete("alice"); err != ErrNoSuchKey {
+		t.Errorf("Delete(alice) error: %v, supposed to be %v", err, ErrNoSuchKey)
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+type cacheabilityKey struct{}
+
+// WithCacheability returns a context in which DoNotCache marks the decision of the enforcement as not cacheable,
+// and a function reporting whether the decision can be cached, i.e. DoNotCache has not been called.
+func WithCacheability(ctx context.Context) (context.Context, func() bool) {
+	var notCacheable int32
+	return context.WithValue(ctx, cacheabilityKey{}, &notCacheable), func() bool {
+		return atomic.LoadInt32(&notCacheable) == 0
+	}
+}
+
+// DoNotCache is returned by a context function of the matcher, see Enforcer.AddContextFunction, whose result
+// must not be cached, e.g. because it depends on the time: return cache.DoNotCache(ctx, hour < 18), nil.
+// It marks the decision of the enforcement of ctx as not cacheable and returns value.
+func DoNotCache(ctx context.Context, value interface{}) interface{} {
+	if notCacheable, ok := ctx.Value(cacheabilityKey{}).(*int32); ok {
+		atomic.StoreInt32(notCacheable, 1)
+	}
+	return value
+}
@@ -0,0 +1,76 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// SyncCache is a TTLCache that is safe for concurrent use, so that it can be used without the locks
+// CachedEnforcer takes around its caches, e.g. shared between several enforcers.
+type SyncCache struct {
+	mu sync.RWMutex
+	c  *TTLCache
+}
+
+// NewSyncCache creates an empty SyncCache.
+func NewSyncCache() *SyncCache {
+	return &SyncCache{c: NewTTLCache()}
+}
+
+func (c *SyncCache) Set(key string, value bool, extra ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Set(key, value, extra...)
+}
+
+func (c *SyncCache) Get(key string) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.c.Get(key)
+}
+
+func (c *SyncCache) GetWithTTL(key string) (bool, time.Duration, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.c.GetWithTTL(key)
+}
+
+func (c *SyncCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Delete(key)
+}
+
+func (c *SyncCache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.c.Clear()
+}
+
+// Len returns the number of items stored in cache, including the expired ones not dropped yet.
+func (c *SyncCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.c.Len()
+}
+
+// SetClock sets the function giving the current time the survival times are measured with, time.Now by default.
+func (c *SyncCache) SetClock(now func() time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.c.SetClock(now)
+}
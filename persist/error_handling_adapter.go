@@ -0,0 +1,29 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+import "github.com/casbin/casbin/v2/model"
+
+// LoadErrorHandler is given every malformed rule found when loading the policy, with its line number
+// and raw text. It returns true to skip the rule and go on loading, false to stop loading with the error.
+type LoadErrorHandler func(line int, raw string, err error) (skip bool)
+
+// ErrorHandlingAdapter is the interface for Casbin adapters that can go on loading the policy past malformed rules.
+type ErrorHandlingAdapter interface {
+	Adapter
+
+	// LoadPolicyWithErrorHandler loads all policy rules from the storage, the malformed rules are given to handler.
+	LoadPolicyWithErrorHandler(model model.Model, handler LoadErrorHandler) error
+}
@@ -55,7 +55,16 @@ func (a *Adapter) LoadPolicy(model model.Model) error {
 		return errors.New("invalid file path, file path cannot be empty")
 	}
 
-	return a.loadPolicyFile(model, persist.LoadPolicyLine)
+	return a.loadPolicyFile(model, persist.LoadPolicyLine, nil)
+}
+
+// LoadPolicyWithErrorHandler loads all policy rules from the storage, the malformed lines are given to errorHandler.
+func (a *Adapter) LoadPolicyWithErrorHandler(model model.Model, errorHandler persist.LoadErrorHandler) error {
+	if a.filePath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	return a.loadPolicyFile(model, persist.LoadPolicyLine, errorHandler)
 }
 
 // SavePolicy saves all policy rules to the storage.
@@ -66,26 +75,22 @@ func (a *Adapter) SavePolicy(model model.Model) error {
 
 	var tmp bytes.Buffer
 
-	for ptype, ast := range model["p"] {
-		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
-			tmp.WriteString("\n")
-		}
-	}
-
-	for ptype, ast := range model["g"] {
-		for _, rule := range ast.Policy {
-			tmp.WriteString(ptype + ", ")
-			tmp.WriteString(util.ArrayToString(rule))
-			tmp.WriteString("\n")
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range persist.SortedPtypes(model, sec) {
+			for _, rule := range model[sec][ptype].Policy {
+				tmp.WriteString(ptype + ", ")
+				tmp.WriteString(util.ArrayToString(rule))
+				tmp.WriteString("\n")
+			}
 		}
 	}
 
 	return a.savePolicyFile(strings.TrimRight(tmp.String(), "\n"))
 }
 
-func (a *Adapter) loadPolicyFile(model model.Model, handler func(string, model.Model) error) error {
+// loadPolicyFile loads every line of the file with handler, the lines it fails for are given to errorHandler
+// if it is not nil.
+func (a *Adapter) loadPolicyFile(model model.Model, handler func(string, model.Model) error, errorHandler persist.LoadErrorHandler) error {
 	f, err := os.Open(a.filePath)
 	if err != nil {
 		return err
@@ -93,10 +98,10 @@ func (a *Adapter) loadPolicyFile(model model.Model, handler func(string, model.M
 	defer f.Close()
 
 	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
+	for i := 1; scanner.Scan(); i++ {
 		line := strings.TrimSpace(scanner.Text())
 		err = handler(line, model)
-		if err != nil {
+		if err != nil && (errorHandler == nil || !errorHandler(i, line, err)) {
 			return err
 		}
 	}
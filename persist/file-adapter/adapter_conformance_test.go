@@ -0,0 +1,65 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileadapter_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/persist/adaptertest"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
+
+// emptyFiles returns a function creating an empty policy file in a temporary directory at every call,
+// and a function removing the directory.
+func emptyFiles(t *testing.T) (func() string, func()) {
+	dir, err := ioutil.TempDir("", "casbin-adapter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	return func() string {
+			n++
+			path := filepath.Join(dir, fmt.Sprintf("policy%d.csv", n))
+			if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			return path
+		}, func() {
+			_ = os.RemoveAll(dir)
+		}
+}
+
+func TestAdapterConformance(t *testing.T) {
+	newFile, cleanup := emptyFiles(t)
+	defer cleanup()
+	adaptertest.TestAdapter(t, func() persist.Adapter { return fileadapter.NewAdapter(newFile()) })
+}
+
+func TestFilteredAdapterConformance(t *testing.T) {
+	newFile, cleanup := emptyFiles(t)
+	defer cleanup()
+	adaptertest.TestAdapter(t, func() persist.Adapter { return fileadapter.NewFilteredAdapter(newFile()) })
+}
+
+func TestMultiFileAdapterConformance(t *testing.T) {
+	newFile, cleanup := emptyFiles(t)
+	defer cleanup()
+	adaptertest.TestAdapter(t, func() persist.Adapter { return fileadapter.NewMultiFileAdapter(newFile(), newFile()) })
+}
@@ -17,11 +17,14 @@ package fileadapter
 import (
 	"bufio"
 	"errors"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
 )
 
 // FilteredAdapter is the filtered file adapter for Casbin. It can load policy
@@ -113,6 +116,59 @@ func (a *FilteredAdapter) SavePolicy(model model.Model) error {
 	return a.Adapter.SavePolicy(model)
 }
 
+// SaveFilteredPolicy replaces the policy rules that match the filter in the file with the rules of the model
+// that match the filter, they are written where the first rule matching the filter was, or at the end of the file.
+// The other lines of the file are kept, and the rules of the model that do not match the filter are ignored.
+func (a *FilteredAdapter) SaveFilteredPolicy(model model.Model, filter interface{}) error {
+	if filter == nil {
+		return a.SavePolicy(model)
+	}
+	if a.filePath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	filterValue, ok := filter.(*Filter)
+	if !ok {
+		return errors.New("invalid filter type")
+	}
+
+	var rules []string
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(model[sec]))
+		for ptype := range model[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+		for _, ptype := range ptypes {
+			for _, rule := range model[sec][ptype].Policy {
+				if line := ptype + ", " + util.ArrayToString(rule); !filterLine(line, filterValue) {
+					rules = append(rules, line)
+				}
+			}
+		}
+	}
+
+	content, err := ioutil.ReadFile(a.filePath)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	spliced := false
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || filterLine(trimmed, filterValue) {
+			lines = append(lines, line)
+		} else if !spliced {
+			lines = append(lines, rules...)
+			spliced = true
+		}
+	}
+	if !spliced {
+		lines = append(lines, rules...)
+	}
+	return a.savePolicyFile(strings.Join(lines, "\n"))
+}
+
 func filterLine(line string, filter *Filter) bool {
 	if filter == nil {
 		return false
@@ -0,0 +1,349 @@
+// Copyright 2017 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fileadapter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// MultiFileAdapter is the file adapter for a policy split across several CSV files, e.g. one per team.
+// It loads the files in the sorted order of their paths and remembers the file every rule comes from,
+// so that saving the policy writes every rule back to its file. The new rules go to the default file.
+type MultiFileAdapter struct {
+	paths       []string
+	defaultPath string
+	filtered    bool
+
+	mu sync.Mutex
+	// sources are the files the loaded or added rules are in, keyed by rule, e.g. "p, alice, data1, read".
+	sources map[string]string
+}
+
+// NewMultiFileAdapter is the constructor for MultiFileAdapter, the first path is the default file.
+func NewMultiFileAdapter(paths ...string) *MultiFileAdapter {
+	a := &MultiFileAdapter{sources: map[string]string{}}
+	if len(paths) != 0 {
+		a.defaultPath = paths[0]
+	}
+	a.paths = append(a.paths, paths...)
+	sort.Strings(a.paths)
+	return a
+}
+
+// NewFileAdapterFromGlob creates a MultiFileAdapter for the files matching the pattern, e.g. "policies/*.csv",
+// the first of them in sorted order is the default file.
+func NewFileAdapterFromGlob(pattern string) (*MultiFileAdapter, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no policy file matches %s", pattern)
+	}
+	sort.Strings(paths)
+	return NewMultiFileAdapter(paths...), nil
+}
+
+// SetDefaultFile sets the file the new rules are written to, it is added to the files of the adapter if needed.
+func (a *MultiFileAdapter) SetDefaultFile(path string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.defaultPath = path
+	if !util.In(path, a.paths...) {
+		a.paths = append(a.paths, path)
+		sort.Strings(a.paths)
+	}
+}
+
+// LoadPolicy loads all policy rules from all the files.
+func (a *MultiFileAdapter) LoadPolicy(model model.Model) error {
+	a.filtered = false
+	return a.loadPolicyFiles(model, nil)
+}
+
+// LoadFilteredPolicy loads only the policy rules of all the files that match the filter, a *Filter.
+func (a *MultiFileAdapter) LoadFilteredPolicy(model model.Model, filter interface{}) error {
+	if filter == nil {
+		return a.LoadPolicy(model)
+	}
+	filterValue, ok := filter.(*Filter)
+	if !ok {
+		return errors.New("invalid filter type")
+	}
+	err := a.loadPolicyFiles(model, filterValue)
+	if err == nil {
+		a.filtered = true
+	}
+	return err
+}
+
+// IsFiltered returns true if the loaded policy has been filtered.
+func (a *MultiFileAdapter) IsFiltered() bool {
+	return a.filtered
+}
+
+// loadPolicyFiles reads the files line by line and loads the rules that match the filter, all of them if it is nil.
+func (a *MultiFileAdapter) loadPolicyFiles(model model.Model, filter *Filter) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.paths) == 0 {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	sources := map[string]string{}
+	for _, path := range a.paths {
+		err := a.scanPolicyFile(path, func(line string) error {
+			if filterLine(line, filter) {
+				return nil
+			}
+			if err := persist.LoadPolicyLine(line, model); err != nil {
+				return err
+			}
+			if key, ok := ruleKey(line); ok {
+				if _, ok := sources[key]; !ok {
+					sources[key] = path
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	a.sources = sources
+	return nil
+}
+
+// scanPolicyFile calls handler for every trimmed line of the file.
+func (a *MultiFileAdapter) scanPolicyFile(path string, handler func(line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err = handler(strings.TrimSpace(scanner.Text())); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// SavePolicy saves all policy rules, every rule to the file it was loaded from or added to, the others to the default file.
+func (a *MultiFileAdapter) SavePolicy(model model.Model) error {
+	if a.filtered {
+		return errors.New("cannot save a filtered policy")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.defaultPath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	lines := map[string][]string{}
+	sources := map[string]string{}
+	for _, sec := range []string{"p", "g"} {
+		ptypes := make([]string, 0, len(model[sec]))
+		for ptype := range model[sec] {
+			ptypes = append(ptypes, ptype)
+		}
+		sort.Strings(ptypes)
+		for _, ptype := range ptypes {
+			for _, rule := range model[sec][ptype].Policy {
+				line := ptype + ", " + util.ArrayToString(rule)
+				path, ok := a.sources[line]
+				if !ok {
+					path = a.defaultPath
+				}
+				sources[line] = path
+				lines[path] = append(lines[path], line)
+			}
+		}
+	}
+
+	for _, path := range a.paths {
+		if err := writePolicyFile(path, lines[path]); err != nil {
+			return err
+		}
+	}
+	a.sources = sources
+	return nil
+}
+
+// AddPolicy adds a policy rule to the default file.
+func (a *MultiFileAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{rule})
+}
+
+// AddPolicies adds policy rules to the default file.
+func (a *MultiFileAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.defaultPath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	f, err := os.OpenFile(a.defaultPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, rule := range rules {
+		line := ptype + ", " + util.ArrayToString(rule)
+		if _, err = w.WriteString(line + "\n"); err != nil {
+			_ = f.Close()
+			return err
+		}
+		a.sources[line] = a.defaultPath
+	}
+	if err = w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// RemovePolicy removes a policy rule from the file it is in.
+func (a *MultiFileAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{rule})
+}
+
+// RemovePolicies removes policy rules from the files they are in.
+func (a *MultiFileAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	removed := map[string][]string{}
+	for _, rule := range rules {
+		line := ptype + ", " + util.ArrayToString(rule)
+		if path, ok := a.sources[line]; ok {
+			removed[path] = append(removed[path], line)
+		}
+	}
+
+	for path, lines := range removed {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var kept []string
+		for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+			if key, ok := ruleKey(strings.TrimSpace(line)); ok && util.In(key, lines...) {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if err = writePolicyFile(path, kept); err != nil {
+			return err
+		}
+		for _, line := range lines {
+			delete(a.sources, line)
+		}
+	}
+	return nil
+}
+
+// RemoveFilteredPolicy removes the policy rules that match the filter from all the files, an empty field value
+// matches any value.
+func (a *MultiFileAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, path := range a.paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var kept []string
+		removed := false
+		for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+			if tokens, ok := ruleTokens(strings.TrimSpace(line)); ok && tokens[0] == ptype && matchFilter(tokens[1:], fieldIndex, fieldValues) {
+				delete(a.sources, util.ArrayToString(tokens))
+				removed = true
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if removed {
+			if err = writePolicyFile(path, kept); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchFilter returns true if the fields of the rule from fieldIndex are the field values, the empty ones
+// matching any value.
+func matchFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	for i, fieldValue := range fieldValues {
+		if fieldValue == "" {
+			continue
+		}
+		if fieldIndex+i >= len(rule) || rule[fieldIndex+i] != fieldValue {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleKey returns the rule of the policy line as it is saved, e.g. "p, alice, data1, read",
+// and false for an empty or comment line.
+func ruleKey(line string) (string, bool) {
+	tokens, ok := ruleTokens(line)
+	if !ok {
+		return "", false
+	}
+	return util.ArrayToString(tokens), true
+}
+
+// ruleTokens returns the ptype and the fields of the policy line, and false for an empty or comment line.
+func ruleTokens(line string) ([]string, bool) {
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+	r := csv.NewReader(strings.NewReader(line))
+	r.TrimLeadingSpace = true
+	tokens, err := r.Read()
+	if err != nil {
+		return nil, false
+	}
+	return tokens, true
+}
+
+// writePolicyFile replaces the content of the file with the lines.
+func writePolicyFile(path string, lines []string) error {
+	text := strings.Join(lines, "\n")
+	if text != "" {
+		text += "\n"
+	}
+	return ioutil.WriteFile(path, []byte(text), 0644)
+}
@@ -0,0 +1,145 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonadapter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// Rule is a policy rule as it is stored in the JSON file.
+type Rule struct {
+	PType string   `json:"ptype"`
+	Rule  []string `json:"rule"`
+}
+
+// Adapter is the JSON file adapter for Casbin.
+// It can load policy from a JSON file or save policy to a JSON file.
+// Unlike the CSV file adapter, the fields of the rules can contain commas, quotes and newlines.
+type Adapter struct {
+	filePath string
+}
+
+// NewAdapter is the constructor for Adapter.
+func NewAdapter(filePath string) *Adapter {
+	return &Adapter{filePath: filePath}
+}
+
+// LoadPolicy loads all policy rules from the storage.
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyWithErrorHandler(model, nil)
+}
+
+// LoadPolicyWithErrorHandler loads all policy rules from the storage, the malformed rules are given to errorHandler
+// with their position in the file and their JSON text.
+func (a *Adapter) LoadPolicyWithErrorHandler(model model.Model, errorHandler persist.LoadErrorHandler) error {
+	if a.filePath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	data, err := ioutil.ReadFile(a.filePath)
+	if err != nil {
+		return err
+	}
+
+	rules, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+
+	for i, rule := range rules {
+		if err = persist.LoadPolicyArray(append([]string{rule.PType}, rule.Rule...), model); err != nil {
+			raw, _ := json.Marshal(rule)
+			if errorHandler == nil || !errorHandler(i+1, string(raw), err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SavePolicy saves all policy rules to the storage.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	if a.filePath == "" {
+		return errors.New("invalid file path, file path cannot be empty")
+	}
+
+	data, err := Marshal(model)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(a.filePath, data, 0644)
+}
+
+// Marshal returns the JSON encoding of the policy of the model.
+// The "p" rules come before the "g" rules and the ptypes are in lexicographical order, so the output is stable.
+func Marshal(model model.Model) ([]byte, error) {
+	rules := []Rule{}
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range persist.SortedPtypes(model, sec) {
+			for _, rule := range model[sec][ptype].Policy {
+				rules = append(rules, Rule{PType: ptype, Rule: rule})
+			}
+		}
+	}
+
+	return json.MarshalIndent(rules, "", "  ")
+}
+
+// Unmarshal parses the JSON encoding of a policy.
+func Unmarshal(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+
+	for i, rule := range rules {
+		if rule.PType == "" || (rule.PType[0] != 'p' && rule.PType[0] != 'g') {
+			return nil, fmt.Errorf("invalid ptype %q of rule %d", rule.PType, i)
+		}
+	}
+	return rules, nil
+}
+
+// AddPolicy adds a policy rule to the storage.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return errors.New("not implemented")
+}
+
+// AddPolicies adds policy rules to the storage.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	return errors.New("not implemented")
+}
+
+// RemovePolicy removes a policy rule from the storage.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return errors.New("not implemented")
+}
+
+// RemovePolicies removes policy rules from the storage.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	return errors.New("not implemented")
+}
+
+// RemoveFilteredPolicy removes policy rules that match the filter from the storage.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errors.New("not implemented")
+}
@@ -51,3 +51,18 @@ func TestDuplicateRuleInAdapter(t *testing.T) {
 
 	testRuleCount(t, e.GetModel(), 1, "p", "p", "LoadPolicyArray")
 }
+
+func TestLoadMalformedRuleInAdapter(t *testing.T) {
+	e, _ := casbin.NewEnforcer("../examples/basic_model.conf")
+
+	for _, rule := range [][]string{{}, {"", "alice"}, {"x", "alice", "data1", "read"}, {"g", "alice", "admin"},
+		{"p", "alice", "data1"}, {"p", "alice", "data1", "read", "extra"}} {
+		if err := persist.LoadPolicyArray(rule, e.GetModel()); err == nil {
+			t.Errorf("LoadPolicyArray should fail for %v", rule)
+		}
+	}
+	if err := persist.LoadPolicyLine(`p, "alice, data1, read`, e.GetModel()); err == nil {
+		t.Error("LoadPolicyLine should fail for a malformed line")
+	}
+	testRuleCount(t, e.GetModel(), 0, "p", "p", "LoadPolicyArray")
+}
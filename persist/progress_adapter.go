@@ -0,0 +1,27 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+import "github.com/casbin/casbin/v2/model"
+
+// ProgressAdapter is the interface for Casbin adapters that report the progress of loading the policy,
+// e.g. for the health reporting of a service loading a large policy at startup.
+type ProgressAdapter interface {
+	Adapter
+
+	// LoadPolicyWithProgress loads all policy rules from the storage like LoadPolicy, calling progress with
+	// the number of rules loaded so far as the loading goes on, e.g. every thousand rules.
+	LoadPolicyWithProgress(model model.Model, progress func(loaded int)) error
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stringadapter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// Adapter is the in-memory string adapter for Casbin.
+// It loads policy from a CSV text and saves policy back to the same text, both as a whole and rule by rule.
+type Adapter struct {
+	Line string
+}
+
+// NewAdapter is the constructor for Adapter.
+func NewAdapter(line string) *Adapter {
+	return &Adapter{Line: line}
+}
+
+// LoadPolicy loads all policy rules from the text.
+func (a *Adapter) LoadPolicy(model model.Model) error {
+	return a.LoadPolicyWithErrorHandler(model, nil)
+}
+
+// LoadPolicyWithErrorHandler loads all policy rules from the text, the malformed lines are given to errorHandler.
+func (a *Adapter) LoadPolicyWithErrorHandler(model model.Model, errorHandler persist.LoadErrorHandler) error {
+	for i, line := range strings.Split(a.Line, "\n") {
+		line = strings.TrimSpace(line)
+		if err := persist.LoadPolicyLine(line, model); err != nil && (errorHandler == nil || !errorHandler(i+1, line, err)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SavePolicy saves all policy rules to the text.
+func (a *Adapter) SavePolicy(model model.Model) error {
+	var tmp bytes.Buffer
+
+	for _, sec := range []string{"p", "g"} {
+		for _, ptype := range persist.SortedPtypes(model, sec) {
+			for _, rule := range model[sec][ptype].Policy {
+				tmp.WriteString(ptype + ", ")
+				tmp.WriteString(util.ArrayToString(rule))
+				tmp.WriteString("\n")
+			}
+		}
+	}
+
+	a.Line = strings.TrimRight(tmp.String(), "\n")
+	return nil
+}
+
+// AddPolicy adds a policy rule to the text.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return a.AddPolicies(sec, ptype, [][]string{rule})
+}
+
+// AddPolicies adds policy rules to the text.
+func (a *Adapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	for _, rule := range rules {
+		if a.Line != "" && !strings.HasSuffix(a.Line, "\n") {
+			a.Line += "\n"
+		}
+		a.Line += ruleLine(ptype, rule)
+	}
+	return nil
+}
+
+// RemovePolicy removes a policy rule from the text.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return a.RemovePolicies(sec, ptype, [][]string{rule})
+}
+
+// RemovePolicies removes policy rules from the text.
+func (a *Adapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.rewrite(ptype, func(rule []string) ([][]string, bool) {
+		return nil, indexOfRule(rules, rule) != -1
+	})
+	return nil
+}
+
+// RemoveFilteredPolicy removes the policy rules that match the filter from the text.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	a.rewrite(ptype, func(rule []string) ([][]string, bool) {
+		return nil, matchesFilter(rule, fieldIndex, fieldValues)
+	})
+	return nil
+}
+
+// UpdatePolicy updates a policy rule of the text.
+func (a *Adapter) UpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	return a.UpdatePolicies(sec, ptype, [][]string{oldRule}, [][]string{newRule})
+}
+
+// UpdatePolicies updates policy rules of the text, oldRules[i] is replaced by newRules[i].
+func (a *Adapter) UpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	if len(oldRules) != len(newRules) {
+		return errors.New("the number of old rules and new rules differ")
+	}
+	a.rewrite(ptype, func(rule []string) ([][]string, bool) {
+		if i := indexOfRule(oldRules, rule); i != -1 {
+			return [][]string{newRules[i]}, true
+		}
+		return nil, false
+	})
+	return nil
+}
+
+// UpdateFilteredPolicies replaces the policy rules that match the filter by newRules in the text,
+// and returns the rules it replaced.
+func (a *Adapter) UpdateFilteredPolicies(sec string, ptype string, newRules [][]string, fieldIndex int, fieldValues ...string) ([][]string, error) {
+	var oldRules [][]string
+	a.rewrite(ptype, func(rule []string) ([][]string, bool) {
+		if !matchesFilter(rule, fieldIndex, fieldValues) {
+			return nil, false
+		}
+		oldRules = append(oldRules, rule)
+		return nil, true
+	})
+	return oldRules, a.AddPolicies(sec, ptype, newRules)
+}
+
+// rewrite gives the rules of ptype in the text to edit, and replaces each rule edit reports as changed by the
+// rules it returns. The other lines are kept as they are.
+func (a *Adapter) rewrite(ptype string, edit func(rule []string) ([][]string, bool)) {
+	lines := strings.Split(a.Line, "\n")
+	res := make([]string, 0, len(lines))
+	for _, line := range lines {
+		tokens := parseLine(line)
+		if len(tokens) == 0 || tokens[0] != ptype {
+			res = append(res, line)
+			continue
+		}
+		rules, changed := edit(tokens[1:])
+		if !changed {
+			res = append(res, line)
+			continue
+		}
+		for _, rule := range rules {
+			res = append(res, ruleLine(ptype, rule))
+		}
+	}
+	a.Line = strings.Join(res, "\n")
+}
+
+// parseLine returns the fields of a policy line the way persist.LoadPolicyLine reads them,
+// nil for the blank, comment and malformed lines.
+func parseLine(line string) []string {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	r := csv.NewReader(strings.NewReader(line))
+	r.Comma = ','
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	tokens, err := r.Read()
+	if err != nil {
+		return nil
+	}
+	return tokens
+}
+
+func ruleLine(ptype string, rule []string) string {
+	return ptype + ", " + util.ArrayToString(rule)
+}
+
+func indexOfRule(rules [][]string, rule []string) int {
+	for i, r := range rules {
+		if util.ArrayEquals(r, rule) {
+			return i
+		}
+	}
+	return -1
+}
+
+func matchesFilter(rule []string, fieldIndex int, fieldValues []string) bool {
+	for i, value := range fieldValues {
+		if value == "" {
+			continue
+		}
+		if fieldIndex+i >= len(rule) || rule[fieldIndex+i] != value {
+			return false
+		}
+	}
+	return true
+}
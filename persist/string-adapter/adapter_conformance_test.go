@@ -0,0 +1,27 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stringadapter_test
+
+import (
+	"testing"
+
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/persist/adaptertest"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+)
+
+func TestAdapterConformance(t *testing.T) {
+	adaptertest.TestAdapter(t, func() persist.Adapter { return stringadapter.NewAdapter("") })
+}
@@ -0,0 +1,24 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package persist
+
+// GenerationWatcher is a Watcher that is told the generation of the policy, see Enforcer.GetPolicyGeneration,
+// so that its notifications can carry it and the other instances can tell whether they missed a change.
+type GenerationWatcher interface {
+	Watcher
+	// SetPolicyGeneration is called with the new generation whenever the policy of the enforcer changes,
+	// before the watcher is notified of the change.
+	SetPolicyGeneration(generation uint64)
+}
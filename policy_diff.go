@@ -0,0 +1,103 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"bytes"
+	"strings"
+)
+
+// PolicySnapshot is a copy of all the policy rules keyed by ptype, e.g. "p", "p2", "g", see GetPolicySnapshot.
+type PolicySnapshot map[string][][]string
+
+// PolicyDiff is the difference between two policy snapshots, see DiffPolicy.
+// The rules are keyed by ptype, the ptypes without added or removed rules are left out.
+type PolicyDiff struct {
+	Added   map[string][][]string
+	Removed map[string][][]string
+}
+
+// GetPolicySnapshot returns a copy of all the current policy rules keyed by ptype,
+// in the form accepted by DistributedEnforcer.SelfLoadPolicyFromRules.
+func (e *Enforcer) GetPolicySnapshot() PolicySnapshot {
+	snapshot := make(PolicySnapshot)
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range e.model[sec] {
+			rules := make([][]string, 0, len(ast.Policy))
+			for _, rule := range ast.Policy {
+				rules = append(rules, deepCopyPolicy(rule))
+			}
+			snapshot[ptype] = rules
+		}
+	}
+	return snapshot
+}
+
+// DiffPolicy returns the rules of b that are not in a as added and the rules of a that are not in b as removed,
+// in the order of their snapshot. The rules are compared with the spaces around their fields trimmed,
+// so that "alice, data1" and "alice,data1" are the same rule, and the duplicates are reported once.
+// A nil snapshot has no rules.
+func DiffPolicy(a, b *PolicySnapshot) PolicyDiff {
+	var rulesA, rulesB PolicySnapshot
+	if a != nil {
+		rulesA = *a
+	}
+	if b != nil {
+		rulesB = *b
+	}
+	return PolicyDiff{
+		Added:   subtractRules(rulesB, rulesA),
+		Removed: subtractRules(rulesA, rulesB),
+	}
+}
+
+// subtractRules returns the normalized rules of a that are not in b, keyed by ptype.
+func subtractRules(a, b PolicySnapshot) map[string][][]string {
+	res := map[string][][]string{}
+	for ptype, rules := range a {
+		excluded := map[string]bool{}
+		for _, rule := range b[ptype] {
+			excluded[ruleKey(normalizeRule(rule))] = true
+		}
+		for _, rule := range rules {
+			rule = normalizeRule(rule)
+			key := ruleKey(rule)
+			if !excluded[key] {
+				excluded[key] = true
+				res[ptype] = append(res[ptype], rule)
+			}
+		}
+	}
+	return res
+}
+
+// ruleKey encodes the fields of the rule with their lengths, so that distinct rules never share a key,
+// whatever the fields contain.
+func ruleKey(rule []string) string {
+	var key bytes.Buffer
+	for _, field := range rule {
+		writeKeyPart(&key, 'f', field)
+	}
+	return key.String()
+}
+
+// normalizeRule returns a copy of the rule with the spaces around its fields trimmed.
+func normalizeRule(rule []string) []string {
+	res := make([]string, len(rule))
+	for i, field := range rule {
+		res[i] = strings.TrimSpace(field)
+	}
+	return res
+}
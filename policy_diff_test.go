@@ -0,0 +1,75 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testDiffPolicy(t *testing.T, a, b PolicySnapshot, added, removed map[string][][]string) {
+	t.Helper()
+	diff := DiffPolicy(&a, &b)
+	if !reflect.DeepEqual(diff.Added, added) {
+		t.Errorf("added rules: %v, supposed to be %v", diff.Added, added)
+	}
+	if !reflect.DeepEqual(diff.Removed, removed) {
+		t.Errorf("removed rules: %v, supposed to be %v", diff.Removed, removed)
+	}
+}
+
+func TestDiffPolicy(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	before := e.GetPolicySnapshot()
+
+	// no-op
+	testDiffPolicy(t, before, e.GetPolicySnapshot(), map[string][][]string{}, map[string][][]string{})
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.AddGroupingPolicy("eve", "data2_admin")
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	after := e.GetPolicySnapshot()
+	testDiffPolicy(t, before, after,
+		map[string][][]string{"p": {{"eve", "data3", "read"}}, "g": {{"eve", "data2_admin"}}},
+		map[string][][]string{"p": {{"alice", "data1", "read"}}})
+	testDiffPolicy(t, after, before,
+		map[string][][]string{"p": {{"alice", "data1", "read"}}},
+		map[string][][]string{"p": {{"eve", "data3", "read"}}, "g": {{"eve", "data2_admin"}}})
+
+	// adding back a removed rule is a no-op, wherever it is.
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	_, _ = e.RemoveGroupingPolicy("eve", "data2_admin")
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	testDiffPolicy(t, before, e.GetPolicySnapshot(), map[string][][]string{}, map[string][][]string{})
+
+	// the rules are normalized and the duplicates reported once.
+	testDiffPolicy(t,
+		PolicySnapshot{"p": {{"alice", "data1", "read"}}},
+		PolicySnapshot{"p": {{"alice", " data1", "read "}, {"bob", "data2", "write"}, {"bob", "data2", " write"}}, "p2": {{"bob"}}},
+		map[string][][]string{"p": {{"bob", "data2", "write"}}, "p2": {{"bob"}}},
+		map[string][][]string{})
+
+	// the rules whose fields join into the same string are distinct.
+	testDiffPolicy(t,
+		PolicySnapshot{"p": {{"alice", "data1,read", "x"}}},
+		PolicySnapshot{"p": {{"alice", "data1,read", "x"}, {"alice,data1", "read", "x"}}},
+		map[string][][]string{"p": {{"alice,data1", "read", "x"}}},
+		map[string][][]string{})
+
+	diff := DiffPolicy(nil, &before)
+	if len(diff.Added["p"]) != 4 || len(diff.Added["g"]) != 1 || len(diff.Removed) != 0 {
+		t.Errorf("diff from nil: %v, supposed to add the whole policy", diff)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// GetPolicyGeneration returns the generation of the policy, a number increased by every change of the policy:
+// the rules added, removed or updated, and the policy loaded or cleared. It tells whether the policy changed since
+// it was last looked at without comparing the rules, the generations of different enforcers are unrelated.
+func (e *Enforcer) GetPolicyGeneration() uint64 {
+	return atomic.LoadUint64(&e.policyGeneration)
+}
+
+// bumpPolicyGeneration increases the generation of the policy after a change and tells it to the watcher.
+func (e *Enforcer) bumpPolicyGeneration() {
+	generation := atomic.AddUint64(&e.policyGeneration, 1)
+	if watcher, ok := e.watcher.(persist.GenerationWatcher); ok {
+		watcher.SetPolicyGeneration(generation)
+	}
+}
+
+// GetPolicyHash returns the hex-encoded SHA-256 of the rules of the policy, which does not depend on the order
+// of the rules, so that enforcers can compare their policies. It is computed again only when the generation
+// of the policy has changed since the last call.
+func (e *Enforcer) GetPolicyHash() string {
+	generation := e.GetPolicyGeneration()
+
+	e.policyHashMu.Lock()
+	defer e.policyHashMu.Unlock()
+	if e.policyHash != "" && e.policyHashGeneration == generation {
+		return e.policyHash
+	}
+
+	var lines []string
+	for _, sec := range []string{"p", "g"} {
+		for ptype, ast := range e.model[sec] {
+			for _, rule := range ast.Policy {
+				lines = append(lines, ptype+"\x1f"+strings.Join(rule, "\x1f"))
+			}
+		}
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, line := range lines {
+		_, _ = h.Write([]byte(line))
+		_, _ = h.Write([]byte{'\n'})
+	}
+	e.policyHash = hex.EncodeToString(h.Sum(nil))
+	e.policyHashGeneration = generation
+	return e.policyHash
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"testing"
+)
+
+type generationWatcher struct {
+	SampleWatcher
+	generation uint64
+	notified   []uint64
+}
+
+func (w *generationWatcher) SetPolicyGeneration(generation uint64) {
+	w.generation = generation
+}
+
+func (w *generationWatcher) Update() error {
+	w.notified = append(w.notified, w.generation)
+	return nil
+}
+
+func testPolicyGeneration(t *testing.T, e *Enforcer, title string, change func(), increased bool) {
+	t.Helper()
+	before := e.GetPolicyGeneration()
+	change()
+	if after := e.GetPolicyGeneration(); (after > before) != increased {
+		t.Errorf("%s: generation %d after %d, supposed to be increased: %t", title, after, before, increased)
+	}
+}
+
+func TestPolicyGeneration(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+
+	testPolicyGeneration(t, e, "AddPolicy", func() { _, _ = e.AddPolicy("eve", "data3", "read") }, true)
+	testPolicyGeneration(t, e, "AddPolicy of an existing rule", func() { _, _ = e.AddPolicy("eve", "data3", "read") }, false)
+	testPolicyGeneration(t, e, "AddPolicies", func() { _, _ = e.AddPolicies([][]string{{"eve", "data3", "write"}}) }, true)
+	testPolicyGeneration(t, e, "UpdatePolicy", func() {
+		_, _ = e.UpdatePolicy([]string{"eve", "data3", "write"}, []string{"eve", "data4", "write"})
+	}, true)
+	testPolicyGeneration(t, e, "UpdatePolicies", func() {
+		_, _ = e.UpdatePolicies([][]string{{"eve", "data4", "write"}}, [][]string{{"eve", "data5", "write"}})
+	}, true)
+	testPolicyGeneration(t, e, "UpdateFilteredPolicies", func() {
+		_, _ = e.UpdateFilteredPolicies([][]string{{"eve", "data6", "write"}}, 0, "eve", "data5")
+	}, true)
+	testPolicyGeneration(t, e, "RemovePolicy", func() { _, _ = e.RemovePolicy("eve", "data3", "read") }, true)
+	testPolicyGeneration(t, e, "RemovePolicy of a missing rule", func() { _, _ = e.RemovePolicy("eve", "data3", "read") }, false)
+	testPolicyGeneration(t, e, "RemovePolicies", func() { _, _ = e.RemovePolicies([][]string{{"eve", "data6", "write"}}) }, true)
+	testPolicyGeneration(t, e, "AddGroupingPolicy", func() { _, _ = e.AddGroupingPolicy("eve", "data2_admin") }, true)
+	testPolicyGeneration(t, e, "RemoveFilteredGroupingPolicy", func() { _, _ = e.RemoveFilteredGroupingPolicy(0, "eve") }, true)
+	testPolicyGeneration(t, e, "ClearPolicy", func() { e.ClearPolicy() }, true)
+	testPolicyGeneration(t, e, "LoadPolicy", func() { _ = e.LoadPolicy() }, true)
+	testPolicyGeneration(t, e, "Enforce", func() { _, _ = e.Enforce("alice", "data1", "read") }, false)
+}
+
+func TestPolicyHash(t *testing.T) {
+	e1, _ := NewEnforcer("examples/rbac_model.conf")
+	e2, _ := NewEnforcer("examples/rbac_model.conf")
+	_, _ = e1.AddPolicies([][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}})
+	_, _ = e1.AddGroupingPolicy("alice", "admin")
+	_, _ = e2.AddGroupingPolicy("alice", "admin")
+	_, _ = e2.AddPolicies([][]string{{"bob", "data2", "write"}, {"alice", "data1", "read"}})
+
+	hash := e1.GetPolicyHash()
+	if hash != e2.GetPolicyHash() {
+		t.Error("The policy hash should not depend on the order of the rules")
+	}
+	if e1.GetPolicyHash() != hash {
+		t.Error("The policy hash should not change while the policy does not")
+	}
+
+	_, _ = e1.RemovePolicy("alice", "data1", "read")
+	if e1.GetPolicyHash() == hash {
+		t.Error("The policy hash should change with the policy")
+	}
+	_, _ = e1.AddPolicy("alice", "data1", "read")
+	if e1.GetPolicyHash() != hash {
+		t.Error("The policy hash should be the same for the same rules")
+	}
+
+	_, _ = e2.UpdateGroupingPolicy([]string{"alice", "admin"}, []string{"admin", "alice"})
+	if e2.GetPolicyHash() == hash {
+		t.Error("The policy hash should depend on the order of the fields of the rules")
+	}
+}
+
+func TestGenerationWatcher(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	w := &generationWatcher{}
+	_ = e.SetWatcher(w)
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	generation := e.GetPolicyGeneration()
+	if len(w.notified) != 2 || w.notified[0] != generation-1 || w.notified[1] != generation {
+		t.Errorf("The notifications should carry the generations %d and %d, got %v", generation-1, generation, w.notified)
+	}
+}
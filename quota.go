@@ -0,0 +1,199 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/casbin/casbin/v2/persist/cache"
+)
+
+// QuotaStore keeps how many times each subject was allowed each action by a matcher calling quotaAllow,
+// see SetQuotaStore. It must be safe for concurrent use.
+type QuotaStore interface {
+	// Used returns how many times the subject was allowed the action.
+	Used(sub string, act string) (int, error)
+	// Use counts one more use of the action by the subject if it was used less than limit times,
+	// and returns whether it did.
+	Use(sub string, act string, limit int) (bool, error)
+	// Release gives back a use counted by Use, when another quota of the enforcement was used up.
+	Release(sub string, act string) error
+}
+
+// MemoryQuotaStore is an in-memory QuotaStore.
+type MemoryQuotaStore struct {
+	mu   sync.Mutex
+	used map[[2]string]int
+}
+
+// NewMemoryQuotaStore creates an empty MemoryQuotaStore.
+func NewMemoryQuotaStore() *MemoryQuotaStore {
+	return &MemoryQuotaStore{used: map[[2]string]int{}}
+}
+
+func (s *MemoryQuotaStore) Used(sub string, act string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used[[2]string{sub, act}], nil
+}
+
+func (s *MemoryQuotaStore) Use(sub string, act string, limit int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{sub, act}
+	if s.used[key] >= limit {
+		return false, nil
+	}
+	s.used[key]++
+	return true, nil
+}
+
+func (s *MemoryQuotaStore) Release(sub string, act string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := [2]string{sub, act}
+	if s.used[key] > 0 {
+		s.used[key]--
+	}
+	return nil
+}
+
+// Reset forgets the uses of the action by the subject.
+func (s *MemoryQuotaStore) Reset(sub string, act string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.used, [2]string{sub, act})
+}
+
+// quotaUsageKey is the context key of the quotas checked by an enforcement.
+type quotaUsageKey struct{}
+
+type quotaUse struct {
+	rule     int
+	sub, act string
+	limit    int
+}
+
+// quotaUsage records the quotas quotaAllow found available during an enforcement, for each rule.
+type quotaUsage struct {
+	mu sync.Mutex
+	// rule is the index of the rule being evaluated, decided the one of the rule deciding the enforcement.
+	rule, decided int
+	uses          []quotaUse
+}
+
+// evaluate records the quotas checked from now on for the rule at index rule.
+func (u *quotaUsage) evaluate(rule int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.rule = rule
+}
+
+// decide sets the rule deciding the enforcement, whose quotas are used, -1 for none.
+func (u *quotaUsage) decide(rule int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.decided = rule
+}
+
+func (u *quotaUsage) add(use quotaUse) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	use.rule = u.rule
+	for i, recorded := range u.uses {
+		if recorded.rule == use.rule && recorded.sub == use.sub && recorded.act == use.act {
+			if use.limit < recorded.limit {
+				u.uses[i].limit = use.limit
+			}
+			return
+		}
+	}
+	u.uses = append(u.uses, use)
+}
+
+// SetQuotaStore sets the store of the quotas the matchers can check with quotaAllow(sub, act, limit),
+// which is true while the subject was allowed the action less than limit times, e.g.
+// m = r.sub == p.sub && r.act == p.act && quotaAllow(r.sub, r.act, 3).
+// A use is counted only when the enforcement allows the request, and only for the rule deciding it.
+// An allowed request is denied if one of its quotas was used up by a concurrent enforcement meanwhile, and then
+// uses none of them. A CachedEnforcer does not cache the decisions depending on quotaAllow.
+func (e *Enforcer) SetQuotaStore(store QuotaStore) {
+	e.quotaStore = store
+	e.AddContextFunction("quotaAllow", e.quotaAllow)
+}
+
+// quotaAllow is the quotaAllow function of the matchers, it records the available quotas into the usage
+// of the enforcement found in the context, if any, and marks the decision as not cacheable.
+func (e *Enforcer) quotaAllow(ctx context.Context, args ...interface{}) (interface{}, error) {
+	if len(args) != 3 {
+		return false, fmt.Errorf("quotaAllow: expected 3 arguments, got %d", len(args))
+	}
+	sub, ok1 := args[0].(string)
+	act, ok2 := args[1].(string)
+	limit, ok3 := args[2].(float64)
+	if !ok1 || !ok2 || !ok3 {
+		return false, errors.New("quotaAllow: the arguments must be a subject, an action and a limit")
+	}
+	store := e.quotaStore
+	if store == nil {
+		return false, errors.New("quotaAllow: no quota store, call SetQuotaStore first")
+	}
+
+	used, err := store.Used(sub, act)
+	if err != nil {
+		return false, err
+	}
+	if used >= int(limit) {
+		return cache.DoNotCache(ctx, false), nil
+	}
+	if usage, ok := ctx.Value(quotaUsageKey{}).(*quotaUsage); ok {
+		usage.add(quotaUse{sub: sub, act: act, limit: int(limit)})
+	}
+	return cache.DoNotCache(ctx, true), nil
+}
+
+// withQuotaUsage returns the context of an enforcement recording the quotas it checks into the returned usage.
+func withQuotaUsage(ctx context.Context) (context.Context, *quotaUsage) {
+	usage := &quotaUsage{}
+	return context.WithValue(ctx, quotaUsageKey{}, usage), usage
+}
+
+// use counts the uses of the quotas of the deciding rule once the request is allowed, it returns false
+// and releases the uses already counted if a quota was used up meanwhile.
+func (u *quotaUsage) use(store QuotaStore) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var used []quotaUse
+	for _, use := range u.uses {
+		if use.rule != u.decided {
+			continue
+		}
+		ok, err := store.Use(use.sub, use.act, use.limit)
+		if err == nil && ok {
+			used = append(used, use)
+			continue
+		}
+		for _, counted := range used {
+			if releaseErr := store.Release(counted.sub, counted.act); releaseErr != nil && err == nil {
+				err = releaseErr
+			}
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+func newQuotaEnforcer(t *testing.T, limit string) *Enforcer {
+	t.Helper()
+	m, err := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act && quotaAllow(r.sub, r.act, ` + limit + `)
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewEnforcer(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = e.AddPolicies([][]string{{"alice", "data1", "read"}, {"bob", "data1", "read"}})
+	return e
+}
+
+func TestQuota(t *testing.T) {
+	e := newQuotaEnforcer(t, "3")
+	if _, err := e.Enforce("alice", "data1", "read"); err == nil {
+		t.Error("Enforce should fail without a quota store")
+	}
+
+	store := NewMemoryQuotaStore()
+	e.SetQuotaStore(store)
+
+	// the denied requests do not use the quota.
+	testEnforce(t, e, "alice", "data1", "write", false)
+	testEnforce(t, e, "alice", "data2", "read", false)
+	for i := 0; i < 3; i++ {
+		testEnforce(t, e, "alice", "data1", "read", true)
+	}
+	testEnforce(t, e, "alice", "data1", "read", false)
+	if used, _ := store.Used("alice", "read"); used != 3 {
+		t.Errorf("alice used read %d times, supposed to be 3", used)
+	}
+
+	// the quotas are per subject and action.
+	testEnforce(t, e, "bob", "data1", "read", true)
+
+	store.Reset("alice", "read")
+	testEnforce(t, e, "alice", "data1", "read", true)
+}
+
+func TestQuotaConcurrency(t *testing.T) {
+	e := newQuotaEnforcer(t, "10")
+	e.SetQuotaStore(NewMemoryQuotaStore())
+
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := e.Enforce("alice", "data1", "read"); ok {
+				atomic.AddInt32(&allowed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 10 {
+		t.Errorf("%d requests were allowed, supposed to be 10", allowed)
+	}
+}
+
+func TestQuotaDecidingRule(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && quotaAllow(r.sub, p.act, 3) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{{"alice", "data1", "write"}, {"alice", "data1", "read"}})
+	store := NewMemoryQuotaStore()
+	e.SetQuotaStore(store)
+
+	// the quota of the write rule is checked, but only the read rule decides.
+	testEnforce(t, e, "alice", "data1", "read", true)
+	if used, _ := store.Used("alice", "write"); used != 0 {
+		t.Errorf("alice used write %d times, supposed to be 0", used)
+	}
+	if used, _ := store.Used("alice", "read"); used != 1 {
+		t.Errorf("alice used read %d times, supposed to be 1", used)
+	}
+}
+
+// usedUpQuotaStore is a MemoryQuotaStore whose quota of act is always used up when it is used.
+type usedUpQuotaStore struct {
+	*MemoryQuotaStore
+	act string
+}
+
+func (s usedUpQuotaStore) Use(sub string, act string, limit int) (bool, error) {
+	if act == s.act {
+		return false, nil
+	}
+	return s.MemoryQuotaStore.Use(sub, act, limit)
+}
+
+func TestQuotaRelease(t *testing.T) {
+	e := newQuotaEnforcer(t, `3) && quotaAllow(r.sub, "daily", 1`)
+	store := usedUpQuotaStore{MemoryQuotaStore: NewMemoryQuotaStore(), act: "daily"}
+	e.SetQuotaStore(store)
+
+	testEnforce(t, e, "alice", "data1", "read", false)
+	if used, _ := store.Used("alice", "read"); used != 0 {
+		t.Errorf("alice used read %d times, supposed to be released", used)
+	}
+}
+
+func TestQuotaCachedEnforcer(t *testing.T) {
+	e, _ := NewCachedEnforcer(newQuotaEnforcer(t, "2").GetModel())
+	e.SetQuotaStore(NewMemoryQuotaStore())
+
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "alice", "data1", "read", true)
+	testEnforceCache(t, e, "alice", "data1", "read", false)
+}
@@ -15,6 +15,7 @@
 package defaultrolemanager
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -408,6 +409,13 @@ func (rm *RoleManagerImpl) GetAllDomains() ([]string, error) {
 	return domains, nil
 }
 
+// CopyEmpty returns a role manager with the hierarchy level, matching functions and logger of rm but without its links.
+func (rm *RoleManagerImpl) CopyEmpty() rbac.RoleManager {
+	c := NewRoleManagerImpl(rm.maxHierarchyLevel)
+	c.matchingFunc, c.domainMatchingFunc, c.logger = rm.matchingFunc, rm.domainMatchingFunc, rm.logger
+	return c
+}
+
 func (rm *RoleManagerImpl) copyFrom(other *RoleManagerImpl) {
 	other.Range(func(name1, name2 string, domain ...string) bool {
 		_ = rm.AddLink(name1, name2, domain...)
@@ -430,6 +438,31 @@ func (rm *RoleManagerImpl) Range(fn func(name1, name2 string, domain ...string)
 	rangeLinks(rm.allRoles, fn)
 }
 
+// AddLinkCtx is AddLink, the context is not used.
+func (rm *RoleManagerImpl) AddLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	return rm.AddLink(name1, name2, domain...)
+}
+
+// DeleteLinkCtx is DeleteLink, the context is not used.
+func (rm *RoleManagerImpl) DeleteLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	return rm.DeleteLink(name1, name2, domain...)
+}
+
+// HasLinkCtx is HasLink, the context is not used.
+func (rm *RoleManagerImpl) HasLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error) {
+	return rm.HasLink(name1, name2, domain...)
+}
+
+// GetRolesCtx is GetRoles, the context is not used.
+func (rm *RoleManagerImpl) GetRolesCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	return rm.GetRoles(name, domain...)
+}
+
+// GetUsersCtx is GetUsers, the context is not used.
+func (rm *RoleManagerImpl) GetUsersCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	return rm.GetUsers(name, domain...)
+}
+
 // Deprecated: BuildRelationship is no longer required
 func (rm *RoleManagerImpl) BuildRelationship(name1 string, name2 string, domain ...string) error {
 	return nil
@@ -477,6 +510,13 @@ func (dm *DomainManager) AddDomainMatchingFunc(name string, fn rbac.MatchingFunc
 	dm.rebuild()
 }
 
+// CopyEmpty returns a domain manager with the hierarchy level, matching functions and logger of dm but without its links.
+func (dm *DomainManager) CopyEmpty() rbac.RoleManager {
+	c := NewDomainManager(dm.maxHierarchyLevel)
+	c.matchingFunc, c.domainMatchingFunc, c.logger = dm.matchingFunc, dm.domainMatchingFunc, dm.logger
+	return c
+}
+
 // clears the map of RoleManagers
 func (dm *DomainManager) rebuild() {
 	rmMap := dm.rmMap
@@ -527,6 +567,14 @@ func (dm *DomainManager) Match(str string, pattern string) bool {
 	}
 }
 
+// MatchName matches the role name with the pattern, using the matching function added by AddMatchingFunc.
+func (dm *DomainManager) MatchName(str string, pattern string) bool {
+	if dm.matchingFunc != nil {
+		return dm.matchingFunc(str, pattern)
+	}
+	return str == pattern
+}
+
 func (dm *DomainManager) rangeAffectedRoleManagers(domain string, fn func(rm *RoleManagerImpl)) {
 	if dm.domainMatchingFunc != nil {
 		dm.rmMap.Range(func(key, value interface{}) bool {
@@ -685,6 +733,31 @@ func (rm *DomainManager) GetAllDomains() ([]string, error) {
 	return domains, nil
 }
 
+// AddLinkCtx is AddLink, the context is not used.
+func (dm *DomainManager) AddLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	return dm.AddLink(name1, name2, domain...)
+}
+
+// DeleteLinkCtx is DeleteLink, the context is not used.
+func (dm *DomainManager) DeleteLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	return dm.DeleteLink(name1, name2, domain...)
+}
+
+// HasLinkCtx is HasLink, the context is not used.
+func (dm *DomainManager) HasLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error) {
+	return dm.HasLink(name1, name2, domain...)
+}
+
+// GetRolesCtx is GetRoles, the context is not used.
+func (dm *DomainManager) GetRolesCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	return dm.GetRoles(name, domain...)
+}
+
+// GetUsersCtx is GetUsers, the context is not used.
+func (dm *DomainManager) GetUsersCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	return dm.GetUsers(name, domain...)
+}
+
 // Deprecated: BuildRelationship is no longer required
 func (rm *DomainManager) BuildRelationship(name1 string, name2 string, domain ...string) error {
 	return nil
@@ -699,3 +772,8 @@ func NewRoleManager(maxHierarchyLevel int) *RoleManager {
 	rm.DomainManager = NewDomainManager(maxHierarchyLevel)
 	return rm
 }
+
+// CopyEmpty returns a role manager with the hierarchy level, matching functions and logger of rm but without its links.
+func (rm *RoleManager) CopyEmpty() rbac.RoleManager {
+	return &RoleManager{DomainManager: rm.DomainManager.CopyEmpty().(*DomainManager)}
+}
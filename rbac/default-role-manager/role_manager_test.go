@@ -387,3 +387,75 @@ func TestMaxHierarchyLevel(t *testing.T) {
 	testRole(t, rm, "level1", "level2", true)
 	testRole(t, rm, "level1", "level3", true)
 }
+
+func TestCopyEmpty(t *testing.T) {
+	rm := NewRoleManager(10)
+	rm.AddMatchingFunc("keyMatch2", util.KeyMatch2)
+	rm.AddDomainMatchingFunc("keyMatch2", util.KeyMatch2)
+	_ = rm.AddLink("/book/:id", "book_group", "*")
+
+	// The copy keeps the matching functions but none of the links.
+	c := rm.CopyEmpty()
+	testDomainRole(t, c, "/book/1", "book_group", "domain1", false)
+	_ = c.AddLink("/pen/:id", "pen_group", "*")
+	testDomainRole(t, c, "/pen/1", "pen_group", "domain1", true)
+	testDomainRole(t, rm, "/pen/1", "pen_group", "domain1", false)
+	testDomainRole(t, rm, "/book/1", "book_group", "domain1", true)
+}
+
+// testRolesAndUsersSymmetry checks that every role of every name lists the name as one of its users, and the other way around.
+func testRolesAndUsersSymmetry(t *testing.T, rm rbac.RoleManager, names []string) {
+	t.Helper()
+	for _, name := range names {
+		roles, _ := rm.GetRoles(name)
+		for _, role := range roles {
+			if users, _ := rm.GetUsers(role); !util.In(name, users...) {
+				t.Errorf("%s is a role of %s, but the users of %s are %s", role, name, role, users)
+			}
+		}
+		users, _ := rm.GetUsers(name)
+		for _, user := range users {
+			if roles, _ := rm.GetRoles(user); !util.In(name, roles...) {
+				t.Errorf("%s is a user of %s, but the roles of %s are %s", user, name, user, roles)
+			}
+		}
+	}
+}
+
+func TestRoleAsUserAndRole(t *testing.T) {
+	rm := NewRoleManager(10)
+	_ = rm.AddLink("alice", "role1")
+	_ = rm.AddLink("carol", "role1")
+	_ = rm.AddLink("role1", "role2")
+	_ = rm.AddLink("bob", "role2")
+	_ = rm.AddLink("role2", "role3")
+
+	// role1 and role2 are both users and roles, the links are followed through them but never backwards.
+	testRole(t, rm, "alice", "role1", true)
+	testRole(t, rm, "alice", "role2", true)
+	testRole(t, rm, "alice", "role3", true)
+	testRole(t, rm, "role1", "role3", true)
+	testRole(t, rm, "bob", "role3", true)
+	testRole(t, rm, "bob", "role1", false)
+	testRole(t, rm, "role2", "role1", false)
+	testRole(t, rm, "role3", "alice", false)
+	testRole(t, rm, "alice", "carol", false)
+
+	testPrintRoles(t, rm, "alice", []string{"role1"})
+	testPrintRoles(t, rm, "role1", []string{"role2"})
+	testPrintRoles(t, rm, "role2", []string{"role3"})
+	testPrintRoles(t, rm, "role3", []string{})
+	testPrintUsers(t, rm, "role1", []string{"alice", "carol"})
+	testPrintUsers(t, rm, "role2", []string{"role1", "bob"})
+	testPrintUsers(t, rm, "role3", []string{"role2"})
+	testPrintUsers(t, rm, "alice", []string{})
+
+	names := []string{"alice", "bob", "carol", "role1", "role2", "role3"}
+	testRolesAndUsersSymmetry(t, rm, names)
+
+	_ = rm.DeleteLink("role1", "role2")
+	testRole(t, rm, "alice", "role2", false)
+	testRole(t, rm, "alice", "role1", true)
+	testPrintUsers(t, rm, "role2", []string{"bob"})
+	testRolesAndUsersSymmetry(t, rm, names)
+}
@@ -59,6 +59,71 @@ type RoleManager interface {
 	AddDomainMatchingFunc(name string, fn MatchingFunc)
 }
 
+// ContextRoleManager is a RoleManager whose operations can also be given a context, e.g. to time out or trace
+// the queries of a role manager backed by an external service. The enforcer calls HasLinkCtx with the context
+// of EnforceCtx for the role functions of the matchers.
+type ContextRoleManager interface {
+	RoleManager
+	// AddLinkCtx is AddLink with a context.
+	AddLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error
+	// DeleteLinkCtx is DeleteLink with a context.
+	DeleteLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error
+	// HasLinkCtx is HasLink with a context.
+	HasLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error)
+	// GetRolesCtx is GetRoles with a context.
+	GetRolesCtx(ctx context.Context, name string, domain ...string) ([]string, error)
+	// GetUsersCtx is GetUsers with a context.
+	GetUsersCtx(ctx context.Context, name string, domain ...string) ([]string, error)
+}
+
+// NewContextRoleManager adapts a RoleManager to a ContextRoleManager whose operations fail with the error
+// of the context once it is done, rm is returned as is if it is already a ContextRoleManager.
+func NewContextRoleManager(rm RoleManager) ContextRoleManager {
+	if crm, ok := rm.(ContextRoleManager); ok {
+		return crm
+	}
+	return &contextRoleManager{RoleManager: rm}
+}
+
+type contextRoleManager struct {
+	RoleManager
+}
+
+func (rm *contextRoleManager) AddLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rm.AddLink(name1, name2, domain...)
+}
+
+func (rm *contextRoleManager) DeleteLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return rm.DeleteLink(name1, name2, domain...)
+}
+
+func (rm *contextRoleManager) HasLinkCtx(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return rm.HasLink(name1, name2, domain...)
+}
+
+func (rm *contextRoleManager) GetRolesCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rm.GetRoles(name, domain...)
+}
+
+func (rm *contextRoleManager) GetUsersCtx(ctx context.Context, name string, domain ...string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rm.GetUsers(name, domain...)
+}
+
 // RoleManagerWithContext provides a context-aware interface to define the operations for managing roles.
 // Prefer this over RoleManager interface for context propagation, which is useful for things like handling
 // request timeouts.
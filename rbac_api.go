@@ -15,20 +15,30 @@
 package casbin
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/casbin/casbin/v2/constant"
 	"github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/casbin/casbin/v2/rbac"
 	"github.com/casbin/casbin/v2/util"
 )
 
-// GetRolesForUser gets the roles that a user has.
+// GetRolesForUser gets the roles that a user has, sorted lexicographically.
 func (e *Enforcer) GetRolesForUser(name string, domain ...string) ([]string, error) {
 	res, err := e.model["g"]["g"].RM.GetRoles(name, domain...)
+	sort.Strings(res)
 	return res, err
 }
 
-// GetUsersForRole gets the users that has a role.
+// GetUsersForRole gets the users that has a role, sorted lexicographically.
 func (e *Enforcer) GetUsersForRole(name string, domain ...string) ([]string, error) {
 	res, err := e.model["g"]["g"].RM.GetUsers(name, domain...)
+	sort.Strings(res)
 	return res, err
 }
 
@@ -91,21 +101,49 @@ func (e *Enforcer) DeleteRolesForUser(user string, domain ...string) (bool, erro
 	return e.RemoveFilteredGroupingPolicy(0, args...)
 }
 
-// DeleteUser deletes a user.
+// DeleteUser deletes a user: the role inheritance rules of every grouping ptype whose user it is, in every domain,
+// and the rules of every policy ptype whose subject it is. The policy ptypes other than "p" without a sub token
+// are left alone.
 // Returns false if the user does not exist (aka not affected).
 func (e *Enforcer) DeleteUser(user string) (bool, error) {
-	var err error
-	res1, err := e.RemoveFilteredGroupingPolicy(0, user)
-	if err != nil {
-		return res1, err
+	removed := false
+	for _, ptype := range persist.SortedPtypes(e.model, "g") {
+		res, err := e.RemoveFilteredNamedGroupingPolicy(ptype, 0, user)
+		removed = removed || res
+		if err != nil {
+			return removed, err
+		}
 	}
 
+	for _, ptype := range persist.SortedPtypes(e.model, "p") {
+		subIndex, err := e.GetFieldIndex(ptype, constant.SubjectIndex)
+		if err != nil {
+			if ptype == "p" {
+				return false, err
+			}
+			continue
+		}
+		res, err := e.RemoveFilteredNamedPolicy(ptype, subIndex, user)
+		removed = removed || res
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// DeleteUsers deletes the users, the role inheritance rules and the permissions of all the users are
+// removed with one batch call per section and the watcher is notified once.
+// Returns false if none of the users exist (aka not affected).
+func (e *Enforcer) DeleteUsers(users []string) (bool, error) {
 	subIndex, err := e.GetFieldIndex("p", constant.SubjectIndex)
 	if err != nil {
 		return false, err
 	}
-	res2, err := e.RemoveFilteredPolicy(subIndex, user)
-	return res1 || res2, err
+
+	gRules := e.getRulesForSubjects("g", "g", 0, users)
+	pRules := e.getRulesForSubjects("p", "p", subIndex, users)
+	return e.removeGroupingPoliciesAndPolicies(gRules, pRules)
 }
 
 // DeleteRole deletes a role.
@@ -163,6 +201,39 @@ func (e *Enforcer) DeletePermissionsForUser(user string) (bool, error) {
 	return e.RemoveFilteredPolicy(subIndex, user)
 }
 
+// DeletePermissionsForUsers deletes the permissions of the users or roles with one batch call.
+// Returns false if none of the users or roles have any permissions (aka not affected).
+func (e *Enforcer) DeletePermissionsForUsers(users []string) (bool, error) {
+	subIndex, err := e.GetFieldIndex("p", constant.SubjectIndex)
+	if err != nil {
+		return false, err
+	}
+
+	rules := e.getRulesForSubjects("p", "p", subIndex, users)
+	if len(rules) == 0 {
+		return false, nil
+	}
+	return e.removePolicies("p", "p", rules)
+}
+
+// getRulesForSubjects gets the rules whose value at fieldIndex is one of the subjects.
+func (e *Enforcer) getRulesForSubjects(sec string, ptype string, fieldIndex int, subjects []string) [][]string {
+	subjectSet := make(map[string]struct{}, len(subjects))
+	for _, subject := range subjects {
+		subjectSet[subject] = struct{}{}
+	}
+
+	var rules [][]string
+	if ast, ok := e.model[sec][ptype]; ok {
+		for _, rule := range ast.Policy {
+			if _, ok := subjectSet[rule[fieldIndex]]; ok {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	return rules
+}
+
 // GetPermissionsForUser gets permissions for a user or role.
 func (e *Enforcer) GetPermissionsForUser(user string, domain ...string) [][]string {
 	return e.GetNamedPermissionsForUser("p", user, domain...)
@@ -195,11 +266,127 @@ func (e *Enforcer) GetNamedPermissionsForUser(ptype string, user string, domain
 	return permission
 }
 
+// ExpandActionWildcards replaces every permission whose action is "*" with one permission for each of allActions,
+// e.g. ["alice", "data1", "*"] with allActions ["read", "write"] becomes ["alice", "data1", "read"] and
+// ["alice", "data1", "write"]. The action is the "act" field of "p", the last field if there is none.
+// The other permissions are kept as they are and the duplicates are removed.
+func (e *Enforcer) ExpandActionWildcards(perms [][]string, allActions []string) [][]string {
+	actIndex, err := e.GetFieldIndex("p", constant.ActionIndex)
+	if err != nil {
+		actIndex = -1
+	}
+
+	res := make([][]string, 0, len(perms))
+	seen := map[string]struct{}{}
+	add := func(perm []string) {
+		key := strings.Join(perm, model.DefaultSep)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			res = append(res, perm)
+		}
+	}
+	for _, perm := range perms {
+		index := actIndex
+		if index < 0 || index >= len(perm) {
+			index = len(perm) - 1
+		}
+		if index < 0 || perm[index] != "*" {
+			add(perm)
+			continue
+		}
+		for _, action := range allActions {
+			expanded := append([]string(nil), perm...)
+			expanded[index] = action
+			add(expanded)
+		}
+	}
+	return res
+}
+
+// GetPermittedActions gets the actions the subject may perform on the object, e.g. to decide which buttons to show,
+// sorted lexicographically. The actions tested are the values of the "act" field of the "p" rules, the last
+// field if there is none, except for the wildcard "*", which only grants the other actions.
+// The requests are (sub, obj, act), or (sub, domain, obj, act) with a domain.
+func (e *Enforcer) GetPermittedActions(sub string, obj string, domain ...string) ([]string, error) {
+	actIndex, err := e.GetFieldIndex("p", constant.ActionIndex)
+	if err != nil {
+		actIndex = len(e.model["p"]["p"].Tokens) - 1
+	}
+
+	var actions []string
+	for _, action := range e.model.GetValuesForFieldInPolicy("p", "p", actIndex) {
+		if action != "*" {
+			actions = append(actions, action)
+		}
+	}
+	sort.Strings(actions)
+
+	requests := make([][]interface{}, len(actions))
+	for i, action := range actions {
+		if len(domain) > 0 {
+			requests[i] = []interface{}{sub, domain[0], obj, action}
+		} else {
+			requests[i] = []interface{}{sub, obj, action}
+		}
+	}
+	results, err := e.BatchEnforce(requests)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for i, allowed := range results {
+		if allowed {
+			res = append(res, actions[i])
+		}
+	}
+	return res, nil
+}
+
 // HasPermissionForUser determines whether a user has a permission.
 func (e *Enforcer) HasPermissionForUser(user string, permission ...string) bool {
 	return e.HasPolicy(util.JoinSlice(user, permission...))
 }
 
+// AddDefaultRole makes every subject have the role in the domain without a grouping rule for each of them,
+// for both the enforcement with g() and GetImplicitRolesForUser.
+// The default roles are not part of the policy, they are neither saved nor returned by GetGroupingPolicy.
+func (e *Enforcer) AddDefaultRole(role string, domain ...string) {
+	if e.defaultRoles == nil {
+		e.defaultRoles = map[string][]string{}
+	}
+	key := defaultRoleDomain(domain)
+	if !util.In(role, e.defaultRoles[key]...) {
+		e.defaultRoles[key] = append(e.defaultRoles[key], role)
+	}
+	e.invalidateMatcherMap()
+}
+
+// DeleteDefaultRole removes a role added by AddDefaultRole.
+func (e *Enforcer) DeleteDefaultRole(role string, domain ...string) {
+	key := defaultRoleDomain(domain)
+	roles := e.defaultRoles[key][:0]
+	for _, r := range e.defaultRoles[key] {
+		if r != role {
+			roles = append(roles, r)
+		}
+	}
+	if len(roles) == 0 {
+		delete(e.defaultRoles, key)
+	} else {
+		e.defaultRoles[key] = roles
+	}
+	e.invalidateMatcherMap()
+}
+
+// defaultRoleDomain returns the domain the default roles are keyed by, "" without a domain.
+func defaultRoleDomain(domain []string) string {
+	if len(domain) == 0 {
+		return ""
+	}
+	return domain[0]
+}
+
 // GetImplicitRolesForUser gets implicit roles that a user has.
 // Compared to GetRolesForUser(), this function retrieves indirect roles besides direct roles.
 // For example:
@@ -208,62 +395,125 @@ func (e *Enforcer) HasPermissionForUser(user string, permission ...string) bool
 //
 // GetRolesForUser("alice") can only get: ["role:admin"].
 // But GetImplicitRolesForUser("alice") will get: ["role:admin", "role:user"].
+// Roles are returned level by level, each level sorted lexicographically.
 func (e *Enforcer) GetImplicitRolesForUser(name string, domain ...string) ([]string, error) {
+	return e.getImplicitRolesForUser(name, nil, domain...)
+}
+
+// GetImplicitRolesForUserExcluding gets implicit roles that a user has like GetImplicitRolesForUser(),
+// without the excluded roles and the roles the user only inherits through them.
+// For example:
+// g, alice, role:delegate
+// g, alice, role:user
+// g, role:delegate, role:admin
+// g, role:admin, role:user
+//
+// GetImplicitRolesForUserExcluding("alice", []string{"role:delegate"}) will get: ["role:user"],
+// role:admin is only inherited through role:delegate while alice also has role:user directly.
+func (e *Enforcer) GetImplicitRolesForUserExcluding(name string, exclude []string, domain ...string) ([]string, error) {
+	excluded := make(map[string]bool, len(exclude))
+	for _, role := range exclude {
+		excluded[role] = true
+	}
+	return e.getImplicitRolesForUser(name, excluded, domain...)
+}
+
+func (e *Enforcer) getImplicitRolesForUser(name string, excluded map[string]bool, domain ...string) ([]string, error) {
 	res := []string{}
 
-	for _, rm := range e.rmMap {
+	for _, ptype := range e.sortedRmTypes() {
+		roles, err := e.getImplicitRolesForUserInRm(ptype, name, excluded, domain...)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, roles...)
+	}
+
+	return res, nil
+}
 
-		roleSet := make(map[string]bool)
-		roleSet[name] = true
-		q := make([]string, 0)
-		q = append(q, name)
+// getImplicitRolesForUserInRm gets the implicit roles of a user with the role manager of the ptype only,
+// the excluded roles are neither returned nor followed.
+func (e *Enforcer) getImplicitRolesForUserInRm(ptype string, name string, excluded map[string]bool, domain ...string) ([]string, error) {
+	res := []string{}
+	rm := e.rmMap[ptype]
 
-		for len(q) > 0 {
-			name := q[0]
-			q = q[1:]
+	roleSet := make(map[string]bool)
+	roleSet[name] = true
 
-			roles, err := rm.GetRoles(name, domain...)
-			if err != nil {
-				return nil, err
-			}
-			for _, r := range roles {
-				if _, ok := roleSet[r]; !ok {
-					res = append(res, r)
-					q = append(q, r)
-					roleSet[r] = true
-				}
+	roles, err := rm.GetRoles(name, domain...)
+	if err != nil {
+		return nil, err
+	}
+	// the default roles are direct roles of the user.
+	if ptype == "g" {
+		roles = append(roles, e.defaultRoles[defaultRoleDomain(domain)]...)
+	}
+	q := make([]string, 0)
+
+	for {
+		sort.Strings(roles)
+		for _, r := range roles {
+			if _, ok := roleSet[r]; !ok && !excluded[r] {
+				res = append(res, r)
+				q = append(q, r)
+				roleSet[r] = true
 			}
 		}
+		if len(q) == 0 {
+			break
+		}
+
+		name := q[0]
+		q = q[1:]
+		if roles, err = rm.GetRoles(name, domain...); err != nil {
+			return nil, err
+		}
 	}
 
 	return res, nil
 }
 
 // GetImplicitUsersForRole gets implicit users for a role.
+// Users are returned level by level, each level sorted lexicographically.
 func (e *Enforcer) GetImplicitUsersForRole(name string, domain ...string) ([]string, error) {
 	res := []string{}
 
-	for _, rm := range e.rmMap {
+	for _, ptype := range e.sortedRmTypes() {
+		users, err := e.getImplicitUsersForRoleInRm(ptype, name, domain...)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, users...)
+	}
 
-		roleSet := make(map[string]bool)
-		roleSet[name] = true
-		q := make([]string, 0)
-		q = append(q, name)
+	return res, nil
+}
 
-		for len(q) > 0 {
-			name := q[0]
-			q = q[1:]
+// getImplicitUsersForRoleInRm gets the implicit users for a role with the role manager of the ptype only.
+func (e *Enforcer) getImplicitUsersForRoleInRm(ptype string, name string, domain ...string) ([]string, error) {
+	res := []string{}
+	rm := e.rmMap[ptype]
 
-			roles, err := rm.GetUsers(name, domain...)
-			if err != nil && err.Error() != "error: name does not exist" {
-				return nil, err
-			}
-			for _, r := range roles {
-				if _, ok := roleSet[r]; !ok {
-					res = append(res, r)
-					q = append(q, r)
-					roleSet[r] = true
-				}
+	roleSet := make(map[string]bool)
+	roleSet[name] = true
+	q := make([]string, 0)
+	q = append(q, name)
+
+	for len(q) > 0 {
+		name := q[0]
+		q = q[1:]
+
+		roles, err := rm.GetUsers(name, domain...)
+		if err != nil && err.Error() != "error: name does not exist" {
+			return nil, err
+		}
+		sort.Strings(roles)
+		for _, r := range roles {
+			if _, ok := roleSet[r]; !ok {
+				res = append(res, r)
+				q = append(q, r)
+				roleSet[r] = true
 			}
 		}
 	}
@@ -294,34 +544,217 @@ func (e *Enforcer) GetImplicitPermissionsForUser(user string, domain ...string)
 // GetImplicitPermissionsForUser("alice") can only get: [["admin", "data1", "read"]], whose policy is default policy "p"
 // But you can specify the named policy "p2" to get: [["admin", "create"]] by    GetNamedImplicitPermissionsForUser("p2","alice")
 func (e *Enforcer) GetNamedImplicitPermissionsForUser(ptype string, user string, domain ...string) ([][]string, error) {
+	return e.GetNamedImplicitPermissionsForUserByGroupings(ptype, nil, user, domain...)
+}
+
+// GetNamedImplicitPermissionsForUserByGroupings gets implicit permissions for a user or role by named policy
+// like GetNamedImplicitPermissionsForUser(), the roles are resolved through the role managers of the given gtypes,
+// "g" is used if gtypes is empty.
+// For example:
+// p2, admin, delete
+// p2, manager, create
+// g, alice, admin
+// g2, alice, manager
+//
+// GetNamedImplicitPermissionsForUserByGroupings("p2", []string{"g2"}, "alice") will get: [["manager", "create"]].
+func (e *Enforcer) GetNamedImplicitPermissionsForUserByGroupings(ptype string, gtypes []string, user string, domain ...string) ([][]string, error) {
+	if len(domain) > 1 {
+		return nil, errors.ERR_DOMAIN_PARAMETER
+	}
+
+	if len(gtypes) == 0 {
+		gtypes = []string{"g"}
+	}
+	rms := make([]rbac.RoleManager, 0, len(gtypes))
+	for _, gtype := range gtypes {
+		rm, ok := e.rmMap[gtype]
+		if !ok {
+			return nil, fmt.Errorf("role definition %s does not exist", gtype)
+		}
+		rms = append(rms, rm)
+	}
+
 	permission := make([][]string, 0)
-	rm := e.GetRoleManager()
+	subIndex, err := e.GetFieldIndex(ptype, constant.SubjectIndex)
+	if err != nil {
+		subIndex = 0
+	}
 	domainIndex, _ := e.GetFieldIndex(ptype, constant.DomainIndex)
-	for _, rule := range e.model["p"][ptype].Policy {
-		if len(domain) == 0 {
-			matched, _ := rm.HasLink(user, rule[0])
-			if matched {
-				permission = append(permission, deepCopyPolicy(rule))
-			}
-		} else if len(domain) > 1 {
-			return nil, errors.ERR_DOMAIN_PARAMETER
-		} else {
-			d := domain[0]
-			matched := rm.Match(d, rule[domainIndex])
-			if !matched {
-				continue
+
+	// The role managers are only asked about the distinct subjects, which the model looks up in its
+	// subject index if EnablePermissionIndex is on. The role managers the user is linked to a subject by
+	// are kept to match the domains of its rules.
+	linked := make(map[string][]rbac.RoleManager)
+	rules := e.model.GetPolicyOfSubjects(ptype, func(subject string) bool {
+		for _, rm := range rms {
+			if matched, _ := rm.HasLink(user, subject, domain...); matched {
+				linked[subject] = append(linked[subject], rm)
 			}
-			matched, _ = rm.HasLink(user, rule[0], d)
-			if matched {
-				newRule := deepCopyPolicy(rule)
-				newRule[domainIndex] = d
-				permission = append(permission, newRule)
+		}
+		return len(linked[subject]) != 0
+	})
+
+	if len(domain) == 0 {
+		for _, rule := range rules {
+			permission = append(permission, deepCopyPolicy(rule))
+		}
+		return permission, nil
+	}
+
+	d := domain[0]
+	added := make(map[string]struct{})
+	for _, rule := range rules {
+		matched := false
+		for _, rm := range linked[rule[subIndex]] {
+			if matched = rm.Match(d, rule[domainIndex]); matched {
+				break
 			}
 		}
+		if !matched {
+			continue
+		}
+
+		newRule := deepCopyPolicy(rule)
+		newRule[domainIndex] = d
+		// rules of different domains can turn into the same rule once the domain is filled in
+		key := strings.Join(newRule, model.DefaultSep)
+		if _, ok := added[key]; ok {
+			continue
+		}
+		added[key] = struct{}{}
+		permission = append(permission, newRule)
 	}
 	return permission, nil
 }
 
+// PermissionSourceDirect is the source of the permissions granted to the user itself, see PermissionWithSource.
+const PermissionSourceDirect = "direct"
+
+// PermissionWithSource is a permission along with the subject of the rule granting it: the role the user inherits
+// it from, or PermissionSourceDirect if the rule is the user's own.
+type PermissionWithSource struct {
+	Rule   []string
+	Source string
+}
+
+// GetImplicitPermissionsForUserWithSource gets the implicit permissions for a user or role like
+// GetImplicitPermissionsForUser(), along with the role granting each of them.
+// For example:
+// p, admin, data1, read
+// p, alice, data2, read
+// g, alice, admin
+//
+// GetImplicitPermissionsForUserWithSource("alice") will get: [{["admin", "data1", "read"], "admin"},
+// {["alice", "data2", "read"], "direct"}].
+func (e *Enforcer) GetImplicitPermissionsForUserWithSource(user string, domain ...string) ([]PermissionWithSource, error) {
+	permissions, err := e.GetImplicitPermissionsForUser(user, domain...)
+	if err != nil {
+		return nil, err
+	}
+
+	subIndex, err := e.GetFieldIndex("p", constant.SubjectIndex)
+	if err != nil {
+		subIndex = 0
+	}
+	res := make([]PermissionWithSource, len(permissions))
+	for i, permission := range permissions {
+		source := permission[subIndex]
+		if source == user {
+			source = PermissionSourceDirect
+		}
+		res[i] = PermissionWithSource{Rule: permission, Source: source}
+	}
+	return res, nil
+}
+
+// SubjectPolicies are the policy rules affecting a subject, see GetPoliciesForSubject.
+type SubjectPolicies struct {
+	// Direct are the rules naming the subject.
+	Direct [][]string
+	// Inherited are the rules of the roles the subject has directly or through other roles, in the order of the roles
+	// like GetImplicitRolesForUser().
+	Inherited [][]string
+}
+
+// GetPoliciesForSubject gets the policy rules affecting a subject for an access review, the rules naming the subject
+// apart from the rules it inherits from its roles.
+// For example:
+// p, admin, data1, read
+// p, alice, data2, read
+// g, alice, admin
+//
+// GetPoliciesForSubject("alice") will get: {Direct: [["alice", "data2", "read"]], Inherited: [["admin", "data1", "read"]]}.
+func (e *Enforcer) GetPoliciesForSubject(sub string, domain ...string) (*SubjectPolicies, error) {
+	roles, err := e.getImplicitRolesForUserInRm("g", sub, nil, domain...)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := &SubjectPolicies{Direct: e.GetPermissionsForUser(sub, domain...), Inherited: [][]string{}}
+	for _, role := range roles {
+		policies.Inherited = append(policies.Inherited, e.GetPermissionsForUser(role, domain...)...)
+	}
+	return policies, nil
+}
+
+// GetEffectivePermissionsForUser gets the implicit permissions that the user actually has once the policy effect
+// is applied. Compared to GetImplicitPermissionsForUser(), deny rules are left out, and so are the allow rules
+// overridden by a deny rule.
+// For example:
+// p, admin, data1, read, allow
+// p, admin, data1, write, allow
+// p, alice, data1, write, deny
+// g, alice, admin
+//
+// GetEffectivePermissionsForUser("alice") will get: [["admin", "data1", "read", "allow"]].
+func (e *Enforcer) GetEffectivePermissionsForUser(user string, domain ...string) ([][]string, error) {
+	permissions, err := e.GetImplicitPermissionsForUser(user, domain...)
+	if err != nil {
+		return nil, err
+	}
+
+	// each request value is taken from the rule field of the same name, e.g. r.obj from p.obj
+	pTokens := make(map[string]int)
+	for i, token := range e.model["p"]["p"].Tokens {
+		pTokens[token] = i
+	}
+	rTokens := e.model["r"]["r"].Tokens
+	fieldIndexes := make([]int, len(rTokens))
+	subIndex := 0
+	for i, token := range rTokens {
+		index, ok := pTokens["p"+strings.TrimPrefix(token, "r")]
+		if !ok {
+			return nil, fmt.Errorf("request field %s has no matching policy field", token)
+		}
+		fieldIndexes[i] = index
+		if token == "r_sub" {
+			subIndex = i
+		}
+	}
+
+	res := make([][]string, 0)
+	for _, permission := range permissions {
+		if eftIndex, ok := pTokens["p_eft"]; ok && permission[eftIndex] != "allow" {
+			continue
+		}
+
+		rvals := make([]interface{}, len(fieldIndexes))
+		for i, index := range fieldIndexes {
+			rvals[i] = permission[index]
+		}
+		rvals[subIndex] = user
+
+		allowed, err := e.Enforce(rvals...)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			res = append(res, permission)
+		}
+	}
+	return res, nil
+}
+
 // GetImplicitUsersForPermission gets implicit users for a permission.
 // For example:
 // p, admin, data1, read
@@ -356,48 +789,49 @@ func (e *Enforcer) GetImplicitUsersForPermission(permission ...string) ([]string
 	return res, nil
 }
 
-// GetDomainsForUser gets all domains
+// GetDomainsForUser gets all domains, sorted lexicographically.
 func (e *Enforcer) GetDomainsForUser(user string) ([]string, error) {
 	var domains []string
-	for _, rm := range e.rmMap {
-		domain, err := rm.GetDomains(user)
+	for _, ptype := range e.sortedRmTypes() {
+		domain, err := e.rmMap[ptype].GetDomains(user)
 		if err != nil {
 			return nil, err
 		}
 		domains = append(domains, domain...)
 	}
+	sort.Strings(domains)
 	return domains, nil
 }
 
-// GetImplicitResourcesForUser returns all policies that user obtaining in domain
+// GetImplicitResourcesForUser returns all policies that user obtaining in domain.
+// The fields of the policies that the matcher groups with a role definition, e.g. the object in g2(r.obj, p.obj),
+// are expanded to all the members of the group, so a rule on "/folder" also gives the rules on "/folder/file"
+// if "/folder/file" is in the group "/folder" of g2.
 func (e *Enforcer) GetImplicitResourcesForUser(user string, domain ...string) ([][]string, error) {
 	permissions, err := e.GetImplicitPermissionsForUser(user, domain...)
 	if err != nil {
 		return nil, err
 	}
+	groupings := e.getPolicyFieldGroupings()
 	res := make([][]string, 0)
 	for _, permission := range permissions {
-		if permission[0] == user {
-			res = append(res, permission)
-			continue
-		}
 		resLocal := [][]string{{user}}
-		tokensLength := len(permission)
-		t := make([][]string, 1, tokensLength)
-		for _, token := range permission[1:] {
-			tokens, err := e.GetImplicitUsersForRole(token, domain...)
-			if err != nil {
-				return nil, err
+		for i, token := range permission[1:] {
+			tokens := []string{}
+			for _, ptype := range groupings[i+1] {
+				users, err := e.getImplicitUsersForRoleInRm(ptype, token, domain...)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, users...)
 			}
 			tokens = append(tokens, token)
-			t = append(t, tokens)
-		}
-		for i := 1; i < tokensLength; i++ {
+
 			n := make([][]string, 0)
-			for _, tokens := range t[i] {
+			for _, token := range tokens {
 				for _, policy := range resLocal {
 					t := append([]string(nil), policy...)
-					t = append(t, tokens)
+					t = append(t, token)
 					n = append(n, t)
 				}
 			}
@@ -408,6 +842,25 @@ func (e *Enforcer) GetImplicitResourcesForUser(user string, domain ...string) ([
 	return res, nil
 }
 
+var policyFieldGroupingRegex = regexp.MustCompile(`\b(g[0-9]*)\(\s*r_[A-Za-z0-9_]+\s*,\s*p_([A-Za-z0-9_]+)\b`)
+
+// getPolicyFieldGroupings returns, for every field of the "p" policy, the role definitions the matcher
+// groups it with, e.g. g2 for the object field with the matcher "g2(r.obj, p.obj)".
+func (e *Enforcer) getPolicyFieldGroupings() map[int][]string {
+	groupings := map[int][]string{}
+	for _, match := range policyFieldGroupingRegex.FindAllStringSubmatch(e.model["m"]["m"].Value, -1) {
+		if _, ok := e.rmMap[match[1]]; !ok {
+			continue
+		}
+		for i, token := range e.model["p"]["p"].Tokens {
+			if token == "p_"+match[2] && !containsString(groupings[i], match[1]) {
+				groupings[i] = append(groupings[i], match[1])
+			}
+		}
+	}
+	return groupings
+}
+
 // deepCopyPolicy returns a deepcopy version of the policy to prevent changing policies through returned slice
 func deepCopyPolicy(src []string) []string {
 	newRule := make([]string, len(src))
@@ -0,0 +1,64 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"fmt"
+	"testing"
+)
+
+func BenchmarkGetImplicitPermissionsForUserLarge(b *testing.B) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", false)
+
+	// 3000 roles in a tree, each role inherits its parent.
+	gPolicies := make([][]string, 0)
+	for i := 1; i < 3000; i++ {
+		gPolicies = append(gPolicies, []string{fmt.Sprintf("role%d", i), fmt.Sprintf("role%d", i/2)})
+	}
+	gPolicies = append(gPolicies, []string{"alice", "role2999"})
+	_, err := e.AddGroupingPolicies(gPolicies)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// 300000 rules, 100 for each role.
+	pPolicies := make([][]string, 0)
+	for i := 0; i < 300000; i++ {
+		pPolicies = append(pPolicies, []string{fmt.Sprintf("role%d", i%3000), fmt.Sprintf("data%d", i/3000), "read"})
+	}
+	_, err = e.AddPolicies(pPolicies)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("single pass", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = e.GetImplicitPermissionsForUser("alice")
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		e.EnablePermissionIndex(true)
+		defer e.EnablePermissionIndex(false)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_, _ = e.GetImplicitPermissionsForUser("alice")
+		}
+	})
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = scanImplicitPermissionsForUser(e, "p", "alice")
+		}
+	})
+}
@@ -75,6 +75,14 @@ func (e *SyncedEnforcer) DeleteUser(user string) (bool, error) {
 	return e.Enforcer.DeleteUser(user)
 }
 
+// DeleteUsers deletes the users with one batch call per section.
+// Returns false if none of the users exist (aka not affected).
+func (e *SyncedEnforcer) DeleteUsers(users []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.DeleteUsers(users)
+}
+
 // DeleteRole deletes a role.
 // Returns false if the role does not exist (aka not affected).
 func (e *SyncedEnforcer) DeleteRole(role string) (bool, error) {
@@ -115,6 +123,14 @@ func (e *SyncedEnforcer) DeletePermissionsForUser(user string) (bool, error) {
 	return e.Enforcer.DeletePermissionsForUser(user)
 }
 
+// DeletePermissionsForUsers deletes the permissions of the users or roles with one batch call.
+// Returns false if none of the users or roles have any permissions (aka not affected).
+func (e *SyncedEnforcer) DeletePermissionsForUsers(users []string) (bool, error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	return e.Enforcer.DeletePermissionsForUsers(users)
+}
+
 // GetPermissionsForUser gets permissions for a user or role.
 func (e *SyncedEnforcer) GetPermissionsForUser(user string, domain ...string) [][]string {
 	e.m.RLock()
@@ -122,6 +138,20 @@ func (e *SyncedEnforcer) GetPermissionsForUser(user string, domain ...string) []
 	return e.Enforcer.GetPermissionsForUser(user, domain...)
 }
 
+// ExpandActionWildcards replaces every permission whose action is "*" with one permission for each of allActions.
+func (e *SyncedEnforcer) ExpandActionWildcards(perms [][]string, allActions []string) [][]string {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.ExpandActionWildcards(perms, allActions)
+}
+
+// GetPermittedActions gets the actions the subject may perform on the object, sorted lexicographically.
+func (e *SyncedEnforcer) GetPermittedActions(sub string, obj string, domain ...string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPermittedActions(sub, obj, domain...)
+}
+
 // GetNamedPermissionsForUser gets permissions for a user or role by named policy.
 func (e *SyncedEnforcer) GetNamedPermissionsForUser(ptype string, user string, domain ...string) [][]string {
 	e.m.RLock()
@@ -136,6 +166,20 @@ func (e *SyncedEnforcer) HasPermissionForUser(user string, permission ...string)
 	return e.Enforcer.HasPermissionForUser(user, permission...)
 }
 
+// AddDefaultRole makes every subject have the role in the domain without a grouping rule for each of them.
+func (e *SyncedEnforcer) AddDefaultRole(role string, domain ...string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.AddDefaultRole(role, domain...)
+}
+
+// DeleteDefaultRole removes a role added by AddDefaultRole.
+func (e *SyncedEnforcer) DeleteDefaultRole(role string, domain ...string) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.Enforcer.DeleteDefaultRole(role, domain...)
+}
+
 // GetImplicitRolesForUser gets implicit roles that a user has.
 // Compared to GetRolesForUser(), this function retrieves indirect roles besides direct roles.
 // For example:
@@ -150,6 +194,35 @@ func (e *SyncedEnforcer) GetImplicitRolesForUser(name string, domain ...string)
 	return e.Enforcer.GetImplicitRolesForUser(name, domain...)
 }
 
+// GetImplicitRolesForUserExcluding gets implicit roles that a user has, without the excluded roles and the roles
+// only inherited through them.
+func (e *SyncedEnforcer) GetImplicitRolesForUserExcluding(name string, exclude []string, domain ...string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitRolesForUserExcluding(name, exclude, domain...)
+}
+
+// GetImplicitRolesForUserWithDomain gets the implicit roles of a user in every domain the user has roles in, as {role, domain} pairs.
+func (e *SyncedEnforcer) GetImplicitRolesForUserWithDomain(user string) ([][2]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitRolesForUserWithDomain(user)
+}
+
+// GetImplicitPermissionsForUserWithSource gets implicit permissions for a user or role, along with the role granting each of them.
+func (e *SyncedEnforcer) GetImplicitPermissionsForUserWithSource(user string, domain ...string) ([]PermissionWithSource, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitPermissionsForUserWithSource(user, domain...)
+}
+
+// GetPoliciesForSubject gets the policy rules naming a subject apart from the rules it inherits from its roles.
+func (e *SyncedEnforcer) GetPoliciesForSubject(sub string, domain ...string) (*SubjectPolicies, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetPoliciesForSubject(sub, domain...)
+}
+
 // GetImplicitPermissionsForUser gets implicit permissions for a user or role.
 // Compared to GetPermissionsForUser(), this function retrieves permissions for inherited roles.
 // For example:
@@ -180,6 +253,29 @@ func (e *SyncedEnforcer) GetNamedImplicitPermissionsForUser(ptype string, user s
 	return e.Enforcer.GetNamedImplicitPermissionsForUser(ptype, user, domain...)
 }
 
+// GetNamedImplicitPermissionsForUserByGroupings gets implicit permissions for a user or role by named policy
+// like GetNamedImplicitPermissionsForUser(), the roles are resolved through the role managers of the given gtypes,
+// "g" is used if gtypes is empty.
+// For example:
+// p2, admin, delete
+// p2, manager, create
+// g, alice, admin
+// g2, alice, manager
+//
+// GetNamedImplicitPermissionsForUserByGroupings("p2", []string{"g2"}, "alice") will get: [["manager", "create"]].
+func (e *SyncedEnforcer) GetNamedImplicitPermissionsForUserByGroupings(ptype string, gtypes []string, user string, domain ...string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetNamedImplicitPermissionsForUserByGroupings(ptype, gtypes, user, domain...)
+}
+
+// GetEffectivePermissionsForUser gets the implicit permissions that the user actually has once the policy effect is applied.
+func (e *SyncedEnforcer) GetEffectivePermissionsForUser(user string, domain ...string) ([][]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetEffectivePermissionsForUser(user, domain...)
+}
+
 // GetImplicitUsersForPermission gets implicit users for a permission.
 // For example:
 // p, admin, data1, read
@@ -15,11 +15,20 @@
 package casbin
 
 import (
+	"fmt"
 	"github.com/casbin/casbin/v2/constant"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"reflect"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -126,6 +135,262 @@ func TestRoleAPI(t *testing.T) {
 	testEnforce(t, e, "bob", "data2", "write", true)
 }
 
+func TestRoleAsUserAndRole(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "role1"}, {"role1", "role2"}, {"bob", "role2"}})
+	_, _ = e.AddPolicies([][]string{{"role1", "data1", "read"}, {"role2", "data2", "write"}})
+
+	// role1 is a role of alice and a user of role2, so alice gets the permissions of both.
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "alice", "data2", "write", true)
+	testEnforce(t, e, "role1", "data2", "write", true)
+	testEnforce(t, e, "bob", "data2", "write", true)
+	testEnforce(t, e, "bob", "data1", "read", false)
+	testEnforce(t, e, "role2", "data1", "read", false)
+
+	testGetRoles(t, e, []string{"role1"}, "alice")
+	testGetRoles(t, e, []string{"role2"}, "role1")
+	testGetRoles(t, e, []string{}, "role2")
+	testGetUsers(t, e, []string{"alice"}, "role1")
+	testGetUsers(t, e, []string{"role1", "bob"}, "role2")
+	testGetImplicitRoles(t, e, "alice", []string{"role1", "role2"})
+	testGetImplicitUsersForRole(t, e, "role2", []string{"role1", "bob", "alice"})
+
+	for _, name := range []string{"alice", "bob", "role1", "role2"} {
+		roles, _ := e.GetRolesForUser(name)
+		for _, role := range roles {
+			if users, _ := e.GetUsersForRole(role); !util.In(name, users...) {
+				t.Errorf("%s is a role of %s, but the users of %s are %s", role, name, role, users)
+			}
+		}
+	}
+}
+
+func TestDefaultRole(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	_, _ = e.AddPolicy("member", "data3", "read")
+	_, _ = e.AddGroupingPolicy("member", "reader")
+	_, _ = e.AddPolicy("reader", "data4", "read")
+
+	testEnforce(t, e, "eve", "data3", "read", false)
+	e.AddDefaultRole("member")
+
+	// eve is in no grouping rule, but has the default role and the roles it inherits.
+	testEnforce(t, e, "eve", "data3", "read", true)
+	testEnforce(t, e, "eve", "data4", "read", true)
+	testEnforce(t, e, "eve", "data2", "read", false)
+	testEnforce(t, e, "alice", "data2", "read", true)
+	testEnforce(t, e, "alice", "data3", "read", true)
+	testGetImplicitRoles(t, e, "eve", []string{"member", "reader"})
+	testGetImplicitRoles(t, e, "alice", []string{"data2_admin", "member", "reader"})
+	testGetGroupingPolicy(t, e, [][]string{{"alice", "data2_admin"}, {"member", "reader"}})
+
+	e.DeleteDefaultRole("member")
+	testEnforce(t, e, "eve", "data3", "read", false)
+	testGetImplicitRoles(t, e, "eve", []string{})
+}
+
+func TestDefaultRoleWithDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.AddDefaultRole("admin", "domain2")
+
+	testDomainEnforce(t, e, "eve", "domain2", "data2", "read", true)
+	testDomainEnforce(t, e, "eve", "domain1", "data1", "read", false)
+	testDomainEnforce(t, e, "alice", "domain2", "data2", "write", true)
+	testGetImplicitRoles(t, e, "eve", []string{})
+	testGetImplicitRolesInDomain(t, e, "eve", "domain2", []string{"admin"})
+	testGetImplicitRolesInDomain(t, e, "eve", "domain1", []string{})
+}
+
+func TestDefaultRoleCache(t *testing.T) {
+	e, _ := NewCachedEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	_, _ = e.AddPolicy("member", "data3", "read")
+
+	testEnforceCache(t, e, "eve", "data3", "read", false)
+	e.AddDefaultRole("member")
+	testEnforceCache(t, e, "eve", "data3", "read", true)
+	e.DeleteDefaultRole("member")
+	testEnforceCache(t, e, "eve", "data3", "read", false)
+}
+
+type recordingAdapter struct {
+	*fileadapter.Adapter
+	calls   []string
+	failSec string
+}
+
+func (a *recordingAdapter) AddPolicy(sec string, ptype string, rule []string) error {
+	a.calls = append(a.calls, "AddPolicy "+sec)
+	if sec == a.failSec {
+		return fmt.Errorf("cannot add %s rules", sec)
+	}
+	return nil
+}
+
+func (a *recordingAdapter) AddPolicies(sec string, ptype string, rules [][]string) error {
+	a.calls = append(a.calls, fmt.Sprintf("AddPolicies %s %d", sec, len(rules)))
+	return nil
+}
+
+func (a *recordingAdapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	a.calls = append(a.calls, "RemovePolicy "+sec)
+	return nil
+}
+
+func (a *recordingAdapter) RemovePolicies(sec string, ptype string, rules [][]string) error {
+	a.calls = append(a.calls, fmt.Sprintf("RemovePolicies %s %d", sec, len(rules)))
+	if sec == a.failSec {
+		return fmt.Errorf("cannot remove %s rules", sec)
+	}
+	return nil
+}
+
+func (a *recordingAdapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	a.calls = append(a.calls, "RemoveFilteredPolicy "+sec+" "+ptype)
+	return nil
+}
+
+type countingWatcher struct {
+	updates int
+}
+
+func (w *countingWatcher) SetUpdateCallback(func(string)) error {
+	return nil
+}
+
+func (w *countingWatcher) Update() error {
+	w.updates++
+	return nil
+}
+
+func (w *countingWatcher) Close() {
+}
+
+func TestDeleteUserAllPtypes(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+p2 = sub, obj
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`)
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	policy := "p, alice, domain1, data1, read\np, alice, domain2, data2, write\np, admin, domain1, data1, write\n" +
+		"p2, alice, data3\np2, bob, alice\n" +
+		"g, alice, admin, domain1\ng, alice, admin, domain2\ng, bob, alice, domain1\ng2, alice, staff"
+	if err := ioutil.WriteFile(path, []byte(policy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter(path)}
+	e, _ := NewEnforcer(m, a)
+
+	res, err := e.DeleteUser("alice")
+	if !res || err != nil {
+		t.Fatalf("DeleteUser: %t, %v", res, err)
+	}
+	// the rules of alice are removed from every ptype and domain, the rules about alice as a role or an object stay.
+	testGetPolicy(t, e, [][]string{{"admin", "domain1", "data1", "write"}})
+	testGetGroupingPolicy(t, e, [][]string{{"bob", "alice", "domain1"}})
+	if rules := e.GetNamedPolicy("p2"); !util.Array2DEquals(rules, [][]string{{"bob", "alice"}}) {
+		t.Errorf("p2 rules: %v, supposed to be [[bob alice]]", rules)
+	}
+	if rules := e.GetNamedGroupingPolicy("g2"); len(rules) != 0 {
+		t.Errorf("g2 rules: %v, supposed to be none", rules)
+	}
+	expected := []string{"RemoveFilteredPolicy g g", "RemoveFilteredPolicy g g2", "RemoveFilteredPolicy p p", "RemoveFilteredPolicy p p2"}
+	if !util.ArrayEquals(a.calls, expected) {
+		t.Errorf("Adapter calls: %v, supposed to be %v", a.calls, expected)
+	}
+
+	res, err = e.DeleteUser("alice")
+	if res || err != nil {
+		t.Errorf("DeleteUser of a deleted user: %t, %v", res, err)
+	}
+}
+
+func TestDeleteUsers(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+
+	users := []string{"alice"}
+	for i := 0; i < 200; i++ {
+		user := fmt.Sprintf("user%d", i)
+		users = append(users, user)
+		_, _ = e.AddGroupingPolicy(user, "data2_admin")
+		_, _ = e.AddPolicy(user, fmt.Sprintf("data%d", i), "read")
+	}
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+	a.calls = nil
+
+	res, err := e.DeleteUsers(users)
+	if !res || err != nil {
+		t.Fatalf("DeleteUsers: %t, %v", res, err)
+	}
+	if !util.ArrayEquals(a.calls, []string{"RemovePolicies g 201", "RemovePolicies p 201"}) {
+		t.Errorf("Adapter calls: %v", a.calls)
+	}
+	if w.updates != 1 {
+		t.Errorf("Watcher updates: %d, supposed to be 1", w.updates)
+	}
+	testGetRoles(t, e, []string{}, "alice")
+	testGetUsers(t, e, []string{}, "data2_admin")
+	testEnforce(t, e, "alice", "data1", "read", false)
+	testEnforce(t, e, "user5", "data5", "read", false)
+	testEnforce(t, e, "bob", "data2", "write", true)
+
+	res, _ = e.DeleteUsers(users)
+	if res || len(a.calls) != 2 || w.updates != 1 {
+		t.Errorf("DeleteUsers of deleted users: %t, %v, %d updates", res, a.calls, w.updates)
+	}
+
+	res, err = e.DeletePermissionsForUsers([]string{"bob", "data2_admin", "carol"})
+	if !res || err != nil {
+		t.Fatalf("DeletePermissionsForUsers: %t, %v", res, err)
+	}
+	if !util.ArrayEquals(a.calls[2:], []string{"RemovePolicies p 3"}) {
+		t.Errorf("Adapter calls: %v", a.calls)
+	}
+	if w.updates != 2 {
+		t.Errorf("Watcher updates: %d, supposed to be 2", w.updates)
+	}
+	testGetPolicy(t, e, [][]string{})
+}
+
+func TestDeleteUsersAdapterError(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv"), failSec: "p"}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+
+	res, err := e.DeleteUsers([]string{"alice", "bob"})
+	if err == nil {
+		t.Fatal("DeleteUsers should fail when the adapter cannot remove the p rules")
+	}
+	if !res {
+		t.Error("DeleteUsers should report the removed g rules")
+	}
+
+	// The g rules were removed from the storage, the p rules were not.
+	testGetRoles(t, e, []string{}, "alice")
+	testHasPolicy(t, e, []string{"alice", "data1", "read"}, true)
+	testHasPolicy(t, e, []string{"bob", "data2", "write"}, true)
+	if w.updates != 1 {
+		t.Errorf("Watcher updates: %d, supposed to be 1", w.updates)
+	}
+}
+
 func TestRoleAPI_Domains(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
 
@@ -314,6 +579,52 @@ func TestImplicitRoleAPI(t *testing.T) {
 	testGetRoles(t, e, []string{"/book/1/2/3/4/5", "pen_admin"}, "cathy")
 }
 
+func testGetImplicitRolesExcluding(t *testing.T, e *Enforcer, name string, exclude []string, res []string, domain ...string) {
+	t.Helper()
+	myRes, err := e.GetImplicitRolesForUserExcluding(name, exclude, domain...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(res, myRes) {
+		t.Errorf("Implicit roles for %s excluding %v: %v, supposed to be %v", name, exclude, myRes, res)
+	}
+}
+
+func TestImplicitRolesExcluding(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+
+	testGetImplicitRolesExcluding(t, e, "alice", nil, []string{"admin", "data1_admin", "data2_admin"})
+	// excluding the intermediate role prunes the roles below it.
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"admin"}, []string{})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"data1_admin"}, []string{"admin", "data2_admin"})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"data1_admin", "data2_admin"}, []string{"admin"})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"unknown"}, []string{"admin", "data1_admin", "data2_admin"})
+
+	// the roles also reachable through a role that is not excluded are kept.
+	e, _ = NewEnforcer("examples/rbac_model.conf")
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "delegate"},
+		{"alice", "user"},
+		{"delegate", "admin"},
+		{"admin", "auditor"},
+		{"admin", "user"},
+		{"user", "reader"},
+	})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"delegate"}, []string{"user", "reader"})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"user"}, []string{"delegate", "admin", "auditor"})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"admin", "user"}, []string{"delegate"})
+	testGetImplicitRoles(t, e, "alice", []string{"delegate", "user", "admin", "reader", "auditor"})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf")
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "delegate", "domain1"},
+		{"delegate", "admin", "domain1"},
+		{"alice", "admin", "domain2"},
+	})
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"delegate"}, []string{}, "domain1")
+	testGetImplicitRolesExcluding(t, e, "alice", []string{"delegate"}, []string{"admin"}, "domain2")
+}
+
 func testGetImplicitPermissions(t *testing.T, e *Enforcer, name string, res [][]string, domain ...string) {
 	t.Helper()
 	myRes, _ := e.GetImplicitPermissionsForUser(name, domain...)
@@ -344,6 +655,83 @@ func testGetNamedImplicitPermissions(t *testing.T, e *Enforcer, ptype string, na
 	}
 }
 
+func TestExpandActionWildcards(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	_, _ = e.AddPolicy("alice", "data2", "*")
+	actions := []string{"read", "write", "delete"}
+
+	perms := e.ExpandActionWildcards(e.GetPermissionsForUser("alice"), actions)
+	expected := [][]string{{"alice", "data1", "read"}, {"alice", "data2", "read"}, {"alice", "data2", "write"}, {"alice", "data2", "delete"}}
+	if !util.Array2DEquals(expected, perms) {
+		t.Error("Expanded permissions for alice: ", perms, ", supposed to be ", expected)
+	}
+
+	// the rules already granting an action of the wildcard are not duplicated.
+	perms = e.ExpandActionWildcards([][]string{{"bob", "data2", "write"}, {"bob", "data2", "*"}}, actions)
+	expected = [][]string{{"bob", "data2", "write"}, {"bob", "data2", "read"}, {"bob", "data2", "delete"}}
+	if !util.Array2DEquals(expected, perms) {
+		t.Error("Expanded permissions for bob: ", perms, ", supposed to be ", expected)
+	}
+
+	perms = e.ExpandActionWildcards([][]string{{"bob", "data2", "*"}}, nil)
+	if len(perms) != 0 {
+		t.Error("A wildcard expanded against no action should grant nothing, got ", perms)
+	}
+}
+
+func testGetPermittedActions(t *testing.T, e *Enforcer, sub string, obj string, domain []string, res []string) {
+	t.Helper()
+	myRes, err := e.GetPermittedActions(sub, obj, domain...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(myRes, res) {
+		t.Errorf("Permitted actions for %s on %s %v: %v, supposed to be %v", sub, obj, domain, myRes, res)
+	}
+}
+
+func TestGetPermittedActions(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testGetPermittedActions(t, e, "alice", "data1", nil, []string{"read"})
+	testGetPermittedActions(t, e, "alice", "data2", nil, []string{"read", "write"})
+	testGetPermittedActions(t, e, "bob", "data1", nil, []string{})
+
+	// A wildcard action grants every known action but is not an action itself.
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[role_definition]
+g = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && keyMatch(r.obj, p.obj) && (r.act == p.act || p.act == "*")
+`)
+	e, _ = NewEnforcer(m)
+	_, _ = e.AddPolicies([][]string{
+		{"reader", "/doc/*", "read"},
+		{"editor", "/doc/*", "write"},
+		{"editor", "/doc/*", "share"},
+		{"admin", "/*", "*"},
+	})
+	_, _ = e.AddGroupingPolicies([][]string{{"alice", "reader"}, {"bob", "editor"}, {"bob", "reader"}, {"carol", "admin"}})
+	testGetPermittedActions(t, e, "alice", "/doc/1", nil, []string{"read"})
+	testGetPermittedActions(t, e, "bob", "/doc/1", nil, []string{"read", "share", "write"})
+	testGetPermittedActions(t, e, "bob", "/img/1", nil, []string{})
+	testGetPermittedActions(t, e, "carol", "/img/1", nil, []string{"read", "share", "write"})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	testGetPermittedActions(t, e, "alice", "data1", []string{"domain1"}, []string{"read", "write"})
+	testGetPermittedActions(t, e, "alice", "data2", []string{"domain1"}, []string{})
+	testGetPermittedActions(t, e, "bob", "data2", []string{"domain2"}, []string{"read", "write"})
+}
+
 func TestImplicitPermissionAPI(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
 
@@ -374,11 +762,463 @@ func TestImplicitPermissionAPI(t *testing.T) {
 
 }
 
+func testGetPoliciesForSubject(t *testing.T, e *Enforcer, sub string, direct [][]string, inherited [][]string, domain ...string) {
+	t.Helper()
+	policies, err := e.GetPoliciesForSubject(sub, domain...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !util.Array2DEquals(direct, policies.Direct) {
+		t.Errorf("Direct policies for %s: %v, supposed to be %v", sub, policies.Direct, direct)
+	}
+	if !util.Array2DEquals(inherited, policies.Inherited) {
+		t.Errorf("Inherited policies for %s: %v, supposed to be %v", sub, policies.Inherited, inherited)
+	}
+}
+
+func TestGetPoliciesForSubject(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+
+	// alice inherits the rules of data1_admin and data2_admin through admin, which has no rule of its own.
+	testGetPoliciesForSubject(t, e, "alice", [][]string{{"alice", "data1", "read"}}, [][]string{
+		{"data1_admin", "data1", "read"},
+		{"data1_admin", "data1", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	testGetPoliciesForSubject(t, e, "bob", [][]string{{"bob", "data2", "write"}}, [][]string{})
+	testGetPoliciesForSubject(t, e, "admin", [][]string{}, [][]string{
+		{"data1_admin", "data1", "read"},
+		{"data1_admin", "data1", "write"},
+		{"data2_admin", "data2", "read"},
+		{"data2_admin", "data2", "write"},
+	})
+	testGetPoliciesForSubject(t, e, "nobody", [][]string{}, [][]string{})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	_, _ = e.AddPolicy("alice", "domain1", "data3", "read")
+	testGetPoliciesForSubject(t, e, "alice", [][]string{{"alice", "domain1", "data3", "read"}}, [][]string{
+		{"admin", "domain1", "data1", "read"},
+		{"admin", "domain1", "data1", "write"},
+	}, "domain1")
+	testGetPoliciesForSubject(t, e, "alice", [][]string{}, [][]string{}, "domain2")
+}
+
+func TestImplicitPermissionsWithSource(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_with_hierarchy_policy.csv")
+
+	permissions, err := e.GetImplicitPermissionsForUserWithSource("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []PermissionWithSource{
+		{Rule: []string{"alice", "data1", "read"}, Source: PermissionSourceDirect},
+		{Rule: []string{"data1_admin", "data1", "read"}, Source: "data1_admin"},
+		{Rule: []string{"data1_admin", "data1", "write"}, Source: "data1_admin"},
+		{Rule: []string{"data2_admin", "data2", "read"}, Source: "data2_admin"},
+		{Rule: []string{"data2_admin", "data2", "write"}, Source: "data2_admin"},
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("Permissions with source for alice: %v, supposed to be %v", permissions, expected)
+	}
+
+	permissions, _ = e.GetImplicitPermissionsForUserWithSource("bob")
+	if !reflect.DeepEqual(permissions, []PermissionWithSource{{Rule: []string{"bob", "data2", "write"}, Source: PermissionSourceDirect}}) {
+		t.Errorf("Permissions with source for bob: %v", permissions)
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	_, _ = e.AddPolicy("alice", "domain1", "data3", "read")
+	permissions, _ = e.GetImplicitPermissionsForUserWithSource("alice", "domain1")
+	expected = []PermissionWithSource{
+		{Rule: []string{"admin", "domain1", "data1", "read"}, Source: "admin"},
+		{Rule: []string{"admin", "domain1", "data1", "write"}, Source: "admin"},
+		{Rule: []string{"alice", "domain1", "data3", "read"}, Source: PermissionSourceDirect},
+	}
+	if !reflect.DeepEqual(permissions, expected) {
+		t.Errorf("Permissions with source for alice in domain1: %v, supposed to be %v", permissions, expected)
+	}
+}
+
 func TestImplicitPermissionAPIWithDomain(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_hierarchy_with_domains_policy.csv")
 	testGetImplicitPermissionsWithDomain(t, e, "alice", "domain1", [][]string{{"alice", "domain1", "data2", "read"}, {"role:reader", "domain1", "data1", "read"}, {"role:writer", "domain1", "data1", "write"}})
 }
 
+func TestNamedImplicitPermissionsWithGTypes(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+p2 = sub, act
+p3 = act, sub
+
+[role_definition]
+g = _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub) && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	_, _ = e.AddPolicy("admin", "data1", "read")
+	_, _ = e.AddNamedPolicy("p2", "manager", "create")
+	_, _ = e.AddNamedPolicy("p2", "admin", "delete")
+	_, _ = e.AddNamedPolicy("p3", "approve", "manager")
+	_, _ = e.AddGroupingPolicy("alice", "admin")
+	_, _ = e.AddNamedGroupingPolicy("g2", "alice", "manager")
+
+	testNamedImplicitPermissionsWithGTypes := func(ptype string, gtypes []string, res [][]string) {
+		t.Helper()
+		myRes, err := e.GetNamedImplicitPermissionsForUserByGroupings(ptype, gtypes, "alice")
+		if err != nil {
+			t.Error(err)
+		}
+		if !util.Array2DEquals(res, myRes) {
+			t.Error("Named implicit permissions for alice with ", gtypes, ": ", myRes, ", supposed to be ", res)
+		}
+	}
+
+	// The admin role comes from g, so it does not show up when resolving through g2 only.
+	testNamedImplicitPermissionsWithGTypes("p2", []string{"g2"}, [][]string{{"manager", "create"}})
+	testNamedImplicitPermissionsWithGTypes("p2", nil, [][]string{{"admin", "delete"}})
+	testNamedImplicitPermissionsWithGTypes("p2", []string{"g", "g2"}, [][]string{{"manager", "create"}, {"admin", "delete"}})
+	testNamedImplicitPermissionsWithGTypes("p", []string{"g2"}, [][]string{})
+	testNamedImplicitPermissionsWithGTypes("p", nil, [][]string{{"admin", "data1", "read"}})
+	// The subject of p3 is its second field.
+	testNamedImplicitPermissionsWithGTypes("p3", []string{"g2"}, [][]string{{"approve", "manager"}})
+
+	if _, err := e.GetNamedImplicitPermissionsForUserByGroupings("p", []string{"g3"}, "alice"); err == nil {
+		t.Error("GetNamedImplicitPermissionsForUserByGroupings should fail for an undefined role definition")
+	}
+}
+
+// scanImplicitPermissionsForUser asks the role manager about every rule, it is the reference
+// GetNamedImplicitPermissionsForUser is checked against.
+func scanImplicitPermissionsForUser(e *Enforcer, ptype string, user string, domain ...string) [][]string {
+	permission := make([][]string, 0)
+	added := make(map[string]struct{})
+	rm := e.GetRoleManager()
+	domainIndex, _ := e.GetFieldIndex(ptype, constant.DomainIndex)
+	for _, rule := range e.model["p"][ptype].Policy {
+		newRule := deepCopyPolicy(rule)
+		if len(domain) == 0 {
+			if matched, _ := rm.HasLink(user, rule[0]); !matched {
+				continue
+			}
+		} else {
+			if !rm.Match(domain[0], rule[domainIndex]) {
+				continue
+			}
+			if matched, _ := rm.HasLink(user, rule[0], domain[0]); !matched {
+				continue
+			}
+			newRule[domainIndex] = domain[0]
+		}
+		key := strings.Join(newRule, ",")
+		if _, ok := added[key]; !ok {
+			added[key] = struct{}{}
+			permission = append(permission, newRule)
+		}
+	}
+	return permission
+}
+
+// roleLinks returns the direct roles of the names in every role manager of e, keyed by ptype and name.
+func roleLinks(e *Enforcer, names []string) map[string][]string {
+	links := map[string][]string{}
+	for _, ptype := range []string{"g", "g2"} {
+		rm := e.GetNamedRoleManager(ptype)
+		for _, name := range names {
+			roles, _ := rm.GetRoles(name)
+			sort.Strings(roles)
+			links[ptype+":"+name] = roles
+		}
+	}
+	return links
+}
+
+func TestIncrementalRoleLinks(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	names := make([]string, 20)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%d", i)
+	}
+	name := func() string { return names[r.Intn(len(names))] }
+
+	incremental, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf")
+	batched, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf")
+	batched.EnableAutoBuildRoleLinks(false)
+
+	for i := 0; i < 500; i++ {
+		ptype := []string{"g", "g2"}[r.Intn(2)]
+		rules := [][]string{{name(), name()}, {name(), name()}}
+		for _, e := range []*Enforcer{incremental, batched} {
+			switch i % 5 {
+			case 0, 1:
+				_, _ = e.AddNamedGroupingPolicies(ptype, rules)
+			case 2:
+				_, _ = e.RemoveNamedGroupingPolicy(ptype, rules[0])
+			case 3:
+				_, _ = e.RemoveFilteredNamedGroupingPolicy(ptype, 0, rules[0][0])
+			case 4:
+				_, _ = e.UpdateNamedGroupingPolicy(ptype, rules[0], rules[1])
+			}
+		}
+	}
+
+	links := roleLinks(incremental, names)
+	if err := incremental.BuildRoleLinks(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, roleLinks(incremental, names)) {
+		t.Error("The role links built incrementally should be the ones of a full rebuild")
+	}
+
+	// The grouping rule mutations update the role links even with the automatic build disabled.
+	if !reflect.DeepEqual(links, roleLinks(batched, names)) {
+		t.Error("The role links should be updated incrementally while the automatic build is disabled")
+	}
+	if err := batched.RebuildRoleLinks(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(links, roleLinks(batched, names)) {
+		t.Error("RebuildRoleLinks should rebuild the same role links")
+	}
+
+	if err := incremental.BuildIncrementalRoleLinks(model.PolicyAdd, "g3", [][]string{{"a", "b"}}); err == nil {
+		t.Error("BuildIncrementalRoleLinks should fail for an undefined grouping ptype")
+	}
+}
+
+// domainRoleLinks returns the roles and the users of every name in every domain for g, and in no domain for g2.
+func domainRoleLinks(e *Enforcer, names []string, domains []string) map[string][]string {
+	links := map[string][]string{}
+	for _, name := range names {
+		for _, domain := range domains {
+			roles, _ := e.GetNamedRoleManager("g").GetRoles(name, domain)
+			users, _ := e.GetNamedRoleManager("g").GetUsers(name, domain)
+			sort.Strings(roles)
+			sort.Strings(users)
+			links["g:"+domain+":"+name] = append(append(roles, "|"), users...)
+		}
+		roles, _ := e.GetNamedRoleManager("g2").GetRoles(name)
+		sort.Strings(roles)
+		links["g2:"+name] = roles
+	}
+	return links
+}
+
+func TestFilteredGroupingRemovalRoleLinks(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+
+[role_definition]
+g = _, _, _
+g2 = _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && g2(r.obj, p.obj) && r.act == p.act
+`)
+	e, _ := NewEnforcer(m)
+	// the g2 rules carry a field the role definition does not have, rules differing by it share a link.
+	e.AllowExtraFields(true)
+
+	r := rand.New(rand.NewSource(1))
+	names := make([]string, 15)
+	for i := range names {
+		names[i] = fmt.Sprintf("n%d", i)
+	}
+	domains := []string{"d0", "d1", "d2"}
+	name := func() string { return names[r.Intn(len(names))] }
+	domain := func() string { return domains[r.Intn(len(domains))] }
+
+	for round := 0; round < 50; round++ {
+		for i := 0; i < 20; i++ {
+			_, _ = e.AddGroupingPolicy(name(), name(), domain())
+			_, _ = e.AddNamedGroupingPolicy("g2", name(), name(), fmt.Sprint(r.Intn(2)))
+		}
+
+		switch round % 4 {
+		case 0:
+			_, _ = e.RemoveFilteredGroupingPolicy(0, name())
+		case 1:
+			_, _ = e.RemoveFilteredGroupingPolicy(1, name(), domain())
+		case 2:
+			_, _ = e.RemoveFilteredGroupingPolicy(2, domain())
+		case 3:
+			_, _ = e.RemoveFilteredNamedGroupingPolicy("g2", 2, fmt.Sprint(r.Intn(2)))
+		}
+		if round%2 == 0 {
+			_, _ = e.RemoveFilteredNamedGroupingPolicy("g2", 0, name())
+		}
+
+		links := domainRoleLinks(e, names, domains)
+		if err := e.BuildRoleLinks(); err != nil {
+			t.Fatal(err)
+		}
+		if rebuilt := domainRoleLinks(e, names, domains); !reflect.DeepEqual(links, rebuilt) {
+			t.Fatalf("round %d: the role links after the filtered removal differ from a full rebuild", round)
+		}
+	}
+}
+
+func TestImplicitPermissionsMatchScan(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	for i := 1; i < 50; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("role%d", i), fmt.Sprintf("role%d", r.Intn(i)))
+	}
+	for i := 0; i < 20; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("user%d", i), fmt.Sprintf("role%d", r.Intn(50)))
+	}
+	for i := 0; i < 1000; i++ {
+		sub := fmt.Sprintf("role%d", r.Intn(50))
+		if i%5 == 0 {
+			sub = fmt.Sprintf("user%d", r.Intn(20))
+		}
+		_, _ = e.AddPolicy(sub, fmt.Sprintf("data%d", r.Intn(100)), []string{"read", "write"}[r.Intn(2)])
+	}
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user%d", i)
+		myRes, _ := e.GetImplicitPermissionsForUser(user)
+		if res := scanImplicitPermissionsForUser(e, "p", user); !util.Array2DEquals(res, myRes) {
+			t.Errorf("Implicit permissions for %s: %v, supposed to be %v", user, myRes, res)
+		}
+	}
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf")
+	e.AddNamedDomainMatchingFunc("g", "keyMatch", util.KeyMatch)
+	domains := []string{"domain1", "domain2", "domain3", "*"}
+	for i := 1; i < 50; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("role%d", i), fmt.Sprintf("role%d", r.Intn(i)), domains[r.Intn(4)])
+	}
+	for i := 0; i < 20; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("user%d", i), fmt.Sprintf("role%d", r.Intn(50)), domains[r.Intn(4)])
+	}
+	for i := 0; i < 1000; i++ {
+		_, _ = e.AddPolicy(fmt.Sprintf("role%d", r.Intn(50)), domains[r.Intn(4)], fmt.Sprintf("data%d", r.Intn(20)), "read")
+	}
+	for i := 0; i < 20; i++ {
+		user := fmt.Sprintf("user%d", i)
+		for _, domain := range domains[:3] {
+			myRes, _ := e.GetImplicitPermissionsForUser(user, domain)
+			if res := scanImplicitPermissionsForUser(e, "p", user, domain); !util.Array2DEquals(res, myRes) {
+				t.Errorf("Implicit permissions for %s in %s: %v, supposed to be %v", user, domain, myRes, res)
+			}
+		}
+	}
+}
+
+func TestPermissionIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	e.EnablePermissionIndex(true)
+	testGetImplicitPermissionsWithDomain(t, e, "alice", "domain1", [][]string{{"admin", "domain1", "data1", "read"}, {"admin", "domain1", "data1", "write"}})
+
+	// The index follows the policy through all kinds of changes.
+	for i := 1; i < 30; i++ {
+		_, _ = e.AddGroupingPolicy(fmt.Sprintf("role%d", i), fmt.Sprintf("role%d", r.Intn(i)), "domain1")
+	}
+	rule := func() []string {
+		return []string{fmt.Sprintf("role%d", r.Intn(30)), "domain1", fmt.Sprintf("data%d", r.Intn(20)), "read"}
+	}
+	for i := 0; i < 500; i++ {
+		switch i % 6 {
+		case 0, 1:
+			_, _ = e.AddPolicy(rule())
+		case 2:
+			_, _ = e.AddPolicies([][]string{rule(), rule()})
+		case 3:
+			_, _ = e.RemovePolicy(e.GetPolicy()[r.Intn(len(e.GetPolicy()))])
+		case 4:
+			// updating a rule into one of the others would duplicate it
+			if newRule := rule(); !e.HasPolicy(newRule) {
+				_, _ = e.UpdatePolicy(e.GetPolicy()[r.Intn(len(e.GetPolicy()))], newRule)
+			}
+		case 5:
+			if i%30 == 5 {
+				_, _ = e.RemoveFilteredPolicy(0, fmt.Sprintf("role%d", r.Intn(30)))
+			}
+		}
+	}
+	for i := 0; i < 30; i++ {
+		role := fmt.Sprintf("role%d", i)
+		myRes, _ := e.GetImplicitPermissionsForUser(role, "domain1")
+		if res := scanImplicitPermissionsForUser(e, "p", role, "domain1"); !util.Array2DEquals(res, myRes) {
+			t.Errorf("Implicit permissions for %s: %v, supposed to be %v", role, myRes, res)
+		}
+	}
+
+	if err := e.LoadPolicy(); err != nil {
+		t.Fatal(err)
+	}
+	testGetImplicitPermissionsWithDomain(t, e, "alice", "domain1", [][]string{{"admin", "domain1", "data1", "read"}, {"admin", "domain1", "data1", "write"}})
+	e.ClearPolicy()
+	testGetImplicitPermissionsWithDomain(t, e, "alice", "domain1", [][]string{})
+}
+
+func TestEffectivePermissionAPI(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_deny_model.conf", "examples/rbac_with_deny_policy.csv")
+
+	implicit, _ := e.GetImplicitPermissionsForUser("alice")
+	if !util.Array2DEquals(implicit, [][]string{
+		{"alice", "data1", "read", "allow"},
+		{"data2_admin", "data2", "read", "allow"},
+		{"data2_admin", "data2", "write", "allow"},
+		{"alice", "data2", "write", "deny"}}) {
+		t.Errorf("Implicit permissions for alice: %v", implicit)
+	}
+
+	// The deny rule cancels the write permission alice inherits from data2_admin.
+	testGetEffectivePermissions(t, e, "alice", [][]string{
+		{"alice", "data1", "read", "allow"},
+		{"data2_admin", "data2", "read", "allow"}})
+	testGetEffectivePermissions(t, e, "bob", [][]string{{"bob", "data2", "write", "allow"}})
+	testGetEffectivePermissions(t, e, "data2_admin", [][]string{
+		{"data2_admin", "data2", "read", "allow"},
+		{"data2_admin", "data2", "write", "allow"}})
+
+	_, _ = e.RemovePolicy("alice", "data2", "write", "deny")
+	testGetEffectivePermissions(t, e, "alice", [][]string{
+		{"alice", "data1", "read", "allow"},
+		{"data2_admin", "data2", "read", "allow"},
+		{"data2_admin", "data2", "write", "allow"}})
+
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	myRes, _ := e.GetEffectivePermissionsForUser("alice", "domain1")
+	if !util.Array2DEquals(myRes, [][]string{{"admin", "domain1", "data1", "read"}, {"admin", "domain1", "data1", "write"}}) {
+		t.Errorf("Effective permissions for alice in domain1: %v", myRes)
+	}
+}
+
+func testGetEffectivePermissions(t *testing.T, e *Enforcer, name string, res [][]string) {
+	t.Helper()
+	myRes, err := e.GetEffectivePermissionsForUser(name)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !util.Array2DEquals(res, myRes) {
+		t.Error("Effective permissions for ", name, ": ", myRes, ", supposed to be ", res)
+	}
+}
+
 func testGetImplicitUsers(t *testing.T, e *Enforcer, res []string, permission ...string) {
 	t.Helper()
 	myRes, _ := e.GetImplicitUsersForPermission(permission...)
@@ -455,6 +1295,39 @@ func TestGetImplicitResourcesForUser(t *testing.T) {
 	}, "cathy")
 }
 
+func TestGetImplicitResourcesForUserWithObjectHierarchy(t *testing.T) {
+	m, _ := model.NewModelFromFile("examples/rbac_with_resource_roles_model.conf")
+	e, _ := NewEnforcer(m, stringadapter.NewAdapter(strings.Join([]string{
+		"p, alice, /folder, read",
+		"p, editor, /folder/sub, write",
+		"g, bob, editor",
+		"g2, /folder/file, /folder",
+		"g2, /folder/sub, /folder",
+		"g2, /folder/sub/file, /folder/sub",
+	}, "\n")))
+
+	// Access to a folder is access to everything below it, but not to its parent.
+	testEnforce(t, e, "alice", "/folder", "read", true)
+	testEnforce(t, e, "alice", "/folder/file", "read", true)
+	testEnforce(t, e, "alice", "/folder/sub/file", "read", true)
+	testEnforce(t, e, "alice", "/folder/sub/file", "write", false)
+	testEnforce(t, e, "bob", "/folder/sub/file", "write", true)
+	testEnforce(t, e, "bob", "/folder/file", "write", false)
+	testEnforce(t, e, "bob", "/folder", "write", false)
+
+	testGetImplicitResourcesForUser(t, e, [][]string{
+		{"alice", "/folder", "read"},
+		{"alice", "/folder/file", "read"},
+		{"alice", "/folder/sub", "read"},
+		{"alice", "/folder/sub/file", "read"},
+	}, "alice")
+	// The subjects are grouped by g only, the objects by g2 only.
+	testGetImplicitResourcesForUser(t, e, [][]string{
+		{"bob", "/folder/sub", "write"},
+		{"bob", "/folder/sub/file", "write"},
+	}, "bob")
+}
+
 func TestImplicitUsersForRole(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_pattern_model.conf", "examples/rbac_with_pattern_policy.csv")
 
@@ -542,3 +1415,48 @@ func TestCustomizedFieldIndex(t *testing.T) {
 	}
 	testEnforce(t, e, "bob", "data2", "write", false)
 }
+
+func TestDeterministicOutput(t *testing.T) {
+	lines := []string{
+		"p, alice, data1, read",
+		"p, bob, data2, write",
+		"p, data1_admin, data1, read",
+		"p, data1_admin, data1, write",
+		"p, data2_admin, data2, read",
+		"p, data2_admin, data2, write",
+		"g, alice, admin",
+		"g, bob, admin",
+		"g, cathy, admin",
+		"g, admin, data1_admin",
+		"g, admin, data2_admin",
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		r.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+		m, _ := model.NewModelFromFile("examples/rbac_model.conf")
+		e, _ := NewEnforcer(m, stringadapter.NewAdapter(strings.Join(lines, "\n")))
+		e.SetDeterministicOutput(true)
+
+		testSortedList(t, "GetAllSubjects", e.GetAllSubjects(), []string{"alice", "bob", "data1_admin", "data2_admin"})
+		testSortedList(t, "GetAllObjects", e.GetAllObjects(), []string{"data1", "data2"})
+		testSortedList(t, "GetAllActions", e.GetAllActions(), []string{"read", "write"})
+		testSortedList(t, "GetAllRoles", e.GetAllRoles(), []string{"admin", "data1_admin", "data2_admin"})
+
+		roles, _ := e.GetRolesForUser("admin")
+		testSortedList(t, "GetRolesForUser", roles, []string{"data1_admin", "data2_admin"})
+		users, _ := e.GetUsersForRole("admin")
+		testSortedList(t, "GetUsersForRole", users, []string{"alice", "bob", "cathy"})
+		roles, _ = e.GetImplicitRolesForUser("alice")
+		testSortedList(t, "GetImplicitRolesForUser", roles, []string{"admin", "data1_admin", "data2_admin"})
+		users, _ = e.GetImplicitUsersForRole("data1_admin")
+		testSortedList(t, "GetImplicitUsersForRole", users, []string{"admin", "alice", "bob", "cathy"})
+	}
+}
+
+func testSortedList(t *testing.T, title string, res []string, expected []string) {
+	t.Helper()
+	if !util.ArrayEquals(res, expected) {
+		t.Errorf("%s: %v, supposed to be %v", title, res, expected)
+	}
+}
@@ -14,20 +14,42 @@
 
 package casbin
 
-import "github.com/casbin/casbin/v2/constant"
+import (
+	"fmt"
+	"sort"
+	"strings"
 
-// GetUsersForRoleInDomain gets the users that has a role inside a domain. Add by Gordon
+	"github.com/casbin/casbin/v2/constant"
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/util"
+)
+
+// GetUsersForRoleInDomain gets the users that has a role inside a domain, sorted lexicographically. Add by Gordon
 func (e *Enforcer) GetUsersForRoleInDomain(name string, domain string) []string {
 	res, _ := e.model["g"]["g"].RM.GetUsers(name, domain)
+	sort.Strings(res)
 	return res
 }
 
-// GetRolesForUserInDomain gets the roles that a user has inside a domain.
+// GetRolesForUserInDomain gets the roles that a user has inside a domain, sorted lexicographically.
 func (e *Enforcer) GetRolesForUserInDomain(name string, domain string) []string {
 	res, _ := e.model["g"]["g"].RM.GetRoles(name, domain)
+	sort.Strings(res)
 	return res
 }
 
+// GetImplicitUsersForRoleInDomain gets the users that have a role inside a domain directly or through other roles,
+// honoring the domain matching function of "g". Users are returned level by level, each level sorted lexicographically.
+func (e *Enforcer) GetImplicitUsersForRoleInDomain(role string, domain string) ([]string, error) {
+	return e.getImplicitUsersForRoleInRm("g", role, domain)
+}
+
+// GetImplicitRolesForUserInDomain gets the roles that a user has inside a domain directly or through other roles,
+// honoring the domain matching function of "g". Roles are returned level by level, each level sorted lexicographically.
+func (e *Enforcer) GetImplicitRolesForUserInDomain(user string, domain string) ([]string, error) {
+	return e.getImplicitRolesForUserInRm("g", user, nil, domain)
+}
+
 // GetPermissionsForUserInDomain gets permissions for a user or role inside a domain.
 func (e *Enforcer) GetPermissionsForUserInDomain(user string, domain string) [][]string {
 	res, _ := e.GetImplicitPermissionsForUser(user, domain)
@@ -92,6 +114,69 @@ func (e *Enforcer) GetAllUsersByDomain(domain string) []string {
 	return users
 }
 
+// GetAllSubjectsByDomain gets the subjects that show up in the "p" rules of the domain, sorted lexicographically.
+// It returns an *errors.ErrTokenNotFound if the policy definition has no dom token.
+func (e *Enforcer) GetAllSubjectsByDomain(domain string) ([]string, error) {
+	return e.GetAllNamedSubjectsByDomain("p", domain)
+}
+
+// GetAllNamedSubjectsByDomain gets the subjects that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *Enforcer) GetAllNamedSubjectsByDomain(ptype string, domain string) ([]string, error) {
+	return e.getAllNamedValuesByDomain(ptype, constant.SubjectIndex, domain)
+}
+
+// GetAllObjectsByDomain gets the objects that show up in the "p" rules of the domain, sorted lexicographically.
+// It returns an *errors.ErrTokenNotFound if the policy definition has no dom token.
+func (e *Enforcer) GetAllObjectsByDomain(domain string) ([]string, error) {
+	return e.GetAllNamedObjectsByDomain("p", domain)
+}
+
+// GetAllNamedObjectsByDomain gets the objects that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *Enforcer) GetAllNamedObjectsByDomain(ptype string, domain string) ([]string, error) {
+	return e.getAllNamedValuesByDomain(ptype, constant.ObjectIndex, domain)
+}
+
+// GetAllActionsByDomain gets the actions that show up in the "p" rules of the domain, sorted lexicographically.
+// It returns an *errors.ErrTokenNotFound if the policy definition has no dom token.
+func (e *Enforcer) GetAllActionsByDomain(domain string) ([]string, error) {
+	return e.GetAllNamedActionsByDomain("p", domain)
+}
+
+// GetAllNamedActionsByDomain gets the actions that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *Enforcer) GetAllNamedActionsByDomain(ptype string, domain string) ([]string, error) {
+	return e.getAllNamedValuesByDomain(ptype, constant.ActionIndex, domain)
+}
+
+// getAllNamedValuesByDomain gets the distinct values of the field of the ptype rules in the domain, sorted lexicographically.
+func (e *Enforcer) getAllNamedValuesByDomain(ptype string, field string, domain string) ([]string, error) {
+	ast, ok := e.model["p"][ptype]
+	if !ok {
+		return nil, fmt.Errorf("ptype %s is not defined in the policy definition", ptype)
+	}
+	domainIndex, err := e.GetFieldIndex(ptype, constant.DomainIndex)
+	if err != nil {
+		return nil, &Err.ErrTokenNotFound{PType: ptype, Token: constant.DomainIndex}
+	}
+	index, err := e.GetFieldIndex(ptype, field)
+	if err != nil {
+		return nil, &Err.ErrTokenNotFound{PType: ptype, Token: field}
+	}
+
+	values := []string{}
+	seen := make(map[string]struct{})
+	for _, rule := range ast.Policy {
+		if len(rule) <= domainIndex || len(rule) <= index || rule[domainIndex] != domain {
+			continue
+		}
+		if _, ok := seen[rule[index]]; !ok {
+			seen[rule[index]] = struct{}{}
+			values = append(values, rule[index])
+		}
+	}
+	sort.Strings(values)
+	return values, nil
+}
+
 // DeleteAllUsersByDomain would delete all users associated with the domain.
 func (e *Enforcer) DeleteAllUsersByDomain(domain string) (bool, error) {
 	g := e.model["g"]["g"]
@@ -140,7 +225,70 @@ func (e *Enforcer) DeleteDomains(domains ...string) (bool, error) {
 	return true, nil
 }
 
-// GetAllDomains would get all domains.
+// GetAllDomains gets the domains that show up in the policy or grouping rules, sorted lexicographically.
+// It returns an *errors.ErrTokenNotFound if neither the policy definitions nor the role definitions have a domain.
 func (e *Enforcer) GetAllDomains() ([]string, error) {
-	return e.model["g"]["g"].RM.GetAllDomains()
+	hasDomain := false
+	seen := make(map[string]struct{})
+	addDomains := func(rules [][]string, index int) {
+		hasDomain = true
+		for _, rule := range rules {
+			if len(rule) > index {
+				seen[rule[index]] = struct{}{}
+			}
+		}
+	}
+
+	for ptype, ast := range e.model["p"] {
+		if index, err := e.GetFieldIndex(ptype, constant.DomainIndex); err == nil {
+			addDomains(ast.Policy, index)
+		}
+	}
+	for _, ast := range e.model["g"] {
+		// g = _, _, _ has the domain as its third field.
+		if strings.Count(ast.Value, "_") >= 3 {
+			addDomains(ast.Policy, 2)
+		}
+	}
+	if !hasDomain {
+		return nil, &Err.ErrTokenNotFound{PType: "p", Token: constant.DomainIndex}
+	}
+
+	domains := make([]string, 0, len(seen))
+	for domain := range seen {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+// GetImplicitRolesForUserWithDomain gets the implicit roles of a user in every domain the user has roles in,
+// as {role, domain} pairs sorted by domain. The domain is "" for the roles of a model without domains.
+func (e *Enforcer) GetImplicitRolesForUserWithDomain(user string) ([][2]string, error) {
+	domains, err := e.GetDomainsForUser(user)
+	if err != nil {
+		return nil, err
+	}
+
+	res := [][2]string{}
+	seen := make(map[[2]string]bool)
+	for _, domain := range util.RemoveDuplicateElement(domains) {
+		var roles []string
+		if domain == "" {
+			roles, err = e.GetImplicitRolesForUser(user)
+		} else {
+			roles, err = e.GetImplicitRolesForUser(user, domain)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, role := range roles {
+			pair := [2]string{role, domain}
+			if !seen[pair] {
+				seen[pair] = true
+				res = append(res, pair)
+			}
+		}
+	}
+	return res, nil
 }
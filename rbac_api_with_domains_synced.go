@@ -28,6 +28,20 @@ func (e *SyncedEnforcer) GetRolesForUserInDomain(name string, domain string) []s
 	return e.Enforcer.GetRolesForUserInDomain(name, domain)
 }
 
+// GetImplicitUsersForRoleInDomain gets the users that have a role inside a domain directly or through other roles.
+func (e *SyncedEnforcer) GetImplicitUsersForRoleInDomain(role string, domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitUsersForRoleInDomain(role, domain)
+}
+
+// GetImplicitRolesForUserInDomain gets the roles that a user has inside a domain directly or through other roles.
+func (e *SyncedEnforcer) GetImplicitRolesForUserInDomain(user string, domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetImplicitRolesForUserInDomain(user, domain)
+}
+
 // GetPermissionsForUserInDomain gets permissions for a user or role inside a domain.
 func (e *SyncedEnforcer) GetPermissionsForUserInDomain(user string, domain string) [][]string {
 	e.m.RLock()
@@ -58,3 +72,53 @@ func (e *SyncedEnforcer) DeleteRolesForUserInDomain(user string, domain string)
 	defer e.m.Unlock()
 	return e.Enforcer.DeleteRolesForUserInDomain(user, domain)
 }
+
+// GetAllSubjectsByDomain gets the subjects that show up in the "p" rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllSubjectsByDomain(domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllSubjectsByDomain(domain)
+}
+
+// GetAllNamedSubjectsByDomain gets the subjects that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllNamedSubjectsByDomain(ptype string, domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllNamedSubjectsByDomain(ptype, domain)
+}
+
+// GetAllObjectsByDomain gets the objects that show up in the "p" rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllObjectsByDomain(domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllObjectsByDomain(domain)
+}
+
+// GetAllNamedObjectsByDomain gets the objects that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllNamedObjectsByDomain(ptype string, domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllNamedObjectsByDomain(ptype, domain)
+}
+
+// GetAllActionsByDomain gets the actions that show up in the "p" rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllActionsByDomain(domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllActionsByDomain(domain)
+}
+
+// GetAllNamedActionsByDomain gets the actions that show up in the named policy rules of the domain, sorted lexicographically.
+func (e *SyncedEnforcer) GetAllNamedActionsByDomain(ptype string, domain string) ([]string, error) {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return e.Enforcer.GetAllNamedActionsByDomain(ptype, domain)
+}
+
+// ScopedToDomain returns a view of the enforcer scoped to the domain, whose calls are synchronized like the ones
+// of the enforcer, see Enforcer.ScopedToDomain.
+func (e *SyncedEnforcer) ScopedToDomain(domain string) *DomainView {
+	e.m.RLock()
+	defer e.m.RUnlock()
+	return newDomainView(e, e.model, domain)
+}
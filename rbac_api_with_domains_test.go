@@ -15,9 +15,13 @@
 package casbin
 
 import (
+	"errors"
+	"reflect"
 	"sort"
 	"testing"
 
+	Err "github.com/casbin/casbin/v2/errors"
+	"github.com/casbin/casbin/v2/model"
 	"github.com/casbin/casbin/v2/util"
 )
 
@@ -266,4 +270,144 @@ func TestGetAllDomains(t *testing.T) {
 	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
 
 	testGetAllDomains(t, e, []string{"domain1", "domain2"})
+
+	// The domains of the policy and grouping rules.
+	e, _ = NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy2.csv")
+	testGetAllDomains(t, e, []string{"domain1", "domain2", "domain3"})
+	_, _ = e.AddPolicy("admin", "domain4", "data4", "read")
+	_, _ = e.AddGroupingPolicy("carol", "admin", "domain5")
+	testGetAllDomains(t, e, []string{"domain1", "domain2", "domain3", "domain4", "domain5"})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	var notFound *Err.ErrTokenNotFound
+	if _, err := e.GetAllDomains(); !errors.As(err, &notFound) {
+		t.Errorf("GetAllDomains without domains: %v, supposed to be ErrTokenNotFound", err)
+	}
+}
+
+func testGetImplicitRolesForUserWithDomain(t *testing.T, e *Enforcer, user string, res [][2]string) {
+	t.Helper()
+	myRes, err := e.GetImplicitRolesForUserWithDomain(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("implicit roles with domain for %s: %v, supposed to be %v", user, myRes, res)
+	}
+}
+
+func TestGetImplicitRolesForUserWithDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy.csv")
+	testGetImplicitRolesForUserWithDomain(t, e, "alice", [][2]string{{"admin", "domain1"}})
+
+	// The same role name in two domains gives a pair for each.
+	_, _ = e.AddRoleForUserInDomain("alice", "admin", "domain2")
+	_, _ = e.AddRoleForUserInDomain("admin", "member", "domain2")
+	testGetImplicitRolesForUserWithDomain(t, e, "alice", [][2]string{{"admin", "domain1"}, {"admin", "domain2"}, {"member", "domain2"}})
+	testGetImplicitRolesForUserWithDomain(t, e, "bob", [][2]string{{"admin", "domain2"}, {"member", "domain2"}})
+	testGetImplicitRolesForUserWithDomain(t, e, "eve", [][2]string{})
+
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	testGetImplicitRolesForUserWithDomain(t, e, "alice", [][2]string{{"data2_admin", ""}})
+}
+
+func testGetImplicitInDomain(t *testing.T, name string, get func(name string, domain string) ([]string, error), node string, domain string, res []string) {
+	t.Helper()
+	myRes, err := get(node, domain)
+	if err != nil {
+		t.Fatalf("%s(%s, %s): %v", name, node, domain, err)
+	}
+	if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("%s(%s, %s): %v, supposed to be %v", name, node, domain, myRes, res)
+	}
+}
+
+func TestImplicitInDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domain_pattern_model.conf")
+	e.AddNamedDomainMatchingFunc("g", "KeyMatch", util.KeyMatch)
+	_, _ = e.AddGroupingPolicies([][]string{
+		{"alice", "admin", "*"},
+		{"bob", "admin", "tenant-9"},
+		{"carol", "bob", "tenant-9"},
+		{"admin", "reader", "*"},
+		{"admin", "writer", "tenant-9"},
+		{"dave", "reader", "tenant-1"},
+		// a cycle must not loop forever nor return the queried node.
+		{"writer", "admin", "tenant-9"},
+	})
+
+	users := e.GetImplicitUsersForRoleInDomain
+	testGetImplicitInDomain(t, "GetImplicitUsersForRoleInDomain", users, "admin", "tenant-9", []string{"alice", "bob", "writer", "carol"})
+	testGetImplicitInDomain(t, "GetImplicitUsersForRoleInDomain", users, "admin", "tenant-1", []string{"alice"})
+	testGetImplicitInDomain(t, "GetImplicitUsersForRoleInDomain", users, "reader", "tenant-9", []string{"admin", "alice", "bob", "writer", "carol"})
+	testGetImplicitInDomain(t, "GetImplicitUsersForRoleInDomain", users, "reader", "tenant-1", []string{"admin", "dave", "alice"})
+	testGetImplicitInDomain(t, "GetImplicitUsersForRoleInDomain", users, "nobody", "tenant-9", []string{})
+
+	roles := e.GetImplicitRolesForUserInDomain
+	testGetImplicitInDomain(t, "GetImplicitRolesForUserInDomain", roles, "alice", "tenant-9", []string{"admin", "reader", "writer"})
+	testGetImplicitInDomain(t, "GetImplicitRolesForUserInDomain", roles, "alice", "tenant-1", []string{"admin", "reader"})
+	testGetImplicitInDomain(t, "GetImplicitRolesForUserInDomain", roles, "carol", "tenant-9", []string{"bob", "admin", "reader", "writer"})
+	testGetImplicitInDomain(t, "GetImplicitRolesForUserInDomain", roles, "carol", "tenant-1", []string{})
+	testGetImplicitInDomain(t, "GetImplicitRolesForUserInDomain", roles, "writer", "tenant-9", []string{"admin", "reader"})
+}
+
+func testGetAllByDomain(t *testing.T, name string, get func(ptype string, domain string) ([]string, error), ptype string, domain string, res []string) {
+	t.Helper()
+	myRes, err := get(ptype, domain)
+	if err != nil {
+		t.Errorf("%s(%s, %s): %v", name, ptype, domain, err)
+	} else if !reflect.DeepEqual(myRes, res) {
+		t.Errorf("%s(%s, %s): %v, supposed to be %v", name, ptype, domain, myRes, res)
+	}
+}
+
+func TestGetAllByDomain(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_with_domains_model.conf", "examples/rbac_with_domains_policy2.csv")
+
+	testGetAllByDomain(t, "GetAllNamedSubjectsByDomain", e.GetAllNamedSubjectsByDomain, "p", "domain2", []string{"admin"})
+	testGetAllByDomain(t, "GetAllNamedSubjectsByDomain", e.GetAllNamedSubjectsByDomain, "p", "domain3", []string{"user"})
+	testGetAllByDomain(t, "GetAllNamedObjectsByDomain", e.GetAllNamedObjectsByDomain, "p", "domain1", []string{"data1"})
+	testGetAllByDomain(t, "GetAllNamedObjectsByDomain", e.GetAllNamedObjectsByDomain, "p", "domain3", []string{"data2"})
+	testGetAllByDomain(t, "GetAllNamedActionsByDomain", e.GetAllNamedActionsByDomain, "p", "domain2", []string{"read", "write"})
+	testGetAllByDomain(t, "GetAllNamedActionsByDomain", e.GetAllNamedActionsByDomain, "p", "domain3", []string{"read"})
+	testGetAllByDomain(t, "GetAllNamedObjectsByDomain", e.GetAllNamedObjectsByDomain, "p", "domain4", []string{})
+	if objects, _ := e.GetAllObjectsByDomain("domain2"); !reflect.DeepEqual(objects, []string{"data2"}) {
+		t.Errorf("GetAllObjectsByDomain(domain2): %v, supposed to be [data2]", objects)
+	}
+
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, dom, obj, act
+
+[policy_definition]
+p = sub, dom, obj, act
+p2 = dom, act, obj, sub
+
+[role_definition]
+g = _, _, _
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = g(r.sub, p.sub, r.dom) && r.dom == p.dom && r.obj == p.obj && r.act == p.act
+`)
+	e, _ = NewEnforcer(m)
+	_, _ = e.AddPolicy("admin", "tenant1", "data1", "read")
+	_, _ = e.AddNamedPolicies("p2", [][]string{
+		{"tenant1", "write", "data2", "bob"},
+		{"tenant1", "read", "data1", "alice"},
+		{"tenant2", "read", "data3", "alice"},
+	})
+	testGetAllByDomain(t, "GetAllNamedSubjectsByDomain", e.GetAllNamedSubjectsByDomain, "p2", "tenant1", []string{"alice", "bob"})
+	testGetAllByDomain(t, "GetAllNamedObjectsByDomain", e.GetAllNamedObjectsByDomain, "p2", "tenant1", []string{"data1", "data2"})
+	testGetAllByDomain(t, "GetAllNamedActionsByDomain", e.GetAllNamedActionsByDomain, "p2", "tenant2", []string{"read"})
+	testGetAllByDomain(t, "GetAllNamedObjectsByDomain", e.GetAllNamedObjectsByDomain, "p", "tenant1", []string{"data1"})
+
+	// A model without domains has no dom token.
+	e, _ = NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	var notFound *Err.ErrTokenNotFound
+	if _, err := e.GetAllObjectsByDomain("domain1"); !errors.As(err, &notFound) || notFound.Token != "dom" {
+		t.Errorf("GetAllObjectsByDomain without domains: %v, supposed to be ErrTokenNotFound for dom", err)
+	}
 }
@@ -179,3 +179,77 @@ func BenchmarkHasLinkWithPatternAndDomainPatternLarge(b *testing.B) {
 		_, _ = rm.HasLink("staffUser1001", "staff001", "/orgs/1/sites/site001")
 	}
 }
+
+// importGroupingPolicies adds 10000 g2 rules by batches of 1000, with the role links built incrementally
+// or rebuilt from scratch after every batch.
+func importGroupingPolicies(b *testing.B, rebuild bool) {
+	for i := 0; i < b.N; i++ {
+		e, _ := NewEnforcer("examples/rbac_with_resource_roles_model.conf")
+		for batch := 0; batch < 10; batch++ {
+			rules := make([][]string, 1000)
+			for j := range rules {
+				rules[j] = []string{fmt.Sprintf("data%d", batch*1000+j), fmt.Sprintf("group%d", j%100)}
+			}
+			if _, err := e.AddNamedGroupingPolicies("g2", rules); err != nil {
+				b.Fatal(err)
+			}
+			if rebuild {
+				if err := e.BuildRoleLinks(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkImportGroupingPoliciesIncremental(b *testing.B) {
+	importGroupingPolicies(b, false)
+}
+
+func BenchmarkImportGroupingPoliciesFullRebuild(b *testing.B) {
+	importGroupingPolicies(b, true)
+}
+
+// removeFilteredGroupingPolicy removes the 100 members of a group out of 10000 g rules, with the role links
+// updated incrementally or rebuilt from scratch after the removal. The members are added back outside the timer.
+func removeFilteredGroupingPolicy(b *testing.B, rebuild bool) {
+	e, _ := NewEnforcer("examples/rbac_model.conf")
+	rules := make([][]string, 10000)
+	for j := range rules {
+		rules[j] = []string{fmt.Sprintf("user%d", j), fmt.Sprintf("group%d", j%100)}
+	}
+	if _, err := e.AddGroupingPolicies(rules); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		group := fmt.Sprintf("group%d", i%100)
+		if _, err := e.RemoveFilteredGroupingPolicy(1, group); err != nil {
+			b.Fatal(err)
+		}
+		if rebuild {
+			if err := e.BuildRoleLinks(); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		b.StopTimer()
+		members := make([][]string, 0, 100)
+		for j := i % 100; j < len(rules); j += 100 {
+			members = append(members, rules[j])
+		}
+		if _, err := e.AddGroupingPolicies(members); err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+	}
+}
+
+func BenchmarkRemoveFilteredGroupingPolicyIncremental(b *testing.B) {
+	removeFilteredGroupingPolicy(b, false)
+}
+
+func BenchmarkRemoveFilteredGroupingPolicyFullRebuild(b *testing.B) {
+	removeFilteredGroupingPolicy(b, true)
+}
@@ -0,0 +1,160 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+)
+
+// RuleUsage is a policy rule with the number of times it matched, see GetNamedPolicyWithUsage.
+type RuleUsage struct {
+	Rule []string
+	// Count is the number of enforcements the rule matched in since the usage was last reset.
+	Count uint64
+	// LastMatched is the time of the last enforcement the rule matched in, zero if there was none.
+	LastMatched time.Time
+}
+
+// EnableRuleUsageTracking controls whether the enforcements count the matches of every policy rule,
+// see GetRuleUsage. The rules are told apart by their content, not their position, so the counts survive
+// the rules being removed, added or loaded again. Disabling it keeps the counts until ResetRuleUsage.
+func (e *Enforcer) EnableRuleUsageTracking(enable bool) {
+	if enable && e.ruleUsage == nil {
+		e.ruleUsage = &ruleUsageTracker{}
+	}
+	e.trackRuleUsage = enable
+}
+
+// GetRuleUsage returns the number of times the rules matched since the usage was last reset, keyed by the ptype
+// and the rule joined by ", ", e.g. "p, alice, data1, read". The rules that did not match are left out.
+func (e *Enforcer) GetRuleUsage() map[string]uint64 {
+	usage := map[string]uint64{}
+	if e.ruleUsage == nil {
+		return usage
+	}
+	e.ruleUsage.counters.Range(func(key, value interface{}) bool {
+		if count := atomic.LoadUint64(&value.(*ruleCounter).count); count != 0 {
+			usage[key.(string)] = count
+		}
+		return true
+	})
+	return usage
+}
+
+// ResetRuleUsage sets the number of times the rules matched back to zero.
+func (e *Enforcer) ResetRuleUsage() {
+	if e.ruleUsage == nil {
+		return
+	}
+	e.ruleUsage.counters.Range(func(_, value interface{}) bool {
+		counter := value.(*ruleCounter)
+		atomic.StoreUint64(&counter.count, 0)
+		atomic.StoreInt64(&counter.lastMatched, 0)
+		return true
+	})
+}
+
+// GetPolicyWithUsage returns the "p" rules with their usage, see GetNamedPolicyWithUsage.
+func (e *Enforcer) GetPolicyWithUsage() []RuleUsage {
+	return e.GetNamedPolicyWithUsage("p")
+}
+
+// GetNamedPolicyWithUsage returns the rules of the ptype with the number of times they matched and when they last did,
+// in the order of GetNamedPolicy. For example the rules that did not match in the last day are the ones
+// whose LastMatched is before time.Now().Add(-24 * time.Hour).
+func (e *Enforcer) GetNamedPolicyWithUsage(ptype string) []RuleUsage {
+	policy := e.model.GetPolicy("p", ptype)
+	res := make([]RuleUsage, len(policy))
+	for i, rule := range policy {
+		res[i].Rule = rule
+		if e.ruleUsage == nil {
+			continue
+		}
+		if value, ok := e.ruleUsage.counters.Load(ruleUsageKey(ptype, rule)); ok {
+			counter := value.(*ruleCounter)
+			res[i].Count = atomic.LoadUint64(&counter.count)
+			if lastMatched := atomic.LoadInt64(&counter.lastMatched); lastMatched != 0 {
+				res[i].LastMatched = time.Unix(0, lastMatched)
+			}
+		}
+	}
+	return res
+}
+
+// ruleUsageTracker holds the counters of the rules, keyed by ruleUsageKey.
+type ruleUsageTracker struct {
+	counters sync.Map
+	// index holds the *ruleUsageIndex of the current policy, mu serializes building it.
+	index atomic.Value
+	mu    sync.Mutex
+}
+
+// ruleUsageIndex holds the counters of the rules of the ptypes in the order of the policy of a generation,
+// so that an enforcement finds the counter of a rule by its position.
+type ruleUsageIndex struct {
+	generation uint64
+	ptypes     map[string][]*ruleCounter
+}
+
+type ruleCounter struct {
+	count uint64
+	// lastMatched is in nanoseconds since the Unix epoch.
+	lastMatched int64
+}
+
+func (c *ruleCounter) matched() {
+	atomic.AddUint64(&c.count, 1)
+	atomic.StoreInt64(&c.lastMatched, time.Now().UnixNano())
+}
+
+func ruleUsageKey(ptype string, rule []string) string {
+	return ptype + ", " + strings.Join(rule, ", ")
+}
+
+// countersFor returns the counters of the rules of the ptype in the order of the policy, which is of the generation.
+func (t *ruleUsageTracker) countersFor(m model.Model, generation uint64, ptype string) []*ruleCounter {
+	policy := m["p"][ptype].Policy
+	if index, ok := t.index.Load().(*ruleUsageIndex); ok && index.generation == generation {
+		if counters, ok := index.ptypes[ptype]; ok && len(counters) == len(policy) {
+			return counters
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ptypes := map[string][]*ruleCounter{}
+	if index, ok := t.index.Load().(*ruleUsageIndex); ok && index.generation == generation {
+		if counters, ok := index.ptypes[ptype]; ok && len(counters) == len(policy) {
+			return counters
+		}
+		for key, counters := range index.ptypes {
+			ptypes[key] = counters
+		}
+	}
+
+	counters := make([]*ruleCounter, len(policy))
+	for i, rule := range policy {
+		counter, _ := t.counters.LoadOrStore(ruleUsageKey(ptype, rule), &ruleCounter{})
+		counters[i] = counter.(*ruleCounter)
+	}
+	ptypes[ptype] = counters
+	t.index.Store(&ruleUsageIndex{generation: generation, ptypes: ptypes})
+	return counters
+}
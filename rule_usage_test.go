@@ -0,0 +1,118 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/casbin/casbin/v2/model"
+	stringadapter "github.com/casbin/casbin/v2/persist/string-adapter"
+)
+
+func testRuleUsage(t *testing.T, e *Enforcer, res map[string]uint64) {
+	t.Helper()
+	if usage := e.GetRuleUsage(); !reflect.DeepEqual(usage, res) {
+		t.Errorf("rule usage: %v, supposed to be %v", usage, res)
+	}
+}
+
+func TestRuleUsage(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	enforce := func(n int, rvals ...interface{}) {
+		for i := 0; i < n; i++ {
+			_, _ = e.Enforce(rvals...)
+		}
+	}
+
+	// Nothing is counted until the tracking is enabled.
+	enforce(1, "alice", "data1", "read")
+	testRuleUsage(t, e, map[string]uint64{})
+
+	e.EnableRuleUsageTracking(true)
+	enforce(3, "alice", "data1", "read")
+	enforce(2, "bob", "data2", "write")
+	enforce(1, "alice", "data2", "write")
+	enforce(2, "bob", "data1", "read")
+	testRuleUsage(t, e, map[string]uint64{
+		"p, alice, data1, read":        3,
+		"p, bob, data2, write":         2,
+		"p, data2_admin, data2, write": 1,
+	})
+
+	usage := e.GetPolicyWithUsage()
+	counts := make([]uint64, len(usage))
+	for i, rule := range usage {
+		counts[i] = rule.Count
+		if rule.LastMatched.IsZero() != (rule.Count == 0) {
+			t.Errorf("%v matched %d times, last at %v", rule.Rule, rule.Count, rule.LastMatched)
+		}
+	}
+	if !reflect.DeepEqual(counts, []uint64{3, 2, 0, 1}) {
+		t.Errorf("counts of the policy: %v, supposed to be [3 2 0 1]", counts)
+	}
+
+	// The counts follow the rules when their position changes, and when the policy is loaded again.
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	enforce(1, "bob", "data2", "write")
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	enforce(1, "alice", "data1", "read")
+	_ = e.LoadPolicy()
+	enforce(1, "alice", "data1", "read")
+	enforce(1, "data2_admin", "data2", "read")
+	testRuleUsage(t, e, map[string]uint64{
+		"p, alice, data1, read":        5,
+		"p, bob, data2, write":         3,
+		"p, data2_admin, data2, read":  1,
+		"p, data2_admin, data2, write": 1,
+	})
+
+	e.ResetRuleUsage()
+	testRuleUsage(t, e, map[string]uint64{})
+	for _, rule := range e.GetPolicyWithUsage() {
+		if rule.Count != 0 || !rule.LastMatched.IsZero() {
+			t.Errorf("%v matched %d times, last at %v after the reset", rule.Rule, rule.Count, rule.LastMatched)
+		}
+	}
+
+	e.EnableRuleUsageTracking(false)
+	enforce(1, "alice", "data1", "read")
+	testRuleUsage(t, e, map[string]uint64{})
+}
+
+func TestRuleUsageSkippedEffect(t *testing.T) {
+	m, _ := model.NewModelFromString(`
+[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act, eft
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && r.obj == p.obj && r.act == p.act
+`)
+	e, _ := NewEnforcer(m, stringadapter.NewAdapter("p, alice, data1, read, deny\np, alice, data1, read, allow"))
+	e.EnableRuleUsageTracking(true)
+
+	// The deny rule cannot change the decision under allow-override, it is still counted when it matches.
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testRuleUsage(t, e, map[string]uint64{
+		"p, alice, data1, read, deny":  1,
+		"p, alice, data1, read, allow": 1,
+	})
+}
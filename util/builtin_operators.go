@@ -15,21 +15,25 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"hash/fnv"
 	"net"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Knetic/govaluate"
 	"github.com/casbin/casbin/v2/rbac"
 )
 
 var (
-	keyMatch4Re *regexp.Regexp = regexp.MustCompile(`{([^/]+)}`)
+	// keyMatch4Re matches the {param} tokens, non-greedy so that "{a}_{b}" is two tokens.
+	keyMatch4Re *regexp.Regexp = regexp.MustCompile(`{([^/]+?)}`)
 
 	memorizedMapShards = 120
 )
@@ -127,6 +131,69 @@ func KeyMatch2Func(args ...interface{}) (interface{}, error) {
 	return bool(KeyMatch2(name1, name2)), nil
 }
 
+// NormalizePath collapses the duplicate slashes of a path, removes its "." segments and its trailing slash,
+// except for the root "/". A path with a ".." segment is rejected, false is returned for it.
+// Percent-encoded characters are not decoded: the path should be decoded before it is normalized.
+func NormalizePath(p string) (string, bool) {
+	segments := strings.Split(p, "/")
+	kept := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", false
+		}
+		kept = append(kept, segment)
+	}
+
+	normalized := strings.Join(kept, "/")
+	if strings.HasPrefix(p, "/") {
+		normalized = "/" + normalized
+	}
+	return normalized, true
+}
+
+// KeyMatchNormalized is KeyMatch of the paths normalized by NormalizePath,
+// so that "/foo//bar/" and "/foo/./bar" match the pattern of "/foo/bar". A path with a ".." segment never matches.
+func KeyMatchNormalized(key1 string, key2 string) bool {
+	key1, ok1 := NormalizePath(key1)
+	key2, ok2 := NormalizePath(key2)
+	return ok1 && ok2 && KeyMatch(key1, key2)
+}
+
+// KeyMatchNormalizedFunc is the wrapper for KeyMatchNormalized.
+func KeyMatchNormalizedFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "keyMatchNormalized", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(KeyMatchNormalized(name1, name2)), nil
+}
+
+// KeyMatch2Normalized is KeyMatch2 of the paths normalized by NormalizePath,
+// so that "/foo//bar/" and "/foo/./bar" match the pattern of "/foo/bar". A path with a ".." segment never matches.
+func KeyMatch2Normalized(key1 string, key2 string) bool {
+	key1, ok1 := NormalizePath(key1)
+	key2, ok2 := NormalizePath(key2)
+	return ok1 && ok2 && KeyMatch2(key1, key2)
+}
+
+// KeyMatch2NormalizedFunc is the wrapper for KeyMatch2Normalized.
+func KeyMatch2NormalizedFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "keyMatch2Normalized", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(KeyMatch2Normalized(name1, name2)), nil
+}
+
 // KeyGet2 returns value matched pattern
 // For example, "/resource1" matches "/:resource"
 // if the pathVar == "resource", then "resource1" will be returned
@@ -227,6 +294,8 @@ func KeyGet3Func(args ...interface{}) (interface{}, error) {
 // "/parent/123/child/123" matches "/parent/{id}/child/{id}"
 // "/parent/123/child/456" does not match "/parent/{id}/child/{id}"
 // But KeyMatch3 will match both.
+// Like in KeyMatch3, the rest of key2 is a regular expression and "/*" matches anything, even nothing,
+// see KeyMatch4Strict for stricter semantics.
 func KeyMatch4(key1 string, key2 string) bool {
 	key2 = strings.Replace(key2, "/*", "/.*", -1)
 
@@ -235,7 +304,8 @@ func KeyMatch4(key1 string, key2 string) bool {
 	re := keyMatch4Re
 	key2 = re.ReplaceAllStringFunc(key2, func(s string) string {
 		tokens = append(tokens, s[1:len(s)-1])
-		return "([^/]+)"
+		// the groups are named so that the groups of key2 itself are told apart.
+		return fmt.Sprintf("(?P<keyMatch4_%d>[^/]+)", len(tokens)-1)
 	})
 
 	re = regexp.MustCompile("^" + key2 + "$")
@@ -243,19 +313,18 @@ func KeyMatch4(key1 string, key2 string) bool {
 	if matches == nil {
 		return false
 	}
-	matches = matches[1:]
-
-	if len(tokens) != len(matches) {
-		panic(errors.New("KeyMatch4: number of tokens is not equal to number of values"))
-	}
 
 	values := map[string]string{}
-
-	for key, token := range tokens {
+	for i, name := range re.SubexpNames() {
+		if !strings.HasPrefix(name, "keyMatch4_") {
+			continue
+		}
+		index, _ := strconv.Atoi(name[len("keyMatch4_"):])
+		token := tokens[index]
 		if _, ok := values[token]; !ok {
-			values[token] = matches[key]
+			values[token] = matches[i]
 		}
-		if values[token] != matches[key] {
+		if values[token] != matches[i] {
 			return false
 		}
 	}
@@ -263,6 +332,71 @@ func KeyMatch4(key1 string, key2 string) bool {
 	return true
 }
 
+// KeyMatch4Strict determines whether key1 matches the pattern of key2 like KeyMatch4, with these semantics:
+//
+//   - a {param} matches a non-empty text without "/", it can be part of a segment like in "/proj_{name}",
+//     and all the occurrences of a param must match the same text, e.g. "/orgs/1/projects/2" does not match
+//     "/orgs/{id}/projects/{id}";
+//   - a segment of key2 that is a * matches one non-empty segment, or one or more non-empty segments if it is
+//     the last one, e.g. "/files/*" matches "/files/a" and "/files/a/b" but neither "/files/" nor "/files".
+//     The text it matches is never bound to a param;
+//   - a key1 with an empty segment, like "/a//b", never matches;
+//   - everything else in key2 is matched literally, not as a regular expression.
+func KeyMatch4Strict(key1 string, key2 string) bool {
+	if strings.Contains(key1, "//") {
+		return false
+	}
+
+	var tokens []string
+	segments := strings.Split(key2, "/")
+	for i, segment := range segments {
+		if segment == "*" {
+			if i == len(segments)-1 {
+				segments[i] = "[^/]+(?:/[^/]+)*"
+			} else {
+				segments[i] = "[^/]+"
+			}
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, loc := range keyMatch4Re.FindAllStringSubmatchIndex(segment, -1) {
+			b.WriteString(regexp.QuoteMeta(segment[last:loc[0]]))
+			b.WriteString("([^/]+?)")
+			tokens = append(tokens, segment[loc[2]:loc[3]])
+			last = loc[1]
+		}
+		b.WriteString(regexp.QuoteMeta(segment[last:]))
+		segments[i] = b.String()
+	}
+
+	matches := regexp.MustCompile("^" + strings.Join(segments, "/") + "$").FindStringSubmatch(key1)
+	if matches == nil {
+		return false
+	}
+
+	values := map[string]string{}
+	for i, token := range tokens {
+		if value, ok := values[token]; ok && value != matches[i+1] {
+			return false
+		}
+		values[token] = matches[i+1]
+	}
+	return true
+}
+
+// KeyMatch4StrictFunc is the wrapper for KeyMatch4Strict.
+func KeyMatch4StrictFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "keyMatch4Strict", err)
+	}
+
+	name1 := args[0].(string)
+	name2 := args[1].(string)
+
+	return bool(KeyMatch4Strict(name1, name2)), nil
+}
+
 // KeyMatch4Func is the wrapper for KeyMatch4.
 func KeyMatch4Func(args ...interface{}) (interface{}, error) {
 	if err := validateVariadicArgs(2, args...); err != nil {
@@ -275,7 +409,7 @@ func KeyMatch4Func(args ...interface{}) (interface{}, error) {
 	return bool(KeyMatch4(name1, name2)), nil
 }
 
-// KeyMatch determines whether key1 matches the pattern of key2 and ignores the parameters in key2.
+// KeyMatch5 determines whether key1 matches key2 and ignores the query parameters of key1.
 // For example, "/foo/bar?status=1&type=2" matches "/foo/bar"
 func KeyMatch5(key1 string, key2 string) bool {
 	i := strings.Index(key1, "?")
@@ -369,14 +503,170 @@ func GlobMatchFunc(args ...interface{}) (interface{}, error) {
 	return GlobMatch(name1, name2)
 }
 
+// In determines whether value is one of list, it is false for an empty list.
+func In(value string, list ...string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// InFunc is the wrapper for In. It is not a built-in function of the matchers, where "in" is the operator
+// of the same meaning, e.g. "r.sub in ('alice', 'bob')".
+func InFunc(args ...interface{}) (interface{}, error) {
+	value, list, err := membershipArgs(args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", "in", err)
+	}
+
+	return In(value, list...), nil
+}
+
+// NotIn determines whether value is not one of list, it is true for an empty list.
+func NotIn(value string, list ...string) bool {
+	return !In(value, list...)
+}
+
+// NotInFunc is the wrapper for NotIn.
+func NotInFunc(args ...interface{}) (interface{}, error) {
+	value, list, err := membershipArgs(args...)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", "notIn", err)
+	}
+
+	return NotIn(value, list...), nil
+}
+
+// membershipArgs splits the arguments of in and notIn into the value and the list.
+func membershipArgs(args ...interface{}) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, errors.New("Expected at least 1 argument, but got 0")
+	}
+
+	values := make([]string, len(args))
+	for i, arg := range args {
+		value, ok := arg.(string)
+		if !ok {
+			return "", nil, errors.New("Argument must be a string")
+		}
+		values[i] = value
+	}
+	return values[0], values[1:], nil
+}
+
+// parseTimes parses the RFC 3339 timestamps, it returns false if one of them is malformed.
+func parseTimes(values ...string) ([]time.Time, bool) {
+	times := make([]time.Time, len(values))
+	for i, value := range values {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, false
+		}
+		times[i] = t
+	}
+	return times, true
+}
+
+// TimeAfter determines whether the RFC 3339 timestamp t is after ref, e.g. "2024-01-02T00:00:00Z" is after
+// "2024-01-01T00:00:00Z". It is false if one of them is malformed.
+func TimeAfter(t string, ref string) bool {
+	times, ok := parseTimes(t, ref)
+	return ok && times[0].After(times[1])
+}
+
+// TimeAfterFunc is the wrapper for TimeAfter.
+func TimeAfterFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "timeAfter", err)
+	}
+
+	return TimeAfter(args[0].(string), args[1].(string)), nil
+}
+
+// TimeBefore determines whether the RFC 3339 timestamp t is before ref. It is false if one of them is malformed.
+func TimeBefore(t string, ref string) bool {
+	times, ok := parseTimes(t, ref)
+	return ok && times[0].Before(times[1])
+}
+
+// TimeBeforeFunc is the wrapper for TimeBefore.
+func TimeBeforeFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(2, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "timeBefore", err)
+	}
+
+	return TimeBefore(args[0].(string), args[1].(string)), nil
+}
+
+// TimeBetween determines whether the RFC 3339 timestamp t is in the window from start, included, to end, excluded,
+// e.g. r.time in business hours with timeBetween(r.time, p.start, p.end). It is false if one of them is malformed.
+func TimeBetween(t string, start string, end string) bool {
+	times, ok := parseTimes(t, start, end)
+	return ok && !times[0].Before(times[1]) && times[0].Before(times[2])
+}
+
+// TimeBetweenFunc is the wrapper for TimeBetween.
+func TimeBetweenFunc(args ...interface{}) (interface{}, error) {
+	if err := validateVariadicArgs(3, args...); err != nil {
+		return false, fmt.Errorf("%s: %s", "timeBetween", err)
+	}
+
+	return TimeBetween(args[0].(string), args[1].(string), args[2].(string)), nil
+}
+
 // GenerateGFunction is the factory method of the g(_, _[, _]) function.
 func GenerateGFunction(rm rbac.RoleManager) govaluate.ExpressionFunction {
+	var g func(ctx context.Context, args ...interface{}) (interface{}, error)
+	if rm == nil {
+		g = generateGFunction(nil)
+	} else {
+		g = generateGFunction(func(_ context.Context, name1 string, name2 string, domain ...string) (bool, error) {
+			v, _ := rm.HasLink(name1, name2, domain...)
+			return v, nil
+		})
+	}
+	return func(args ...interface{}) (interface{}, error) {
+		return g(nil, args...)
+	}
+}
+
+// GenerateGFunctionCtx is the factory method of the g(_, _[, _]) function calling the HasLinkCtx of rm with ctx,
+// the function fails with the error of HasLinkCtx, e.g. ctx.Err().
+func GenerateGFunctionCtx(ctx context.Context, rm rbac.ContextRoleManager) govaluate.ExpressionFunction {
+	g := generateGFunction(rm.HasLinkCtx)
+	return func(args ...interface{}) (interface{}, error) {
+		return g(ctx, args...)
+	}
+}
+
+// GenerateContextGFunction is the factory method of the g(ctx, _, _[, _]) function, whose first argument is
+// the context the HasLinkCtx of rm is called with, so that one function serves the calls of different contexts.
+// The function fails with the error of HasLinkCtx, e.g. ctx.Err().
+func GenerateContextGFunction(rm rbac.ContextRoleManager) govaluate.ExpressionFunction {
+	g := generateGFunction(rm.HasLinkCtx)
+	return func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, errors.New("g: the context argument is missing")
+		}
+		ctx, ok := args[0].(context.Context)
+		if !ok {
+			ctx = context.Background()
+		}
+		return g(ctx, args[1:]...)
+	}
+}
+
+// generateGFunction returns the g(_, _[, _]) function memorizing the results of hasLink, which is given
+// the context the function is called with. Names are only equal to themselves if hasLink is nil.
+func generateGFunction(hasLink func(ctx context.Context, name1 string, name2 string, domain ...string) (bool, error)) func(ctx context.Context, args ...interface{}) (interface{}, error) {
 	memorized := []sync.Map{}
 	for i := 0; i < memorizedMapShards; i++ {
 		memorized = append(memorized, sync.Map{})
 	}
 
-	return func(args ...interface{}) (interface{}, error) {
+	return func(ctx context.Context, args ...interface{}) (interface{}, error) {
 		// Like all our other govaluate functions, all args are strings.
 
 		// Allocate and generate a cache key from the arguments...
@@ -409,13 +699,18 @@ func GenerateGFunction(rm rbac.RoleManager) govaluate.ExpressionFunction {
 		// If not, do the calculation.
 		// There are guaranteed to be exactly 2 or 3 arguments.
 		name1, name2 := args[0].(string), args[1].(string)
-		if rm == nil {
+		if hasLink == nil {
 			v = name1 == name2
-		} else if len(args) == 2 {
-			v, _ = rm.HasLink(name1, name2)
 		} else {
-			domain := args[2].(string)
-			v, _ = rm.HasLink(name1, name2, domain)
+			var domain []string
+			if len(args) > 2 {
+				domain = []string{args[2].(string)}
+			}
+			ok, err := hasLink(ctx, name1, name2, domain...)
+			if err != nil {
+				return nil, err
+			}
+			v = ok
 		}
 
 		memorized[shadId].Store(key, v)
@@ -116,6 +116,78 @@ func TestKeyMatch2(t *testing.T) {
 	testKeyMatch2(t, "/alice/all", "/:/all", false)
 }
 
+func testNormalizePath(t *testing.T, path string, res string, ok bool) {
+	t.Helper()
+	myRes, myOk := NormalizePath(path)
+	t.Logf(`%s: "%s", %t`, path, myRes, myOk)
+
+	if myRes != res || myOk != ok {
+		t.Errorf(`%s: "%s", %t, supposed to be "%s", %t`, path, myRes, myOk, res, ok)
+	}
+}
+
+func TestNormalizePath(t *testing.T) {
+	testNormalizePath(t, "/", "/", true)
+	testNormalizePath(t, "", "", true)
+	testNormalizePath(t, "/foo/bar", "/foo/bar", true)
+	testNormalizePath(t, "/foo/bar/", "/foo/bar", true)
+	testNormalizePath(t, "/foo//bar", "/foo/bar", true)
+	testNormalizePath(t, "//foo///bar//", "/foo/bar", true)
+	testNormalizePath(t, "/foo/./bar/.", "/foo/bar", true)
+	testNormalizePath(t, "foo/bar/", "foo/bar", true)
+	testNormalizePath(t, "//", "/", true)
+	testNormalizePath(t, "/foo/%2e%2e/bar", "/foo/%2e%2e/bar", true)
+	testNormalizePath(t, "/foo/../bar", "", false)
+	testNormalizePath(t, "/..", "", false)
+	testNormalizePath(t, "/foo/..", "", false)
+	testNormalizePath(t, "/foo/..bar", "/foo/..bar", true)
+}
+
+func testKeyMatchNormalized(t *testing.T, key1 string, key2 string, res bool) {
+	t.Helper()
+	myRes := KeyMatchNormalized(key1, key2)
+	t.Logf("%s < %s: %t", key1, key2, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", key1, key2, !res, res)
+	}
+}
+
+func TestKeyMatchNormalized(t *testing.T) {
+	testKeyMatchNormalized(t, "/foo", "/foo", true)
+	testKeyMatchNormalized(t, "/foo/", "/foo", true)
+	testKeyMatchNormalized(t, "/foo//bar", "/foo/bar", true)
+	testKeyMatchNormalized(t, "/foo/./bar/", "/foo/bar", true)
+	testKeyMatchNormalized(t, "/foo/bar", "/foo/*", true)
+	testKeyMatchNormalized(t, "//foo/bar", "/foo/*", true)
+	testKeyMatchNormalized(t, "/foobar", "/foo/*", false)
+	testKeyMatchNormalized(t, "/foo/../bar", "/bar", false)
+	testKeyMatchNormalized(t, "/foo/../bar", "/foo/*", false)
+}
+
+func testKeyMatch2Normalized(t *testing.T, key1 string, key2 string, res bool) {
+	t.Helper()
+	myRes := KeyMatch2Normalized(key1, key2)
+	t.Logf("%s < %s: %t", key1, key2, myRes)
+
+	if myRes != res {
+		t.Errorf("%s < %s: %t, supposed to be %t", key1, key2, !res, res)
+	}
+}
+
+func TestKeyMatch2Normalized(t *testing.T) {
+	testKeyMatch2Normalized(t, "/api/users", "/api/users", true)
+	testKeyMatch2Normalized(t, "/api/users/", "/api/users", true)
+	testKeyMatch2Normalized(t, "/api//users", "/api/users", true)
+	testKeyMatch2Normalized(t, "/api/./users", "/api/users", true)
+	testKeyMatch2Normalized(t, "/api/userss", "/api/users", false)
+	testKeyMatch2Normalized(t, "/", "/", true)
+	testKeyMatch2Normalized(t, "/", "/:resource", false)
+	testKeyMatch2Normalized(t, "/api/users//1/", "/api/users/:id", true)
+	testKeyMatch2Normalized(t, "/api/users/1/../2", "/api/users/:id", false)
+	testKeyMatch2Normalized(t, "/api/users/..", "/api/*", false)
+}
+
 func testKeyGet2(t *testing.T, key1 string, key2 string, pathVar string, res string) {
 	t.Helper()
 	myRes := KeyGet2(key1, key2, pathVar)
@@ -270,6 +342,60 @@ func TestKeyMatch4(t *testing.T) {
 	testKeyMatch4(t, "/parent/123/child/456", "/parent/{id}/child/{id}/book/{id}", false)
 
 	testKeyMatch4(t, "/parent/123/child/123", "/parent/{i/d}/child/{i/d}", false)
+
+	// several params in a segment are distinct params.
+	testKeyMatch4(t, "/proj/a_b/a", "/proj/{x}_{y}/{x}", true)
+	testKeyMatch4(t, "/proj/a_b/b", "/proj/{x}_{y}/{x}", false)
+	// the groups of the pattern itself do not shift the params.
+	testKeyMatch4(t, "/parent/123/child/123", "/(parent|root)/{id}/child/{id}", true)
+	testKeyMatch4(t, "/parent/123/child/456", "/(parent|root)/{id}/child/{id}", false)
+}
+
+func TestKeyMatch4Strict(t *testing.T) {
+	tests := []struct {
+		key1 string
+		key2 string
+		res  bool
+	}{
+		{"/orgs/1/projects/1", "/orgs/{id}/projects/{id}", true},
+		{"/orgs/1/projects/2", "/orgs/{id}/projects/{id}", false},
+		{"/orgs/1/projects/2", "/orgs/{id}/projects/{pid}", true},
+		// a param repeated three times.
+		{"/a/1/b/1/c/1", "/a/{id}/b/{id}/c/{id}", true},
+		{"/a/1/b/1/c/2", "/a/{id}/b/{id}/c/{id}", false},
+		{"/a/2/b/1/c/1", "/a/{id}/b/{id}/c/{id}", false},
+		// params never match empty segments, and a key with an empty segment never matches.
+		{"/orgs//projects/", "/orgs/{id}/projects/{id}", false},
+		{"/orgs/1/projects/", "/orgs/{id}/projects/{pid}", false},
+		{"/files//a", "/files/*", false},
+		{"//", "/{id}/", false},
+		// a trailing * matches one or more segments, and is never bound to a param.
+		{"/files/a", "/files/*", true},
+		{"/files/a/b", "/files/*", true},
+		{"/files/", "/files/*", false},
+		{"/files", "/files/*", false},
+		{"/orgs/1/projects/1/tasks", "/orgs/{id}/projects/{id}/*", true},
+		{"/orgs/1/projects/2/tasks", "/orgs/{id}/projects/{id}/*", false},
+		{"/orgs/1/projects/1", "/orgs/{id}/projects/{id}/*", false},
+		{"/orgs/1/2/1", "/orgs/{id}/*", true},
+		// a * elsewhere matches one segment.
+		{"/orgs/1/x/1", "/orgs/{id}/*/{id}", true},
+		{"/orgs/1/x/y/1", "/orgs/{id}/*/{id}", false},
+		// params inside segments.
+		{"/proj/proj_a_admin/a", "/proj/proj_{name}_admin/{name}", true},
+		{"/proj/proj_a_admin/b", "/proj/proj_{name}_admin/{name}", false},
+		// the rest of the pattern is literal.
+		{"/a.b/1", "/a.b/{id}", true},
+		{"/axb/1", "/a.b/{id}", false},
+		{"/parent/1", "/(parent|root)/{id}", false},
+		{"/(parent|root)/1", "/(parent|root)/{id}", true},
+		{"/parent/1/child/1", "/parent/{i/d}/child/{i/d}", false},
+	}
+	for _, test := range tests {
+		if res := KeyMatch4Strict(test.key1, test.key2); res != test.res {
+			t.Errorf("%s < %s: %t, supposed to be %t", test.key1, test.key2, res, test.res)
+		}
+	}
 }
 
 func testRegexMatch(t *testing.T, key1 string, key2 string, res bool) {
@@ -543,3 +669,88 @@ func TestGlobMatch(t *testing.T) {
 	testGlobMatch(t, "/prefix/subprefix/foobar", "*/foo*", false)
 	testGlobMatch(t, "/prefix/subprefix/foobar", "*/foo/*", false)
 }
+
+func testMembershipFunc(t *testing.T, f func(args ...interface{}) (interface{}, error), res bool, err string, args ...interface{}) {
+	t.Helper()
+	myRes, myErr := f(args...)
+	myErrStr := ""
+
+	if myErr != nil {
+		myErrStr = myErr.Error()
+	}
+
+	if myRes != res || err != myErrStr {
+		t.Errorf("%v returns %v %v, supposed to be %v %v", args, myRes, myErr, res, err)
+	}
+}
+
+func TestInFunc(t *testing.T) {
+	testMembershipFunc(t, InFunc, false, "in: Expected at least 1 argument, but got 0")
+	testMembershipFunc(t, InFunc, false, "in: Argument must be a string", "alice", 1)
+	testMembershipFunc(t, InFunc, false, "", "alice")
+	testMembershipFunc(t, InFunc, true, "", "alice", "alice")
+	testMembershipFunc(t, InFunc, true, "", "alice", "bob", "alice", "alice")
+	testMembershipFunc(t, InFunc, false, "", "alice", "bob", "bob")
+}
+
+func TestNotInFunc(t *testing.T) {
+	testMembershipFunc(t, NotInFunc, false, "notIn: Expected at least 1 argument, but got 0")
+	testMembershipFunc(t, NotInFunc, false, "notIn: Argument must be a string", "alice", "bob", false)
+	testMembershipFunc(t, NotInFunc, true, "", "alice")
+	testMembershipFunc(t, NotInFunc, false, "", "alice", "alice")
+	testMembershipFunc(t, NotInFunc, false, "", "alice", "bob", "alice", "alice")
+	testMembershipFunc(t, NotInFunc, true, "", "alice", "bob", "bob")
+}
+
+func TestTimeComparison(t *testing.T) {
+	const (
+		start = "2024-01-01T09:00:00Z"
+		end   = "2024-01-01T17:00:00Z"
+	)
+	testCases := []struct {
+		t             string
+		after, before bool
+		between       bool
+	}{
+		{"2024-01-01T08:59:59Z", false, true, false},
+		{"2024-01-01T09:00:00Z", false, false, true},
+		{"2024-01-01T12:00:00Z", true, false, true},
+		// the time zone is taken into account.
+		{"2024-01-01T13:00:00+02:00", true, false, true},
+		{"2024-01-01T17:00:00Z", true, false, false},
+		{"2024-01-02T00:00:00Z", true, false, false},
+		// malformed timestamps.
+		{"2024-01-01 12:00:00", false, false, false},
+		{"", false, false, false},
+		{"noon", false, false, false},
+	}
+	for _, tc := range testCases {
+		if res := TimeAfter(tc.t, start); res != tc.after {
+			t.Errorf("TimeAfter(%q, %q): %t, supposed to be %t", tc.t, start, res, tc.after)
+		}
+		if res := TimeBefore(tc.t, start); res != tc.before {
+			t.Errorf("TimeBefore(%q, %q): %t, supposed to be %t", tc.t, start, res, tc.before)
+		}
+		if res := TimeBetween(tc.t, start, end); res != tc.between {
+			t.Errorf("TimeBetween(%q, %q, %q): %t, supposed to be %t", tc.t, start, end, res, tc.between)
+		}
+	}
+
+	// a malformed reference or window is never matched.
+	if TimeAfter("2024-01-01T12:00:00Z", "yesterday") || TimeBefore("2024-01-01T12:00:00Z", "tomorrow") {
+		t.Error("a malformed reference should not be matched")
+	}
+	if TimeBetween("2024-01-01T12:00:00Z", start, "17:00") {
+		t.Error("a malformed window should not be matched")
+	}
+
+	if _, err := TimeBetweenFunc("2024-01-01T12:00:00Z", start); err == nil || err.Error() != "timeBetween: Expected 3 arguments, but got 2" {
+		t.Errorf("TimeBetweenFunc error: %v", err)
+	}
+	if _, err := TimeAfterFunc("2024-01-01T12:00:00Z", 1); err == nil || err.Error() != "timeAfter: Argument must be a string" {
+		t.Errorf("TimeAfterFunc error: %v", err)
+	}
+	if res, err := TimeBeforeFunc(start, end); res != true || err != nil {
+		t.Errorf("TimeBeforeFunc: %v, %v, supposed to be true", res, err)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/Knetic/govaluate"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// WrapFunction wraps an arbitrary Go func, e.g. func(string, string) bool or func(string, ...string) (bool, error),
+// into a govaluate.ExpressionFunction that checks the arguments before calling it.
+// Supported arguments are strings, bools, numbers, interfaces, structs and pointers to structs, the last one may be variadic.
+// Supported results are a bool, string, number or interface, optionally followed by an error.
+// Numbers are passed from and returned to the matcher as float64, integer arguments must be whole numbers.
+func WrapFunction(name string, fn interface{}) (govaluate.ExpressionFunction, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return nil, fmt.Errorf("%s: %T is not a function", name, fn)
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumIn(); i++ {
+		in := t.In(i)
+		if t.IsVariadic() && i == t.NumIn()-1 {
+			in = in.Elem()
+		}
+		if !isSupportedArgument(in) {
+			return nil, fmt.Errorf("%s: argument %d has unsupported type %s", name, i, in)
+		}
+	}
+
+	switch {
+	case t.NumOut() == 1:
+	case t.NumOut() == 2 && t.Out(1) == errorType:
+	default:
+		return nil, fmt.Errorf("%s: must return a single value, optionally followed by an error", name)
+	}
+	if !isSupportedResult(t.Out(0)) {
+		return nil, fmt.Errorf("%s: result has unsupported type %s", name, t.Out(0))
+	}
+
+	return func(args ...interface{}) (interface{}, error) {
+		in, err := convertArguments(t, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+
+		out := v.Call(in)
+		if len(out) == 2 && !out[1].IsNil() {
+			return nil, out[1].Interface().(error)
+		}
+		return convertResult(out[0]), nil
+	}, nil
+}
+
+func isSupportedArgument(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Interface, reflect.Struct:
+		return true
+	case reflect.Ptr:
+		return t.Elem().Kind() == reflect.Struct
+	default:
+		return isNumber(t)
+	}
+}
+
+func isSupportedResult(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Interface:
+		return true
+	default:
+		return isNumber(t)
+	}
+}
+
+func isNumber(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func convertArguments(t reflect.Type, args []interface{}) ([]reflect.Value, error) {
+	if t.IsVariadic() {
+		if len(args) < t.NumIn()-1 {
+			return nil, fmt.Errorf("Expected at least %d arguments, but got %d", t.NumIn()-1, len(args))
+		}
+	} else if len(args) != t.NumIn() {
+		return nil, fmt.Errorf("Expected %d arguments, but got %d", t.NumIn(), len(args))
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var argType reflect.Type
+		if t.IsVariadic() && i >= t.NumIn()-1 {
+			argType = t.In(t.NumIn() - 1).Elem()
+		} else {
+			argType = t.In(i)
+		}
+
+		value, ok := convertArgument(argType, arg)
+		if !ok {
+			return nil, fmt.Errorf("argument %d must be %s, but got %T", i, argType, arg)
+		}
+		in[i] = value
+	}
+	return in, nil
+}
+
+func convertArgument(t reflect.Type, arg interface{}) (reflect.Value, bool) {
+	if arg == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			return reflect.Zero(t), true
+		default:
+			return reflect.Value{}, false
+		}
+	}
+
+	v := reflect.ValueOf(arg)
+	if v.Type().AssignableTo(t) {
+		return v, true
+	}
+	if (t.Kind() == reflect.String || t.Kind() == reflect.Bool) && v.Kind() == t.Kind() {
+		return v.Convert(t), true
+	}
+	if !isNumber(t) || !isNumber(v.Type()) {
+		return reflect.Value{}, false
+	}
+
+	// the matcher passes all numbers as float64
+	f := v.Convert(reflect.TypeOf(float64(0))).Float()
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if f != math.Trunc(f) || f < 0 {
+			return reflect.Value{}, false
+		}
+	default:
+		if f != math.Trunc(f) {
+			return reflect.Value{}, false
+		}
+	}
+	return v.Convert(t), true
+}
+
+func convertResult(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String:
+		return v.String()
+	case reflect.Interface:
+		return v.Interface()
+	default:
+		return v.Convert(reflect.TypeOf(float64(0))).Float()
+	}
+}
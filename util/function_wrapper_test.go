@@ -0,0 +1,107 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testWrappedFunction(t *testing.T, name string, fn interface{}, args []interface{}, res interface{}) {
+	t.Helper()
+	function, err := WrapFunction(name, fn)
+	if err != nil {
+		t.Fatalf("WrapFunction(%s): %v", name, err)
+	}
+	myRes, err := function(args...)
+	if err != nil {
+		t.Errorf("%s%v: %v", name, args, err)
+	} else if myRes != res {
+		t.Errorf("%s%v: %v (%T), supposed to be %v (%T)", name, args, myRes, myRes, res, res)
+	}
+}
+
+func testWrappedFunctionError(t *testing.T, name string, fn interface{}, args []interface{}, res string) {
+	t.Helper()
+	function, err := WrapFunction(name, fn)
+	if err != nil {
+		t.Fatalf("WrapFunction(%s): %v", name, err)
+	}
+	if _, err := function(args...); err == nil || err.Error() != res {
+		t.Errorf("%s%v error: %v, supposed to be %s", name, args, err, res)
+	}
+}
+
+type role string
+
+type user struct {
+	Name string
+}
+
+func TestWrapFunction(t *testing.T) {
+	testWrappedFunction(t, "prefix", strings.HasPrefix, []interface{}{"/data1", "/data"}, true)
+	testWrappedFunction(t, "prefixWithError", func(s, prefix string) (bool, error) {
+		return strings.HasPrefix(s, prefix), nil
+	}, []interface{}{"/data1", "/foo"}, false)
+	testWrappedFunction(t, "upper", strings.ToUpper, []interface{}{"alice"}, "ALICE")
+	testWrappedFunction(t, "isRole", func(r role) bool { return r == "admin" }, []interface{}{"admin"}, true)
+	testWrappedFunction(t, "isAdult", func(u user, age int) bool { return u.Name != "" && age >= 18 }, []interface{}{user{"alice"}, float64(30)}, true)
+	testWrappedFunction(t, "isAlice", func(u *user) bool { return u != nil && u.Name == "alice" }, []interface{}{&user{"alice"}}, true)
+	testWrappedFunction(t, "isNil", func(v interface{}) bool { return v == nil }, []interface{}{nil}, true)
+	// Numbers are returned as float64.
+	testWrappedFunction(t, "count", func(s ...string) int { return len(s) }, []interface{}{"a", "b", "c"}, float64(3))
+	testWrappedFunction(t, "count", func(s ...string) int { return len(s) }, []interface{}{}, float64(0))
+	testWrappedFunction(t, "in", func(s string, set ...string) bool {
+		for _, v := range set {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	}, []interface{}{"b", "a", "b"}, true)
+	testWrappedFunction(t, "half", func(f float32) float32 { return f / 2 }, []interface{}{float64(3)}, float64(1.5))
+
+	testWrappedFunctionError(t, "prefix", strings.HasPrefix, []interface{}{"/data1"}, "prefix: Expected 2 arguments, but got 1")
+	testWrappedFunctionError(t, "prefix", strings.HasPrefix, []interface{}{"/data1", float64(1)}, "prefix: argument 1 must be string, but got float64")
+	testWrappedFunctionError(t, "in", func(s string, set ...string) bool { return false }, []interface{}{}, "in: Expected at least 1 arguments, but got 0")
+	testWrappedFunctionError(t, "in", func(s string, set ...string) bool { return false }, []interface{}{"a", "b", true}, "in: argument 2 must be string, but got bool")
+	testWrappedFunctionError(t, "isAdult", func(age int) bool { return age >= 18 }, []interface{}{float64(17.5)}, "isAdult: argument 0 must be int, but got float64")
+	testWrappedFunctionError(t, "positive", func(n uint) bool { return n > 0 }, []interface{}{float64(-1)}, "positive: argument 0 must be uint, but got float64")
+	testWrappedFunctionError(t, "upper", strings.ToUpper, []interface{}{nil}, "upper: argument 0 must be string, but got <nil>")
+	testWrappedFunctionError(t, "fail", func() (bool, error) { return false, errors.New("fail") }, nil, "fail")
+}
+
+func TestWrapFunctionUnsupported(t *testing.T) {
+	var nilFunc func() bool
+	for name, fn := range map[string]interface{}{
+		"notFunc":      "abc",
+		"nilFunc":      nilFunc,
+		"nil":          nil,
+		"noResult":     func(string) {},
+		"twoResults":   func(string) (bool, bool) { return false, false },
+		"noError":      func(string) (bool, string) { return false, "" },
+		"mapResult":    func(string) map[string]bool { return nil },
+		"sliceArg":     func([]string) bool { return false },
+		"mapArg":       func(map[string]string) bool { return false },
+		"funcArg":      func(func()) bool { return false },
+		"chanVariadic": func(...chan int) bool { return false },
+		"intPtrArg":    func(*int) bool { return false },
+	} {
+		if _, err := WrapFunction(name, fn); err == nil {
+			t.Errorf("WrapFunction(%s) should fail", name)
+		}
+	}
+}
@@ -42,6 +42,86 @@ func RemoveComments(s string) string {
 	return strings.TrimSpace(s[0:pos])
 }
 
+// SplitConjunction splits the expression at its top-level && operators, the ones that are neither
+// inside parentheses nor inside a string literal. Parentheses enclosing a whole clause are removed first,
+// so "(a && b) && c" gives "a", "b" and "c", while "(a || b) && c" gives "a || b" and "c".
+// An expression with a top-level || is not a conjunction and is returned whole, since || binds
+// less tightly than &&: "a && b || c" is "(a && b) || c".
+func SplitConjunction(s string) []string {
+	s = strings.TrimSpace(s)
+	for hasEnclosingParentheses(s) {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+
+	var ands []int
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == '|' && depth == 0 && i+1 < len(s) && s[i+1] == '|':
+			return []string{s}
+		case c == '&' && depth == 0 && i+1 < len(s) && s[i+1] == '&':
+			ands = append(ands, i)
+			i++
+		}
+	}
+	if len(ands) == 0 {
+		return []string{s}
+	}
+
+	var clauses []string
+	start := 0
+	for _, i := range ands {
+		clauses = append(clauses, SplitConjunction(s[start:i])...)
+		start = i + 2
+	}
+	return append(clauses, SplitConjunction(s[start:])...)
+}
+
+// hasEnclosingParentheses reports whether s starts with a parenthesis that is closed at its very end.
+func hasEnclosingParentheses(s string) bool {
+	if len(s) < 2 || s[0] != '(' || s[len(s)-1] != ')' {
+		return false
+	}
+
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i == len(s)-1
+			}
+		}
+	}
+	return false
+}
+
 // ArrayEquals determines whether two string arrays are identical.
 func ArrayEquals(a []string, b []string) bool {
 	if len(a) != len(b) {
@@ -190,6 +270,24 @@ func HasEval(s string) bool {
 	return evalReg.MatchString(s)
 }
 
+var functionCallReg = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+var stringLiteralReg = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+
+// GetFunctionCalls returns the names of the functions called by the expression, in order of first call,
+// e.g. ["keyMatch", "regexMatch"] for "keyMatch(r_obj, p_obj) && regexMatch(r_act, p_act)".
+// The "in" operator and calls within string literals are not function calls.
+func GetFunctionCalls(s string) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, match := range functionCallReg.FindAllStringSubmatch(stringLiteralReg.ReplaceAllString(s, "''"), -1) {
+		if name := match[1]; name != "in" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 // ReplaceEval replace function eval with the value of its parameters
 func ReplaceEval(s string, rule string) string {
 	return evalReg.ReplaceAllString(s, "("+rule+")")
@@ -233,6 +331,36 @@ func RemoveDuplicateElement(s []string) []string {
 	return result
 }
 
+// EditDistance returns the Levenshtein distance of a and b, the number of single character insertions,
+// deletions and substitutions needed to turn a into b.
+func EditDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
 type node struct {
 	key   interface{}
 	value interface{}
@@ -302,6 +430,7 @@ func (cache *LRUCache) Put(key interface{}, value interface{}) {
 	n, ok := cache.m[key]
 	if ok {
 		cache.remove(n, false)
+		n.value = value
 	} else {
 		n = &node{key, value, nil, nil}
 		if len(cache.m) >= cache.capacity {
@@ -311,6 +440,16 @@ func (cache *LRUCache) Put(key interface{}, value interface{}) {
 	cache.add(n, false)
 }
 
+// PeekOldest returns the key of the entry the next Put of a new key would evict, without marking it as used.
+// The entries are ordered by their last Get or Put, so the entries that were never read again are evicted
+// in the order they were put.
+func (cache *LRUCache) PeekOldest() (key interface{}, ok bool) {
+	if cache.tail.prev == cache.head {
+		return nil, false
+	}
+	return cache.tail.prev.key, true
+}
+
 type SyncLRUCache struct {
 	rwm sync.RWMutex
 	*LRUCache
@@ -322,9 +461,10 @@ func NewSyncLRUCache(capacity int) *SyncLRUCache {
 	return cache
 }
 
+// Get takes the write lock, because it moves the entry to the front of the eviction order.
 func (cache *SyncLRUCache) Get(key interface{}) (value interface{}, ok bool) {
-	cache.rwm.RLock()
-	defer cache.rwm.RUnlock()
+	cache.rwm.Lock()
+	defer cache.rwm.Unlock()
 	return cache.LRUCache.Get(key)
 }
 
@@ -333,3 +473,9 @@ func (cache *SyncLRUCache) Put(key interface{}, value interface{}) {
 	defer cache.rwm.Unlock()
 	cache.LRUCache.Put(key, value)
 }
+
+func (cache *SyncLRUCache) PeekOldest() (key interface{}, ok bool) {
+	cache.rwm.RLock()
+	defer cache.rwm.RUnlock()
+	return cache.LRUCache.PeekOldest()
+}
@@ -67,6 +67,34 @@ func TestRemoveComments(t *testing.T) {
 	testRemoveComments(t, "r.act == p.act", "r.act == p.act")
 }
 
+func testSplitConjunction(t *testing.T, s string, res []string) {
+	t.Helper()
+	myRes := SplitConjunction(s)
+	t.Logf("%s: %q", s, myRes)
+
+	if !ArrayEquals(myRes, res) {
+		t.Errorf("%s: %q, supposed to be %q", s, myRes, res)
+	}
+}
+
+func TestSplitConjunction(t *testing.T) {
+	testSplitConjunction(t, "r_sub == p_sub", []string{"r_sub == p_sub"})
+	testSplitConjunction(t, "r_sub == p_sub && keyMatch(r_obj, p_obj) && r_act == p_act",
+		[]string{"r_sub == p_sub", "keyMatch(r_obj, p_obj)", "r_act == p_act"})
+	testSplitConjunction(t, "(r_sub == p_sub && r_obj == p_obj) && r_act == p_act",
+		[]string{"r_sub == p_sub", "r_obj == p_obj", "r_act == p_act"})
+	testSplitConjunction(t, "(r_sub == p_sub || r_sub == \"root\") && r_act == p_act",
+		[]string{"r_sub == p_sub || r_sub == \"root\"", "r_act == p_act"})
+	testSplitConjunction(t, "(r_sub == p_sub) || (r_obj == p_obj)", []string{"(r_sub == p_sub) || (r_obj == p_obj)"})
+	testSplitConjunction(t, "r_sub == p_sub && r_obj == p_obj || r_sub == \"root\"",
+		[]string{"r_sub == p_sub && r_obj == p_obj || r_sub == \"root\""})
+	testSplitConjunction(t, "r_act == p_act && (r_sub == p_sub && r_obj == p_obj || r_sub == \"root\")",
+		[]string{"r_act == p_act", "r_sub == p_sub && r_obj == p_obj || r_sub == \"root\""})
+	testSplitConjunction(t, "r_sub == p_sub && eval('r_obj == \"a && b\"') && r_act in ('read', 'write')",
+		[]string{"r_sub == p_sub", "eval('r_obj == \"a && b\"')", "r_act in ('read', 'write')"})
+	testSplitConjunction(t, "r_sub == \"a \\\" && b\"", []string{"r_sub == \"a \\\" && b\""})
+}
+
 func testArrayEquals(t *testing.T, a []string, b []string, res bool) {
 	t.Helper()
 	myRes := ArrayEquals(a, b)
@@ -163,6 +191,22 @@ func TestGetEvalValue(t *testing.T) {
 	testGetEvalValue(t, "a && eval(a) && eval(b) && b && c", []string{"a", "b"})
 }
 
+func testGetFunctionCalls(t *testing.T, s string, res []string) {
+	t.Helper()
+	myRes := GetFunctionCalls(s)
+
+	if !ArrayEquals(myRes, res) {
+		t.Errorf("%s: %v supposed to be %v", s, myRes, res)
+	}
+}
+
+func TestGetFunctionCalls(t *testing.T) {
+	testGetFunctionCalls(t, "r_sub == p_sub", nil)
+	testGetFunctionCalls(t, "keyMatch(r_obj, p_obj) && regexMatch(r_act, p_act)", []string{"keyMatch", "regexMatch"})
+	testGetFunctionCalls(t, "g(r_sub, p_sub) && (keyMatch (r_obj, p_obj) || keyMatch(r_obj, '/pub'))", []string{"g", "keyMatch"})
+	testGetFunctionCalls(t, "r_sub in ('alice', 'bob') && customMatch(r_obj, 'f(x)')", []string{"customMatch"})
+}
+
 func testReplaceEvalWithMap(t *testing.T, s string, sets map[string]string, res string) {
 	t.Helper()
 	myRes := ReplaceEvalWithMap(s, sets)
@@ -223,3 +267,66 @@ func TestLRUCache(t *testing.T) {
 	testCacheGet(t, cache, "two", nil, false)
 	testCacheEqual(t, cache, []int{1, 3, 4})
 }
+
+func testCachePeekOldest(t *testing.T, c *LRUCache, key interface{}, ok bool) {
+	t.Helper()
+	k, o := c.PeekOldest()
+	if k != key || o != ok {
+		t.Errorf("PeekOldest(): (%v, %t) supposed to be (%v, %t)", k, o, key, ok)
+	}
+}
+
+func TestLRUCacheEvictionOrder(t *testing.T) {
+	cache := NewLRUCache(3)
+	testCachePeekOldest(t, cache, nil, false)
+
+	cache.Put("one", 1)
+	cache.Put("two", 2)
+	cache.Put("three", 3)
+	testCachePeekOldest(t, cache, "one", true)
+	testCachePeekOldest(t, cache, "one", true)
+
+	// Without reads, the entries are evicted in the order they were put.
+	var evicted []string
+	for i, key := range []string{"four", "five", "six", "seven"} {
+		oldest, _ := cache.PeekOldest()
+		cache.Put(key, 4+i)
+		if _, ok := cache.Get(oldest); ok {
+			t.Errorf("%s should have been evicted by putting %s", oldest, key)
+		}
+		evicted = append(evicted, oldest.(string))
+	}
+	if !ArrayEquals(evicted, []string{"one", "two", "three", "four"}) {
+		t.Errorf("eviction order: %v, supposed to be %v", evicted, []string{"one", "two", "three", "four"})
+	}
+
+	// A Get or a Put of an existing key moves the entry to the end of the eviction order.
+	testCachePeekOldest(t, cache, "five", true)
+	cache.Get("five")
+	testCachePeekOldest(t, cache, "six", true)
+	cache.Put("six", 60)
+	testCachePeekOldest(t, cache, "seven", true)
+	cache.Put("eight", 8)
+	testCacheGet(t, cache, "seven", nil, false)
+	testCachePeekOldest(t, cache, "five", true)
+	testCacheEqual(t, cache, []int{5, 60, 8})
+}
+
+func testEditDistance(t *testing.T, a string, b string, res int) {
+	t.Helper()
+	if myRes := EditDistance(a, b); myRes != res {
+		t.Errorf("EditDistance(%s, %s): %d, supposed to be %d", a, b, myRes, res)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	testEditDistance(t, "", "", 0)
+	testEditDistance(t, "", "abc", 3)
+	testEditDistance(t, "abc", "", 3)
+	testEditDistance(t, "keyMatch", "keyMatch", 0)
+	testEditDistance(t, "keyMatch6", "keyMatch5", 1)
+	testEditDistance(t, "kyeMatch", "keyMatch", 2)
+	testEditDistance(t, "regexMach", "regexMatch", 1)
+	testEditDistance(t, "kitten", "sitting", 3)
+	testEditDistance(t, "日本", "日本語", 1)
+}
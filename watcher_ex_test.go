@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/util"
 )
 
 type SampleWatcherEx struct {
@@ -68,3 +69,64 @@ func TestSetWatcherEx(t *testing.T) {
 	_, _ = e.AddPolicies([][]string{{"admin", "data1", "read"}, {"admin", "data2", "read"}})    // calls watcherEx.UpdateForAddPolicies()
 	_, _ = e.RemovePolicies([][]string{{"admin", "data1", "read"}, {"admin", "data2", "read"}}) // calls watcherEx.UpdateForRemovePolicies()
 }
+
+// recordingWatcher records the names of the watcher calls the enforcer makes.
+type recordingWatcher struct {
+	SampleWatcherEx
+	calls []string
+}
+
+func (w *recordingWatcher) Update() error {
+	w.calls = append(w.calls, "Update")
+	return nil
+}
+
+func (w *recordingWatcher) UpdateForAddPolicies(sec string, ptype string, rules ...[]string) error {
+	w.calls = append(w.calls, "UpdateForAddPolicies")
+	return nil
+}
+
+func (w *recordingWatcher) UpdateForRemovePolicies(sec string, ptype string, rules ...[]string) error {
+	w.calls = append(w.calls, "UpdateForRemovePolicies")
+	return nil
+}
+
+func (w *recordingWatcher) UpdateForUpdatePolicy(sec string, ptype string, oldRule, newRule []string) error {
+	w.calls = append(w.calls, "UpdateForUpdatePolicy")
+	return nil
+}
+
+func (w *recordingWatcher) UpdateForUpdatePolicies(sec string, ptype string, oldRules, newRules [][]string) error {
+	w.calls = append(w.calls, "UpdateForUpdatePolicies")
+	return nil
+}
+
+func TestWatcherDiffThreshold(t *testing.T) {
+	e, _ := NewEnforcer("examples/rbac_model.conf", "examples/rbac_policy.csv")
+	e.EnableAutoSave(false)
+	w := &recordingWatcher{}
+	_ = e.SetWatcher(w)
+	e.SetWatcherDiffThreshold(2)
+
+	_, _ = e.AddPolicies([][]string{{"u1", "data1", "read"}, {"u2", "data1", "read"}})
+	_, _ = e.AddPolicies([][]string{{"u3", "data1", "read"}, {"u4", "data1", "read"}, {"u5", "data1", "read"}})
+	_, _ = e.RemovePolicies([][]string{{"u1", "data1", "read"}})
+	_, _ = e.RemovePolicies([][]string{{"u2", "data1", "read"}, {"u3", "data1", "read"}, {"u4", "data1", "read"}})
+	// an update counts both its old and its new rules.
+	_, _ = e.UpdatePolicies([][]string{{"u5", "data1", "read"}}, [][]string{{"u5", "data2", "read"}})
+	_, _ = e.UpdatePolicies([][]string{{"alice", "data1", "read"}, {"bob", "data2", "write"}}, [][]string{{"alice", "data1", "write"}, {"bob", "data2", "read"}})
+	_, _ = e.UpdatePolicy([]string{"u5", "data2", "read"}, []string{"u5", "data3", "read"})
+
+	expected := []string{"UpdateForAddPolicies", "Update", "UpdateForRemovePolicies", "Update", "UpdateForUpdatePolicies", "Update", "UpdateForUpdatePolicy"}
+	if !util.ArrayEquals(w.calls, expected) {
+		t.Errorf("watcher calls: %v, supposed to be %v", w.calls, expected)
+	}
+
+	// without a threshold the rules are always sent.
+	w.calls = nil
+	e.SetWatcherDiffThreshold(0)
+	_, _ = e.AddPolicies([][]string{{"u3", "data1", "read"}, {"u4", "data1", "read"}, {"u6", "data1", "read"}})
+	if !util.ArrayEquals(w.calls, []string{"UpdateForAddPolicies"}) {
+		t.Errorf("watcher calls: %v, supposed to be [UpdateForAddPolicies]", w.calls)
+	}
+}
@@ -14,7 +14,14 @@
 
 package casbin
 
-import "testing"
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/casbin/casbin/v2/model"
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+)
 
 type SampleWatcher struct {
 	callback func(string)
@@ -89,3 +96,73 @@ func TestSelfModify(t *testing.T) {
 		t.Fatal("callback should not be called")
 	}
 }
+
+// flakyAdapter fails to load the policy the first failures times.
+type flakyAdapter struct {
+	*fileadapter.Adapter
+	failures int
+	loads    int
+}
+
+var errTransient = errors.New("transient error")
+
+func (a *flakyAdapter) LoadPolicy(model model.Model) error {
+	a.loads++
+	if a.loads <= a.failures {
+		// a half-loaded policy must not be used.
+		model.AddPolicy("p", "p", []string{"eve", "data3", "read"})
+		return errTransient
+	}
+	return a.Adapter.LoadPolicy(model)
+}
+
+func TestWatcherCallbackRetry(t *testing.T) {
+	a := &flakyAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	sampleWatcher := &SampleWatcher{}
+	_ = e.SetWatcher(sampleWatcher)
+	var failures []error
+	e.OnSyncFailure(func(err error) {
+		failures = append(failures, err)
+	})
+
+	// two failures with a single attempt leave the enforcer stale with its previous policy.
+	a.loads, a.failures = 0, 2
+	_ = sampleWatcher.Update()
+	status := e.GetSyncStatus()
+	if !e.IsPolicyStale() || status.Failures != 1 || status.LastError != errTransient {
+		t.Errorf("sync status: %+v, supposed to be stale after 1 failure", status)
+	}
+	if len(failures) != 1 {
+		t.Errorf("sync failures: %v, supposed to be reported once", failures)
+	}
+	testEnforce(t, e, "alice", "data1", "read", true)
+	testEnforce(t, e, "eve", "data3", "read", false)
+
+	_ = sampleWatcher.Update()
+	if status := e.GetSyncStatus(); !status.Stale || status.Failures != 2 {
+		t.Errorf("sync status: %+v, supposed to be stale after 2 failures", status)
+	}
+
+	// the next notification succeeds.
+	_ = sampleWatcher.Update()
+	if status := e.GetSyncStatus(); status.Stale || status.Failures != 0 || status.LastSync.IsZero() {
+		t.Errorf("sync status: %+v, supposed to be synced", status)
+	}
+	testEnforce(t, e, "eve", "data3", "read", false)
+
+	// with retries, a single notification gets over two failures.
+	a.loads, a.failures = 0, 2
+	failures = nil
+	e.SetWatcherCallbackRetry(3, time.Millisecond)
+	_ = sampleWatcher.Update()
+	if a.loads != 3 || e.IsPolicyStale() || len(failures) != 0 {
+		t.Errorf("%d loads, sync status: %+v, failures: %v, supposed to be synced after 3 loads", a.loads, e.GetSyncStatus(), failures)
+	}
+
+	a.loads, a.failures = 0, 5
+	_ = sampleWatcher.Update()
+	if a.loads != 3 || !e.IsPolicyStale() || len(failures) != 1 {
+		t.Errorf("%d loads, sync status: %+v, failures: %v, supposed to be stale after 3 loads", a.loads, e.GetSyncStatus(), failures)
+	}
+}
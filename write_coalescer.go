@@ -0,0 +1,174 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/casbin/casbin/v2/persist"
+)
+
+// writeOp is a single rule write waiting to be flushed to the adapter.
+type writeOp struct {
+	add       bool
+	sec       string
+	ptype     string
+	rule      []string
+	cancelled bool
+}
+
+// writeCoalescer delays the single rule writes of the auto-save feature for a window, so that
+// adding and then removing the same rule (or the other way around) never reaches the adapter.
+type writeCoalescer struct {
+	mu      sync.Mutex
+	window  time.Duration
+	adapter persist.Adapter
+	ops     []*writeOp
+	pending map[string]*writeOp
+	timer   *time.Timer
+	// locker is held by the timer while it flushes, so that the adapter is not written concurrently
+	// with the mutations of a SyncedEnforcer.
+	locker  sync.Locker
+	onError func(error)
+}
+
+func newWriteCoalescer(window time.Duration, onError func(error)) *writeCoalescer {
+	return &writeCoalescer{
+		window:  window,
+		pending: make(map[string]*writeOp),
+		onError: onError,
+	}
+}
+
+// write queues the write, or cancels the queued opposite write of the same rule. It must only be given the
+// changes the model made, so that a cancelled pair never leaves the model and the adapter apart.
+// The write is queued even if flushing the writes queued for another adapter fails, whose error is returned.
+func (c *writeCoalescer) write(adapter persist.Adapter, add bool, sec string, ptype string, rule []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a write to another adapter cannot be merged with the queued ones
+	var err error
+	if c.adapter != nil && c.adapter != adapter {
+		err = c.flushLocked()
+	}
+	c.adapter = adapter
+
+	key := ruleKey(append([]string{sec, ptype}, rule...))
+	if op, ok := c.pending[key]; ok && op.add != add {
+		op.cancelled = true
+		delete(c.pending, key)
+		return err
+	}
+
+	op := &writeOp{add: add, sec: sec, ptype: ptype, rule: rule}
+	c.ops = append(c.ops, op)
+	c.pending[key] = op
+	if c.timer == nil {
+		c.timer = time.AfterFunc(c.window, c.flushOnTimer)
+	}
+	return err
+}
+
+// flushOnTimer flushes the queued writes when the window elapses and reports the error to onError.
+func (c *writeCoalescer) flushOnTimer() {
+	if c.locker != nil {
+		c.locker.Lock()
+		defer c.locker.Unlock()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.flushLocked(); err != nil {
+		c.onError(err)
+	}
+}
+
+// flush writes the queued writes to the adapter and returns the first error met.
+func (c *writeCoalescer) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flushLocked()
+}
+
+func (c *writeCoalescer) flushLocked() error {
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+
+	var firstErr error
+	for _, op := range c.ops {
+		if op.cancelled {
+			continue
+		}
+
+		var err error
+		if op.add {
+			err = c.adapter.AddPolicy(op.sec, op.ptype, op.rule)
+		} else {
+			err = c.adapter.RemovePolicy(op.sec, op.ptype, op.rule)
+		}
+		if err != nil && err.Error() != notImplemented && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.ops = nil
+	c.pending = make(map[string]*writeOp)
+	return firstErr
+}
+
+// coalescing reports whether the single rule writes are queued. They are not while a watcher or a dispatcher
+// is set: the peers they notify would reload a storage that does not hold the change yet.
+func (e *Enforcer) coalescing() bool {
+	return e.writeCoalescer != nil && e.watcher == nil && e.dispatcher == nil
+}
+
+// SetWriteCoalesceWindow delays the adapter writes of AddPolicy and RemovePolicy (and their named and
+// grouping variants) for the window when auto-save is on. Writes of the same rule that cancel each other
+// out within the window, like an add followed by a remove, are not sent to the adapter at all.
+// Other mutations and LoadPolicy/SavePolicy flush the queued writes first, so the adapter sees them in order,
+// and return the error of the flush. The errors of the flushes done when the window elapses are passed to
+// onError, which is required.
+// Coalescing cannot be combined with a watcher or a dispatcher: it is refused if one is set, and writes are
+// sent right away if one is set later.
+// A window of 0 (the default) flushes the queued writes and turns coalescing off.
+func (e *Enforcer) SetWriteCoalesceWindow(d time.Duration, onError func(error)) error {
+	if d > 0 {
+		if onError == nil {
+			return errors.New("an error callback is required to coalesce writes")
+		}
+		if e.watcher != nil || e.dispatcher != nil {
+			return errors.New("writes cannot be coalesced with a watcher or a dispatcher set")
+		}
+	}
+
+	err := e.FlushWrites()
+	if d <= 0 {
+		e.writeCoalescer = nil
+	} else {
+		e.writeCoalescer = newWriteCoalescer(d, onError)
+	}
+	return err
+}
+
+// FlushWrites sends the writes queued by SetWriteCoalesceWindow to the adapter now.
+func (e *Enforcer) FlushWrites() error {
+	if e.writeCoalescer == nil {
+		return nil
+	}
+	return e.writeCoalescer.flush()
+}
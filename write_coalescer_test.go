@@ -0,0 +1,176 @@
+// Copyright 2022 The casbin Authors. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package casbin
+
+import (
+	"testing"
+	"time"
+
+	fileadapter "github.com/casbin/casbin/v2/persist/file-adapter"
+	"github.com/casbin/casbin/v2/util"
+)
+
+func testAdapterCalls(t *testing.T, e *Enforcer, a *recordingAdapter, res []string) {
+	t.Helper()
+	if err := e.FlushWrites(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !util.ArrayEquals(res, a.calls) {
+		t.Error("Adapter calls: ", a.calls, ", supposed to be ", res)
+	}
+	a.calls = nil
+}
+
+func TestWriteCoalesceWindow(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	_ = e.SetWriteCoalesceWindow(time.Hour, func(err error) { t.Error(err) })
+
+	// An add followed by a remove of the same rule cancels out.
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	_, _ = e.AddGroupingPolicy("eve", "data2_admin")
+	_, _ = e.RemoveGroupingPolicy("eve", "data2_admin")
+	testAdapterCalls(t, e, a, nil)
+	testEnforce(t, e, "eve", "data3", "read", false)
+
+	// So does a remove followed by an add.
+	_, _ = e.RemovePolicy("alice", "data1", "read")
+	testEnforce(t, e, "alice", "data1", "read", false)
+	_, _ = e.AddPolicy("alice", "data1", "read")
+	testAdapterCalls(t, e, a, nil)
+	testEnforce(t, e, "alice", "data1", "read", true)
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.AddPolicy("eve", "data3", "write")
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	testAdapterCalls(t, e, a, []string{"AddPolicy p"})
+
+	// Batch operations flush the queued writes first to keep the order.
+	_, _ = e.RemovePolicy("eve", "data3", "write")
+	_, _ = e.AddPolicies([][]string{{"eve", "data4", "read"}})
+	testAdapterCalls(t, e, a, []string{"RemovePolicy p", "AddPolicies p 1"})
+
+	// Turning the window off flushes the queued writes.
+	_, _ = e.AddPolicy("eve", "data5", "read")
+	_ = e.SetWriteCoalesceWindow(0, nil)
+	if !util.ArrayEquals(a.calls, []string{"AddPolicy p"}) {
+		t.Error("Adapter calls: ", a.calls)
+	}
+	a.calls = nil
+	_, _ = e.AddPolicy("eve", "data6", "read")
+	_, _ = e.RemovePolicy("eve", "data6", "read")
+	testAdapterCalls(t, e, a, []string{"AddPolicy p", "RemovePolicy p"})
+}
+
+func TestWriteCoalesceWindowAbsentRule(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	_ = e.SetWriteCoalesceWindow(time.Hour, func(err error) { t.Error(err) })
+
+	// Removing an absent rule queues nothing, so the add that follows still reaches the adapter.
+	if ok, err := e.RemovePolicy("eve", "data3", "read"); ok || err != nil {
+		t.Errorf("RemovePolicy: %t, %v, supposed to be false", ok, err)
+	}
+	if ok, err := e.AddPolicy("eve", "data3", "read"); !ok || err != nil {
+		t.Errorf("AddPolicy: %t, %v, supposed to be true", ok, err)
+	}
+	testAdapterCalls(t, e, a, []string{"AddPolicy p"})
+
+}
+
+func TestWriteCoalescerKeys(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	c := newWriteCoalescer(time.Hour, func(err error) { t.Error(err) })
+
+	// Rules whose fields only join into the same string do not cancel each other out.
+	_ = c.write(a, true, "p", "p", []string{"a,b", "c", "read"})
+	_ = c.write(a, false, "p", "p", []string{"a", "b,c", "read"})
+	if err := c.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !util.ArrayEquals(a.calls, []string{"AddPolicy p", "RemovePolicy p"}) {
+		t.Error("Adapter calls: ", a.calls, ", supposed to be [AddPolicy p RemovePolicy p]")
+	}
+}
+
+func TestWriteCoalesceWindowTimer(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	_ = e.SetWriteCoalesceWindow(10*time.Millisecond, func(err error) { t.Error(err) })
+
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	_, _ = e.AddPolicy("eve", "data3", "write")
+	time.Sleep(50 * time.Millisecond)
+
+	// The timer already flushed the write, FlushWrites has nothing left to send.
+	testAdapterCalls(t, e, a, []string{"AddPolicy p"})
+	testAdapterCalls(t, e, a, nil)
+}
+
+func TestWriteCoalesceWindowErrors(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv"), failSec: "g"}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	if err := e.SetWriteCoalesceWindow(time.Hour, nil); err == nil {
+		t.Error("SetWriteCoalesceWindow should require an error callback")
+	}
+
+	errs := make(chan error, 1)
+	_ = e.SetWriteCoalesceWindow(10*time.Millisecond, func(err error) { errs <- err })
+	_, _ = e.AddGroupingPolicy("eve", "data2_admin")
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("The error callback should be passed the error of the delayed write")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The error of the delayed write was not reported")
+	}
+
+	// A mutation that flushes the queued writes returns the error of the flush.
+	_ = e.SetWriteCoalesceWindow(time.Hour, func(err error) { t.Error(err) })
+	_, _ = e.AddGroupingPolicy("eve", "data1_admin")
+	if _, err := e.AddPolicies([][]string{{"eve", "data4", "read"}}); err == nil {
+		t.Error("AddPolicies should return the error of the queued write")
+	}
+	testAdapterCalls(t, e, a, []string{"AddPolicy g", "AddPolicy g"})
+	testHasPolicy(t, e, []string{"eve", "data4", "read"}, false)
+}
+
+func TestWriteCoalesceWindowWatcher(t *testing.T) {
+	a := &recordingAdapter{Adapter: fileadapter.NewAdapter("examples/rbac_policy.csv")}
+	e, _ := NewEnforcer("examples/rbac_model.conf", a)
+	w := &countingWatcher{}
+	_ = e.SetWatcher(w)
+	if err := e.SetWriteCoalesceWindow(time.Hour, func(err error) { t.Error(err) }); err == nil {
+		t.Error("SetWriteCoalesceWindow should be refused with a watcher set")
+	}
+
+	// A watcher set after the window flushes the queued writes and sends the new ones right away,
+	// so the peers it notifies reload a storage holding the change.
+	e, _ = NewEnforcer("examples/rbac_model.conf", a)
+	_ = e.SetWriteCoalesceWindow(time.Hour, func(err error) { t.Error(err) })
+	_, _ = e.AddPolicy("eve", "data3", "read")
+	_ = e.SetWatcher(w)
+	_, _ = e.RemovePolicy("eve", "data3", "read")
+	if !util.ArrayEquals(a.calls, []string{"AddPolicy p", "RemovePolicy p"}) {
+		t.Error("Adapter calls: ", a.calls)
+	}
+	if w.updates != 1 {
+		t.Errorf("Watcher updates: %d, supposed to be 1", w.updates)
+	}
+}